@@ -0,0 +1,53 @@
+package quic
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+)
+
+// SPKIHash calculates the SHA-256 hash of the SubjectPublicKeyInfo of a certificate.
+// This is the value used for public key pinning.
+func SPKIHash(cert *x509.Certificate) [32]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// VerifyPinnedSPKI returns a function that can be used as tls.Config.VerifyPeerCertificate.
+// It accepts a certificate chain if one of its certificates has one of the pinned SPKI hashes.
+// If the chain was verified, the verified chains are checked. Otherwise (if InsecureSkipVerify is set)
+// the certificates presented by the server are checked.
+// It works for both gQUIC and IETF QUIC.
+func VerifyPinnedSPKI(pins ...[32]byte) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	isPinned := func(cert *x509.Certificate) bool {
+		hash := SPKIHash(cert)
+		for _, pin := range pins {
+			if pin == hash {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) > 0 {
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					if isPinned(cert) {
+						return nil
+					}
+				}
+			}
+			return errors.New("no pinned public key in the verified certificate chains")
+		}
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if isPinned(cert) {
+				return nil
+			}
+		}
+		return errors.New("no pinned public key in the certificate chain")
+	}
+}
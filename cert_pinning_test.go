@@ -0,0 +1,49 @@
+package quic
+
+import (
+	"crypto/x509"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SPKI pinning", func() {
+	var (
+		rawCerts [][]byte
+		certs    []*x509.Certificate
+	)
+
+	BeforeEach(func() {
+		rawCerts = testdata.GetCertificate().Certificate
+		certs = make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			var err error
+			certs[i], err = x509.ParseCertificate(raw)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("accepts a chain containing a pinned certificate", func() {
+		verify := VerifyPinnedSPKI([32]byte{0xde, 0xad}, SPKIHash(certs[len(certs)-1]))
+		Expect(verify(rawCerts, nil)).To(Succeed())
+	})
+
+	It("rejects a chain without a pinned certificate", func() {
+		verify := VerifyPinnedSPKI([32]byte{0xde, 0xad})
+		Expect(verify(rawCerts, nil)).To(MatchError("no pinned public key in the certificate chain"))
+	})
+
+	It("rejects invalid certificates", func() {
+		verify := VerifyPinnedSPKI(SPKIHash(certs[0]))
+		Expect(verify([][]byte{[]byte("foobar")}, nil)).ToNot(Succeed())
+	})
+
+	It("checks the verified chains, if available", func() {
+		verify := VerifyPinnedSPKI(SPKIHash(certs[0]))
+		Expect(verify(nil, [][]*x509.Certificate{certs})).To(Succeed())
+		// the raw certificates are ignored if there are verified chains
+		Expect(verify(rawCerts, [][]*x509.Certificate{{&x509.Certificate{}}})).To(MatchError("no pinned public key in the verified certificate chains"))
+	})
+})
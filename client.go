@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -49,6 +50,14 @@ var (
 // DialAddr establishes a new QUIC connection to a server.
 // The hostname for SNI is taken from the given address.
 func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return DialAddrContext(context.Background(), addr, tlsConf, config)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server using the provided context.
+// If the context expires before the connection is established, the handshake is aborted
+// and the UDP socket that was created for the connection is closed.
+// See DialAddr for details.
+func DialAddrContext(ctx context.Context, addr string, tlsConf *tls.Config, config *Config) (Session, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
@@ -57,7 +66,12 @@ func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error)
 	if err != nil {
 		return nil, err
 	}
-	return Dial(udpConn, udpAddr, addr, tlsConf, config)
+	sess, err := DialContext(ctx, udpConn, udpAddr, addr, tlsConf, config)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	return sess, nil
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
@@ -68,6 +82,20 @@ func Dial(
 	host string,
 	tlsConf *tls.Config,
 	config *Config,
+) (Session, error) {
+	return DialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using a net.PacketConn and the provided context.
+// If the context expires before the connection is established, the handshake (including version negotiation) is aborted.
+// See Dial for details.
+func DialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
 ) (Session, error) {
 	connID, err := generateConnectionID()
 	if err != nil {
@@ -106,7 +134,7 @@ func Dial(
 
 	utils.Infof("Starting new connection to %s (%s -> %s), connectionID %x, version %s", hostname, c.conn.LocalAddr().String(), c.conn.RemoteAddr().String(), c.connectionID, c.version)
 
-	if err := c.dial(); err != nil {
+	if err := c.dial(ctx); err != nil {
 		return nil, err
 	}
 	return c.session, nil
@@ -152,6 +180,15 @@ func populateClientConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	ackSendDelay := protocol.DefaultMaxAckDelay
+	if config.AckSendDelay != 0 {
+		ackSendDelay = config.AckSendDelay
+	}
+	retransmittablePacketsBeforeAck := protocol.DefaultRetransmittablePacketsBeforeAck
+	if config.RetransmittablePacketsBeforeAck > 0 {
+		retransmittablePacketsBeforeAck = config.RetransmittablePacketsBeforeAck
+	}
+	fecGroupSize := utils.Max(0, utils.Min(config.FECGroupSize, protocol.MaxFECGroupSize))
 
 	return &Config{
 		Versions:                              versions,
@@ -162,32 +199,40 @@ func populateClientConfig(config *Config) *Config {
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		AckSendDelay:                          ackSendDelay,
+		RetransmittablePacketsBeforeAck:       retransmittablePacketsBeforeAck,
+		DisableAckDecimation:                  config.DisableAckDecimation,
+		PeerAckSendDelay:                      config.PeerAckSendDelay,
+		PeerRetransmittablePacketsBeforeAck:   config.PeerRetransmittablePacketsBeforeAck,
+		EnableMultipath:                       config.EnableMultipath,
+		FECGroupSize:                          fecGroupSize,
+		ServerStateCache:                      config.ServerStateCache,
 		KeepAlive:                             config.KeepAlive,
 	}
 }
 
-func (c *client) dial() error {
+func (c *client) dial(ctx context.Context) error {
 	var err error
 	if c.version.UsesTLS() {
-		err = c.dialTLS()
+		err = c.dialTLS(ctx)
 	} else {
-		err = c.dialGQUIC()
+		err = c.dialGQUIC(ctx)
 	}
 	if err == errCloseSessionForNewVersion {
-		return c.dial()
+		return c.dial(ctx)
 	}
 	return err
 }
 
-func (c *client) dialGQUIC() error {
+func (c *client) dialGQUIC(ctx context.Context) error {
 	if err := c.createNewGQUICSession(); err != nil {
 		return err
 	}
 	go c.listen()
-	return c.establishSecureConnection()
+	return c.establishSecureConnection(ctx)
 }
 
-func (c *client) dialTLS() error {
+func (c *client) dialTLS(ctx context.Context) error {
 	params := &handshake.TransportParameters{
 		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
 		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
@@ -195,6 +240,9 @@ func (c *client) dialTLS() error {
 		OmitConnectionID:            c.config.RequestConnectionIDOmission,
 		MaxBidiStreams:              uint16(c.config.MaxIncomingStreams),
 		MaxUniStreams:               uint16(c.config.MaxIncomingUniStreams),
+		MaxAckDelay:                 c.config.AckSendDelay,
+		MinAckDelay:                 protocol.MinAckDelay,
+		EnableFEC:                   c.config.FECGroupSize > 0,
 	}
 	csc := handshake.NewCryptoStreamConn(nil)
 	extHandler := handshake.NewExtensionHandlerClient(params, c.initialVersion, c.config.Versions, c.version)
@@ -204,13 +252,17 @@ func (c *client) dialTLS() error {
 	}
 	mintConf.ExtensionHandler = extHandler
 	mintConf.ServerName = c.hostname
-	c.tls = newMintController(csc, mintConf, protocol.PerspectiveClient)
+	mc := newMintController(csc, mintConf, protocol.PerspectiveClient)
+	if c.tlsConf != nil {
+		mc.keyLogWriter = c.tlsConf.KeyLogWriter
+	}
+	c.tls = mc
 
 	if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 		return err
 	}
 	go c.listen()
-	if err := c.establishSecureConnection(); err != nil {
+	if err := c.establishSecureConnection(ctx); err != nil {
 		if err != handshake.ErrCloseSessionForRetry {
 			return err
 		}
@@ -218,7 +270,7 @@ func (c *client) dialTLS() error {
 		if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 			return err
 		}
-		if err := c.establishSecureConnection(); err != nil {
+		if err := c.establishSecureConnection(ctx); err != nil {
 			return err
 		}
 	}
@@ -230,8 +282,9 @@ func (c *client) dialTLS() error {
 // - errCloseSessionForNewVersion when the server sends a version negotiation packet
 // - handshake.ErrCloseSessionForRetry when the server performs a stateless retry (for IETF QUIC)
 // - any other error that might occur
+// - the context error when the context expires before the connection is established
 // - when the connection is secure (for gQUIC), or forward-secure (for IETF QUIC)
-func (c *client) establishSecureConnection() error {
+func (c *client) establishSecureConnection(ctx context.Context) error {
 	var runErr error
 	errorChan := make(chan struct{})
 	go func() {
@@ -247,17 +300,34 @@ func (c *client) establishSecureConnection() error {
 	select {
 	case <-errorChan:
 		return runErr
+	case <-ctx.Done():
+		return c.abortHandshake(ctx.Err(), errorChan)
 	case <-c.versionNegotiationChan:
 	}
 
 	select {
 	case <-errorChan:
 		return runErr
+	case <-ctx.Done():
+		return c.abortHandshake(ctx.Err(), errorChan)
 	case err := <-c.session.handshakeStatus():
 		return err
 	}
 }
 
+// abortHandshake closes the session, waits until it has shut down, and closes the connection.
+// The connection is closed explicitly, since the session might have been closed
+// for a version negotiation at the same time.
+func (c *client) abortHandshake(err error, errorChan <-chan struct{}) error {
+	c.mutex.Lock()
+	sess := c.session
+	c.mutex.Unlock()
+	sess.Close(err)
+	<-errorChan
+	c.conn.Close()
+	return err
+}
+
 // Listen listens on the underlying connection and passes packets on for handling.
 // It returns when the connection is closed.
 func (c *client) listen() {
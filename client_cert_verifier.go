@@ -0,0 +1,90 @@
+package quic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+)
+
+// The clientCertVerifier implements the tls.ClientAuthType policies for the server.
+// mint only requests a certificate from the client, but doesn't verify it.
+type clientCertVerifier struct {
+	config *tls.Config
+
+	mutex          sync.Mutex
+	verifiedChains [][]*x509.Certificate
+}
+
+// newClientCertVerifier creates a new clientCertVerifier.
+// It returns nil if the tls.Config doesn't request client certificates.
+func newClientCertVerifier(tlsConf *tls.Config) *clientCertVerifier {
+	if tlsConf == nil || tlsConf.ClientAuth == tls.NoClientCert {
+		return nil
+	}
+	return &clientCertVerifier{config: tlsConf}
+}
+
+// requiresClientCert says if the client has to send a certificate
+func requiresClientCert(clientAuth tls.ClientAuthType) bool {
+	return clientAuth == tls.RequireAnyClientCert || clientAuth == tls.RequireAndVerifyClientCert
+}
+
+// VerifyPeerCertificate is called by mint when the client sent a certificate.
+// It verifies the certificate chain against the ClientCAs, if required,
+// and then calls the VerifyPeerCertificate callback of the tls.Config.
+func (v *clientCertVerifier) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	var chains [][]*x509.Certificate
+	if len(rawCerts) > 0 && (v.config.ClientAuth == tls.VerifyClientCertIfGiven || v.config.ClientAuth == tls.RequireAndVerifyClientCert) {
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		opts := x509.VerifyOptions{
+			Roots:         v.config.ClientCAs,
+			CurrentTime:   time.Now(),
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if v.config.Time != nil {
+			opts.CurrentTime = v.config.Time()
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		var err error
+		chains, err = certs[0].Verify(opts)
+		if err != nil {
+			return err
+		}
+	}
+	if v.config.VerifyPeerCertificate != nil {
+		if err := v.config.VerifyPeerCertificate(rawCerts, chains); err != nil {
+			return err
+		}
+	}
+	v.mutex.Lock()
+	v.verifiedChains = chains
+	v.mutex.Unlock()
+	return nil
+}
+
+// checkCertificatePresent is called after the handshake completed.
+// mint accepts the handshake if the client didn't send a certificate, even if one was requested.
+func (v *clientCertVerifier) checkCertificatePresent(peerCerts []*x509.Certificate) error {
+	if len(peerCerts) == 0 && requiresClientCert(v.config.ClientAuth) {
+		return errors.New("client didn't provide a certificate")
+	}
+	return nil
+}
+
+func (v *clientCertVerifier) getVerifiedChains() [][]*x509.Certificate {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.verifiedChains
+}
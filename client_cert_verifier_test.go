@@ -0,0 +1,216 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// nonBlockingBuffer returns 0 bytes instead of io.EOF when it is empty, which makes mint return AlertWouldBlock
+type nonBlockingBuffer struct {
+	bytes.Buffer
+}
+
+func (b *nonBlockingBuffer) Read(p []byte) (int, error) {
+	if b.Len() == 0 {
+		return 0, nil
+	}
+	return b.Buffer.Read(p)
+}
+
+var _ = Describe("Client certificate verification", func() {
+	generateCert := func(template, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		Expect(err).ToNot(HaveOccurred())
+		if parent == nil {
+			parent = template
+			parentKey = key
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := x509.ParseCertificate(certDER)
+		Expect(err).ToNot(HaveOccurred())
+		return cert, key
+	}
+
+	var (
+		caCert     *x509.Certificate
+		clientCert *x509.Certificate
+		clientCAs  *x509.CertPool
+	)
+
+	BeforeEach(func() {
+		var caKey *rsa.PrivateKey
+		caCert, caKey = generateCert(&x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}, nil, nil)
+		clientCert, _ = generateCert(&x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, caCert, caKey)
+		clientCAs = x509.NewCertPool()
+		clientCAs.AddCert(caCert)
+	})
+
+	It("isn't used if no client certificate is requested", func() {
+		Expect(newClientCertVerifier(nil)).To(BeNil())
+		Expect(newClientCertVerifier(&tls.Config{})).To(BeNil())
+		Expect(newClientCertVerifier(&tls.Config{ClientAuth: tls.RequestClientCert})).ToNot(BeNil())
+	})
+
+	It("verifies the certificate against the ClientCAs", func() {
+		v := newClientCertVerifier(&tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		})
+		Expect(v.VerifyPeerCertificate([][]byte{clientCert.Raw}, nil)).To(Succeed())
+		Expect(v.getVerifiedChains()).To(Equal([][]*x509.Certificate{{clientCert, caCert}}))
+	})
+
+	It("rejects certificates that are not signed by one of the ClientCAs", func() {
+		v := newClientCertVerifier(&tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  x509.NewCertPool(),
+		})
+		err := v.VerifyPeerCertificate([][]byte{clientCert.Raw}, nil)
+		Expect(err).To(BeAssignableToTypeOf(x509.UnknownAuthorityError{}))
+		Expect(v.getVerifiedChains()).To(BeNil())
+	})
+
+	It("uses the time of the tls.Config", func() {
+		v := newClientCertVerifier(&tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+			Time:       func() time.Time { return time.Now().Add(2 * time.Hour) },
+		})
+		err := v.VerifyPeerCertificate([][]byte{clientCert.Raw}, nil)
+		Expect(err).To(BeAssignableToTypeOf(x509.CertificateInvalidError{}))
+	})
+
+	It("doesn't verify the certificate, if not requested", func() {
+		v := newClientCertVerifier(&tls.Config{ClientAuth: tls.RequireAnyClientCert})
+		Expect(v.VerifyPeerCertificate([][]byte{clientCert.Raw}, nil)).To(Succeed())
+		Expect(v.getVerifiedChains()).To(BeNil())
+	})
+
+	It("calls the VerifyPeerCertificate callback with the verified chains", func() {
+		testErr := errors.New("rejected")
+		var chains [][]*x509.Certificate
+		v := newClientCertVerifier(&tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+			VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+				Expect(rawCerts).To(Equal([][]byte{clientCert.Raw}))
+				chains = verifiedChains
+				return testErr
+			},
+		})
+		Expect(v.VerifyPeerCertificate([][]byte{clientCert.Raw}, nil)).To(MatchError(testErr))
+		Expect(chains).To(Equal([][]*x509.Certificate{{clientCert, caCert}}))
+		Expect(v.getVerifiedChains()).To(BeNil())
+	})
+
+	It("requires a certificate, depending on the ClientAuthType", func() {
+		for _, clientAuth := range []tls.ClientAuthType{tls.RequestClientCert, tls.VerifyClientCertIfGiven} {
+			v := newClientCertVerifier(&tls.Config{ClientAuth: clientAuth})
+			Expect(v.checkCertificatePresent(nil)).To(Succeed())
+		}
+		for _, clientAuth := range []tls.ClientAuthType{tls.RequireAnyClientCert, tls.RequireAndVerifyClientCert} {
+			v := newClientCertVerifier(&tls.Config{ClientAuth: clientAuth})
+			Expect(v.checkCertificatePresent(nil)).To(MatchError("client didn't provide a certificate"))
+			Expect(v.checkCertificatePresent([]*x509.Certificate{clientCert})).To(Succeed())
+		}
+	})
+
+	Context("handshakes", func() {
+		// runHandshake runs a TLS handshake between a client and a server, using the buffer mode of the CryptoStreamConn
+		runHandshake := func(clientConf, serverConf *tls.Config) (*mintController, mint.Alert) {
+			clientMintConf, err := tlsToMintConfig(clientConf, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			clientMintConf.ServerName = "quic.clemente.io"
+			serverMintConf, err := tlsToMintConfig(serverConf, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			verifier := newClientCertVerifier(serverConf)
+			serverMintConf.VerifyPeerCertificate = verifier.VerifyPeerCertificate
+			clientToServer := &nonBlockingBuffer{}
+			serverToClient := &nonBlockingBuffer{}
+			clientCSC := handshake.NewCryptoStreamConn(nil)
+			clientCSC.SetStream(struct {
+				io.Reader
+				io.Writer
+			}{serverToClient, clientToServer})
+			serverCSC := handshake.NewCryptoStreamConn(nil)
+			serverCSC.SetStream(struct {
+				io.Reader
+				io.Writer
+			}{clientToServer, serverToClient})
+			client := newMintController(clientCSC, clientMintConf, protocol.PerspectiveClient)
+			server := newMintController(serverCSC, serverMintConf, protocol.PerspectiveServer)
+			server.clientCertVerifier = verifier
+
+			for i := 0; i < 10; i++ {
+				if alert := client.Handshake(); alert != mint.AlertNoAlert && alert != mint.AlertWouldBlock {
+					Fail("client handshake failed: " + alert.String())
+				}
+				alert := server.Handshake()
+				if alert != mint.AlertNoAlert && alert != mint.AlertWouldBlock {
+					return server, alert
+				}
+				if server.State() == mint.StateServerConnected {
+					return server, mint.AlertNoAlert
+				}
+			}
+			Fail("handshake didn't complete")
+			return nil, mint.AlertNoAlert
+		}
+
+		It("sends a client certificate and exposes it on the server", func() {
+			clientConf := testdata.GetTLSConfig()
+			clientConf.InsecureSkipVerify = true
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.RequireAnyClientCert
+			server, alert := runHandshake(clientConf, serverConf)
+			Expect(alert).To(Equal(mint.AlertNoAlert))
+			state := server.ConnectionState()
+			Expect(state.PeerCertificates).ToNot(BeEmpty())
+			Expect(state.PeerCertificates[0].Raw).To(Equal(clientConf.Certificates[0].Certificate[0]))
+		})
+
+		It("rejects clients that don't send a certificate", func() {
+			clientConf := &tls.Config{InsecureSkipVerify: true}
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.RequireAnyClientCert
+			_, alert := runHandshake(clientConf, serverConf)
+			Expect(alert).To(Equal(mint.AlertBadCertificate))
+		})
+
+		It("accepts clients that don't send a certificate, if it's optional", func() {
+			clientConf := &tls.Config{InsecureSkipVerify: true}
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.VerifyClientCertIfGiven
+			server, alert := runHandshake(clientConf, serverConf)
+			Expect(alert).To(Equal(mint.AlertNoAlert))
+			Expect(server.ConnectionState().PeerCertificates).To(BeEmpty())
+		})
+	})
+})
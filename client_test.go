@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"net"
@@ -110,6 +111,47 @@ var _ = Describe("Client", func() {
 			Eventually(dialed).Should(BeClosed())
 		})
 
+		It("aborts the handshake when the context is canceled", func() {
+			packetConn.dataToRead <- acceptClientVersionPacket(cl.connectionID)
+			ctx, cancel := context.WithCancel(context.Background())
+			dialed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).To(MatchError(context.Canceled))
+				close(dialed)
+			}()
+			Consistently(dialed).ShouldNot(BeClosed())
+			cancel()
+			Eventually(dialed).Should(BeClosed())
+			Expect(sess.closed).To(BeTrue())
+			Expect(sess.closeReason).To(MatchError(context.Canceled))
+			Expect(packetConn.closed).To(BeTrue())
+		})
+
+		It("aborts the version negotiation when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			dialed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).To(MatchError(context.Canceled))
+				close(dialed)
+			}()
+			Consistently(dialed).ShouldNot(BeClosed())
+			cancel()
+			Eventually(dialed).Should(BeClosed())
+			Expect(sess.closed).To(BeTrue())
+			Expect(packetConn.closed).To(BeTrue())
+		})
+
+		It("returns immediately if the context is already done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			_, err := DialAddrContext(ctx, "localhost:17890", nil, nil)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
 		It("resolves the address", func() {
 			if os.Getenv("APPVEYOR") == "True" {
 				Skip("This test is flaky on AppVeyor.")
@@ -198,11 +240,19 @@ var _ = Describe("Client", func() {
 
 		It("setups with the right values", func() {
 			config := &Config{
-				HandshakeTimeout:            1337 * time.Minute,
-				IdleTimeout:                 42 * time.Hour,
-				RequestConnectionIDOmission: true,
-				MaxIncomingStreams:          1234,
-				MaxIncomingUniStreams:       4321,
+				HandshakeTimeout:                    1337 * time.Minute,
+				IdleTimeout:                         42 * time.Hour,
+				RequestConnectionIDOmission:         true,
+				MaxIncomingStreams:                  1234,
+				MaxIncomingUniStreams:               4321,
+				AckSendDelay:                        42 * time.Millisecond,
+				RetransmittablePacketsBeforeAck:     5,
+				DisableAckDecimation:                true,
+				PeerAckSendDelay:                    100 * time.Millisecond,
+				PeerRetransmittablePacketsBeforeAck: 20,
+				EnableMultipath:                     true,
+				FECGroupSize:                        10,
+				ServerStateCache:                    NewLRUServerStateCache(1),
 			}
 			c := populateClientConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -210,6 +260,21 @@ var _ = Describe("Client", func() {
 			Expect(c.RequestConnectionIDOmission).To(BeTrue())
 			Expect(c.MaxIncomingStreams).To(Equal(1234))
 			Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+			Expect(c.AckSendDelay).To(Equal(42 * time.Millisecond))
+			Expect(c.RetransmittablePacketsBeforeAck).To(Equal(5))
+			Expect(c.DisableAckDecimation).To(BeTrue())
+			Expect(c.PeerAckSendDelay).To(Equal(100 * time.Millisecond))
+			Expect(c.PeerRetransmittablePacketsBeforeAck).To(Equal(20))
+			Expect(c.EnableMultipath).To(BeTrue())
+			Expect(c.FECGroupSize).To(Equal(10))
+			Expect(c.ServerStateCache).To(Equal(config.ServerStateCache))
+		})
+
+		It("limits the FEC group size", func() {
+			c := populateClientConfig(&Config{FECGroupSize: 1000})
+			Expect(c.FECGroupSize).To(Equal(protocol.MaxFECGroupSize))
+			c = populateClientConfig(&Config{FECGroupSize: -1})
+			Expect(c.FECGroupSize).To(BeZero())
 		})
 
 		It("errors when the Config contains an invalid version", func() {
@@ -244,6 +309,8 @@ var _ = Describe("Client", func() {
 			Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 			Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
+			Expect(c.AckSendDelay).To(Equal(protocol.DefaultMaxAckDelay))
+			Expect(c.RetransmittablePacketsBeforeAck).To(Equal(protocol.DefaultRetransmittablePacketsBeforeAck))
 		})
 
 		It("errors when receiving an error from the connection", func() {
@@ -330,7 +397,7 @@ var _ = Describe("Client", func() {
 				established := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(established)
 				}()
@@ -377,7 +444,7 @@ var _ = Describe("Client", func() {
 						stopRunLoop:  make(chan struct{}),
 					}, nil
 				}
-				go cl.dial()
+				go cl.dial(context.Background())
 				Eventually(func() uint32 { return atomic.LoadUint32(&sessionCounter) }).Should(BeEquivalentTo(1))
 				cl.config = &Config{Versions: []protocol.VersionNumber{77, 78}}
 				cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(0x1337, []protocol.VersionNumber{77}))
@@ -7,6 +7,9 @@ import (
 
 type connection interface {
 	Write([]byte) error
+	// WriteTo writes to a different remote address, using the same local address.
+	// It is used for additional paths of a multipath session.
+	WriteTo([]byte, net.Addr) error
 	Read([]byte) (int, net.Addr, error)
 	Close() error
 	LocalAddr() net.Addr
@@ -28,6 +31,11 @@ func (c *conn) Write(p []byte) error {
 	return err
 }
 
+func (c *conn) WriteTo(p []byte, addr net.Addr) error {
+	_, err := c.pconn.WriteTo(p, addr)
+	return err
+}
+
 func (c *conn) Read(p []byte) (int, net.Addr, error) {
 	return c.pconn.ReadFrom(p)
 }
@@ -0,0 +1,173 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// The FEC scheme protects groups of forward-secure packets.
+// For every packet, a symbol is formed by prepending the packet number length and the payload length to the (unencrypted) payload.
+// The FEC frame contains the XOR of all symbols of a group, such that a single lost packet can be recovered.
+const fecSymbolHeaderLen = 3
+
+func getFECSymbol(pnLen protocol.PacketNumberLen, payload []byte) []byte {
+	symbol := make([]byte, fecSymbolHeaderLen+len(payload))
+	symbol[0] = uint8(pnLen)
+	symbol[1] = uint8(len(payload) >> 8)
+	symbol[2] = uint8(len(payload))
+	copy(symbol[fecSymbolHeaderLen:], payload)
+	return symbol
+}
+
+// xorInto XORs src into dst, and returns the result.
+// If src is longer than dst, dst is padded with zeros.
+func xorInto(dst, src []byte) []byte {
+	for len(dst) < len(src) {
+		dst = append(dst, 0)
+	}
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+	return dst
+}
+
+// The fecEncoder calculates the FEC frames for the packets sent.
+type fecEncoder struct {
+	groupSize int
+
+	packetNumbers []protocol.PacketNumber
+	data          []byte
+
+	completed []*wire.FECFrame
+}
+
+func newFECEncoder(groupSize int) *fecEncoder {
+	return &fecEncoder{groupSize: groupSize}
+}
+
+// AddPacket adds the unencrypted payload of a packet to the current group
+func (e *fecEncoder) AddPacket(pn protocol.PacketNumber, pnLen protocol.PacketNumberLen, payload []byte) {
+	if len(e.packetNumbers) > 0 && pn-e.packetNumbers[0] > protocol.MaxFECGroupSpan {
+		e.completeGroup()
+	}
+	e.packetNumbers = append(e.packetNumbers, pn)
+	e.data = xorInto(e.data, getFECSymbol(pnLen, payload))
+	if len(e.packetNumbers) >= e.groupSize {
+		e.completeGroup()
+	}
+}
+
+// CloseGroup completes the current group, even if it contains less than groupSize packets.
+// This is used when there's no more data to send, since the group would remain unprotected otherwise.
+func (e *fecEncoder) CloseGroup() {
+	if len(e.packetNumbers) == 0 {
+		return
+	}
+	e.completeGroup()
+}
+
+func (e *fecEncoder) completeGroup() {
+	e.completed = append(e.completed, &wire.FECFrame{
+		PacketNumbers: e.packetNumbers,
+		Data:          e.data,
+	})
+	e.packetNumbers = nil
+	e.data = nil
+}
+
+// PopFECFrame returns the FEC frame of a completed group.
+// It returns nil if no group was completed.
+func (e *fecEncoder) PopFECFrame() *wire.FECFrame {
+	if len(e.completed) == 0 {
+		return nil
+	}
+	f := e.completed[0]
+	e.completed = e.completed[1:]
+	return f
+}
+
+type recoveredPacket struct {
+	packetNumber    protocol.PacketNumber
+	packetNumberLen protocol.PacketNumberLen
+	data            []byte
+}
+
+// The fecDecoder saves the symbols of the packets received, and uses them to recover lost packets.
+type fecDecoder struct {
+	symbols map[protocol.PacketNumber][]byte
+	largest protocol.PacketNumber
+}
+
+func newFECDecoder() *fecDecoder {
+	return &fecDecoder{symbols: make(map[protocol.PacketNumber][]byte)}
+}
+
+// ReceivedPacket saves the unencrypted payload of a forward-secure packet.
+// Only the packets within the FEC window are kept.
+func (d *fecDecoder) ReceivedPacket(pn protocol.PacketNumber, pnLen protocol.PacketNumberLen, payload []byte) {
+	if pn < d.lowestInWindow() {
+		return
+	}
+	d.symbols[pn] = getFECSymbol(pnLen, payload)
+	if pn > d.largest {
+		d.largest = pn
+		lowest := d.lowestInWindow()
+		for p := range d.symbols {
+			if p < lowest {
+				delete(d.symbols, p)
+			}
+		}
+	}
+}
+
+// ReceivedFECFrame recovers a lost packet, if exactly one packet of the group was lost.
+// It returns nil if no packet could be recovered.
+func (d *fecDecoder) ReceivedFECFrame(f *wire.FECFrame) (*recoveredPacket, error) {
+	if f.PacketNumbers[0] < d.lowestInWindow() {
+		return nil, nil
+	}
+	var missing protocol.PacketNumber
+	var numMissing int
+	data := make([]byte, len(f.Data))
+	copy(data, f.Data)
+	for _, pn := range f.PacketNumbers {
+		symbol, ok := d.symbols[pn]
+		if !ok {
+			missing = pn
+			numMissing++
+			if numMissing > 1 {
+				return nil, nil
+			}
+			continue
+		}
+		if len(symbol) > len(data) {
+			return nil, qerr.Error(qerr.InvalidFrameData, "FEC data too short")
+		}
+		xorInto(data, symbol)
+	}
+	if numMissing == 0 {
+		return nil, nil
+	}
+	if len(data) < fecSymbolHeaderLen {
+		return nil, qerr.Error(qerr.InvalidFrameData, "FEC data too short")
+	}
+	length := int(data[1])<<8 + int(data[2])
+	if fecSymbolHeaderLen+length > len(data) {
+		return nil, qerr.Error(qerr.InvalidFrameData, "invalid length of recovered packet")
+	}
+	d.symbols[missing] = data[:fecSymbolHeaderLen+length]
+	return &recoveredPacket{
+		packetNumber:    missing,
+		packetNumberLen: protocol.PacketNumberLen(data[0]),
+		data:            data[fecSymbolHeaderLen : fecSymbolHeaderLen+length],
+	}, nil
+}
+
+func (d *fecDecoder) lowestInWindow() protocol.PacketNumber {
+	const window = 2 * protocol.MaxFECGroupSpan
+	if d.largest < window {
+		return 0
+	}
+	return d.largest - window
+}
@@ -0,0 +1,167 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FEC", func() {
+	Context("encoder", func() {
+		var encoder *fecEncoder
+
+		BeforeEach(func() {
+			encoder = newFECEncoder(3)
+		})
+
+		It("doesn't return an FEC frame before a group is complete", func() {
+			encoder.AddPacket(1, protocol.PacketNumberLen2, []byte("foo"))
+			encoder.AddPacket(2, protocol.PacketNumberLen2, []byte("bar"))
+			Expect(encoder.PopFECFrame()).To(BeNil())
+		})
+
+		It("returns an FEC frame when a group is complete", func() {
+			encoder.AddPacket(1, protocol.PacketNumberLen2, []byte("foo"))
+			encoder.AddPacket(2, protocol.PacketNumberLen2, []byte("bar"))
+			encoder.AddPacket(4, protocol.PacketNumberLen4, []byte("foobar"))
+			f := encoder.PopFECFrame()
+			Expect(f).ToNot(BeNil())
+			Expect(f.PacketNumbers).To(Equal([]protocol.PacketNumber{1, 2, 4}))
+			Expect(f.Data).To(HaveLen(fecSymbolHeaderLen + 6))
+			Expect(encoder.PopFECFrame()).To(BeNil())
+		})
+
+		It("closes a partial group", func() {
+			encoder.AddPacket(1, protocol.PacketNumberLen2, []byte("foo"))
+			encoder.AddPacket(2, protocol.PacketNumberLen2, []byte("bar"))
+			encoder.CloseGroup()
+			f := encoder.PopFECFrame()
+			Expect(f).ToNot(BeNil())
+			Expect(f.PacketNumbers).To(Equal([]protocol.PacketNumber{1, 2}))
+			// the next packet starts a new group
+			encoder.AddPacket(3, protocol.PacketNumberLen2, []byte("foobar"))
+			encoder.CloseGroup()
+			Expect(encoder.PopFECFrame().PacketNumbers).To(Equal([]protocol.PacketNumber{3}))
+		})
+
+		It("doesn't complete a group when closing an empty group", func() {
+			encoder.CloseGroup()
+			Expect(encoder.PopFECFrame()).To(BeNil())
+		})
+
+		It("starts a new group when the packet numbers span too large a range", func() {
+			encoder.AddPacket(1, protocol.PacketNumberLen2, []byte("foo"))
+			encoder.AddPacket(2+protocol.MaxFECGroupSpan, protocol.PacketNumberLen2, []byte("bar"))
+			f := encoder.PopFECFrame()
+			Expect(f).ToNot(BeNil())
+			Expect(f.PacketNumbers).To(Equal([]protocol.PacketNumber{1}))
+			Expect(encoder.PopFECFrame()).To(BeNil())
+		})
+	})
+
+	Context("decoder", func() {
+		var (
+			encoder *fecEncoder
+			decoder *fecDecoder
+		)
+
+		payloads := map[protocol.PacketNumber][]byte{
+			10: []byte("foo"),
+			11: []byte("foobar"),
+			12: []byte("lorem ipsum dolor sit amet"),
+			13: []byte("bar"),
+		}
+
+		BeforeEach(func() {
+			encoder = newFECEncoder(4)
+			decoder = newFECDecoder()
+			for pn := protocol.PacketNumber(10); pn <= 13; pn++ {
+				encoder.AddPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+		})
+
+		It("recovers a lost packet", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 13} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			p, err := decoder.ReceivedFECFrame(encoder.PopFECFrame())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(p.packetNumber).To(Equal(protocol.PacketNumber(12)))
+			Expect(p.packetNumberLen).To(Equal(protocol.PacketNumberLen2))
+			Expect(p.data).To(Equal(payloads[12]))
+		})
+
+		It("recovers the longest packet of a group", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 12} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			p, err := decoder.ReceivedFECFrame(encoder.PopFECFrame())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.packetNumber).To(Equal(protocol.PacketNumber(13)))
+			Expect(p.data).To(Equal(payloads[13]))
+		})
+
+		It("doesn't recover anything if no packet was lost", func() {
+			for pn := protocol.PacketNumber(10); pn <= 13; pn++ {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			p, err := decoder.ReceivedFECFrame(encoder.PopFECFrame())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("doesn't recover anything if more than one packet was lost", func() {
+			decoder.ReceivedPacket(10, protocol.PacketNumberLen2, payloads[10])
+			decoder.ReceivedPacket(13, protocol.PacketNumberLen2, payloads[13])
+			p, err := decoder.ReceivedFECFrame(encoder.PopFECFrame())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("doesn't recover a packet twice", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 13} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			f := encoder.PopFECFrame()
+			p, err := decoder.ReceivedFECFrame(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			p, err = decoder.ReceivedFECFrame(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("ignores FEC frames for old packets", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 13} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			decoder.ReceivedPacket(1000, protocol.PacketNumberLen2, []byte("foobar"))
+			Expect(decoder.symbols).To(HaveLen(1))
+			p, err := decoder.ReceivedFECFrame(encoder.PopFECFrame())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("errors if the FEC data is too short", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 13} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			f := encoder.PopFECFrame()
+			f.Data = f.Data[:5] // shorter than the symbol of packet 11
+			_, err := decoder.ReceivedFECFrame(f)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "FEC data too short")))
+		})
+
+		It("errors if the recovered packet has an invalid length", func() {
+			for _, pn := range []protocol.PacketNumber{10, 11, 12} {
+				decoder.ReceivedPacket(pn, protocol.PacketNumberLen2, payloads[pn])
+			}
+			f := encoder.PopFECFrame()
+			f.Data[1] ^= 0xff
+			_, err := decoder.ReceivedFECFrame(f)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "invalid length of recovered packet")))
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package h2quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAltSvcMaxAge is the freshness lifetime of an alternative service without a ma parameter, see RFC 7838, section 3.1
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// An altSvc is an alternative service announced in an Alt-Svc header field, see RFC 7838.
+type altSvc struct {
+	ProtocolID string
+	Authority  string // the host might be empty, which means that the host of the origin is used
+	MaxAge     time.Duration
+	Versions   []string // the values of the v parameter
+}
+
+// parseAltSvc parses the value of an Alt-Svc header field.
+// It returns clear = true if the value is "clear", which invalidates all alternative services of the origin.
+// Invalid alternatives are skipped.
+func parseAltSvc(value string) (services []altSvc, clear bool) {
+	value = strings.TrimSpace(value)
+	if value == "clear" {
+		return nil, true
+	}
+	for _, alternative := range splitQuoted(value, ',') {
+		svc, err := parseAlternative(alternative)
+		if err != nil {
+			continue
+		}
+		services = append(services, svc)
+	}
+	return services, false
+}
+
+func parseAlternative(alternative string) (altSvc, error) {
+	params := splitQuoted(alternative, ';')
+	protocolID, authority, err := parseParam(params[0])
+	if err != nil {
+		return altSvc{}, err
+	}
+	if _, _, err := net.SplitHostPort(authority); err != nil {
+		return altSvc{}, err
+	}
+	svc := altSvc{
+		ProtocolID: protocolID,
+		Authority:  authority,
+		MaxAge:     defaultAltSvcMaxAge,
+	}
+	for _, p := range params[1:] {
+		name, val, err := parseParam(p)
+		if err != nil {
+			return altSvc{}, err
+		}
+		switch name {
+		case "ma":
+			ma, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return altSvc{}, fmt.Errorf("invalid ma parameter: %s", val)
+			}
+			svc.MaxAge = time.Duration(ma) * time.Second
+		case "v":
+			svc.Versions = strings.Split(val, ",")
+		}
+	}
+	return svc, nil
+}
+
+// parseParam parses a name=value pair. The value may be a quoted string.
+func parseParam(param string) (string, string, error) {
+	param = strings.TrimSpace(param)
+	i := strings.IndexByte(param, '=')
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid parameter: %s", param)
+	}
+	name := strings.ToLower(strings.TrimSpace(param[:i]))
+	val, err := unquote(strings.TrimSpace(param[i+1:]))
+	if err != nil {
+		return "", "", err
+	}
+	return name, val, nil
+}
+
+// unquote removes the quotes from a quoted string, as defined in RFC 7230, section 3.2.6.
+// Values that are not quoted are returned unchanged.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", errors.New("unterminated quoted string")
+	}
+	s = s[1 : len(s)-1]
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// splitQuoted splits s at every occurrence of sep that is not inside a quoted string
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	var inQuotes bool
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,55 @@
+package h2quic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alt-Svc", func() {
+	It("parses the value set by SetQuicHeaders", func() {
+		services, clear := parseAltSvc(`quic=":443"; ma=2592000; v="39,38,37,35"`)
+		Expect(clear).To(BeFalse())
+		Expect(services).To(Equal([]altSvc{{
+			ProtocolID: "quic",
+			Authority:  ":443",
+			MaxAge:     2592000 * time.Second,
+			Versions:   []string{"39", "38", "37", "35"},
+		}}))
+	})
+
+	It("parses multiple alternatives", func() {
+		services, clear := parseAltSvc(`h2="alt.example.com:8000", quic="quic.example.com:443"; v="39"`)
+		Expect(clear).To(BeFalse())
+		Expect(services).To(HaveLen(2))
+		Expect(services[0].ProtocolID).To(Equal("h2"))
+		Expect(services[0].Authority).To(Equal("alt.example.com:8000"))
+		Expect(services[1].ProtocolID).To(Equal("quic"))
+		Expect(services[1].Authority).To(Equal("quic.example.com:443"))
+		Expect(services[1].Versions).To(Equal([]string{"39"}))
+	})
+
+	It("uses a max age of 24 hours by default", func() {
+		services, _ := parseAltSvc(`quic=":443"`)
+		Expect(services).To(HaveLen(1))
+		Expect(services[0].MaxAge).To(Equal(24 * time.Hour))
+	})
+
+	It("parses quoted strings with escaped characters", func() {
+		services, _ := parseAltSvc(`quic="\:443"; foo="a\"b;c,d"`)
+		Expect(services).To(HaveLen(1))
+		Expect(services[0].Authority).To(Equal(":443"))
+	})
+
+	It("parses clear", func() {
+		services, clear := parseAltSvc(" clear ")
+		Expect(clear).To(BeTrue())
+		Expect(services).To(BeEmpty())
+	})
+
+	It("skips invalid alternatives", func() {
+		services, _ := parseAltSvc(`quic="443", quic, quic=":443"; ma=foo, quic="foo:443`)
+		Expect(services).To(BeEmpty())
+	})
+})
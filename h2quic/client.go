@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
@@ -22,10 +24,24 @@ import (
 
 type roundTripperOpts struct {
 	DisableCompression bool
+	PushHandler        PushHandler
+	IdleTimeout        time.Duration
 }
 
 var dialAddr = quic.DialAddr
 
+var (
+	// errStreamLimitReached is returned when no new stream can be opened, because the server's stream limit is reached.
+	// The request wasn't sent, so it can be sent on a different connection.
+	errStreamLimitReached = errors.New("h2quic: stream limit reached")
+	// errClientClosed is returned when a request is sent on a client that was closed.
+	// The request wasn't sent, so it can be sent on a different connection.
+	errClientClosed = errors.New("h2quic: client closed")
+)
+
+// ErrExtendedConnectNotSupported is returned for extended CONNECT requests, if the server didn't announce support for them
+var ErrExtendedConnectNotSupported = errors.New("h2quic: the server doesn't support extended CONNECT")
+
 // client is a HTTP2 client doing QUIC requests
 type client struct {
 	mutex sync.RWMutex
@@ -38,17 +54,32 @@ type client struct {
 	handshakeErr error
 	dialOnce     sync.Once
 	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+	established  bool // set when the session was dialed and the header stream was opened
+
+	doneChan           chan struct{} // this channel is closed when the client can't be used for new requests any more
+	closeOnce          sync.Once
+	activeRequests     int
+	streamLimitReached bool
+	idleTimer          *time.Timer
+
+	sentSettings           bool
+	settingsReceived       chan struct{} // this channel is closed when the SETTINGS of the server were received
+	receivedSettings       bool
+	extendedConnectEnabled bool
 
 	session       quic.Session
+	peerStreams   *peerStreams
 	headerStream  quic.Stream
 	headerErr     *qerr.QuicError
 	headerErrored chan struct{} // this channel is closed if an error occurs on the header stream
 	requestWriter *requestWriter
 
 	responses map[protocol.StreamID]chan *http.Response
+	pushes    map[protocol.StreamID]*pushPromise
+	trailers  *trailerMap
 }
 
-var _ http.RoundTripper = &client{}
+var _ pooledClient = &client{}
 
 var defaultQuicConfig = &quic.Config{
 	RequestConnectionIDOmission: true,
@@ -68,13 +99,17 @@ func newClient(
 		config = quicConfig
 	}
 	return &client{
-		hostname:      authorityAddr("https", hostname),
-		responses:     make(map[protocol.StreamID]chan *http.Response),
-		tlsConf:       tlsConfig,
-		config:        config,
-		opts:          opts,
-		headerErrored: make(chan struct{}),
-		dialer:        dialer,
+		hostname:         authorityAddr("https", hostname),
+		responses:        make(map[protocol.StreamID]chan *http.Response),
+		pushes:           make(map[protocol.StreamID]*pushPromise),
+		trailers:         newTrailerMap(),
+		tlsConf:          tlsConfig,
+		config:           config,
+		opts:             opts,
+		headerErrored:    make(chan struct{}),
+		doneChan:         make(chan struct{}),
+		settingsReceived: make(chan struct{}),
+		dialer:           dialer,
 	}
 }
 
@@ -96,10 +131,141 @@ func (c *client) dial() error {
 		return err
 	}
 	c.requestWriter = newRequestWriter(c.headerStream)
+	// Servers that don't support push reject any frame other than HEADERS, so we don't send a SETTINGS frame to disable push.
+	// Instead, pushed streams are reset if push is disabled.
+	// The streams opened by the server are still accepted, such that tunnels can use the streams announced by the server.
+	var onStream func(quic.Stream)
+	if c.opts.PushHandler != nil {
+		onStream = c.handlePushedStream
+	}
+	c.peerStreams = newPeerStreams(c.session, onStream)
+	go c.peerStreams.run()
 	go c.handleHeaderStream()
+	go c.watchSession()
+	c.mutex.Lock()
+	c.established = true
+	c.mutex.Unlock()
+	return nil
+}
+
+// watchSession marks the client as done as soon as the session is closed, or an error occurs on the header stream
+func (c *client) watchSession() {
+	select {
+	case <-c.session.Context().Done():
+	case <-c.headerErrored:
+	}
+	c.setDone()
+}
+
+func (c *client) setDone() {
+	c.closeOnce.Do(func() {
+		close(c.doneChan)
+	})
+}
+
+func (c *client) done() <-chan struct{} {
+	return c.doneChan
+}
+
+// canTakeNewRequest says if a new request can be sent on this client.
+// This is not the case if the client is closed, or if the stream limit was reached.
+func (c *client) canTakeNewRequest() bool {
+	select {
+	case <-c.doneChan:
+		return false
+	default:
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return !c.streamLimitReached
+}
+
+// canCoalesce says if requests for the authority can be sent on this client.
+// This is the case if the certificate presented by the server is valid for the host, and if the port is the same.
+// The caller has to check that the host resolves to the IP address of the server.
+func (c *client) canCoalesce(authority string) bool {
+	c.mutex.RLock()
+	established := c.established
+	c.mutex.RUnlock()
+	if !established {
+		return false
+	}
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		return false
+	}
+	if _, ownPort, _ := net.SplitHostPort(c.hostname); port != ownPort {
+		return false
+	}
+	certs := c.session.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return false
+	}
+	return certs[0].VerifyHostname(host) == nil
+}
+
+// remoteIP returns the IP address of the server.
+// It must only be called after canCoalesce returned true.
+func (c *client) remoteIP() net.IP {
+	if addr, ok := c.session.RemoteAddr().(*net.UDPAddr); ok {
+		return addr.IP
+	}
 	return nil
 }
 
+// isRequestStream says if a stream opened by the server is used by h2quic,
+// i.e. if it is the header stream or the stream of a promised response.
+func (c *client) isRequestStream(id protocol.StreamID) bool {
+	if id == c.headerStream.StreamID() {
+		return true
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	p, ok := c.pushes[id]
+	return ok && p.promised
+}
+
+func (c *client) requestStarted() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.activeRequests++
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+}
+
+func (c *client) requestFinished() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.activeRequests--
+	// a stream was closed, so a new stream can be opened
+	c.streamLimitReached = false
+	if c.activeRequests > 0 || c.opts.IdleTimeout <= 0 {
+		return
+	}
+	if c.idleTimer == nil {
+		c.idleTimer = time.AfterFunc(c.opts.IdleTimeout, func() { c.closeIfIdle() })
+	} else {
+		c.idleTimer.Reset(c.opts.IdleTimeout)
+	}
+}
+
+// closeIfIdle closes the client if no requests are active.
+// It returns true if the client was closed.
+func (c *client) closeIfIdle() bool {
+	c.mutex.Lock()
+	idle := c.activeRequests == 0
+	if idle {
+		c.setDone()
+	}
+	c.mutex.Unlock()
+	if !idle {
+		return false
+	}
+	_ = c.Close()
+	return true
+}
+
 func (c *client) handleHeaderStream() {
 	decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
 	h2framer := http2.NewFramer(nil, c.headerStream)
@@ -114,6 +280,7 @@ func (c *client) handleHeaderStream() {
 	c.headerErr = qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
 	// stop all running request
 	close(c.headerErrored)
+	c.trailers.closeAll()
 }
 
 func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) error {
@@ -121,19 +288,40 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 	if err != nil {
 		return err
 	}
+	if sframe, ok := frame.(*http2.SettingsFrame); ok {
+		return c.handleSettings(sframe)
+	}
+	if pframe, ok := frame.(*http2.PushPromiseFrame); ok {
+		return c.handlePushPromise(h2framer, pframe, decoder)
+	}
 	hframe, ok := frame.(*http2.HeadersFrame)
 	if !ok {
 		return errors.New("not a headers frame")
 	}
 	mhframe := &http2.MetaHeadersFrame{HeadersFrame: hframe}
-	mhframe.Fields, err = decoder.DecodeFull(hframe.HeaderBlockFragment())
+	mhframe.Fields, _, err = readHeaderBlock(h2framer, decoder, hframe, 0)
 	if err != nil {
 		return fmt.Errorf("cannot read header fields: %s", err.Error())
 	}
 
-	c.mutex.RLock()
-	responseChan, ok := c.responses[protocol.StreamID(hframe.StreamID)]
-	c.mutex.RUnlock()
+	id := protocol.StreamID(hframe.StreamID)
+	if isTrailers(mhframe.Fields) {
+		if !hframe.StreamEnded() {
+			return errors.New("trailers must end the stream")
+		}
+		c.trailers.deliver(id, trailerFromHeaders(mhframe.Fields))
+		return nil
+	}
+
+	c.mutex.Lock()
+	responseChan, ok := c.responses[id]
+	var isPush bool
+	if p, promised := c.pushes[id]; !ok && promised && p.promised && !p.gotResponse {
+		p.gotResponse = true
+		responseChan, ok, isPush = p.responseChan, true, true
+		c.maybeDeletePushPromise(id, p)
+	}
+	c.mutex.Unlock()
 	if !ok {
 		return fmt.Errorf("response channel for stream %d not found", hframe.StreamID)
 	}
@@ -142,10 +330,86 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 	if err != nil {
 		return err
 	}
+	// trailers are not supported for pushed responses
+	if rsp.Trailer != nil && !isPush {
+		c.trailers.expect(id)
+	}
 	responseChan <- rsp
 	return nil
 }
 
+// handleSettings applies the settings sent by the server
+func (c *client) handleSettings(f *http2.SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := f.ForeachSetting(func(s http2.Setting) error {
+		if s.ID != settingEnableConnectProtocol {
+			return nil
+		}
+		if s.Val > 1 {
+			return fmt.Errorf("invalid value for SETTINGS_ENABLE_CONNECT_PROTOCOL: %d", s.Val)
+		}
+		c.extendedConnectEnabled = s.Val == 1
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.setSettingsReceived()
+	return nil
+}
+
+// setSettingsReceived must be called with the mutex held
+func (c *client) setSettingsReceived() {
+	if !c.receivedSettings {
+		c.receivedSettings = true
+		close(c.settingsReceived)
+	}
+}
+
+// sendSettings sends the SETTINGS of the client, unless they were already sent.
+// Servers that don't support SETTINGS frames close the session when receiving one,
+// so they are only sent before the first extended CONNECT request.
+func (c *client) sendSettings() error {
+	c.mutex.Lock()
+	if c.sentSettings {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.sentSettings = true
+	c.mutex.Unlock()
+	var settings []http2.Setting
+	if c.opts.PushHandler == nil {
+		settings = append(settings, http2.Setting{ID: http2.SettingEnablePush, Val: 0})
+	}
+	return c.requestWriter.WriteSettings(settings...)
+}
+
+// waitForExtendedConnect sends the SETTINGS of the client, and waits for the SETTINGS of the server.
+// The server only sends its SETTINGS in response to the SETTINGS of the client.
+// It then checks that the server supports extended CONNECT.
+func (c *client) waitForExtendedConnect(ctx context.Context) error {
+	if err := c.sendSettings(); err != nil {
+		return err
+	}
+	select {
+	case <-c.settingsReceived:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.headerErrored:
+		return c.headerErr
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if !c.extendedConnectEnabled {
+		return ErrExtendedConnectNotSupported
+	}
+	return nil
+}
+
 // Roundtrip executes a request and returns a response
 func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	// TODO: add port to address, if it doesn't have one
@@ -155,9 +419,48 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
 		return nil, fmt.Errorf("h2quic Client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
 	}
+	return c.roundTrip(req, true)
+}
 
+// roundTrip executes a request.
+// If waitForStream is not set, it returns errStreamLimitReached if the stream limit is reached, instead of waiting for a stream to become available.
+// The request is counted as active until the response body is read completely or closed.
+func (c *client) roundTrip(req *http.Request, waitForStream bool) (*http.Response, error) {
+	c.requestStarted()
+	res, err := c.doRoundTrip(req, waitForStream)
+	if err != nil {
+		c.requestFinished()
+		if err == errStreamLimitReached {
+			c.mutex.Lock()
+			c.streamLimitReached = true
+			c.mutex.Unlock()
+		}
+		return nil, err
+	}
+	if conn, ok := res.Body.(*streamConn); ok {
+		// a tunnel is active until it is closed
+		conn.onClose = c.requestFinished
+	} else if res.Body == noBody {
+		c.requestFinished()
+	} else {
+		res.Body = &trackedBody{ReadCloser: res.Body, onDone: c.requestFinished}
+	}
+	return res, nil
+}
+
+func (c *client) doRoundTrip(req *http.Request, waitForStream bool) (*http.Response, error) {
 	c.dialOnce.Do(func() {
+		select {
+		case <-c.doneChan:
+			// the client was closed before it was used
+			c.handshakeErr = errClientClosed
+			return
+		default:
+		}
 		c.handshakeErr = c.dial()
+		if c.handshakeErr != nil {
+			c.setDone()
+		}
 	})
 
 	if c.handshakeErr != nil {
@@ -165,11 +468,26 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	hasBody := (req.Body != nil)
+	// The data stream of a CONNECT request is used for the tunnel.
+	// It stays open after the response was received.
+	isTunnel := isTunnelRequest(req.Method)
 
+	ctx := req.Context()
+	if isExtendedConnect(req) {
+		if err := c.waitForExtendedConnect(ctx); err != nil {
+			return nil, err
+		}
+	}
 	responseChan := make(chan *http.Response)
-	dataStream, err := c.session.OpenStreamSync()
+	dataStream, err := c.openStream(ctx, waitForStream)
 	if err != nil {
-		_ = c.CloseWithError(err)
+		if err == errStreamLimitReached || err == errClientClosed {
+			return nil, err
+		}
+		// a cancelled request doesn't affect the other requests on this connection
+		if err != ctx.Err() {
+			_ = c.CloseWithError(err)
+		}
 		return nil, err
 	}
 	c.mutex.Lock()
@@ -177,11 +495,10 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	c.mutex.Unlock()
 
 	var requestedGzip bool
-	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" {
+	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" && !isTunnel {
 		requestedGzip = true
 	}
-	// TODO: add support for trailers
-	endStream := !hasBody
+	endStream := !hasBody && !isTunnel
 	err = c.requestWriter.WriteRequest(req, dataStream.StreamID(), endStream, requestedGzip)
 	if err != nil {
 		_ = c.CloseWithError(err)
@@ -191,7 +508,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	resc := make(chan error, 1)
 	if hasBody {
 		go func() {
-			resc <- c.writeRequestBody(dataStream, req.Body)
+			resc <- c.writeRequestBody(dataStream, req)
 		}()
 	}
 
@@ -204,8 +521,8 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 		bodySent = true
 	}
 
-	ctx := req.Context()
-	for !(bodySent && receivedResponse) {
+	// for tunnels, the body is sent while the response is being read
+	for !receivedResponse || !(bodySent || isTunnel) {
 		select {
 		case res = <-responseChan:
 			receivedResponse = true
@@ -215,6 +532,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 		case err := <-resc:
 			bodySent = true
 			if err != nil {
+				c.trailers.remove(dataStream.StreamID())
 				return nil, err
 			}
 		case <-ctx.Done():
@@ -224,6 +542,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 			c.mutex.Lock()
 			delete(c.responses, dataStream.StreamID())
 			c.mutex.Unlock()
+			c.trailers.remove(dataStream.StreamID())
 			return nil, ctx.Err()
 		case <-c.headerErrored:
 			// an error occurred on the header stream
@@ -238,10 +557,27 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	res = setLength(res, isHead, streamEnded)
 
-	if streamEnded || isHead {
+	if isTunnel {
+		conn := newStreamConn(dataStream, c.session.LocalAddr(), c.session.RemoteAddr(), nil)
+		conn.acceptStream = func(ctx context.Context, id protocol.StreamID) (quic.Stream, error) {
+			if c.isRequestStream(id) {
+				return nil, fmt.Errorf("h2quic: stream %d is already in use", id)
+			}
+			return c.peerStreams.get(ctx, id)
+		}
+		res.Body = conn
+		c.trailers.remove(dataStream.StreamID())
+	} else if streamEnded || isHead {
 		res.Body = noBody
+		c.trailers.remove(dataStream.StreamID())
 	} else {
 		res.Body = dataStream
+		if res.Trailer != nil {
+			res.Body = &responseBody{
+				dataStream: dataStream,
+				trailers:   newTrailerReceiver(c.trailers, dataStream.StreamID(), res.Trailer),
+			}
+		}
 		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
@@ -255,7 +591,32 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, nil
 }
 
-func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (err error) {
+func (c *client) openStream(ctx context.Context, waitForStream bool) (quic.Stream, error) {
+	if waitForStream {
+		return c.session.OpenStreamSyncContext(ctx)
+	}
+	select {
+	case <-c.doneChan:
+		return nil, errClientClosed
+	default:
+	}
+	str, err := c.session.OpenStream()
+	if err == qerr.TooManyOpenStreams {
+		return nil, errStreamLimitReached
+	}
+	if err != nil {
+		// the session might have been closed after the check above
+		select {
+		case <-c.doneChan:
+			return nil, errClientClosed
+		default:
+		}
+	}
+	return str, err
+}
+
+func (c *client) writeRequestBody(dataStream quic.Stream, req *http.Request) (err error) {
+	body := req.Body
 	defer func() {
 		cerr := body.Close()
 		if err == nil {
@@ -269,11 +630,18 @@ func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (e
 		// TODO: what to do with dataStream here? Maybe reset it?
 		return err
 	}
+	// the values of the trailers are set while the body is read
+	if len(declaredTrailers(req.Trailer)) > 0 {
+		if err := c.requestWriter.WriteTrailers(req.Trailer, dataStream.StreamID()); err != nil {
+			return err
+		}
+	}
 	return dataStream.Close()
 }
 
 // Close closes the client
 func (c *client) CloseWithError(e error) error {
+	c.setDone()
 	if c.session == nil {
 		return nil
 	}
@@ -0,0 +1,236 @@
+package h2quic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// A PushHandler handles responses pushed by the server.
+type PushHandler interface {
+	// HandlePush is called for every resource promised by the server.
+	// It is run in its own goroutine.
+	// If HandlePush returns without having called ReadResponse, the push is canceled.
+	HandlePush(r *PushedRequest)
+}
+
+// A PushedRequest is a request promised by the server in a PUSH_PROMISE frame.
+type PushedRequest struct {
+	// Promise is the request promised by the server. It doesn't have a body.
+	Promise *http.Request
+
+	client  *client
+	promise *pushPromise
+
+	mutex        sync.Mutex
+	responseRead bool
+	canceled     bool
+}
+
+// errPushCanceled is returned by ReadResponse after the push was canceled
+var errPushCanceled = errors.New("h2quic: push canceled")
+
+// ReadResponse blocks until the server sends the pushed response, or the context is done.
+// The response body must be closed by the caller.
+func (r *PushedRequest) ReadResponse(ctx context.Context) (*http.Response, error) {
+	r.mutex.Lock()
+	if r.canceled {
+		r.mutex.Unlock()
+		return nil, errPushCanceled
+	}
+	r.responseRead = true
+	r.mutex.Unlock()
+
+	var str quic.Stream
+	select {
+	case str = <-r.promise.streamChan:
+	case <-ctx.Done():
+		r.Cancel()
+		return nil, ctx.Err()
+	case <-r.client.headerErrored:
+		return nil, r.client.headerErr
+	}
+
+	// the client never sends data on a pushed stream
+	str.Close()
+
+	var rsp *http.Response
+	select {
+	case rsp = <-r.promise.responseChan:
+	case <-ctx.Done():
+		r.mutex.Lock()
+		r.canceled = true
+		r.mutex.Unlock()
+		cancelPushedStream(str)
+		return nil, ctx.Err()
+	case <-r.client.headerErrored:
+		return nil, r.client.headerErr
+	}
+
+	isHead := r.Promise.Method == "HEAD"
+	rsp = setLength(rsp, isHead, false)
+	if isHead {
+		rsp.Body = noBody
+	} else {
+		rsp.Body = str
+	}
+	rsp.Request = r.Promise
+	return rsp, nil
+}
+
+// Cancel cancels the push. The server is told to stop sending the pushed response.
+func (r *PushedRequest) Cancel() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+	go func() {
+		select {
+		case str := <-r.promise.streamChan:
+			cancelPushedStream(str)
+		case <-r.client.headerErrored:
+		}
+	}()
+}
+
+func cancelPushedStream(str quic.Stream) {
+	// error code 6 signals that stream was canceled
+	str.CancelRead(6)
+	// in gQUIC, closing the stream sends a RST_STREAM, since reading was canceled
+	str.Close()
+}
+
+// A pushPromise is a resource promised by the server.
+// Its stream and the response headers can arrive in any order.
+type pushPromise struct {
+	promised     bool
+	streamChan   chan quic.Stream    // receives the stream as soon as the server opens it
+	responseChan chan *http.Response // receives the response headers
+	gotStream    bool
+	gotResponse  bool
+}
+
+// getPushPromise gets the pushPromise for a stream, creating it if it doesn't exist yet.
+// The client mutex must be held when calling this function.
+func (c *client) getPushPromise(id protocol.StreamID) *pushPromise {
+	p, ok := c.pushes[id]
+	if !ok {
+		p = &pushPromise{
+			streamChan:   make(chan quic.Stream, 1),
+			responseChan: make(chan *http.Response, 1),
+		}
+		c.pushes[id] = p
+	}
+	return p
+}
+
+// The client mutex must be held when calling this function.
+func (c *client) maybeDeletePushPromise(id protocol.StreamID, p *pushPromise) {
+	if p.gotStream && p.gotResponse {
+		delete(c.pushes, id)
+	}
+}
+
+// handlePushedStream is called for the streams opened by the server, if push is enabled
+func (c *client) handlePushedStream(str quic.Stream) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	p := c.getPushPromise(str.StreamID())
+	p.gotStream = true
+	p.streamChan <- str
+	c.maybeDeletePushPromise(str.StreamID(), p)
+}
+
+func (c *client) handlePushPromise(h2framer *http2.Framer, f *http2.PushPromiseFrame, decoder *hpack.Decoder) error {
+	// decode the header block even if we don't accept the push, in order to keep the HPACK state in sync
+	fields, _, err := readHeaderBlock(h2framer, decoder, f, 0)
+	if err != nil {
+		return fmt.Errorf("cannot read header fields: %s", err.Error())
+	}
+	id := protocol.StreamID(f.PromiseID)
+	if id%2 != 0 {
+		return fmt.Errorf("invalid promised stream %d", id)
+	}
+	if c.opts.PushHandler == nil {
+		return c.refusePush(id)
+	}
+	promise, err := requestFromHeaders(fields)
+	if err != nil {
+		return err
+	}
+	if promise.Method != "GET" && promise.Method != "HEAD" {
+		return fmt.Errorf("invalid method for a pushed request: %s", promise.Method)
+	}
+	promise.TLS = nil
+	promise.RequestURI = ""
+	promise.URL.Scheme = "https"
+	promise.URL.Host = promise.Host
+
+	c.mutex.Lock()
+	p := c.getPushPromise(id)
+	if p.promised {
+		c.mutex.Unlock()
+		return fmt.Errorf("received a second PUSH_PROMISE for stream %d", id)
+	}
+	p.promised = true
+	c.mutex.Unlock()
+
+	r := &PushedRequest{
+		Promise: promise,
+		client:  c,
+		promise: p,
+	}
+	// the server may only push resources it is authoritative for
+	if authorityAddr("https", promise.Host) != c.hostname {
+		r.Cancel()
+		return nil
+	}
+	go func() {
+		c.opts.PushHandler.HandlePush(r)
+		r.mutex.Lock()
+		responseRead := r.responseRead
+		r.mutex.Unlock()
+		if !responseRead {
+			r.Cancel()
+		}
+	}()
+	return nil
+}
+
+// refusePush resets the stream of a pushed response, if push is disabled.
+// The response headers sent by the server are ignored.
+func (c *client) refusePush(id protocol.StreamID) error {
+	sess, ok := c.session.(streamCreator)
+	if !ok {
+		return errors.New("received a PUSH_PROMISE, although push is disabled")
+	}
+	c.mutex.Lock()
+	p := c.getPushPromise(id)
+	if p.promised {
+		c.mutex.Unlock()
+		return fmt.Errorf("received a second PUSH_PROMISE for stream %d", id)
+	}
+	p.promised = true
+	// the stream is not accepted, since push is disabled
+	p.gotStream = true
+	c.mutex.Unlock()
+
+	str, err := sess.GetOrOpenStream(id)
+	if err != nil {
+		return err
+	}
+	// the stream is nil if it was already closed
+	if str != nil {
+		cancelPushedStream(str)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type pushHandlerFunc func(*PushedRequest)
+
+func (f pushHandlerFunc) HandlePush(r *PushedRequest) { f(r) }
+
+var _ = Describe("Client Push", func() {
+	var (
+		client       *client
+		headerStream *mockStream
+		pushedStream *mockStream
+		h2framer     *http2.Framer
+		pushes       chan *PushedRequest
+		handlerDone  chan struct{}
+	)
+
+	encodeHeaders := func(fields ...string) []byte {
+		var headers bytes.Buffer
+		enc := hpack.NewEncoder(&headers)
+		for i := 0; i < len(fields); i += 2 {
+			enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+		}
+		return headers.Bytes()
+	}
+
+	writePushPromise := func(authority string) {
+		err := h2framer.WritePushPromise(http2.PushPromiseParam{
+			StreamID:      5,
+			PromiseID:     2,
+			EndHeaders:    true,
+			BlockFragment: encodeHeaders(":method", "GET", ":scheme", "https", ":authority", authority, ":path", "/style.css"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	writeResponse := func() {
+		err := h2framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      2,
+			EndHeaders:    true,
+			BlockFragment: encodeHeaders(":status", "200", "content-type", "text/css"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		pushes = make(chan *PushedRequest, 1)
+		handlerDone = make(chan struct{})
+		client = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{
+			PushHandler: pushHandlerFunc(func(r *PushedRequest) {
+				pushes <- r
+				// the push is canceled as soon as the handler returns
+				<-handlerDone
+			}),
+		}, nil, nil)
+		session := newMockSession()
+		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
+		client.session = session
+		headerStream = newMockStream(3)
+		client.headerStream = headerStream
+		h2framer = http2.NewFramer(&headerStream.dataToRead, nil)
+		pushedStream = newMockStream(2)
+	})
+
+	AfterEach(func() {
+		close(handlerDone)
+	})
+
+	It("reads a pushed response", func() {
+		writePushPromise("quic.clemente.io:1337")
+		writeResponse()
+		go client.handleHeaderStream()
+		client.handlePushedStream(pushedStream)
+		pushedStream.dataToRead.Write([]byte("body { color: red; }"))
+		close(pushedStream.unblockRead)
+
+		var r *PushedRequest
+		Eventually(pushes).Should(Receive(&r))
+		Expect(r.Promise.Method).To(Equal("GET"))
+		Expect(r.Promise.URL.String()).To(Equal("https://quic.clemente.io:1337/style.css"))
+		rsp, err := r.ReadResponse(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(rsp.Header.Get("Content-Type")).To(Equal("text/css"))
+		Expect(rsp.Request).To(Equal(r.Promise))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("body { color: red; }")))
+		Expect(pushedStream.closed).To(BeTrue())
+		Expect(pushedStream.reset).To(BeFalse())
+		Eventually(func() bool {
+			client.mutex.Lock()
+			defer client.mutex.Unlock()
+			return len(client.pushes) == 0
+		}).Should(BeTrue())
+		Expect(client.headerErrored).ToNot(BeClosed())
+	})
+
+	It("cancels the push if the handler doesn't read the response", func() {
+		client.opts.PushHandler = pushHandlerFunc(func(r *PushedRequest) {})
+		writePushPromise("quic.clemente.io:1337")
+		go client.handleHeaderStream()
+		client.handlePushedStream(pushedStream)
+		Eventually(func() bool { return pushedStream.reset }).Should(BeTrue())
+		Expect(pushedStream.closed).To(BeTrue())
+	})
+
+	It("cancels the push if the context is canceled while waiting for the response", func() {
+		writePushPromise("quic.clemente.io:1337")
+		go client.handleHeaderStream()
+		client.handlePushedStream(pushedStream)
+		var r *PushedRequest
+		Eventually(pushes).Should(Receive(&r))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := r.ReadResponse(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+		Eventually(func() bool { return pushedStream.reset }).Should(BeTrue())
+		_, err = r.ReadResponse(context.Background())
+		Expect(err).To(MatchError(errPushCanceled))
+	})
+
+	It("refuses pushes for other authorities", func() {
+		writePushPromise("example.com")
+		go client.handleHeaderStream()
+		client.handlePushedStream(pushedStream)
+		Consistently(pushes).ShouldNot(Receive())
+		Eventually(func() bool { return pushedStream.reset }).Should(BeTrue())
+		Expect(client.headerErrored).ToNot(BeClosed())
+	})
+
+	It("resets pushed streams if push is disabled", func() {
+		client.opts.PushHandler = nil
+		client.session.(*mockSession).dataStream = pushedStream
+		writePushPromise("quic.clemente.io:1337")
+		writeResponse()
+		go client.handleHeaderStream()
+		Eventually(func() bool { return pushedStream.reset }).Should(BeTrue())
+		Expect(pushedStream.closed).To(BeTrue())
+		Eventually(func() bool {
+			client.mutex.Lock()
+			defer client.mutex.Unlock()
+			return len(client.pushes) == 0
+		}).Should(BeTrue())
+		Consistently(pushes).ShouldNot(Receive())
+		Expect(client.headerErrored).ToNot(BeClosed())
+	})
+
+	It("errors if the same stream is promised twice", func() {
+		writePushPromise("quic.clemente.io:1337")
+		writePushPromise("quic.clemente.io:1337")
+		client.handleHeaderStream()
+		Expect(client.headerErrored).To(BeClosed())
+		Expect(client.headerErr.ErrorMessage).To(Equal("received a second PUSH_PROMISE for stream 2"))
+	})
+
+	It("doesn't send a SETTINGS frame if no PushHandler is set", func() {
+		client.opts.PushHandler = nil
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			return client.session, nil
+		}
+		defer func() { dialAddr = quic.DialAddr }()
+		client.session.(*mockSession).streamsToOpen = []quic.Stream{headerStream}
+		Expect(client.dial()).To(Succeed())
+		// servers that don't support push reject any frame other than HEADERS
+		Expect(headerStream.dataWritten.Len()).To(BeZero())
+	})
+})
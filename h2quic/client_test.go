@@ -5,15 +5,20 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
 
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
 	"github.com/lucas-clemente/quic-go/qerr"
 
 	"time"
@@ -177,13 +182,26 @@ var _ = Describe("Client", func() {
 		var request *http.Request
 		var dataStream *mockStream
 
-		getRequest := func(data []byte) *http2.MetaHeadersFrame {
-			r := bytes.NewReader(data)
+		// getRequest waits until the request was written to the header stream, and parses it.
+		// It skips the SETTINGS frame the client sends before an extended CONNECT request.
+		getRequest := func() *http2.MetaHeadersFrame {
+			var hframe *http2.HeadersFrame
+			Eventually(func() *http2.HeadersFrame {
+				h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+				for {
+					frame, err := h2framer.ReadFrame()
+					if err != nil {
+						return nil
+					}
+					if f, ok := frame.(*http2.HeadersFrame); ok {
+						hframe = f
+						return f
+					}
+				}
+			}).ShouldNot(BeNil())
 			decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
-			h2framer := http2.NewFramer(nil, r)
-			frame, err := h2framer.ReadFrame()
-			Expect(err).ToNot(HaveOccurred())
-			mhframe := &http2.MetaHeadersFrame{HeadersFrame: frame.(*http2.HeadersFrame)}
+			mhframe := &http2.MetaHeadersFrame{HeadersFrame: hframe}
+			var err error
 			mhframe.Fields, err = decoder.DecodeFull(mhframe.HeadersFrame.HeaderBlockFragment())
 			Expect(err).ToNot(HaveOccurred())
 			return mhframe
@@ -219,7 +237,7 @@ var _ = Describe("Client", func() {
 				rsp, err := client.RoundTrip(request)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rsp).To(Equal(teapot))
-				Expect(rsp.Body).To(Equal(dataStream))
+				Expect(rsp.Body.(*trackedBody).ReadCloser).To(Equal(dataStream))
 				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
 				Expect(rsp.Request).To(Equal(request))
 				close(done)
@@ -231,6 +249,23 @@ var _ = Describe("Client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("only sends HEADERS frames, if the request is not an extended CONNECT request", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			getRequest()
+			injectResponse(5, &http.Response{StatusCode: 200})
+			Eventually(done).Should(BeClosed())
+			// servers that don't support SETTINGS frames reject any frame other than HEADERS
+			frame, err := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes())).ReadFrame()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&http2.HeadersFrame{}))
+		})
+
 		It("errors if a request without a body is canceled", func() {
 			done := make(chan struct{})
 			ctx, cancel := context.WithCancel(context.Background())
@@ -337,6 +372,24 @@ var _ = Describe("Client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("doesn't close the session if the context is canceled while waiting for a stream", func() {
+			session.streamsToOpen = []quic.Stream{headerStream, dataStream}
+			session.blockOpenStreamSync = true
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := client.RoundTrip(request.WithContext(ctx))
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+			Expect(session.closed).To(BeFalse())
+		})
+
 		Context("validating the address", func() {
 			It("refuses to do requests for the wrong host", func() {
 				req, err := http.NewRequest("https", "https://quic.clemente.io:1336/foobar.html", nil)
@@ -381,7 +434,7 @@ var _ = Describe("Client", func() {
 				close(done)
 			}()
 			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeNil())
-			mhf := getRequest(headerStream.dataWritten.Bytes())
+			mhf := getRequest()
 			Expect(mhf.HeadersFrame.StreamEnded()).To(BeTrue())
 			// make the go routine return
 			injectResponse(5, &http.Response{})
@@ -397,7 +450,7 @@ var _ = Describe("Client", func() {
 				close(done)
 			}()
 			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeNil())
-			mhf := getRequest(headerStream.dataWritten.Bytes())
+			mhf := getRequest()
 			Expect(mhf.HeadersFrame.StreamEnded()).To(BeFalse())
 			// make the go routine return
 			injectResponse(5, &http.Response{})
@@ -437,6 +490,32 @@ var _ = Describe("Client", func() {
 				Expect(request.Body.(*mockBody).closed).To(BeTrue())
 			})
 
+			It("sends trailers after the body", func() {
+				request.Trailer = http.Header{"Foo": []string{"bar"}}
+				go func() {
+					defer GinkgoRecover()
+					_, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+				}()
+				injectResponse(5, response)
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
+				h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+				frame, err := h2framer.ReadFrame()
+				Expect(err).ToNot(HaveOccurred())
+				fields, err := decoder.DecodeFull(frame.(*http2.HeadersFrame).HeaderBlockFragment())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fields).To(ContainElement(hpack.HeaderField{Name: "trailer", Value: "Foo"}))
+				frame, err = h2framer.ReadFrame()
+				Expect(err).ToNot(HaveOccurred())
+				hframe := frame.(*http2.HeadersFrame)
+				Expect(hframe.StreamID).To(BeEquivalentTo(5))
+				Expect(hframe.StreamEnded()).To(BeTrue())
+				fields, err = decoder.DecodeFull(hframe.HeaderBlockFragment())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fields).To(Equal([]hpack.HeaderField{{Name: "foo", Value: "bar"}}))
+			})
+
 			It("returns the error that occurred when reading the body", func() {
 				testErr := errors.New("testErr")
 				request.Body.(*mockBody).readErr = testErr
@@ -470,6 +549,34 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		It("populates the response trailer when the body is read", func() {
+			response := &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{},
+				Trailer:    http.Header{"Foo": nil},
+			}
+			dataStream.dataToRead.Write([]byte("foobar"))
+			close(dataStream.unblockRead)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foobar")))
+				Expect(rsp.Trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+				close(done)
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			// this is done by readResponse when it receives a response that announces trailers
+			client.trailers.expect(5)
+			injectResponse(5, response)
+			Consistently(done).ShouldNot(BeClosed())
+			client.trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			Eventually(done).Should(BeClosed())
+		})
+
 		Context("gzip compression", func() {
 			var gzippedData []byte // a gzipped foobar
 			var response *http.Response
@@ -506,7 +613,7 @@ var _ = Describe("Client", func() {
 				dataStream.dataToRead.Write(gzippedData)
 				response.Header.Add("Content-Encoding", "gzip")
 				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
+				headers := getHeaderFields(getRequest())
 				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
 				close(dataStream.unblockRead)
 				Eventually(done).Should(BeClosed())
@@ -523,7 +630,7 @@ var _ = Describe("Client", func() {
 				}()
 
 				Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
+				headers := getHeaderFields(getRequest())
 				Expect(headers).ToNot(HaveKey("accept-encoding"))
 				// make the go routine return
 				injectResponse(5, &http.Response{})
@@ -546,7 +653,7 @@ var _ = Describe("Client", func() {
 
 				dataStream.dataToRead.Write([]byte("not gzipped"))
 				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
+				headers := getHeaderFields(getRequest())
 				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
 				Eventually(done).Should(BeClosed())
 			})
@@ -568,7 +675,7 @@ var _ = Describe("Client", func() {
 
 				dataStream.dataToRead.Write([]byte("gzipped data"))
 				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
+				headers := getHeaderFields(getRequest())
 				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
 				Eventually(done).Should(BeClosed())
 			})
@@ -599,6 +706,105 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Header).To(HaveKeyWithValue("Cache-Control", []string{"private"}))
 			})
 
+			It("reads responses with header blocks that span CONTINUATION frames", func() {
+				largeValue := strings.Repeat("a", 2*maxHeaderFragmentSize)
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				enc.WriteField(hpack.HeaderField{Name: "foo", Value: largeValue})
+				Expect(writeHeaders(h2framer, http2.HeadersFrameParam{
+					StreamID:      23,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				go client.handleHeaderStream()
+				var rsp *http.Response
+				Eventually(client.responses[23]).Should(Receive(&rsp))
+				Expect(rsp.Header.Get("foo")).To(Equal(largeValue))
+			})
+
+			It("reads trailers", func() {
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				enc.WriteField(hpack.HeaderField{Name: "trailer", Value: "Foo"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				headers.Reset()
+				enc.WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				go client.handleHeaderStream()
+				var rsp *http.Response
+				Eventually(client.responses[23]).Should(Receive(&rsp))
+				Expect(rsp.Trailer).To(Equal(http.Header{"Foo": nil}))
+				Expect(newTrailerReceiver(client.trailers, 23, rsp.Trailer).wait()).To(Succeed())
+				Expect(rsp.Trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+				Expect(client.headerErrored).ToNot(BeClosed())
+			})
+
+			It("ignores trailers for streams that didn't announce trailers", func() {
+				var headers bytes.Buffer
+				hpack.NewEncoder(&headers).WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      1337,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				go client.handleHeaderStream()
+				Consistently(client.headerErrored).ShouldNot(BeClosed())
+			})
+
+			It("errors if trailers don't end the stream", func() {
+				var headers bytes.Buffer
+				hpack.NewEncoder(&headers).WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				client.handleHeaderStream()
+				Expect(client.headerErrored).To(BeClosed())
+				Expect(client.headerErr).To(MatchError(qerr.Error(qerr.InvalidHeadersStreamData, "trailers must end the stream")))
+			})
+
+			It("reads the settings of the server", func() {
+				Expect(h2framer.WriteSettings(http2.Setting{ID: settingEnableConnectProtocol, Val: 1})).To(Succeed())
+				go client.handleHeaderStream()
+				Eventually(client.settingsReceived).Should(BeClosed())
+				client.mutex.RLock()
+				defer client.mutex.RUnlock()
+				Expect(client.extendedConnectEnabled).To(BeTrue())
+			})
+
+			It("doesn't use the default settings if the server sends other frames first", func() {
+				var headers bytes.Buffer
+				hpack.NewEncoder(&headers).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				go client.handleHeaderStream()
+				Eventually(client.responses[23]).Should(Receive())
+				// the server only sends its SETTINGS in response to the SETTINGS of the client
+				Consistently(client.settingsReceived).ShouldNot(BeClosed())
+			})
+
+			It("errors if the value of SETTINGS_ENABLE_CONNECT_PROTOCOL is invalid", func() {
+				Expect(h2framer.WriteSettings(http2.Setting{ID: settingEnableConnectProtocol, Val: 2})).To(Succeed())
+				client.handleHeaderStream()
+				Expect(client.headerErrored).To(BeClosed())
+				Expect(client.headerErr).To(MatchError(qerr.Error(qerr.InvalidHeadersStreamData, "invalid value for SETTINGS_ENABLE_CONNECT_PROTOCOL: 2")))
+			})
+
 			It("errors if the H2 frame is not a HeadersFrame", func() {
 				h2framer.WritePing(true, [8]byte{0, 0, 0, 0, 0, 0, 0, 0})
 				client.handleHeaderStream()
@@ -634,5 +840,323 @@ var _ = Describe("Client", func() {
 				Expect(client.headerErr.ErrorMessage).To(ContainSubstring("response channel for stream 1337 not found"))
 			})
 		})
+
+		Context("CONNECT requests", func() {
+			var connectReq *http.Request
+
+			BeforeEach(func() {
+				var err error
+				connectReq, err = http.NewRequest("CONNECT", "https://quic.clemente.io:1337", nil)
+				Expect(err).ToNot(HaveOccurred())
+				connectReq.Host = "www.example.org:443"
+				// fake a handshake
+				client.dialOnce.Do(func() {})
+				client.peerStreams = newPeerStreams(session, nil)
+				session.streamsToOpen = []quic.Stream{dataStream}
+			})
+
+			It("returns the data stream as a net.Conn", func() {
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(connectReq)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				injectResponse(5, &http.Response{StatusCode: 200})
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.Body).To(BeAssignableToTypeOf(&streamConn{}))
+				conn := rsp.Body.(net.Conn)
+				Expect(conn.LocalAddr()).To(Equal(session.LocalAddr()))
+				Expect(conn.RemoteAddr()).To(Equal(session.RemoteAddr()))
+				// the header stream and the streams of promised responses are used by h2quic
+				acceptor := conn.(interface {
+					AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+				})
+				_, err := acceptor.AcceptAnnouncedStream(context.Background(), headerStream.StreamID())
+				Expect(err).To(MatchError(ContainSubstring("is already in use")))
+				client.mutex.Lock()
+				client.getPushPromise(4).promised = true
+				client.mutex.Unlock()
+				_, err = acceptor.AcceptAnnouncedStream(context.Background(), 4)
+				Expect(err).To(MatchError("h2quic: stream 4 is already in use"))
+				// other streams are only used once the server opened them
+				strChan := make(chan quic.Stream, 1)
+				go func() {
+					defer GinkgoRecover()
+					str, err := acceptor.AcceptAnnouncedStream(context.Background(), 2)
+					Expect(err).ToNot(HaveOccurred())
+					strChan <- str
+				}()
+				Consistently(strChan).ShouldNot(Receive())
+				session.streamToAccept = newMockStream(2)
+				go client.peerStreams.run()
+				Eventually(strChan).Should(Receive())
+				_, err = conn.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+				// the stream is not ended by the request
+				hframe := getRequest()
+				Expect(hframe.StreamEnded()).To(BeFalse())
+				fields := getHeaderFields(hframe)
+				Expect(fields).To(HaveKeyWithValue(":authority", "www.example.org:443"))
+				Expect(fields).ToNot(HaveKey(":path"))
+				Expect(fields).ToNot(HaveKey("accept-encoding"))
+				// the tunnel is an active request until it is closed
+				Expect(client.activeRequests).To(Equal(1))
+				Expect(conn.Close()).To(Succeed())
+				Expect(client.activeRequests).To(BeZero())
+				Expect(dataStream.closed).To(BeTrue())
+			})
+
+			Context("extended CONNECT", func() {
+				BeforeEach(func() {
+					var err error
+					connectReq, err = http.NewRequest("CONNECT", "https://quic.clemente.io:1337/chat", nil)
+					Expect(err).ToNot(HaveOccurred())
+					connectReq.Proto = "websocket"
+				})
+
+				receiveSettings := func(extendedConnect bool) {
+					client.mutex.Lock()
+					client.extendedConnectEnabled = extendedConnect
+					client.setSettingsReceived()
+					client.mutex.Unlock()
+				}
+
+				It("waits for the settings of the server", func() {
+					rspChan := make(chan *http.Response)
+					go func() {
+						defer GinkgoRecover()
+						rsp, err := client.RoundTrip(connectReq)
+						Expect(err).ToNot(HaveOccurred())
+						rspChan <- rsp
+					}()
+					Consistently(func() int {
+						client.mutex.Lock()
+						defer client.mutex.Unlock()
+						return len(client.responses)
+					}).Should(BeZero())
+					// the client sends its SETTINGS first
+					Eventually(func() int { return headerStream.dataWritten.Len() }).ShouldNot(BeZero())
+					frame, err := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes())).ReadFrame()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frame).To(BeAssignableToTypeOf(&http2.SettingsFrame{}))
+					val, ok := frame.(*http2.SettingsFrame).Value(http2.SettingEnablePush)
+					Expect(ok).To(BeTrue())
+					Expect(val).To(BeZero())
+					receiveSettings(true)
+					injectResponse(5, &http.Response{StatusCode: 200})
+					var rsp *http.Response
+					Eventually(rspChan).Should(Receive(&rsp))
+					Expect(rsp.Body).To(BeAssignableToTypeOf(&streamConn{}))
+					hframe := getRequest()
+					Expect(hframe.StreamEnded()).To(BeFalse())
+					fields := getHeaderFields(hframe)
+					Expect(fields).To(HaveKeyWithValue(":protocol", "websocket"))
+					Expect(fields).To(HaveKeyWithValue(":path", "/chat"))
+				})
+
+				It("errors if the server doesn't support extended CONNECT", func() {
+					receiveSettings(false)
+					_, err := client.RoundTrip(connectReq)
+					Expect(err).To(MatchError(ErrExtendedConnectNotSupported))
+					Expect(client.activeRequests).To(BeZero())
+				})
+
+				It("only sends its SETTINGS once", func() {
+					receiveSettings(false)
+					_, err := client.RoundTrip(connectReq)
+					Expect(err).To(MatchError(ErrExtendedConnectNotSupported))
+					settingsLen := headerStream.dataWritten.Len()
+					Expect(settingsLen).ToNot(BeZero())
+					_, err = client.RoundTrip(connectReq)
+					Expect(err).To(MatchError(ErrExtendedConnectNotSupported))
+					Expect(headerStream.dataWritten.Len()).To(Equal(settingsLen))
+				})
+
+				It("stops waiting for the settings when the request is canceled", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					errChan := make(chan error)
+					go func() {
+						_, err := client.RoundTrip(connectReq.WithContext(ctx))
+						errChan <- err
+					}()
+					Consistently(errChan).ShouldNot(Receive())
+					cancel()
+					Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+				})
+			})
+
+			It("returns the response before the request body was sent", func() {
+				pr, pw := io.Pipe()
+				defer pw.Close()
+				connectReq.Body = pr
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(connectReq)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				injectResponse(5, &http.Response{StatusCode: 200})
+				Eventually(rspChan).Should(Receive())
+				_, err := pw.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() []byte { return dataStream.dataWritten.Bytes() }).Should(Equal([]byte("foobar")))
+			})
+		})
+
+		Context("connection management", func() {
+			doRequest := func() *http.Response {
+				var rsp *http.Response
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					var err error
+					rsp, err = client.roundTrip(request, false)
+					Expect(err).ToNot(HaveOccurred())
+					close(done)
+				}()
+				injectResponse(5, &http.Response{})
+				Eventually(done).Should(BeClosed())
+				return rsp
+			}
+
+			activeRequests := func() int {
+				client.mutex.Lock()
+				defer client.mutex.Unlock()
+				return client.activeRequests
+			}
+
+			It("counts a request as active until the body is closed", func() {
+				rsp := doRequest()
+				Expect(activeRequests()).To(Equal(1))
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(activeRequests()).To(BeZero())
+			})
+
+			It("counts a request as active until the body is read completely", func() {
+				dataStream.dataToRead.Write([]byte("foobar"))
+				close(dataStream.unblockRead)
+				rsp := doRequest()
+				Expect(activeRequests()).To(Equal(1))
+				body, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foobar")))
+				Expect(activeRequests()).To(BeZero())
+			})
+
+			It("returns errStreamLimitReached if the stream limit is reached", func() {
+				client.dialOnce.Do(func() {}) // don't dial
+				session.streamOpenErr = qerr.TooManyOpenStreams
+				_, err := client.roundTrip(request, false)
+				Expect(err).To(MatchError(errStreamLimitReached))
+				Expect(client.canTakeNewRequest()).To(BeFalse())
+				Expect(activeRequests()).To(BeZero())
+				Expect(session.closed).To(BeFalse())
+			})
+
+			It("can take new requests after a request finished", func() {
+				rsp := doRequest()
+				client.mutex.Lock()
+				client.streamLimitReached = true
+				client.mutex.Unlock()
+				Expect(client.canTakeNewRequest()).To(BeFalse())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(client.canTakeNewRequest()).To(BeTrue())
+			})
+
+			It("returns errClientClosed if the client was closed", func() {
+				client.dialOnce.Do(func() {}) // don't dial
+				Expect(client.Close()).To(Succeed())
+				_, err := client.roundTrip(request, false)
+				Expect(err).To(MatchError(errClientClosed))
+				Expect(client.canTakeNewRequest()).To(BeFalse())
+			})
+
+			It("doesn't dial if the client was closed before it was used", func() {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+					Fail("didn't expect a dial")
+					return nil, nil
+				}
+				client.session = nil
+				Expect(client.Close()).To(Succeed())
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(errClientClosed))
+			})
+
+			It("is done when the handshake fails", func() {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+					return nil, errors.New("handshake failed")
+				}
+				_, err := client.RoundTrip(request)
+				Expect(err).To(HaveOccurred())
+				Expect(client.done()).To(BeClosed())
+				Expect(client.canTakeNewRequest()).To(BeFalse())
+			})
+
+			It("is done when the session is closed", func() {
+				doRequest()
+				Expect(client.done()).ToNot(BeClosed())
+				session.ctxCancel()
+				Eventually(client.done()).Should(BeClosed())
+			})
+
+			It("is done when an error occurs on the header stream", func() {
+				doRequest()
+				Expect(client.done()).ToNot(BeClosed())
+				close(headerStream.unblockRead)
+				Eventually(client.done()).Should(BeClosed())
+			})
+
+			It("closes the connection when it was idle for the IdleTimeout", func() {
+				client.opts.IdleTimeout = 50 * time.Millisecond
+				rsp := doRequest()
+				Consistently(client.done(), 100*time.Millisecond).ShouldNot(BeClosed())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Eventually(client.done()).Should(BeClosed())
+				Expect(session.closed).To(BeTrue())
+			})
+
+			It("only closes idle connections", func() {
+				rsp := doRequest()
+				Expect(client.closeIfIdle()).To(BeFalse())
+				Expect(session.closed).To(BeFalse())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(client.closeIfIdle()).To(BeTrue())
+				Expect(session.closed).To(BeTrue())
+				Expect(client.done()).To(BeClosed())
+			})
+
+			Context("coalescing", func() {
+				BeforeEach(func() {
+					cert, err := x509.ParseCertificate(testdata.GetCertificate().Certificate[0])
+					Expect(err).ToNot(HaveOccurred())
+					session.connectionState.PeerCertificates = []*x509.Certificate{cert}
+				})
+
+				It("doesn't coalesce before the connection is established", func() {
+					Expect(client.canCoalesce("quic.clemente.io:1337")).To(BeFalse())
+				})
+
+				It("coalesces if the certificate is valid for the host", func() {
+					doRequest()
+					Expect(client.canCoalesce("quic.clemente.io:1337")).To(BeTrue())
+					Expect(client.remoteIP()).To(Equal(net.IP{127, 0, 0, 1}))
+				})
+
+				It("doesn't coalesce if the certificate is not valid for the host", func() {
+					doRequest()
+					Expect(client.canCoalesce("quic.example.org:1337")).To(BeFalse())
+				})
+
+				It("doesn't coalesce if the port is different", func() {
+					doRequest()
+					Expect(client.canCoalesce("quic.clemente.io:443")).To(BeFalse())
+				})
+			})
+		})
 	})
 })
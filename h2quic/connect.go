@@ -0,0 +1,50 @@
+package h2quic
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Connect establishes a tunnel to the target (host:port) through a proxy, using a CONNECT request.
+// The proxy is the address (host:port) of a h2quic server.
+// The returned net.Conn reads from and writes to the data stream of the request.
+// Canceling the context after Connect returned doesn't affect the tunnel.
+func (r *RoundTripper) Connect(ctx context.Context, proxy, target string) (net.Conn, error) {
+	return r.connect(ctx, http.MethodConnect, proxy, target)
+}
+
+// ConnectUDP establishes a UDP tunnel to the target (host:port) through a proxy, using a CONNECT-UDP request.
+// Every call to Write on the returned net.Conn sends one datagram, and every call to Read receives one datagram, see NewDatagramConn.
+func (r *RoundTripper) ConnectUDP(ctx context.Context, proxy, target string) (net.Conn, error) {
+	conn, err := r.connect(ctx, MethodConnectUDP, proxy, target)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatagramConn(conn), nil
+}
+
+func (r *RoundTripper) connect(ctx context.Context, method, proxy, target string) (net.Conn, error) {
+	req := &http.Request{
+		Method: method,
+		URL:    &url.URL{Scheme: "https", Host: proxy},
+		Host:   target,
+		Header: http.Header{},
+	}
+	rsp, err := r.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("h2quic: %s %s failed: %s", method, target, rsp.Status)
+	}
+	conn, ok := rsp.Body.(net.Conn)
+	if !ok {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("h2quic: %s response doesn't have a data stream", method)
+	}
+	return conn, nil
+}
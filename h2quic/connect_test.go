@@ -0,0 +1,75 @@
+package h2quic
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CONNECT", func() {
+	var (
+		rt       *RoundTripper
+		cl       *mockClient
+		stream   *mockStream
+		response *http.Response
+	)
+
+	BeforeEach(func() {
+		stream = newMockStream(5)
+		response = &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Body:       newStreamConn(stream, &net.UDPAddr{}, &net.UDPAddr{}, nil),
+		}
+		cl = newMockClient()
+		cl.response = response
+		rt = &RoundTripper{
+			createClient: func(authority string) pooledClient {
+				Expect(authority).To(Equal("proxy.example.org:443"))
+				return cl
+			},
+		}
+	})
+
+	It("establishes a tunnel", func() {
+		conn, err := rt.Connect(context.Background(), "proxy.example.org:443", "www.example.org:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn).To(Equal(response.Body))
+		Expect(cl.requests).To(HaveLen(1))
+		req := cl.requests[0]
+		Expect(req.Method).To(Equal(http.MethodConnect))
+		Expect(req.Host).To(Equal("www.example.org:443"))
+		Expect(req.URL.Host).To(Equal("proxy.example.org:443"))
+	})
+
+	It("establishes a UDP tunnel", func() {
+		conn, err := rt.ConnectUDP(context.Background(), "proxy.example.org:443", "8.8.8.8:53")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn).To(BeAssignableToTypeOf(&datagramConn{}))
+		Expect(cl.requests[0].Method).To(Equal(MethodConnectUDP))
+		Expect(cl.requests[0].Host).To(Equal("8.8.8.8:53"))
+		_, err = conn.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.dataWritten.Bytes()).To(Equal(append([]byte{6}, []byte("foobar")...)))
+	})
+
+	It("uses the context", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := rt.Connect(ctx, "proxy.example.org:443", "www.example.org:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.requests[0].Context()).To(Equal(ctx))
+	})
+
+	It("errors if the proxy doesn't establish the tunnel", func() {
+		response.StatusCode = 502
+		response.Status = "502 Bad Gateway"
+		_, err := rt.Connect(context.Background(), "proxy.example.org:443", "www.example.org:443")
+		Expect(err).To(MatchError("h2quic: CONNECT www.example.org:443 failed: 502 Bad Gateway"))
+		Expect(stream.closed).To(BeTrue())
+		Expect(stream.reset).To(BeTrue())
+	})
+})
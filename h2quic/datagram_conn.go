@@ -0,0 +1,89 @@
+package h2quic
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// maxDatagramSize is the maximum size of a UDP payload
+const maxDatagramSize = 65527
+
+var errDatagramTooLarge = errors.New("h2quic: datagram too large")
+
+// A datagramConn sends and receives datagrams on a net.Conn that transports a byte stream.
+// Every datagram is prefixed with its length, encoded as a QUIC variable-length integer.
+type datagramConn struct {
+	net.Conn
+
+	readMutex sync.Mutex
+	reader    *bufio.Reader
+
+	writeMutex sync.Mutex
+	writeBuf   bytes.Buffer
+}
+
+// NewDatagramConn returns a net.Conn that sends and receives datagrams on a tunnel established by a CONNECT-UDP request.
+// Every call to Write sends one datagram, and every call to Read receives one datagram.
+// If the buffer passed to Read is too small for the datagram, the rest of the datagram is discarded, as for a UDP socket.
+// On the server side, conn is the net.Conn returned by Hijack. On the client side, RoundTripper.ConnectUDP already returns a datagram conn.
+func NewDatagramConn(conn net.Conn) net.Conn {
+	return &datagramConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *datagramConn) Read(p []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	l, err := utils.ReadVarInt(c.reader)
+	if err != nil {
+		return 0, err
+	}
+	if l > maxDatagramSize {
+		return 0, fmt.Errorf("h2quic: received a datagram of %d bytes", l)
+	}
+	n := int(l)
+	if n > len(p) {
+		n = len(p)
+	}
+	if _, err := io.ReadFull(c.reader, p[:n]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if _, err := c.reader.Discard(int(l) - n); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return n, nil
+}
+
+func (c *datagramConn) Write(p []byte) (int, error) {
+	if len(p) > maxDatagramSize {
+		return 0, errDatagramTooLarge
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.writeBuf.Reset()
+	utils.WriteVarInt(&c.writeBuf, uint64(len(p)))
+	c.writeBuf.Write(p)
+	if _, err := c.Conn.Write(c.writeBuf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// a stream that ends in the middle of a datagram is an error
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package h2quic
+
+import (
+	"bytes"
+	"io"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A bufferConn is a net.Conn that writes to and reads from a buffer
+type bufferConn struct {
+	net.Conn
+	bytes.Buffer
+}
+
+func (c *bufferConn) Read(p []byte) (int, error)  { return c.Buffer.Read(p) }
+func (c *bufferConn) Write(p []byte) (int, error) { return c.Buffer.Write(p) }
+
+var _ = Describe("Datagram conn", func() {
+	var (
+		stream *bufferConn
+		conn   net.Conn
+	)
+
+	BeforeEach(func() {
+		stream = &bufferConn{}
+		conn = NewDatagramConn(stream)
+	})
+
+	It("sends and receives datagrams", func() {
+		_, err := conn.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = conn.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		b := make([]byte, 100)
+		n, err := conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foo")))
+		n, err = conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+		_, err = conn.Read(b)
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("prefixes datagrams with the length", func() {
+		data := bytes.Repeat([]byte{'a'}, 100)
+		n, err := conn.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(100))
+		l, err := utils.ReadVarInt(&stream.Buffer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(l).To(BeEquivalentTo(100))
+		Expect(stream.Bytes()).To(Equal(data))
+	})
+
+	It("sends empty datagrams", func() {
+		_, err := conn.Write(nil)
+		Expect(err).ToNot(HaveOccurred())
+		n, err := conn.Read(make([]byte, 10))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeZero())
+	})
+
+	It("discards the rest of a datagram that doesn't fit into the buffer", func() {
+		conn.Write([]byte("foobar"))
+		conn.Write([]byte("raboof"))
+		b := make([]byte, 3)
+		n, err := conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foo")))
+		n, err = conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("rab")))
+	})
+
+	It("refuses to send too large datagrams", func() {
+		_, err := conn.Write(make([]byte, maxDatagramSize+1))
+		Expect(err).To(MatchError(errDatagramTooLarge))
+		Expect(stream.Len()).To(BeZero())
+	})
+
+	It("errors when receiving too large datagrams", func() {
+		utils.WriteVarInt(&stream.Buffer, maxDatagramSize+1)
+		_, err := conn.Read(make([]byte, 10))
+		Expect(err).To(MatchError("h2quic: received a datagram of 65528 bytes"))
+	})
+
+	It("errors if the stream ends in the middle of a datagram", func() {
+		utils.WriteVarInt(&stream.Buffer, 10)
+		stream.Write([]byte("foo"))
+		_, err := conn.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+})
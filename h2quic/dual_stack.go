@@ -0,0 +1,270 @@
+package h2quic
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const defaultBrokenQUICTimeout = 5 * time.Minute
+
+// DualStackRoundTripper implements the http.RoundTripper interface.
+// It sends requests over TCP (using HTTP/2, if supported by the server),
+// until the server announces QUIC support in an Alt-Svc header field (as set by Server.SetQuicHeaders).
+// Subsequent requests to the same origin are then sent over QUIC.
+// If the QUIC handshake fails, the request is sent over TCP, and QUIC is not used for this origin for the BrokenQUICTimeout.
+type DualStackRoundTripper struct {
+	// TLSClientConfig specifies the TLS configuration to use for QUIC and for TCP connections.
+	// If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// QuicConfig is the quic.Config used for dialing new QUIC connections.
+	// If nil, reasonable default values will be used.
+	// The HandshakeTimeout determines how long it takes to detect that QUIC is blocked.
+	QuicConfig *quic.Config
+
+	// TCP is the http.RoundTripper used for requests sent over TCP.
+	// If nil, a http.Transport that supports HTTP/2 is used.
+	TCP http.RoundTripper
+
+	// BrokenQUICTimeout is the time that QUIC is not used for an origin after a QUIC handshake failed.
+	// If zero, a timeout of 5 minutes is used.
+	BrokenQUICTimeout time.Duration
+
+	initOnce sync.Once
+	quic     roundTripCloser
+	tcp      http.RoundTripper
+
+	mutex   sync.Mutex
+	altSvcs map[string]*altSvcCacheEntry // the origin is the key
+	broken  map[string]time.Time         // origins for which the QUIC handshake failed
+}
+
+var _ roundTripCloser = &DualStackRoundTripper{}
+
+type altSvcCacheEntry struct {
+	authority string
+	expires   time.Time
+}
+
+// A quicHandshakeError is returned by the dial function of the QUIC RoundTripper.
+// It tells the DualStackRoundTripper that the request can be sent over TCP.
+type quicHandshakeError struct {
+	err error
+}
+
+func (e *quicHandshakeError) Error() string { return e.err.Error() }
+
+func (r *DualStackRoundTripper) init() {
+	r.initOnce.Do(func() {
+		r.altSvcs = make(map[string]*altSvcCacheEntry)
+		r.broken = make(map[string]time.Time)
+		if r.quic == nil {
+			r.quic = &RoundTripper{
+				TLSClientConfig: r.TLSClientConfig,
+				QuicConfig:      r.QuicConfig,
+				Dial:            r.dialQUIC,
+			}
+		}
+		r.tcp = r.TCP
+		if r.tcp == nil {
+			r.tcp = newTCPTransport(r.TLSClientConfig)
+		}
+	})
+}
+
+func newTCPTransport(tlsConf *tls.Config) http.RoundTripper {
+	if tlsConf == nil {
+		return http.DefaultTransport
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       tlsConf.Clone(),
+		TLSHandshakeTimeout:   10 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	// setting a TLSClientConfig disables HTTP/2 in the http.Transport
+	if err := http2.ConfigureTransport(t); err != nil {
+		utils.Errorf("could not enable HTTP/2 for TCP: %s", err.Error())
+	}
+	return t
+}
+
+// RoundTrip sends a request, either over QUIC or over TCP
+func (r *DualStackRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.init()
+	if req.URL == nil || req.URL.Scheme != "https" {
+		return r.tcp.RoundTrip(req)
+	}
+
+	origin := authorityAddr("https", hostnameFromRequest(req))
+	if r.useQUIC(origin) {
+		rsp, err := r.quic.RoundTrip(req)
+		if err == nil {
+			r.handleAltSvc(origin, rsp.Header)
+			return rsp, nil
+		}
+		if _, ok := err.(*quicHandshakeError); !ok {
+			return nil, err
+		}
+		// The request wasn't sent, so it can be sent over TCP.
+		utils.Infof("QUIC handshake with %s failed, falling back to TCP: %s", origin, err.Error())
+		r.mutex.Lock()
+		r.broken[origin] = time.Now().Add(r.brokenQUICTimeout())
+		r.mutex.Unlock()
+	}
+	rsp, err := r.tcp.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	r.handleAltSvc(origin, rsp.Header)
+	return rsp, nil
+}
+
+// useQUIC says if a fresh alternative service is known for an origin, and QUIC is not broken
+func (r *DualStackRoundTripper) useQUIC(origin string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	if brokenUntil, ok := r.broken[origin]; ok {
+		if now.Before(brokenUntil) {
+			return false
+		}
+		delete(r.broken, origin)
+	}
+	entry, ok := r.altSvcs[origin]
+	if !ok {
+		return false
+	}
+	if !now.Before(entry.expires) {
+		delete(r.altSvcs, origin)
+		return false
+	}
+	return true
+}
+
+// handleAltSvc updates the alternative service of an origin.
+// As defined in RFC 7838, section 3, the alternatives received in a response replace all alternatives that were cached before.
+func (r *DualStackRoundTripper) handleAltSvc(origin string, hdr http.Header) {
+	values, ok := hdr["Alt-Svc"]
+	if !ok {
+		return
+	}
+	services, clear := parseAltSvc(strings.Join(values, ","))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.altSvcs, origin)
+	if clear {
+		return
+	}
+	for _, svc := range services {
+		if svc.ProtocolID != "quic" || !r.supportsVersions(svc.Versions) {
+			continue
+		}
+		r.altSvcs[origin] = &altSvcCacheEntry{
+			authority: svc.Authority,
+			expires:   time.Now().Add(svc.MaxAge),
+		}
+		return
+	}
+}
+
+// supportsVersions says if one of the versions announced in the v parameter is supported
+func (r *DualStackRoundTripper) supportsVersions(versions []string) bool {
+	// no v parameter
+	if len(versions) == 0 {
+		return true
+	}
+	supported := protocol.SupportedVersions
+	if r.QuicConfig != nil && len(r.QuicConfig.Versions) > 0 {
+		supported = r.QuicConfig.Versions
+	}
+	for _, v := range versions {
+		for _, s := range supported {
+			if strings.TrimSpace(v) == s.ToAltSvc() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// alternativeAddr returns the address of the alternative service of an origin
+func (r *DualStackRoundTripper) alternativeAddr(origin string) string {
+	r.mutex.Lock()
+	entry, ok := r.altSvcs[origin]
+	r.mutex.Unlock()
+	if !ok {
+		return origin
+	}
+	host, port, err := net.SplitHostPort(entry.authority)
+	if err != nil {
+		return origin
+	}
+	// an empty host means that the alternative service is on the host of the origin
+	if host == "" {
+		host, _, _ = net.SplitHostPort(origin)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// dialQUIC dials the alternative service of an origin
+func (r *DualStackRoundTripper) dialQUIC(network, origin string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+	// the certificate must be valid for the origin, not for the alternative service
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
+	} else {
+		tlsConf = tlsConf.Clone()
+	}
+	if tlsConf.ServerName == "" {
+		host, _, err := net.SplitHostPort(origin)
+		if err != nil {
+			return nil, &quicHandshakeError{err}
+		}
+		tlsConf.ServerName = host
+	}
+	sess, err := dialAddr(r.alternativeAddr(origin), tlsConf, config)
+	if err != nil {
+		return nil, &quicHandshakeError{err}
+	}
+	return sess, nil
+}
+
+func (r *DualStackRoundTripper) brokenQUICTimeout() time.Duration {
+	if r.BrokenQUICTimeout > 0 {
+		return r.BrokenQUICTimeout
+	}
+	return defaultBrokenQUICTimeout
+}
+
+// CloseIdleConnections closes the QUIC and TCP connections that don't have any active requests.
+// TCP connections are only closed if the TCP RoundTripper supports it.
+func (r *DualStackRoundTripper) CloseIdleConnections() {
+	r.init()
+	for _, rt := range []http.RoundTripper{r.tcp, r.quic} {
+		if t, ok := rt.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+	}
+}
+
+// Close closes the QUIC connections that this DualStackRoundTripper has used.
+// Idle TCP connections are closed, if the TCP RoundTripper supports it.
+func (r *DualStackRoundTripper) Close() error {
+	r.init()
+	if t, ok := r.tcp.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+	return r.quic.Close()
+}
@@ -0,0 +1,254 @@
+package h2quic
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockRoundTripper struct {
+	requests        []*http.Request
+	response        *http.Response
+	err             error
+	closed          bool
+	closedIdleConns bool
+}
+
+func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
+	}
+	rsp := &http.Response{Request: req, Header: http.Header{}}
+	if m.response != nil {
+		*rsp = *m.response
+	}
+	return rsp, nil
+}
+
+func (m *mockRoundTripper) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *mockRoundTripper) CloseIdleConnections() {
+	m.closedIdleConns = true
+}
+
+var _ = Describe("DualStackRoundTripper", func() {
+	var (
+		rt      *DualStackRoundTripper
+		tcp     *mockRoundTripper
+		quicRT  *mockRoundTripper
+		req     *http.Request
+		version = protocol.SupportedVersions[0].ToAltSvc()
+	)
+
+	altSvcResponse := func(altSvc string) *http.Response {
+		return &http.Response{Header: http.Header{"Alt-Svc": []string{altSvc}}}
+	}
+
+	BeforeEach(func() {
+		tcp = &mockRoundTripper{}
+		quicRT = &mockRoundTripper{}
+		rt = &DualStackRoundTripper{
+			TCP:  tcp,
+			quic: quicRT,
+		}
+		var err error
+		req, err = http.NewRequest("GET", "https://www.example.org/file.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("uses TCP if no alternative service is known", func() {
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(1))
+		Expect(quicRT.requests).To(BeEmpty())
+	})
+
+	It("uses TCP for plain HTTP requests", func() {
+		req.URL.Scheme = "http"
+		tcp.response = altSvcResponse(`quic=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(2))
+		Expect(quicRT.requests).To(BeEmpty())
+	})
+
+	It("switches to QUIC after an Alt-Svc header was received", func() {
+		tcp.response = altSvcResponse(`quic=":443"; ma=2592000; v="` + version + `"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(1))
+		Expect(quicRT.requests).To(HaveLen(1))
+	})
+
+	It("only uses the alternative service for the same origin", func() {
+		tcp.response = altSvcResponse(`quic=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		req2, err := http.NewRequest("GET", "https://www.example.org:8443/file.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(2))
+		Expect(quicRT.requests).To(BeEmpty())
+	})
+
+	It("ignores alternative services with unsupported versions", func() {
+		tcp.response = altSvcResponse(`quic=":443"; v="1,2"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(2))
+	})
+
+	It("ignores alternative services for other protocols", func() {
+		tcp.response = altSvcResponse(`h2=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(2))
+	})
+
+	It("doesn't use expired alternative services", func() {
+		tcp.response = altSvcResponse(`quic=":443"; ma=0`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		tcp.response = nil
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcp.requests).To(HaveLen(2))
+		Expect(rt.altSvcs).To(BeEmpty())
+	})
+
+	It("clears the alternative services", func() {
+		tcp.response = altSvcResponse(`quic=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		quicRT.response = altSvcResponse("clear")
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicRT.requests).To(HaveLen(1))
+		Expect(tcp.requests).To(HaveLen(2))
+	})
+
+	It("falls back to TCP if the QUIC handshake fails", func() {
+		rt.BrokenQUICTimeout = 100 * time.Millisecond
+		tcp.response = altSvcResponse(`quic=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		quicRT.err = &quicHandshakeError{errors.New("handshake timeout")}
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicRT.requests).To(HaveLen(1))
+		Expect(tcp.requests).To(HaveLen(2))
+		// QUIC is not used until the BrokenQUICTimeout expires
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicRT.requests).To(HaveLen(1))
+		Expect(tcp.requests).To(HaveLen(3))
+		time.Sleep(150 * time.Millisecond)
+		quicRT.err = nil
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicRT.requests).To(HaveLen(2))
+	})
+
+	It("returns errors that occur after the QUIC handshake", func() {
+		testErr := errors.New("test err")
+		tcp.response = altSvcResponse(`quic=":443"`)
+		_, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		quicRT.err = testErr
+		_, err = rt.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+		Expect(tcp.requests).To(HaveLen(1))
+	})
+
+	It("returns errors from TCP", func() {
+		testErr := errors.New("test err")
+		tcp.err = testErr
+		_, err := rt.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("closes the QUIC RoundTripper", func() {
+		Expect(rt.Close()).To(Succeed())
+		Expect(quicRT.closed).To(BeTrue())
+	})
+
+	It("closes idle connections", func() {
+		rt.CloseIdleConnections()
+		Expect(tcp.closedIdleConns).To(BeTrue())
+		Expect(quicRT.closedIdleConns).To(BeTrue())
+		Expect(quicRT.closed).To(BeFalse())
+	})
+
+	Context("dialing", func() {
+		origDialAddr := dialAddr
+
+		AfterEach(func() {
+			dialAddr = origDialAddr
+		})
+
+		It("dials the alternative service, using the hostname of the origin for TLS", func() {
+			tcp.response = altSvcResponse(`quic="alt.example.org:8443"`)
+			_, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			sess := &mockSession{}
+			var dialedAddr, serverName string
+			dialAddr = func(addr string, tlsConf *tls.Config, _ *quic.Config) (quic.Session, error) {
+				dialedAddr = addr
+				serverName = tlsConf.ServerName
+				return sess, nil
+			}
+			tlsConf := &tls.Config{}
+			s, err := rt.dialQUIC("udp", "www.example.org:443", tlsConf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(sess))
+			Expect(dialedAddr).To(Equal("alt.example.org:8443"))
+			Expect(serverName).To(Equal("www.example.org"))
+			Expect(tlsConf.ServerName).To(BeEmpty())
+		})
+
+		It("dials the host of the origin if the alternative service doesn't specify a host", func() {
+			tcp.response = altSvcResponse(`quic=":8443"`)
+			_, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			var dialedAddr string
+			dialAddr = func(addr string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				dialedAddr = addr
+				return &mockSession{}, nil
+			}
+			_, err = rt.dialQUIC("udp", "www.example.org:443", nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialedAddr).To(Equal("www.example.org:8443"))
+		})
+
+		It("returns a quicHandshakeError if dialing fails", func() {
+			testErr := errors.New("test err")
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+				return nil, testErr
+			}
+			_, err := rt.dialQUIC("udp", "www.example.org:443", nil, nil)
+			Expect(err).To(Equal(&quicHandshakeError{testErr}))
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package h2quic
+
+import (
+	"fmt"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// maxHeaderFragmentSize is the maximum size of the header block fragment sent in a single HEADERS or CONTINUATION frame.
+// Larger header blocks are split into multiple frames.
+// It is the default value of SETTINGS_MAX_FRAME_SIZE in HTTP/2.
+const maxHeaderFragmentSize = 16384
+
+// settingEnableConnectProtocol is SETTINGS_ENABLE_CONNECT_PROTOCOL, as defined in RFC 8441.
+// A server sets it to 1 to announce that it supports extended CONNECT requests (requests with a :protocol pseudo-header).
+const settingEnableConnectProtocol http2.SettingID = 0x8
+
+// A headerBlockFrame is a frame that carries (a fragment of) a header block, i.e. a HEADERS, PUSH_PROMISE or CONTINUATION frame.
+type headerBlockFrame interface {
+	http2.Frame
+	HeaderBlockFragment() []byte
+	HeadersEnded() bool
+}
+
+var _ headerBlockFrame = &http2.HeadersFrame{}
+var _ headerBlockFrame = &http2.PushPromiseFrame{}
+var _ headerBlockFrame = &http2.ContinuationFrame{}
+
+// readHeaderBlock decodes the header block that is started by a HEADERS or PUSH_PROMISE frame.
+// If the header block doesn't end in this frame, the CONTINUATION frames following it are read from the framer.
+// Note that the framer only accepts CONTINUATION frames following HEADERS frames.
+// If the size of the header list (as defined in RFC 7540, section 6.5.2) exceeds maxHeaderListSize,
+// the remaining header fields are dropped, and tooLarge is set.
+// A maxHeaderListSize of 0 means that the size of the header list is not limited.
+func readHeaderBlock(h2framer *http2.Framer, decoder *hpack.Decoder, frame headerBlockFrame, maxHeaderListSize uint32) (fields []hpack.HeaderField, tooLarge bool, err error) {
+	var size uint32
+	decoder.SetMaxStringLength(int(maxHeaderListSize))
+	decoder.SetEmitFunc(func(hf hpack.HeaderField) {
+		size += hf.Size()
+		if maxHeaderListSize > 0 && size > maxHeaderListSize {
+			tooLarge = true
+			// the rest of the header block still needs to be decoded, in order to keep the HPACK state in sync
+			decoder.SetEmitEnabled(false)
+			return
+		}
+		fields = append(fields, hf)
+	})
+	defer func() {
+		decoder.SetEmitEnabled(true)
+		decoder.SetEmitFunc(func(hpack.HeaderField) {})
+	}()
+
+	streamID := frame.Header().StreamID
+	for {
+		if _, err := decoder.Write(frame.HeaderBlockFragment()); err != nil {
+			return nil, false, err
+		}
+		if frame.HeadersEnded() {
+			break
+		}
+		// The framer makes sure that a CONTINUATION frame for the same stream follows.
+		f, err := h2framer.ReadFrame()
+		if err != nil {
+			return nil, false, err
+		}
+		cont, ok := f.(*http2.ContinuationFrame)
+		if !ok || cont.StreamID != streamID {
+			return nil, false, fmt.Errorf("expected a CONTINUATION frame for stream %d", streamID)
+		}
+		frame = cont
+	}
+	if err := decoder.Close(); err != nil {
+		return nil, false, err
+	}
+	return fields, tooLarge, nil
+}
+
+// writeHeaders writes a HEADERS frame.
+// If the header block is too large for a single frame, it is split, and the rest is sent in CONTINUATION frames.
+// The caller must make sure that no other frames are written to the header stream at the same time.
+func writeHeaders(h2framer *http2.Framer, p http2.HeadersFrameParam) error {
+	var rest []byte
+	p.BlockFragment, rest = splitHeaderBlock(p.BlockFragment)
+	p.EndHeaders = len(rest) == 0
+	if err := h2framer.WriteHeaders(p); err != nil {
+		return err
+	}
+	return writeContinuations(h2framer, p.StreamID, rest)
+}
+
+func writeContinuations(h2framer *http2.Framer, streamID uint32, block []byte) error {
+	for len(block) > 0 {
+		var fragment []byte
+		fragment, block = splitHeaderBlock(block)
+		if err := h2framer.WriteContinuation(streamID, len(block) == 0, fragment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitHeaderBlock(block []byte) (fragment, rest []byte) {
+	if len(block) <= maxHeaderFragmentSize {
+		return block, nil
+	}
+	return block[:maxHeaderFragmentSize], block[maxHeaderFragmentSize:]
+}
@@ -0,0 +1,152 @@
+package h2quic
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header blocks", func() {
+	var (
+		buf     *bytes.Buffer
+		framer  *http2.Framer
+		encoder *hpack.Encoder
+		hbuf    *bytes.Buffer
+		decoder *hpack.Decoder
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		framer = http2.NewFramer(buf, buf)
+		hbuf = &bytes.Buffer{}
+		encoder = hpack.NewEncoder(hbuf)
+		decoder = hpack.NewDecoder(4096, nil)
+	})
+
+	encode := func(fields ...hpack.HeaderField) []byte {
+		hbuf.Reset()
+		for _, hf := range fields {
+			Expect(encoder.WriteField(hf)).To(Succeed())
+		}
+		return append([]byte{}, hbuf.Bytes()...)
+	}
+
+	readHeadersFrame := func() *http2.HeadersFrame {
+		frame, err := framer.ReadFrame()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&http2.HeadersFrame{}))
+		return frame.(*http2.HeadersFrame)
+	}
+
+	largeValue := strings.Repeat("a", 2*maxHeaderFragmentSize)
+
+	Context("writing", func() {
+		It("writes a HEADERS frame", func() {
+			err := writeHeaders(framer, http2.HeadersFrameParam{
+				StreamID:      5,
+				EndStream:     true,
+				BlockFragment: []byte("foobar"),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			frame := readHeadersFrame()
+			Expect(frame.StreamID).To(BeEquivalentTo(5))
+			Expect(frame.HeadersEnded()).To(BeTrue())
+			Expect(frame.StreamEnded()).To(BeTrue())
+			Expect(frame.HeaderBlockFragment()).To(Equal([]byte("foobar")))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("splits large header blocks into CONTINUATION frames", func() {
+			block := bytes.Repeat([]byte{'a'}, 2*maxHeaderFragmentSize+100)
+			err := writeHeaders(framer, http2.HeadersFrameParam{
+				StreamID:      5,
+				BlockFragment: block,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			frame := readHeadersFrame()
+			Expect(frame.HeadersEnded()).To(BeFalse())
+			received := append([]byte{}, frame.HeaderBlockFragment()...)
+			for i := 0; i < 2; i++ {
+				f, err := framer.ReadFrame()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(BeAssignableToTypeOf(&http2.ContinuationFrame{}))
+				cont := f.(*http2.ContinuationFrame)
+				Expect(cont.StreamID).To(BeEquivalentTo(5))
+				Expect(cont.HeadersEnded()).To(Equal(i == 1))
+				received = append(received, cont.HeaderBlockFragment()...)
+			}
+			Expect(received).To(Equal(block))
+			Expect(buf.Len()).To(BeZero())
+		})
+	})
+
+	Context("reading", func() {
+		It("reads a header block in a single frame", func() {
+			block := encode(hpack.HeaderField{Name: ":status", Value: "200"}, hpack.HeaderField{Name: "foo", Value: "bar"})
+			Expect(writeHeaders(framer, http2.HeadersFrameParam{StreamID: 5, BlockFragment: block})).To(Succeed())
+			fields, tooLarge, err := readHeaderBlock(framer, decoder, readHeadersFrame(), 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tooLarge).To(BeFalse())
+			Expect(fields).To(Equal([]hpack.HeaderField{
+				{Name: ":status", Value: "200"},
+				{Name: "foo", Value: "bar"},
+			}))
+		})
+
+		It("reads a header block that spans CONTINUATION frames", func() {
+			block := encode(hpack.HeaderField{Name: ":status", Value: "200"}, hpack.HeaderField{Name: "foo", Value: largeValue})
+			Expect(writeHeaders(framer, http2.HeadersFrameParam{StreamID: 5, BlockFragment: block})).To(Succeed())
+			fields, tooLarge, err := readHeaderBlock(framer, decoder, readHeadersFrame(), 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tooLarge).To(BeFalse())
+			Expect(fields).To(HaveLen(2))
+			Expect(fields[1].Value).To(Equal(largeValue))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("errors if the header block is followed by a different frame", func() {
+			Expect(framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 5, BlockFragment: encode(hpack.HeaderField{Name: ":status", Value: "200"})})).To(Succeed())
+			Expect(framer.WriteData(5, true, []byte("foobar"))).To(Succeed())
+			_, _, err := readHeaderBlock(framer, decoder, readHeadersFrame(), 0)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors on invalid header blocks", func() {
+			Expect(writeHeaders(framer, http2.HeadersFrameParam{StreamID: 5, BlockFragment: []byte{0xff, 0xff, 0xff}})).To(Succeed())
+			_, _, err := readHeaderBlock(framer, decoder, readHeadersFrame(), 0)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("drops header fields if the header list is too large, and keeps the HPACK state in sync", func() {
+			block := encode(
+				hpack.HeaderField{Name: ":status", Value: "200"},
+				hpack.HeaderField{Name: "foo", Value: "bar"},
+				hpack.HeaderField{Name: "large", Value: strings.Repeat("a", 100)},
+				hpack.HeaderField{Name: "bar", Value: "baz"},
+			)
+			Expect(writeHeaders(framer, http2.HeadersFrameParam{StreamID: 5, BlockFragment: block})).To(Succeed())
+			fields, tooLarge, err := readHeaderBlock(framer, decoder, readHeadersFrame(), 120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tooLarge).To(BeTrue())
+			Expect(fields).To(Equal([]hpack.HeaderField{
+				{Name: ":status", Value: "200"},
+				{Name: "foo", Value: "bar"},
+			}))
+			// the next header block references the fields from the dynamic table
+			block = encode(hpack.HeaderField{Name: "large", Value: strings.Repeat("a", 100)}, hpack.HeaderField{Name: "bar", Value: "baz"})
+			Expect(writeHeaders(framer, http2.HeadersFrameParam{StreamID: 7, BlockFragment: block})).To(Succeed())
+			fields, tooLarge, err = readHeaderBlock(framer, decoder, readHeadersFrame(), 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tooLarge).To(BeFalse())
+			Expect(fields).To(Equal([]hpack.HeaderField{
+				{Name: "large", Value: strings.Repeat("a", 100)},
+				{Name: "bar", Value: "baz"},
+			}))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package h2quic
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// peerStreams accepts the streams opened by the peer.
+// Streams announced on a tunnel are only used once the peer actually opened them,
+// so that an announcement can't be used to implicitly open streams.
+type peerStreams struct {
+	session quic.Session
+
+	onStream func(quic.Stream) // called for every accepted stream, might be nil
+
+	mutex    sync.Mutex
+	highest  protocol.StreamID // the highest stream accepted so far
+	closeErr error
+	accepted chan struct{} // closed when a new stream was accepted, or when the session is closed
+}
+
+func newPeerStreams(session quic.Session, onStream func(quic.Stream)) *peerStreams {
+	return &peerStreams{
+		session:  session,
+		onStream: onStream,
+		accepted: make(chan struct{}),
+	}
+}
+
+// run accepts streams until the session is closed
+func (s *peerStreams) run() {
+	for {
+		str, err := s.session.AcceptStream()
+		s.mutex.Lock()
+		if err != nil {
+			s.closeErr = err
+		} else {
+			s.highest = str.StreamID()
+		}
+		close(s.accepted)
+		s.accepted = make(chan struct{})
+		s.mutex.Unlock()
+		if err != nil {
+			return
+		}
+		if s.onStream != nil {
+			s.onStream(str)
+		}
+	}
+}
+
+// get returns a stream opened by the peer.
+// It blocks until the peer opened the stream, the context is done, or the session is closed.
+// Streams are accepted in order, so it never opens a stream.
+// It returns nil if the stream was already closed.
+func (s *peerStreams) get(ctx context.Context, id protocol.StreamID) (quic.Stream, error) {
+	sess, ok := s.session.(streamCreator)
+	if !ok {
+		return nil, errors.New("h2quic: can't get streams of this session")
+	}
+	for {
+		s.mutex.Lock()
+		highest, closeErr, accepted := s.highest, s.closeErr, s.accepted
+		s.mutex.Unlock()
+		if id <= highest {
+			return sess.GetOrOpenStream(id)
+		}
+		if closeErr != nil {
+			return nil, closeErr
+		}
+		select {
+		case <-accepted:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package h2quic
+
+import (
+	"context"
+	"errors"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer streams", func() {
+	var session *mockSession
+
+	BeforeEach(func() {
+		session = newMockSession()
+		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
+		session.dataStream = newMockStream(5)
+	})
+
+	It("returns a stream once the peer opened it", func() {
+		accepted := make(chan quic.Stream, 1)
+		peers := newPeerStreams(session, func(str quic.Stream) { accepted <- str })
+		strChan := make(chan quic.Stream, 1)
+		go func() {
+			defer GinkgoRecover()
+			str, err := peers.get(context.Background(), 5)
+			Expect(err).ToNot(HaveOccurred())
+			strChan <- str
+		}()
+		Consistently(strChan).ShouldNot(Receive())
+		session.streamToAccept = newMockStream(5)
+		go peers.run()
+		Eventually(strChan).Should(Receive(Equal(session.dataStream)))
+		var str quic.Stream
+		Eventually(accepted).Should(Receive(&str))
+		Expect(str.StreamID()).To(BeEquivalentTo(5))
+	})
+
+	It("returns the error when the session is closed", func() {
+		peers := newPeerStreams(session, nil)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			peers.run()
+			close(done)
+		}()
+		session.Close(nil)
+		Eventually(done).Should(BeClosed())
+		_, err := peers.get(context.Background(), 5)
+		Expect(err).To(MatchError(errors.New("session closed")))
+	})
+
+	It("stops waiting when the context is canceled", func() {
+		peers := newPeerStreams(session, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := peers.get(ctx, 5)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -3,6 +3,7 @@ package h2quic
 import (
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -11,9 +12,26 @@ import (
 	"golang.org/x/net/http2/hpack"
 )
 
+// MethodConnectUDP is the method of a request that establishes a UDP tunnel through a proxy.
+// Like CONNECT, the request doesn't have a :path and a :scheme, and the :authority is the target of the tunnel.
+// The UDP payloads are sent on the data stream of the request, see NewDatagramConn.
+const MethodConnectUDP = "CONNECT-UDP"
+
+// isExtendedConnect says if a request is an extended CONNECT request (see RFC 8441).
+// The protocol is carried in the Proto of the request, e.g. "websocket".
+func isExtendedConnect(req *http.Request) bool {
+	return req.Method == http.MethodConnect && req.Proto != "" && !strings.HasPrefix(req.Proto, "HTTP/")
+}
+
+// isTunnelRequest says if a request with this method establishes a tunnel (see RFC 7540, section 8.3)
+func isTunnelRequest(method string) bool {
+	return method == http.MethodConnect || method == MethodConnectUDP
+}
+
 func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
-	var path, authority, method, contentLengthStr string
+	var path, authority, method, scheme, protocol, contentLengthStr string
 	httpHeaders := http.Header{}
+	var trailer http.Header
 
 	for _, h := range headers {
 		switch h.Name {
@@ -23,8 +41,22 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 			method = h.Value
 		case ":authority":
 			authority = h.Value
+		case ":scheme":
+			scheme = h.Value
+		case ":protocol":
+			protocol = h.Value
 		case "content-length":
 			contentLengthStr = h.Value
+		case "trailer":
+			foreachHeaderElement(h.Value, func(v string) {
+				if !validTrailerHeader(v) {
+					return
+				}
+				if trailer == nil {
+					trailer = http.Header{}
+				}
+				trailer[http.CanonicalHeaderKey(v)] = nil
+			})
 		default:
 			if !h.IsPseudo() {
 				httpHeaders.Add(h.Name, h.Value)
@@ -37,17 +69,47 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 		httpHeaders.Set("Cookie", strings.Join(httpHeaders["Cookie"], "; "))
 	}
 
-	if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
-		return nil, errors.New(":path, :authority and :method must not be empty")
+	if len(protocol) > 0 {
+		if method != http.MethodConnect {
+			return nil, fmt.Errorf(":protocol must only be used for CONNECT requests, got %s", method)
+		}
+		if len(scheme) == 0 {
+			return nil, errors.New(":scheme must not be empty for extended CONNECT requests")
+		}
 	}
 
-	u, err := url.Parse(path)
-	if err != nil {
-		return nil, err
+	var u *url.URL
+	requestURI := path
+	// an extended CONNECT request has a :path and a :scheme, like any other request
+	if isTunnelRequest(method) && len(protocol) == 0 {
+		if len(path) > 0 || len(scheme) > 0 {
+			return nil, fmt.Errorf(":path and :scheme must be omitted for %s requests", method)
+		}
+		if len(authority) == 0 {
+			return nil, fmt.Errorf(":authority must not be empty for %s requests", method)
+		}
+		// the :authority is the target of the tunnel
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
+			return nil, errors.New(":path, :authority and :method must not be empty")
+		}
+		var err error
+		u, err = url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	proto := "HTTP/2.0"
+	if len(protocol) > 0 {
+		proto = protocol
 	}
 
 	var contentLength int64
 	if len(contentLengthStr) > 0 {
+		var err error
 		contentLength, err = strconv.ParseInt(contentLengthStr, 10, 64)
 		if err != nil {
 			return nil, err
@@ -57,19 +119,24 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 	return &http.Request{
 		Method:        method,
 		URL:           u,
-		Proto:         "HTTP/2.0",
+		Proto:         proto,
 		ProtoMajor:    2,
 		ProtoMinor:    0,
 		Header:        httpHeaders,
+		Trailer:       trailer,
 		Body:          nil,
 		ContentLength: contentLength,
 		Host:          authority,
-		RequestURI:    path,
+		RequestURI:    requestURI,
 		TLS:           &tls.ConnectionState{},
 	}, nil
 }
 
 func hostnameFromRequest(req *http.Request) string {
+	// the Host of a CONNECT request is the target of the tunnel, the URL is the proxy
+	if isTunnelRequest(req.Method) && req.URL != nil && len(req.URL.Host) > 0 {
+		return req.URL.Host
+	}
 	if len(req.Host) > 0 {
 		return req.Host
 	}
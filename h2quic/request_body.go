@@ -9,6 +9,8 @@ import (
 type requestBody struct {
 	requestRead bool
 	dataStream  quic.Stream
+
+	trailers *trailerReceiver // nil if the request didn't announce trailers
 }
 
 // make sure the requestBody can be used as a http.Request.Body
@@ -20,7 +22,13 @@ func newRequestBody(stream quic.Stream) *requestBody {
 
 func (b *requestBody) Read(p []byte) (int, error) {
 	b.requestRead = true
-	return b.dataStream.Read(p)
+	n, err := b.dataStream.Read(p)
+	if err == io.EOF && b.trailers != nil {
+		if terr := b.trailers.wait(); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
 }
 
 func (b *requestBody) Close() error {
@@ -1,6 +1,9 @@
 package h2quic
 
 import (
+	"io/ioutil"
+	"net/http"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -12,7 +15,7 @@ var _ = Describe("Request body", func() {
 	)
 
 	BeforeEach(func() {
-		stream = &mockStream{}
+		stream = newMockStream(5)
 		stream.dataToRead.Write([]byte("foobar")) // provides data to be read
 		rb = newRequestBody(stream)
 	})
@@ -36,4 +39,16 @@ var _ = Describe("Request body", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(stream.closed).To(BeFalse())
 	})
+
+	It("populates the trailer at the end of the body", func() {
+		close(stream.unblockRead)
+		trailers := newTrailerMap()
+		trailers.expect(5)
+		trailer := http.Header{"Foo": nil}
+		rb.trailers = newTrailerReceiver(trailers, 5, trailer)
+		trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+		_, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+	})
 })
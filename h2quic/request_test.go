@@ -65,6 +65,22 @@ var _ = Describe("Request", func() {
 		}))
 	})
 
+	It("populates the trailer", func() {
+		headers := []hpack.HeaderField{
+			{Name: ":path", Value: "/foo"},
+			{Name: ":authority", Value: "quic.clemente.io"},
+			{Name: ":method", Value: "POST"},
+			{Name: "trailer", Value: "grpc-status, Content-Length, foo"},
+		}
+		req, err := requestFromHeaders(headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Header).To(BeEmpty())
+		Expect(req.Trailer).To(Equal(http.Header{
+			"Grpc-Status": nil,
+			"Foo":         nil,
+		}))
+	})
+
 	It("errors with missing path", func() {
 		headers := []hpack.HeaderField{
 			{Name: ":authority", Value: "quic.clemente.io"},
@@ -92,6 +108,120 @@ var _ = Describe("Request", func() {
 		Expect(err).To(MatchError(":path, :authority and :method must not be empty"))
 	})
 
+	Context("CONNECT requests", func() {
+		It("populates CONNECT requests", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org:443"},
+				{Name: ":method", Value: "CONNECT"},
+			}
+			req, err := requestFromHeaders(headers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(req.Method).To(Equal("CONNECT"))
+			Expect(req.URL).To(Equal(&url.URL{Host: "www.example.org:443"}))
+			Expect(req.Host).To(Equal("www.example.org:443"))
+			Expect(req.RequestURI).To(Equal("www.example.org:443"))
+		})
+
+		It("populates CONNECT-UDP requests", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "8.8.8.8:53"},
+				{Name: ":method", Value: MethodConnectUDP},
+			}
+			req, err := requestFromHeaders(headers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(req.Method).To(Equal(MethodConnectUDP))
+			Expect(req.URL.Host).To(Equal("8.8.8.8:53"))
+		})
+
+		It("errors if a CONNECT request has a path", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org:443"},
+				{Name: ":method", Value: "CONNECT"},
+				{Name: ":path", Value: "/foo"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":path and :scheme must be omitted for CONNECT requests"))
+		})
+
+		It("errors if a CONNECT request has a scheme", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org:443"},
+				{Name: ":method", Value: "CONNECT"},
+				{Name: ":scheme", Value: "https"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":path and :scheme must be omitted for CONNECT requests"))
+		})
+
+		It("errors if a CONNECT request doesn't have an authority", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":method", Value: "CONNECT"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":authority must not be empty for CONNECT requests"))
+		})
+
+		It("populates extended CONNECT requests", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org"},
+				{Name: ":method", Value: "CONNECT"},
+				{Name: ":path", Value: "/chat"},
+				{Name: ":scheme", Value: "https"},
+				{Name: ":protocol", Value: "websocket"},
+			}
+			req, err := requestFromHeaders(headers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(req.Method).To(Equal("CONNECT"))
+			Expect(req.Proto).To(Equal("websocket"))
+			Expect(req.ProtoMajor).To(Equal(2))
+			Expect(req.URL).To(Equal(&url.URL{Path: "/chat"}))
+			Expect(req.Host).To(Equal("www.example.org"))
+			Expect(req.RequestURI).To(Equal("/chat"))
+			Expect(isExtendedConnect(req)).To(BeTrue())
+		})
+
+		It("errors if an extended CONNECT request doesn't have a path", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org"},
+				{Name: ":method", Value: "CONNECT"},
+				{Name: ":scheme", Value: "https"},
+				{Name: ":protocol", Value: "websocket"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":path, :authority and :method must not be empty"))
+		})
+
+		It("errors if an extended CONNECT request doesn't have a scheme", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org"},
+				{Name: ":method", Value: "CONNECT"},
+				{Name: ":path", Value: "/chat"},
+				{Name: ":protocol", Value: "websocket"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":scheme must not be empty for extended CONNECT requests"))
+		})
+
+		It("errors if a request that is not a CONNECT request has a protocol", func() {
+			headers := []hpack.HeaderField{
+				{Name: ":authority", Value: "www.example.org"},
+				{Name: ":method", Value: "GET"},
+				{Name: ":path", Value: "/chat"},
+				{Name: ":scheme", Value: "https"},
+				{Name: ":protocol", Value: "websocket"},
+			}
+			_, err := requestFromHeaders(headers)
+			Expect(err).To(MatchError(":protocol must only be used for CONNECT requests, got GET"))
+		})
+
+		It("detects extended CONNECT requests", func() {
+			Expect(isExtendedConnect(&http.Request{Method: "CONNECT", Proto: "websocket"})).To(BeTrue())
+			Expect(isExtendedConnect(&http.Request{Method: "CONNECT", Proto: "HTTP/1.1"})).To(BeFalse())
+			Expect(isExtendedConnect(&http.Request{Method: "CONNECT"})).To(BeFalse())
+			Expect(isExtendedConnect(&http.Request{Method: "GET", Proto: "websocket"})).To(BeFalse())
+		})
+	})
+
 	Context("extracting the hostname from a request", func() {
 		var url *url.URL
 
@@ -114,6 +244,15 @@ var _ = Describe("Request", func() {
 			Expect(hostnameFromRequest(req)).To(Equal("quic.clemente.io:1337"))
 		})
 
+		It("uses req.URL.Host for CONNECT requests", func() {
+			req := &http.Request{
+				Method: "CONNECT",
+				Host:   "www.example.org:443",
+				URL:    url,
+			}
+			Expect(hostnameFromRequest(req)).To(Equal("quic.clemente.io:1337"))
+		})
+
 		It("returns an empty hostname if nothing is set", func() {
 			Expect(hostnameFromRequest(&http.Request{})).To(BeEmpty())
 		})
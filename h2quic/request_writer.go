@@ -36,24 +36,58 @@ func newRequestWriter(headerStream quic.Stream) *requestWriter {
 }
 
 func (w *requestWriter) WriteRequest(req *http.Request, dataStreamID protocol.StreamID, endStream, requestGzip bool) error {
-	// TODO: add support for trailers
 	// TODO: add support for gzip compression
-	// TODO: write continuation frames, if the header frame is too long
 
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	w.encodeHeaders(req, requestGzip, "", actualContentLength(req))
+	// trailers are sent after the body, so a request without a body can't have trailers
+	var trailers string
+	if !endStream {
+		trailers = strings.Join(declaredTrailers(req.Trailer), ",")
+	}
+	w.encodeHeaders(req, requestGzip, trailers, actualContentLength(req))
 	h2framer := http2.NewFramer(w.headerStream, nil)
-	return h2framer.WriteHeaders(http2.HeadersFrameParam{
+	return writeHeaders(h2framer, http2.HeadersFrameParam{
 		StreamID:      uint32(dataStreamID),
-		EndHeaders:    true,
 		EndStream:     endStream,
 		BlockFragment: w.hbuf.Bytes(),
 		Priority:      http2.PriorityParam{Weight: 0xff},
 	})
 }
 
+// WriteTrailers writes the trailers of a request.
+// It must be called after the body was sent, if the request announced trailers.
+func (w *requestWriter) WriteTrailers(trailer http.Header, dataStreamID protocol.StreamID) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.hbuf.Reset()
+	for k, vv := range trailer {
+		if !validTrailerHeader(k) {
+			continue
+		}
+		for _, v := range vv {
+			w.writeHeader(strings.ToLower(k), v)
+		}
+	}
+	h2framer := http2.NewFramer(w.headerStream, nil)
+	return writeHeaders(h2framer, http2.HeadersFrameParam{
+		StreamID:      uint32(dataStreamID),
+		EndStream:     true,
+		BlockFragment: w.hbuf.Bytes(),
+	})
+}
+
+// WriteSettings writes a SETTINGS frame on the header stream
+func (w *requestWriter) WriteSettings(settings ...http2.Setting) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	h2framer := http2.NewFramer(w.headerStream, nil)
+	return h2framer.WriteSettings(settings...)
+}
+
 // the rest of this files is copied from http2.Transport
 func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) ([]byte, error) {
 	w.hbuf.Reset()
@@ -67,8 +101,10 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		return nil, err
 	}
 
+	// CONNECT requests don't have a :path and a :scheme, unless they are extended CONNECT requests
+	hasPath := !isTunnelRequest(req.Method) || isExtendedConnect(req)
 	var path string
-	if req.Method != "CONNECT" {
+	if hasPath {
 		path = req.URL.RequestURI()
 		if !validPseudoPath(path) {
 			orig := path
@@ -103,10 +139,13 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// [RFC3986]).
 	w.writeHeader(":authority", host)
 	w.writeHeader(":method", req.Method)
-	if req.Method != "CONNECT" {
+	if hasPath {
 		w.writeHeader(":path", path)
 		w.writeHeader(":scheme", req.URL.Scheme)
 	}
+	if isExtendedConnect(req) {
+		w.writeHeader(":protocol", req.Proto)
+	}
 	if trailers != "" {
 		w.writeHeader("trailer", trailers)
 	}
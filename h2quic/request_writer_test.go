@@ -55,6 +55,44 @@ var _ = Describe("Request", func() {
 		Expect(headerFields).ToNot(HaveKey("accept-encoding"))
 	})
 
+	It("writes CONNECT requests", func() {
+		for _, method := range []string{http.MethodConnect, MethodConnectUDP} {
+			headerStream.dataWritten.Reset()
+			rw = newRequestWriter(headerStream)
+			req, err := http.NewRequest(method, "https://proxy.example.org", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Host = "www.example.org:443"
+			rw.WriteRequest(req, 1337, false, false)
+			_, headerFields := decode(headerStream.dataWritten.Bytes())
+			Expect(headerFields).To(HaveKeyWithValue(":authority", "www.example.org:443"))
+			Expect(headerFields).To(HaveKeyWithValue(":method", method))
+			Expect(headerFields).ToNot(HaveKey(":path"))
+			Expect(headerFields).ToNot(HaveKey(":scheme"))
+		}
+	})
+
+	It("writes extended CONNECT requests", func() {
+		req, err := http.NewRequest("CONNECT", "https://www.example.org/chat", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Proto = "websocket"
+		rw.WriteRequest(req, 1337, false, false)
+		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFields).To(HaveKeyWithValue(":authority", "www.example.org"))
+		Expect(headerFields).To(HaveKeyWithValue(":method", "CONNECT"))
+		Expect(headerFields).To(HaveKeyWithValue(":path", "/chat"))
+		Expect(headerFields).To(HaveKeyWithValue(":scheme", "https"))
+		Expect(headerFields).To(HaveKeyWithValue(":protocol", "websocket"))
+	})
+
+	It("doesn't write the protocol for other requests", func() {
+		req, err := http.NewRequest("GET", "https://www.example.org/chat", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Proto = "websocket"
+		rw.WriteRequest(req, 1337, true, false)
+		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFields).ToNot(HaveKey(":protocol"))
+	})
+
 	It("sets the EndStream header", func() {
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
 		Expect(err).ToNot(HaveOccurred())
@@ -114,4 +152,31 @@ var _ = Describe("Request", func() {
 			HaveKeyWithValue("cookie", `Cookie #1="Value #1"; Cookie #2="Value #2"`),
 		))
 	})
+
+	It("announces trailers", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		req.Trailer = http.Header{"Foo": nil, "Bar": nil, "Content-Length": nil}
+		rw.WriteRequest(req, 5, false, false)
+		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFields).To(HaveKeyWithValue("trailer", "Bar,Foo"))
+	})
+
+	It("doesn't announce trailers, if the request ends the stream", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Trailer = http.Header{"Foo": nil}
+		rw.WriteRequest(req, 5, true, false)
+		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFields).ToNot(HaveKey("trailer"))
+	})
+
+	It("writes trailers", func() {
+		err := rw.WriteTrailers(http.Header{"Foo": []string{"bar"}, "Content-Length": []string{"42"}}, 5)
+		Expect(err).ToNot(HaveOccurred())
+		headerFrame, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFrame.StreamID).To(BeEquivalentTo(5))
+		Expect(headerFrame.StreamEnded()).To(BeTrue())
+		Expect(headerFields).To(Equal(map[string]string{"foo": "bar"}))
+	})
 })
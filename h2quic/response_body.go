@@ -0,0 +1,55 @@
+package h2quic
+
+import (
+	"io"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A responseBody is the body of a response that announced trailers.
+type responseBody struct {
+	dataStream quic.Stream
+	trailers   *trailerReceiver
+}
+
+var _ io.ReadCloser = &responseBody{}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.dataStream.Read(p)
+	if err == io.EOF {
+		if terr := b.trailers.wait(); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.trailers.close()
+	return b.dataStream.Close()
+}
+
+// A trackedBody calls onDone when the body was read completely, or when it is closed.
+type trackedBody struct {
+	io.ReadCloser
+
+	once   sync.Once
+	onDone func()
+}
+
+var _ io.ReadCloser = &trackedBody{}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.onDone)
+	}
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onDone)
+	return err
+}
@@ -0,0 +1,83 @@
+package h2quic
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response body", func() {
+	var (
+		stream   *mockStream
+		trailers *trailerMap
+		trailer  http.Header
+		rb       *responseBody
+	)
+
+	BeforeEach(func() {
+		stream = newMockStream(5)
+		stream.dataToRead.Write([]byte("foobar"))
+		trailers = newTrailerMap()
+		trailers.expect(5)
+		trailer = http.Header{"Foo": nil}
+		rb = &responseBody{
+			dataStream: stream,
+			trailers:   newTrailerReceiver(trailers, 5, trailer),
+		}
+	})
+
+	It("populates the trailer at the end of the body", func() {
+		close(stream.unblockRead)
+		trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+		body, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("foobar")))
+		Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+	})
+
+	It("returns an error if the trailers can't be received", func() {
+		close(stream.unblockRead)
+		trailers.closeAll()
+		_, err := ioutil.ReadAll(rb)
+		Expect(err).To(MatchError(errTrailersNotReceived))
+	})
+
+	It("stops waiting for trailers when closed", func() {
+		Expect(rb.Close()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+		Expect(trailers.chans).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Tracked body", func() {
+	var (
+		stream *mockStream
+		body   *trackedBody
+		called int
+	)
+
+	BeforeEach(func() {
+		called = 0
+		stream = newMockStream(5)
+		stream.dataToRead.Write([]byte("foobar"))
+		body = &trackedBody{ReadCloser: stream, onDone: func() { called++ }}
+	})
+
+	It("calls onDone when the body was read completely", func() {
+		close(stream.unblockRead)
+		data, err := ioutil.ReadAll(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(called).To(Equal(1))
+		Expect(body.Close()).To(Succeed())
+		Expect(called).To(Equal(1))
+	})
+
+	It("calls onDone when the body is closed", func() {
+		Expect(body.Close()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+		Expect(called).To(Equal(1))
+	})
+})
@@ -1,11 +1,16 @@
 package h2quic
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -14,9 +19,12 @@ import (
 	"golang.org/x/net/http2/hpack"
 )
 
+var errHijackNotSupported = errors.New("h2quic: Hijack is only supported for CONNECT requests")
+
 type responseWriter struct {
-	dataStreamID protocol.StreamID
-	dataStream   quic.Stream
+	dataStreamID   protocol.StreamID
+	dataStream     quic.Stream
+	bufferedStream *bufio.Writer
 
 	headerStream      quic.Stream
 	headerStreamMutex *sync.Mutex
@@ -24,6 +32,16 @@ type responseWriter struct {
 	header        http.Header
 	status        int // status code passed to WriteHeader
 	headerWritten bool
+	trailers      []string // the declared trailers
+
+	push func(target string, opts *http.PushOptions) error // nil for pushed responses
+
+	conn     *streamConn // the net.Conn returned by Hijack, only set for CONNECT requests
+	hijacked bool
+
+	ctx             context.Context // the context of the request, canceled when the peer resets the stream or the session is closed
+	closeNotifyOnce sync.Once
+	closeNotifyChan chan bool
 }
 
 func newResponseWriter(headerStream quic.Stream, headerStreamMutex *sync.Mutex, dataStream quic.Stream, dataStreamID protocol.StreamID) *responseWriter {
@@ -32,7 +50,9 @@ func newResponseWriter(headerStream quic.Stream, headerStreamMutex *sync.Mutex,
 		headerStream:      headerStream,
 		headerStreamMutex: headerStreamMutex,
 		dataStream:        dataStream,
+		bufferedStream:    bufio.NewWriter(dataStream),
 		dataStreamID:      dataStreamID,
+		ctx:               dataStream.Context(),
 	}
 }
 
@@ -52,18 +72,30 @@ func (w *responseWriter) WriteHeader(status int) {
 	enc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
 
 	for k, v := range w.header {
+		if k == "Trailer" {
+			for _, t := range v {
+				foreachHeaderElement(t, w.declareTrailer)
+			}
+			continue
+		}
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			w.declareTrailer(strings.TrimPrefix(k, http.TrailerPrefix))
+			continue
+		}
 		for index := range v {
 			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
 		}
 	}
+	if len(w.trailers) > 0 {
+		enc.WriteField(hpack.HeaderField{Name: "trailer", Value: strings.Join(w.trailers, ",")})
+	}
 
 	utils.Infof("Responding with %d", status)
 	w.headerStreamMutex.Lock()
 	defer w.headerStreamMutex.Unlock()
 	h2framer := http2.NewFramer(w.headerStream, nil)
-	err := h2framer.WriteHeaders(http2.HeadersFrameParam{
+	err := writeHeaders(h2framer, http2.HeadersFrameParam{
 		StreamID:      uint32(w.dataStreamID),
-		EndHeaders:    true,
 		BlockFragment: headers.Bytes(),
 	})
 	if err != nil {
@@ -71,20 +103,123 @@ func (w *responseWriter) WriteHeader(status int) {
 	}
 }
 
+func (w *responseWriter) declareTrailer(k string) {
+	k = http.CanonicalHeaderKey(k)
+	if !validTrailerHeader(k) {
+		utils.Debugf("Ignoring invalid trailer %q", k)
+		return
+	}
+	for _, t := range w.trailers {
+		if t == k {
+			return
+		}
+	}
+	w.trailers = append(w.trailers, k)
+}
+
+// writeTrailers writes the trailers. It is called after the handler returned.
+// Trailers set using http.TrailerPrefix are announced if they are set before the header is written.
+// Otherwise they are still sent, but the client might not wait for them.
+func (w *responseWriter) writeTrailers() {
+	for k, vv := range w.header {
+		if !strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		trailerKey := http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))
+		w.declareTrailer(trailerKey)
+		w.header[trailerKey] = vv
+	}
+	// announced trailers are always sent, even if no values were set, since the client waits for them
+	if len(w.trailers) == 0 {
+		return
+	}
+
+	w.headerStreamMutex.Lock()
+	defer w.headerStreamMutex.Unlock()
+	h2framer := http2.NewFramer(w.headerStream, nil)
+	err := writeHeaders(h2framer, http2.HeadersFrameParam{
+		StreamID:      uint32(w.dataStreamID),
+		EndStream:     true,
+		BlockFragment: encodeTrailers(w.header, w.trailers),
+	})
+	if err != nil {
+		utils.Errorf("could not write h2 trailers: %s", err.Error())
+	}
+}
+
 func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
 	if !w.headerWritten {
 		w.WriteHeader(200)
 	}
 	if !bodyAllowedForStatus(w.status) {
 		return 0, http.ErrBodyNotAllowed
 	}
-	return w.dataStream.Write(p)
+	return w.bufferedStream.Write(p)
+}
+
+// Flush sends the header (if it wasn't sent yet) and the buffered data.
+// Writing to a QUIC stream blocks until the data was packed, so when Flush returns, the data is on its way to the client.
+func (w *responseWriter) Flush() {
+	if err := w.flush(); err != nil {
+		utils.Errorf("could not flush to stream: %s", err.Error())
+	}
+}
+
+func (w *responseWriter) flush() error {
+	if w.hijacked {
+		return http.ErrHijacked
+	}
+	if !w.headerWritten {
+		w.WriteHeader(200)
+	}
+	return w.bufferedStream.Flush()
+}
+
+// Push initiates a server push for the target.
+// It returns ErrRecursivePush when called while serving a pushed response,
+// and http.ErrNotSupported if the client disabled server push.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.push == nil {
+		return ErrRecursivePush
+	}
+	return w.push(target, opts)
 }
 
-func (w *responseWriter) Flush() {}
+// CloseNotify returns a channel that receives a value when the peer resets the stream, or when the session is closed.
+// New code should use http.Request.Context instead.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	w.closeNotifyOnce.Do(func() {
+		w.closeNotifyChan = make(chan bool, 1)
+		go func() {
+			<-w.ctx.Done()
+			w.closeNotifyChan <- true
+		}()
+	})
+	return w.closeNotifyChan
+}
 
-// This is a NOP. Use http.Request.Context
-func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
+// Hijack takes over the data stream of a CONNECT request.
+// If the header wasn't written yet, a 200 response is sent, and the buffered data is sent.
+// The returned net.Conn reads from and writes to the data stream. Closing it closes the stream in both directions.
+// The deadlines set by the server due to the ReadTimeout and the WriteTimeout are removed.
+// Hijack is only supported for CONNECT and CONNECT-UDP requests.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.conn == nil {
+		return nil, nil, errHijackNotSupported
+	}
+	if w.hijacked {
+		return nil, nil, http.ErrHijacked
+	}
+	if err := w.flush(); err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.dataStream.SetDeadline(time.Time{})
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
 
 // test that we implement http.Flusher
 var _ http.Flusher = &responseWriter{}
@@ -92,6 +227,12 @@ var _ http.Flusher = &responseWriter{}
 // test that we implement http.CloseNotifier
 var _ http.CloseNotifier = &responseWriter{}
 
+// test that we implement http.Pusher
+var _ http.Pusher = &responseWriter{}
+
+// test that we implement http.Hijacker
+var _ http.Hijacker = &responseWriter{}
+
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
 // permits a body. See RFC 2616, section 4.4.
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -25,6 +26,9 @@ type mockStream struct {
 	canceledWrite bool
 	closed        bool
 	remoteClosed  bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	writeErr      error
 
 	unblockRead chan struct{}
 	ctx         context.Context
@@ -48,9 +52,12 @@ func (s *mockStream) CancelWrite(quic.ErrorCode) error      { s.canceledWrite =
 func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true; s.ctxCancel() }
 func (s mockStream) StreamID() protocol.StreamID            { return s.id }
 func (s *mockStream) Context() context.Context              { return s.ctx }
-func (s *mockStream) SetDeadline(time.Time) error           { panic("not implemented") }
-func (s *mockStream) SetReadDeadline(time.Time) error       { panic("not implemented") }
-func (s *mockStream) SetWriteDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) SetDeadline(t time.Time) error {
+	s.readDeadline, s.writeDeadline = t, t
+	return nil
+}
+func (s *mockStream) SetReadDeadline(t time.Time) error  { s.readDeadline = t; return nil }
+func (s *mockStream) SetWriteDeadline(t time.Time) error { s.writeDeadline = t; return nil }
 
 func (s *mockStream) Read(p []byte) (int, error) {
 	n, _ := s.dataToRead.Read(p)
@@ -60,7 +67,12 @@ func (s *mockStream) Read(p []byte) (int, error) {
 	}
 	return n, nil // never return an EOF
 }
-func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+func (s *mockStream) Write(p []byte) (int, error) {
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+	return s.dataWritten.Write(p)
+}
 
 var _ = Describe("Response Writer", func() {
 	var (
@@ -71,7 +83,7 @@ var _ = Describe("Response Writer", func() {
 
 	BeforeEach(func() {
 		headerStream = &mockStream{}
-		dataStream = &mockStream{}
+		dataStream = newMockStream(5)
 		w = newResponseWriter(headerStream, &sync.Mutex{}, dataStream, 5)
 	})
 
@@ -128,7 +140,9 @@ var _ = Describe("Response Writer", func() {
 		// Should have written 200 on the header stream
 		fields := decodeHeaderFields()
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
-		// And foobar on the data stream
+		// And foobar on the data stream, once the response writer is flushed
+		Expect(dataStream.dataWritten.Len()).To(BeZero())
+		w.Flush()
 		Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
 	})
 
@@ -141,9 +155,41 @@ var _ = Describe("Response Writer", func() {
 		fields := decodeHeaderFields()
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
 		// And foobar on the data stream
+		w.Flush()
 		Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
 	})
 
+	It("writes the header when flushed", func() {
+		w.Header().Set("foo", "bar")
+		w.Flush()
+		fields := decodeHeaderFields()
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(fields).To(HaveKeyWithValue("foo", []string{"bar"}))
+		Expect(dataStream.dataWritten.Len()).To(BeZero())
+	})
+
+	It("sends large writes without waiting for a flush", func() {
+		data := bytes.Repeat([]byte{'a'}, 10000)
+		_, err := w.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dataStream.dataWritten.Len()).ToNot(BeZero())
+		w.Flush()
+		Expect(dataStream.dataWritten.Bytes()).To(Equal(data))
+	})
+
+	Context("CloseNotify", func() {
+		It("notifies when the stream is closed", func() {
+			c := w.CloseNotify()
+			Consistently(c).ShouldNot(Receive())
+			dataStream.ctxCancel()
+			Eventually(c).Should(Receive(BeTrue()))
+		})
+
+		It("returns the same channel when called multiple times", func() {
+			Expect(w.CloseNotify()).To(Equal(w.CloseNotify()))
+		})
+	})
+
 	It("does not WriteHeader() twice", func() {
 		w.WriteHeader(200)
 		w.WriteHeader(500)
@@ -159,4 +205,122 @@ var _ = Describe("Response Writer", func() {
 		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
 		Expect(dataStream.dataWritten.Bytes()).To(HaveLen(0))
 	})
+
+	Context("trailers", func() {
+		decodeTrailers := func() (*http2.HeadersFrame, http.Header) {
+			decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
+			h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+			// skip the HEADERS frame containing the header
+			frame, err := h2framer.ReadFrame()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = decoder.DecodeFull(frame.(*http2.HeadersFrame).HeaderBlockFragment())
+			Expect(err).ToNot(HaveOccurred())
+			frame, err = h2framer.ReadFrame()
+			Expect(err).ToNot(HaveOccurred())
+			hframe := frame.(*http2.HeadersFrame)
+			fields, err := decoder.DecodeFull(hframe.HeaderBlockFragment())
+			Expect(err).ToNot(HaveOccurred())
+			return hframe, trailerFromHeaders(fields)
+		}
+
+		It("announces and writes declared trailers", func() {
+			w.Header().Set("Trailer", "Grpc-Status, Content-Length")
+			w.WriteHeader(200)
+			w.Header().Set("Grpc-Status", "0")
+			w.writeTrailers()
+			fields := decodeHeaderFields()
+			Expect(fields).To(HaveKeyWithValue("trailer", []string{"Grpc-Status"}))
+			hframe, trailer := decodeTrailers()
+			Expect(hframe.StreamID).To(BeEquivalentTo(5))
+			Expect(hframe.StreamEnded()).To(BeTrue())
+			Expect(trailer).To(Equal(http.Header{"Grpc-Status": []string{"0"}}))
+		})
+
+		It("writes announced trailers, even if no value was set", func() {
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.WriteHeader(200)
+			w.writeTrailers()
+			_, trailer := decodeTrailers()
+			Expect(trailer).To(BeEmpty())
+		})
+
+		It("announces trailers set with the TrailerPrefix before the header is written", func() {
+			w.Header().Set(http.TrailerPrefix+"Foo", "bar")
+			w.WriteHeader(200)
+			w.writeTrailers()
+			fields := decodeHeaderFields()
+			Expect(fields).To(HaveKeyWithValue("trailer", []string{"Foo"}))
+			Expect(fields).ToNot(HaveKey("foo"))
+			Expect(fields).ToNot(HaveKey("trailer:foo"))
+			_, trailer := decodeTrailers()
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("writes trailers set with the TrailerPrefix after the header was written", func() {
+			w.WriteHeader(200)
+			w.Header().Set(http.TrailerPrefix+"Foo", "bar")
+			w.writeTrailers()
+			Expect(decodeHeaderFields()).ToNot(HaveKey("trailer"))
+			_, trailer := decodeTrailers()
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("doesn't write trailers, if there are none", func() {
+			w.WriteHeader(200)
+			l := headerStream.dataWritten.Len()
+			w.writeTrailers()
+			Expect(headerStream.dataWritten.Len()).To(Equal(l))
+		})
+	})
+
+	Context("hijacking", func() {
+		BeforeEach(func() {
+			w.conn = newStreamConn(dataStream, &net.UDPAddr{}, &net.UDPAddr{}, nil)
+		})
+
+		It("hijacks the data stream", func() {
+			dataStream.writeDeadline = time.Now().Add(time.Hour)
+			w.Write([]byte("foo"))
+			conn, rw, err := w.Hijack()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conn).To(Equal(w.conn))
+			Expect(rw).ToNot(BeNil())
+			Expect(decodeHeaderFields()).To(HaveKeyWithValue(":status", []string{"200"}))
+			// the buffered data is sent
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foo")))
+			Expect(dataStream.writeDeadline).To(BeZero())
+			_, err = conn.Write([]byte("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		})
+
+		It("uses the status that was already written", func() {
+			w.WriteHeader(http.StatusAccepted)
+			_, _, err := w.Hijack()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decodeHeaderFields()).To(HaveKeyWithValue(":status", []string{"202"}))
+		})
+
+		It("doesn't allow writing after hijacking", func() {
+			_, _, err := w.Hijack()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("foobar"))
+			Expect(err).To(MatchError(http.ErrHijacked))
+			Expect(w.flush()).To(MatchError(http.ErrHijacked))
+		})
+
+		It("doesn't hijack twice", func() {
+			_, _, err := w.Hijack()
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = w.Hijack()
+			Expect(err).To(MatchError(http.ErrHijacked))
+		})
+
+		It("only hijacks CONNECT requests", func() {
+			w.conn = nil
+			_, _, err := w.Hijack()
+			Expect(err).To(MatchError(errHijackNotSupported))
+			Expect(headerStream.dataWritten.Len()).To(BeZero())
+		})
+	})
 })
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 
@@ -19,7 +21,34 @@ type roundTripCloser interface {
 	io.Closer
 }
 
-// RoundTripper implements the http.RoundTripper interface
+// A pooledClient is a client managed by the connection pool of the RoundTripper.
+type pooledClient interface {
+	roundTripCloser
+	// roundTrip sends a request.
+	// If waitForStream is not set, and the stream limit is reached, errStreamLimitReached is returned.
+	// If errStreamLimitReached or errClientClosed is returned, the request can be sent on a different client.
+	roundTrip(req *http.Request, waitForStream bool) (*http.Response, error)
+	canTakeNewRequest() bool
+	canCoalesce(authority string) bool
+	remoteIP() net.IP
+	closeIfIdle() bool
+	// done is closed when the client can't be used for new requests any more
+	done() <-chan struct{}
+}
+
+var lookupIP = net.LookupIP
+
+// RoundTripper implements the http.RoundTripper interface.
+// It maintains a pool of QUIC connections:
+// Connections that are closed (e.g. by the server, or due to an idle timeout) are removed from the pool,
+// and a new connection is dialed for the next request.
+// If the stream limit of all connections to a host is reached, an additional connection is dialed.
+// Requests for a host are sent on an existing connection to a different host,
+// if the certificate of that connection is valid for the host, and if the host resolves to the IP address of that connection.
+//
+// An extended CONNECT request (RFC 8441) is sent if the Method is CONNECT and the Proto is set to the protocol, e.g. "websocket".
+// ErrExtendedConnectNotSupported is returned if the server doesn't support extended CONNECT.
+// The Body of the response to a CONNECT request implements net.Conn, which reads from and writes to the data stream of the request.
 type RoundTripper struct {
 	mutex sync.Mutex
 
@@ -46,7 +75,17 @@ type RoundTripper struct {
 	// If Dial is nil, quic.DialAddr will be used.
 	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
-	clients map[string]roundTripCloser
+	// PushHandler handles responses pushed by the server.
+	// If nil, pushed responses are refused by resetting their streams.
+	PushHandler PushHandler
+
+	// IdleConnTimeout is the maximum amount of time a connection
+	// without active requests remains open before closing itself.
+	// Zero means no limit.
+	IdleConnTimeout time.Duration
+
+	clients      map[string][]pooledClient           // the authority is the key. Clients might be used for multiple authorities.
+	createClient func(authority string) pooledClient // can be set in tests. If nil, newClient is used.
 }
 
 // RoundTripOpt are options for the Transport.RoundTripOpt method.
@@ -100,11 +139,19 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	}
 
 	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
-	if err != nil {
-		return nil, err
+	for {
+		cl, isNew, err := r.getClient(hostname, opt.OnlyCachedConn)
+		if err != nil {
+			return nil, err
+		}
+		// A new client waits for a stream to become available.
+		// Otherwise, the request might be retried on a new client forever.
+		rsp, err := cl.roundTrip(req, isNew)
+		if !isNew && (err == errStreamLimitReached || err == errClientClosed) {
+			continue
+		}
+		return rsp, err
 	}
-	return cl.RoundTrip(req)
 }
 
 // RoundTrip does a round trip.
@@ -112,36 +159,148 @@ func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+// getClient returns a client that can take a new request for the authority.
+// If no such client exists, it tries to coalesce the request onto a connection to a different authority, and dials a new connection otherwise.
+// isNew is set if a new client was created.
+func (r *RoundTripper) getClient(authority string, onlyCached bool) (cl pooledClient, isNew bool, err error) {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	if cl := r.availableClient(authority); cl != nil {
+		r.mutex.Unlock()
+		return cl, false, nil
+	}
+	if onlyCached {
+		r.mutex.Unlock()
+		return nil, false, ErrNoCachedConn
+	}
+	candidates := r.coalescingCandidates(authority)
+	r.mutex.Unlock()
 
-	if r.clients == nil {
-		r.clients = make(map[string]roundTripCloser)
+	var ips []net.IP
+	if len(candidates) > 0 {
+		// the DNS lookup might block, so don't hold the lock
+		host, _, _ := net.SplitHostPort(authority)
+		ips, _ = lookupIP(host)
 	}
 
-	client, ok := r.clients[hostname]
-	if !ok {
-		if onlyCached {
-			return nil, ErrNoCachedConn
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// another request might have added a client for the authority in the meantime
+	if cl := r.availableClient(authority); cl != nil {
+		return cl, false, nil
+	}
+	for _, cl := range candidates {
+		if !cl.canTakeNewRequest() || !containsIP(ips, cl.remoteIP()) {
+			continue
 		}
-		client = newClient(
-			hostname,
+		r.addClient(authority, cl)
+		return cl, false, nil
+	}
+	if r.createClient != nil {
+		cl = r.createClient(authority)
+	} else {
+		cl = newClient(
+			authority,
 			r.TLSClientConfig,
-			&roundTripperOpts{DisableCompression: r.DisableCompression},
+			&roundTripperOpts{
+				DisableCompression: r.DisableCompression,
+				PushHandler:        r.PushHandler,
+				IdleTimeout:        r.IdleConnTimeout,
+			},
 			r.QuicConfig,
 			r.Dial,
 		)
-		r.clients[hostname] = client
 	}
-	return client, nil
+	r.addClient(authority, cl)
+	go r.removeWhenDone(cl)
+	return cl, true, nil
+}
+
+// availableClient returns a client for the authority that can take a new request.
+// The caller must hold the mutex.
+func (r *RoundTripper) availableClient(authority string) pooledClient {
+	for _, cl := range r.clients[authority] {
+		if cl.canTakeNewRequest() {
+			return cl
+		}
+	}
+	return nil
+}
+
+// coalescingCandidates returns the clients for other authorities that requests for this authority might be sent on.
+// The caller must hold the mutex.
+func (r *RoundTripper) coalescingCandidates(authority string) []pooledClient {
+	var candidates []pooledClient
+	for _, cl := range r.allClients() {
+		if cl.canTakeNewRequest() && cl.canCoalesce(authority) {
+			candidates = append(candidates, cl)
+		}
+	}
+	return candidates
+}
+
+// allClients returns all clients in the pool. Every client is only returned once, even if it is used for multiple authorities.
+// The caller must hold the mutex.
+func (r *RoundTripper) allClients() []pooledClient {
+	var all []pooledClient
+	seen := make(map[pooledClient]bool)
+	for _, clients := range r.clients {
+		for _, cl := range clients {
+			if !seen[cl] {
+				seen[cl] = true
+				all = append(all, cl)
+			}
+		}
+	}
+	return all
+}
+
+// The caller must hold the mutex.
+func (r *RoundTripper) addClient(authority string, cl pooledClient) {
+	if r.clients == nil {
+		r.clients = make(map[string][]pooledClient)
+	}
+	r.clients[authority] = append(r.clients[authority], cl)
+}
+
+// removeWhenDone removes a client from the pool as soon as it can't be used any more
+func (r *RoundTripper) removeWhenDone(cl pooledClient) {
+	<-cl.done()
+	// Close the connection, in case the client is done because of an error on the header stream.
+	_ = cl.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for authority, clients := range r.clients {
+		for i, c := range clients {
+			if c == cl {
+				clients = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+		if len(clients) == 0 {
+			delete(r.clients, authority)
+		} else {
+			r.clients[authority] = clients
+		}
+	}
+}
+
+// CloseIdleConnections closes all connections that don't have any active requests.
+func (r *RoundTripper) CloseIdleConnections() {
+	r.mutex.Lock()
+	clients := r.allClients()
+	r.mutex.Unlock()
+
+	for _, cl := range clients {
+		cl.closeIfIdle()
+	}
 }
 
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, client := range r.clients {
+	for _, client := range r.allClients() {
 		if err := client.Close(); err != nil {
 			return err
 		}
@@ -150,6 +309,15 @@ func (r *RoundTripper) Close() error {
 	return nil
 }
 
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func closeRequestBody(req *http.Request) {
 	if req.Body != nil {
 		req.Body.Close()
@@ -5,7 +5,9 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
@@ -14,18 +16,94 @@ import (
 )
 
 type mockClient struct {
-	closed bool
+	mutex sync.Mutex
+
+	requests        []*http.Request
+	waitedForStream []bool
+	response        *http.Response // if nil, an empty response is returned
+	err             error
+	roundTripErr    error // returned if the roundTrip doesn't wait for a stream
+	full            bool
+	coalesce        bool
+	ip              net.IP
+	idle            bool
+	closed          bool
+	doneChan        chan struct{}
+	doneOnce        sync.Once
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{doneChan: make(chan struct{})}
 }
 
 func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	return m.roundTrip(req, true)
+}
+
+func (m *mockClient) roundTrip(req *http.Request, waitForStream bool) (*http.Response, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, req)
+	m.waitedForStream = append(m.waitedForStream, waitForStream)
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.roundTripErr != nil && !waitForStream {
+		switch m.roundTripErr {
+		case errStreamLimitReached:
+			m.full = true
+		case errClientClosed:
+			m.setDone()
+		}
+		return nil, m.roundTripErr
+	}
+	if m.response != nil {
+		return m.response, nil
+	}
 	return &http.Response{Request: req}, nil
 }
+
+func (m *mockClient) canTakeNewRequest() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	select {
+	case <-m.doneChan:
+		return false
+	default:
+		return !m.full
+	}
+}
+
+func (m *mockClient) canCoalesce(string) bool { return m.coalesce }
+func (m *mockClient) remoteIP() net.IP        { return m.ip }
+func (m *mockClient) done() <-chan struct{}   { return m.doneChan }
+
+func (m *mockClient) closeIfIdle() bool {
+	if m.idle {
+		m.Close()
+	}
+	return m.idle
+}
+
 func (m *mockClient) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.closed = true
+	m.setDone()
 	return nil
 }
 
-var _ roundTripCloser = &mockClient{}
+func (m *mockClient) setDone() {
+	m.doneOnce.Do(func() { close(m.doneChan) })
+}
+
+func (m *mockClient) isClosed() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.closed
+}
+
+var _ pooledClient = &mockClient{}
 
 type mockBody struct {
 	reader   bytes.Reader
@@ -68,29 +146,15 @@ var _ = Describe("RoundTripper", func() {
 
 	Context("dialing hosts", func() {
 		origDialAddr := dialAddr
-		streamOpenErr := errors.New("error opening stream")
 
 		BeforeEach(func() {
 			origDialAddr = dialAddr
-			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
-				// return an error when trying to open a stream
-				// we don't want to test all the dial logic here, just that dialing happens at all
-				return &mockSession{streamOpenErr: streamOpenErr}, nil
-			}
 		})
 
 		AfterEach(func() {
 			dialAddr = origDialAddr
 		})
 
-		It("creates new clients", func() {
-			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
-			Expect(err).ToNot(HaveOccurred())
-			_, err = rt.RoundTrip(req)
-			Expect(err).To(MatchError(streamOpenErr))
-			Expect(rt.clients).To(HaveLen(1))
-		})
-
 		It("uses the quic.Config, if provided", func() {
 			config := &quic.Config{HandshakeTimeout: time.Millisecond}
 			var receivedConfig *quic.Config
@@ -114,24 +178,224 @@ var _ = Describe("RoundTripper", func() {
 			Expect(dialed).To(BeTrue())
 		})
 
-		It("reuses existing clients", func() {
-			req, err := http.NewRequest("GET", "https://quic.clemente.io/file1.html", nil)
+		It("redials after the handshake failed", func() {
+			testErr := errors.New("handshake failed")
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+				dialCount++
+				return nil, testErr
+			}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			Eventually(func() int {
+				rt.mutex.Lock()
+				defer rt.mutex.Unlock()
+				return len(rt.clients)
+			}).Should(BeZero())
+			_, err = rt.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			Expect(dialCount).To(Equal(2))
+		})
+	})
+
+	Context("connection pool", func() {
+		var (
+			clients       []*mockClient
+			origLookupIP  = lookupIP
+			numClients    func() int
+			createdClient func(i int) *mockClient
+		)
+
+		BeforeEach(func() {
+			clients = nil
+			rt.createClient = func(authority string) pooledClient {
+				cl := newMockClient()
+				clients = append(clients, cl)
+				return cl
+			}
+			numClients = func() int {
+				rt.mutex.Lock()
+				defer rt.mutex.Unlock()
+				return len(rt.allClients())
+			}
+			createdClient = func(i int) *mockClient {
+				Expect(clients).To(HaveLen(i + 1))
+				return clients[i]
+			}
+			origLookupIP = lookupIP
+		})
+
+		AfterEach(func() {
+			lookupIP = origLookupIP
+		})
+
+		It("creates new clients", func() {
+			_, err := rt.RoundTrip(req1)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = rt.RoundTrip(req)
-			Expect(err).To(MatchError(streamOpenErr))
 			Expect(rt.clients).To(HaveLen(1))
+			Expect(rt.clients).To(HaveKey("www.example.org:443"))
+			// a new client waits for a stream to become available
+			Expect(createdClient(0).waitedForStream).To(Equal([]bool{true}))
+		})
+
+		It("reuses existing clients", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://www.example.org/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clients).To(HaveLen(1))
+			Expect(clients[0].requests).To(Equal([]*http.Request{req1, req2}))
+			Expect(clients[0].waitedForStream).To(Equal([]bool{true, false}))
+		})
+
+		It("uses different clients for different hosts", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
 			req2, err := http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = rt.RoundTrip(req2)
-			Expect(err).To(MatchError(streamOpenErr))
-			Expect(rt.clients).To(HaveLen(1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clients).To(HaveLen(2))
+			Expect(rt.clients).To(HaveLen(2))
 		})
 
-		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
-			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+		It("removes clients that are done, and redials", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			createdClient(0).setDone()
+			Eventually(numClients).Should(BeZero())
+			Expect(clients[0].isClosed()).To(BeTrue())
+			_, err = rt.RoundTrip(req1)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = rt.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
+			Expect(createdClient(1).requests).To(HaveLen(1))
+		})
+
+		It("creates another client when the stream limit is reached", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			createdClient(0).roundTripErr = errStreamLimitReached
+			_, err = rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clients[0].requests).To(HaveLen(2))
+			Expect(createdClient(1).requests).To(HaveLen(1))
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(2))
+			// the next request uses the second client
+			_, err = rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clients[0].requests).To(HaveLen(2))
+			Expect(clients[1].requests).To(HaveLen(2))
+			Expect(clients[1].waitedForStream).To(Equal([]bool{true, false}))
+		})
+
+		It("retries the request if the client was closed", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			createdClient(0).roundTripErr = errClientClosed
+			_, err = rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdClient(1).requests).To(HaveLen(1))
+		})
+
+		It("doesn't retry requests on new clients", func() {
+			rt.createClient = func(string) pooledClient {
+				cl := newMockClient()
+				cl.err = errClientClosed
+				clients = append(clients, cl)
+				return cl
+			}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(errClientClosed))
+			Expect(clients).To(HaveLen(1))
+		})
+
+		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
+			_, err := rt.RoundTripOpt(req1, RoundTripOpt{OnlyCachedConn: true})
 			Expect(err).To(MatchError(ErrNoCachedConn))
+			Expect(clients).To(BeEmpty())
+		})
+
+		It("uses cached clients if RoundTripOpt.OnlyCachedConn is set", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req1, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdClient(0).requests).To(HaveLen(2))
+		})
+
+		Context("coalescing connections", func() {
+			var req2 *http.Request
+
+			BeforeEach(func() {
+				_, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				createdClient(0).ip = net.IPv4(1, 2, 3, 4)
+				req2, err = http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("sends requests for a different host on an existing connection", func() {
+				clients[0].coalesce = true
+				var lookedUp string
+				lookupIP = func(host string) ([]net.IP, error) {
+					lookedUp = host
+					return []net.IP{net.IPv4(5, 6, 7, 8), net.IPv4(1, 2, 3, 4)}, nil
+				}
+				_, err := rt.RoundTrip(req2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lookedUp).To(Equal("quic.clemente.io"))
+				Expect(clients).To(HaveLen(1))
+				Expect(clients[0].requests).To(Equal([]*http.Request{req1, req2}))
+				Expect(rt.clients["quic.clemente.io:443"]).To(HaveLen(1))
+				// the client is only closed once it was removed for all hosts
+				clients[0].setDone()
+				Eventually(numClients).Should(BeZero())
+			})
+
+			It("doesn't coalesce if the certificate is not valid for the host", func() {
+				lookupIP = func(string) ([]net.IP, error) {
+					Fail("didn't expect a DNS lookup")
+					return nil, nil
+				}
+				_, err := rt.RoundTrip(req2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(clients).To(HaveLen(2))
+			})
+
+			It("doesn't coalesce if the host resolves to a different IP", func() {
+				clients[0].coalesce = true
+				lookupIP = func(string) ([]net.IP, error) {
+					return []net.IP{net.IPv4(5, 6, 7, 8)}, nil
+				}
+				_, err := rt.RoundTrip(req2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(clients).To(HaveLen(2))
+			})
+
+			It("doesn't coalesce if the DNS lookup fails", func() {
+				clients[0].coalesce = true
+				lookupIP = func(string) ([]net.IP, error) {
+					return nil, errors.New("no such host")
+				}
+				_, err := rt.RoundTrip(req2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(clients).To(HaveLen(2))
+			})
+		})
+
+		It("closes idle connections", func() {
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			createdClient(1).idle = true
+			rt.CloseIdleConnections()
+			Expect(clients[0].isClosed()).To(BeFalse())
+			Expect(clients[1].isClosed()).To(BeTrue())
+			Eventually(numClients).Should(Equal(1))
 		})
 	})
 
@@ -199,9 +463,9 @@ var _ = Describe("RoundTripper", func() {
 
 	Context("closing", func() {
 		It("closes", func() {
-			rt.clients = make(map[string]roundTripCloser)
-			cl := &mockClient{}
-			rt.clients["foo.bar"] = cl
+			rt.clients = make(map[string][]pooledClient)
+			cl := newMockClient()
+			rt.clients["foo.bar"] = []pooledClient{cl}
 			err := rt.Close()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(rt.clients)).To(BeZero())
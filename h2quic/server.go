@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -35,7 +36,44 @@ var (
 	quicListenAddr = quic.ListenAddr
 )
 
+// contextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string { return "h2quic context value " + k.name }
+
+var (
+	// SessionContextKey is a context key. It can be used in HTTP
+	// handlers with Context.Value to access the QUIC session that
+	// the request was received on. The associated value will be of
+	// type quic.Session.
+	SessionContextKey = &contextKey{"quic-session"}
+	// StreamContextKey is a context key. It can be used in HTTP
+	// handlers with Context.Value to access the data stream of the
+	// request. The associated value will be of type quic.Stream.
+	StreamContextKey = &contextKey{"quic-stream"}
+	// ConnectionStateContextKey is a context key. It can be used in HTTP
+	// handlers with Context.Value to access the state of the QUIC connection,
+	// when the request was received. The associated value will be of type quic.ConnectionState.
+	ConnectionStateContextKey = &contextKey{"quic-connection-state"}
+)
+
 // Server is a HTTP2 server listening for QUIC connections.
+//
+// The limits and timeouts of the http.Server are applied as follows:
+// The ReadTimeout limits the time it takes to read the body of a request, and the WriteTimeout the time it takes to write the response.
+// A new session is closed if the client doesn't send a request within the ReadHeaderTimeout,
+// and a session is closed if it was idle for longer than the IdleTimeout.
+// If ReadHeaderTimeout or IdleTimeout are zero, the value of ReadTimeout is used.
+// Requests with header lists larger than MaxHeaderBytes are rejected.
+// The ConnState callback is called with a net.Conn that represents the QUIC session.
+// The QUIC session can be obtained by calling its Session method.
+//
+// The Server supports CONNECT requests, as well as extended CONNECT requests (RFC 8441), which are used to bootstrap protocols like WebSockets.
+// The Proto of an extended CONNECT request is the value of its :protocol pseudo-header, e.g. "websocket".
+// Handlers obtain the data stream of a CONNECT request as a net.Conn by calling Hijack.
 type Server struct {
 	*http.Server
 
@@ -122,23 +160,32 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 }
 
 func (s *Server) handleHeaderStream(session streamCreator) {
+	state := newSessionState(s, session)
+	defer state.close()
+
 	stream, err := session.AcceptStream()
 	if err != nil {
 		session.Close(qerr.Error(qerr.InvalidHeadersStreamData, err.Error()))
 		return
 	}
+	// the streams opened after the header stream are accepted, such that tunnels can use the streams announced by the client
+	peers := newPeerStreams(session, nil)
+	go peers.run()
 
 	hpackDecoder := hpack.NewDecoder(4096, nil)
 	h2framer := http2.NewFramer(nil, stream)
 
 	var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
+	pusher := newPusher(s, session, stream, &headerStreamMutex)
+	trailers := newTrailerMap()
 	for {
-		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
+		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer, pusher, trailers, state, peers); err != nil {
+			trailers.closeAll()
 			// QuicErrors must originate from stream.Read() returning an error.
 			// In this case, the session has already logged the error, so we don't
 			// need to log it again.
 			if _, ok := err.(*qerr.QuicError); !ok {
-				utils.Errorf("error handling h2 request: %s", err.Error())
+				s.logf("error handling h2 request: %s", err.Error())
 			}
 			session.Close(err)
 			return
@@ -146,43 +193,96 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 	}
 }
 
-func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
+// writeSettings sends the settings of the server.
+// It announces support for extended CONNECT requests.
+// Clients that don't support SETTINGS frames reject them, so they are only sent in response to the SETTINGS of the client.
+func (s *Server) writeSettings(headerStream quic.Stream, headerStreamMutex *sync.Mutex) error {
+	headerStreamMutex.Lock()
+	defer headerStreamMutex.Unlock()
+	return http2.NewFramer(headerStream, nil).WriteSettings(http2.Setting{ID: settingEnableConnectProtocol, Val: 1})
+}
+
+func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer, pusher *pusher, trailers *trailerMap, state *sessionState, peers *peerStreams) error {
 	h2frame, err := h2framer.ReadFrame()
 	if err != nil {
 		return qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
 	}
+	if settingsFrame, ok := h2frame.(*http2.SettingsFrame); ok {
+		if err := pusher.handleSettings(settingsFrame); err != nil {
+			return qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
+		}
+		if state.shouldSendSettings() {
+			return s.writeSettings(headerStream, headerStreamMutex)
+		}
+		return nil
+	}
 	h2headersFrame, ok := h2frame.(*http2.HeadersFrame)
 	if !ok {
 		return qerr.Error(qerr.InvalidHeadersStreamData, "expected a header frame")
 	}
-	if !h2headersFrame.HeadersEnded() {
-		return errors.New("http2 header continuation not implemented")
-	}
-	headers, err := hpackDecoder.DecodeFull(h2headersFrame.HeaderBlockFragment())
+	headers, tooLarge, err := readHeaderBlock(h2framer, hpackDecoder, h2headersFrame, s.maxHeaderListSize())
 	if err != nil {
-		utils.Errorf("invalid http2 headers encoding: %s", err.Error())
+		s.logf("invalid http2 headers encoding: %s", err.Error())
 		return err
 	}
 
-	req, err := requestFromHeaders(headers)
-	if err != nil {
-		return err
+	dataStreamID := protocol.StreamID(h2headersFrame.StreamID)
+	if isTrailers(headers) {
+		if !h2headersFrame.StreamEnded() {
+			return qerr.Error(qerr.InvalidHeadersStreamData, "trailers must end the stream")
+		}
+		// the request is already being handled, so it can't be rejected any more
+		if tooLarge {
+			return qerr.Error(qerr.InvalidHeadersStreamData, "trailers too large")
+		}
+		trailers.deliver(dataStreamID, trailerFromHeaders(headers))
+		return nil
 	}
 
-	if utils.Debug() {
-		utils.Infof("%s %s%s, on data stream %d", req.Method, req.Host, req.RequestURI, h2headersFrame.StreamID)
-	} else {
-		utils.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
+	var req *http.Request
+	if !tooLarge {
+		req, err = requestFromHeaders(headers)
+		if err != nil {
+			return err
+		}
+
+		if utils.Debug() {
+			utils.Infof("%s %s%s, on data stream %d", req.Method, req.Host, req.RequestURI, h2headersFrame.StreamID)
+		} else {
+			utils.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
+		}
 	}
 
-	dataStream, err := session.GetOrOpenStream(protocol.StreamID(h2headersFrame.StreamID))
+	// the data stream might be owned by a tunnel, e.g. by a WebTransport session
+	if !state.requestStarted(dataStreamID) {
+		return qerr.Error(qerr.InvalidHeadersStreamData, fmt.Sprintf("data stream %d is already in use", dataStreamID))
+	}
+	dataStream, err := session.GetOrOpenStream(dataStreamID)
 	if err != nil {
 		return err
 	}
 	// this can happen if the client immediately closes the data stream after sending the request and the runtime processes the reset before the request
 	if dataStream == nil {
+		state.requestFinished(dataStreamID)
+		return nil
+	}
+	if tooLarge {
+		utils.Debugf("Rejecting request on data stream %d: header list too large", dataStreamID)
+		go func() {
+			s.rejectHeaderListTooLarge(headerStream, headerStreamMutex, dataStream, dataStreamID, h2headersFrame.StreamEnded())
+			state.requestFinished(dataStreamID)
+		}()
 		return nil
 	}
+	if s.ReadTimeout > 0 {
+		dataStream.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+	reqBody := newRequestBody(dataStream)
+	// trailers are sent after the body, so a request that ended the stream doesn't have trailers
+	if req.Trailer != nil && !h2headersFrame.StreamEnded() {
+		trailers.expect(dataStreamID)
+		reqBody.trailers = newTrailerReceiver(trailers, dataStreamID, req.Trailer)
+	}
 
 	// handleRequest should be as non-blocking as possible to minimize
 	// head-of-line blocking. Potentially blocking code is run in a separate
@@ -195,36 +295,39 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 			_, _ = dataStream.Read([]byte{0}) // read the eof
 		}
 
-		req = req.WithContext(dataStream.Context())
-		reqBody := newRequestBody(dataStream)
+		connState := session.ConnectionState()
+		ctx, cancel := s.requestContext(session, dataStream, connState)
+		defer cancel()
+		req = req.WithContext(ctx)
 		req.Body = reqBody
 
 		req.RemoteAddr = session.RemoteAddr().String()
+		req.TLS = tlsConnectionState(connState)
 
-		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID))
-
-		handler := s.Handler
-		if handler == nil {
-			handler = http.DefaultServeMux
+		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, dataStreamID)
+		responseWriter.ctx = ctx
+		responseWriter.push = func(target string, opts *http.PushOptions) error {
+			return pusher.push(req, dataStreamID, target, opts)
 		}
-		panicked := false
-		func() {
-			defer func() {
-				if p := recover(); p != nil {
-					// Copied from net/http/server.go
-					const size = 64 << 10
-					buf := make([]byte, size)
-					buf = buf[:runtime.Stack(buf, false)]
-					utils.Errorf("http: panic serving: %v\n%s", p, buf)
-					panicked = true
+		if isTunnelRequest(req.Method) {
+			conn := newStreamConn(dataStream, session.LocalAddr(), session.RemoteAddr(), func() { state.requestFinished(dataStreamID) })
+			conn.acceptStream = func(ctx context.Context, id protocol.StreamID) (quic.Stream, error) {
+				if id == headerStream.StreamID() || !state.claimStream(dataStreamID, id) {
+					return nil, fmt.Errorf("h2quic: stream %d is already in use", id)
 				}
-			}()
-			handler.ServeHTTP(responseWriter, req)
-		}()
-		if panicked {
-			responseWriter.WriteHeader(500)
-		} else {
-			responseWriter.WriteHeader(200)
+				return peers.get(ctx, id)
+			}
+			responseWriter.conn = conn
+		}
+
+		s.runHandler(responseWriter, req)
+		if reqBody.trailers != nil {
+			reqBody.trailers.close()
+		}
+		if responseWriter.hijacked {
+			// The handler now owns the data stream.
+			// The request is active until the net.Conn returned by Hijack is closed.
+			return
 		}
 		if responseWriter.dataStream != nil {
 			if !streamEnded && !reqBody.requestRead {
@@ -233,6 +336,7 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 			}
 			responseWriter.dataStream.Close()
 		}
+		state.requestFinished(dataStreamID)
 		if s.CloseAfterFirstRequest {
 			time.Sleep(100 * time.Millisecond)
 			session.Close(nil)
@@ -242,6 +346,142 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	return nil
 }
 
+// rejectHeaderListTooLarge responds to a request with a header list larger than MaxHeaderBytes
+func (s *Server) rejectHeaderListTooLarge(headerStream quic.Stream, headerStreamMutex *sync.Mutex, dataStream quic.Stream, dataStreamID protocol.StreamID, streamEnded bool) {
+	if streamEnded {
+		dataStream.(remoteCloser).CloseRemote(0)
+		_, _ = dataStream.Read([]byte{0}) // read the eof
+	} else {
+		// in gQUIC, the error code doesn't matter, so just use 0 here
+		dataStream.CancelRead(0)
+	}
+	if s.WriteTimeout > 0 {
+		dataStream.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, dataStreamID)
+	responseWriter.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+	// copied from net/http2/server.go
+	responseWriter.Write([]byte("<h1>HTTP Error 431</h1><p>Request header field or fields too large</p>"))
+	if err := responseWriter.flush(); err != nil {
+		dataStream.CancelWrite(0)
+		return
+	}
+	dataStream.Close()
+}
+
+// requestContext creates the context of a request.
+// It is canceled when the data stream is closed or reset, or when the session is closed.
+// The cancel function must be called when the request was handled.
+func (s *Server) requestContext(session quic.Session, str quic.Stream, connState quic.ConnectionState) (context.Context, context.CancelFunc) {
+	cctx, cancel := context.WithCancel(str.Context())
+	go func() {
+		select {
+		case <-session.Context().Done():
+			cancel()
+		case <-cctx.Done():
+		}
+	}()
+	ctx := context.WithValue(cctx, http.ServerContextKey, s.Server)
+	ctx = context.WithValue(ctx, http.LocalAddrContextKey, session.LocalAddr())
+	ctx = context.WithValue(ctx, SessionContextKey, session)
+	ctx = context.WithValue(ctx, StreamContextKey, str)
+	return context.WithValue(ctx, ConnectionStateContextKey, connState), cancel
+}
+
+// tlsConnectionState converts the state of the QUIC connection to a tls.ConnectionState
+func tlsConnectionState(state quic.ConnectionState) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		HandshakeComplete:          state.HandshakeComplete,
+		DidResume:                  state.DidResume,
+		CipherSuite:                state.CipherSuite,
+		NegotiatedProtocol:         state.NegotiatedProtocol,
+		NegotiatedProtocolIsMutual: true,
+		ServerName:                 state.ServerName,
+		PeerCertificates:           state.PeerCertificates,
+		VerifiedChains:             state.VerifiedChains,
+	}
+}
+
+// runHandler runs the handler, and writes the response header if the handler didn't write it.
+// Afterwards, it flushes the response and writes the trailers.
+// If the response can't be sent completely, the stream is reset.
+func (s *Server) runHandler(responseWriter *responseWriter, req *http.Request) {
+	if s.WriteTimeout > 0 {
+		responseWriter.dataStream.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	panicked := false
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				// Copied from net/http/server.go
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				s.logf("http: panic serving: %v\n%s", p, buf)
+				panicked = true
+			}
+		}()
+		handler.ServeHTTP(responseWriter, req)
+	}()
+	if responseWriter.hijacked {
+		return
+	}
+	if panicked {
+		responseWriter.WriteHeader(500)
+	} else {
+		responseWriter.WriteHeader(200)
+	}
+	if err := responseWriter.flush(); err != nil {
+		utils.Debugf("could not send the response on stream %d: %s", responseWriter.dataStreamID, err.Error())
+		// in gQUIC, the error code doesn't matter, so just use 0 here
+		responseWriter.dataStream.CancelWrite(0)
+		return
+	}
+	responseWriter.writeTrailers()
+}
+
+// logf logs an error to the ErrorLog of the http.Server.
+// If no ErrorLog is set, the error is logged by the quic-go logger.
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	utils.Errorf(format, args...)
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+	return s.ReadTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return s.ReadTimeout
+}
+
+// maxHeaderListSize returns the maximum size of the header list of a request
+// copied from net/http2/server.go
+func (s *Server) maxHeaderListSize() uint32 {
+	n := s.MaxHeaderBytes
+	if n <= 0 {
+		n = http.DefaultMaxHeaderBytes
+	}
+	// http2's count is in a slightly different unit and includes 32 bytes per pair.
+	// So, take the net/http.Server value and pad it up a bit, assuming 10 headers.
+	const perFieldOverhead = 32 // per http2 spec
+	const typicalHeaders = 10   // conservative
+	return uint32(n + typicalHeaders*perFieldOverhead)
+}
+
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
 // Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) Close() error {
@@ -0,0 +1,197 @@
+package h2quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ErrRecursivePush is returned by Push when a handler serving a pushed response tries to push
+var ErrRecursivePush = errors.New("h2quic: recursive push not allowed")
+
+// A pusher pushes responses on a single QUIC connection.
+type pusher struct {
+	server *Server
+
+	session           streamCreator
+	headerStream      quic.Stream
+	headerStreamMutex *sync.Mutex
+
+	disabled int32 // set to 1 when the client sends SETTINGS_ENABLE_PUSH = 0, accessed atomically
+}
+
+func newPusher(server *Server, session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex) *pusher {
+	return &pusher{
+		server:            server,
+		session:           session,
+		headerStream:      headerStream,
+		headerStreamMutex: headerStreamMutex,
+	}
+}
+
+// handleSettings applies the settings sent by the client
+func (p *pusher) handleSettings(f *http2.SettingsFrame) error {
+	return f.ForeachSetting(func(s http2.Setting) error {
+		if s.ID != http2.SettingEnablePush {
+			return nil
+		}
+		switch s.Val {
+		case 0:
+			atomic.StoreInt32(&p.disabled, 1)
+		case 1:
+			atomic.StoreInt32(&p.disabled, 0)
+		default:
+			return fmt.Errorf("invalid value for SETTINGS_ENABLE_PUSH: %d", s.Val)
+		}
+		return nil
+	})
+}
+
+func (p *pusher) enabled() bool {
+	return atomic.LoadInt32(&p.disabled) == 0
+}
+
+// push sends a PUSH_PROMISE for the target on the header stream, associated with the stream of req.
+// It then runs the handler for the promised request on a new server-initiated stream.
+func (p *pusher) push(req *http.Request, associatedStreamID protocol.StreamID, target string, opts *http.PushOptions) error {
+	if !p.enabled() {
+		return http.ErrNotSupported
+	}
+	promise, err := newPromisedRequest(req, target, opts)
+	if err != nil {
+		return err
+	}
+
+	str, err := p.session.OpenStream()
+	if err != nil {
+		return err
+	}
+
+	var headers bytes.Buffer
+	enc := hpack.NewEncoder(&headers)
+	enc.WriteField(hpack.HeaderField{Name: ":method", Value: promise.Method})
+	enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: promise.URL.Scheme})
+	enc.WriteField(hpack.HeaderField{Name: ":authority", Value: promise.Host})
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: promise.RequestURI})
+	for k, vv := range promise.Header {
+		for _, v := range vv {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+
+	utils.Infof("Pushing %s on stream %d", promise.RequestURI, str.StreamID())
+	p.headerStreamMutex.Lock()
+	h2framer := http2.NewFramer(p.headerStream, nil)
+	// The PUSH_PROMISE is not split into CONTINUATION frames, since the http2.Framer doesn't accept CONTINUATION frames following a PUSH_PROMISE.
+	err = h2framer.WritePushPromise(http2.PushPromiseParam{
+		StreamID:      uint32(associatedStreamID),
+		PromiseID:     uint32(str.StreamID()),
+		BlockFragment: headers.Bytes(),
+		EndHeaders:    true,
+	})
+	p.headerStreamMutex.Unlock()
+	if err != nil {
+		str.CancelWrite(0)
+		return err
+	}
+
+	promise.RemoteAddr = req.RemoteAddr
+	promise.TLS = req.TLS
+	go p.servePush(promise, str)
+	return nil
+}
+
+func (p *pusher) servePush(req *http.Request, str quic.Stream) {
+	ctx, cancel := p.server.requestContext(p.session, str, p.session.ConnectionState())
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	// the client never sends data on a pushed stream
+	str.(remoteCloser).CloseRemote(0)
+	_, _ = str.Read([]byte{0}) // read the eof
+
+	// pushed responses can't push again, so the responseWriter doesn't get a pusher
+	responseWriter := newResponseWriter(p.headerStream, p.headerStreamMutex, str, str.StreamID())
+	responseWriter.ctx = ctx
+	p.server.runHandler(responseWriter, req)
+	str.Close()
+}
+
+// newPromisedRequest validates the target and options of a push, and creates the promised request.
+// The validation is copied from http2.responseWriter.Push.
+func newPromisedRequest(req *http.Request, target string, opts *http.PushOptions) (*http.Request, error) {
+	if opts == nil {
+		opts = new(http.PushOptions)
+	}
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+	// The RFC effectively limits promised requests to GET and HEAD:
+	// "Promised requests MUST be cacheable [GET, HEAD, or POST], and MUST be safe [GET or HEAD]"
+	// http://tools.ietf.org/html/rfc7540#section-8.2
+	if method != "GET" && method != "HEAD" {
+		return nil, fmt.Errorf("method %q must be GET or HEAD", method)
+	}
+
+	const wantScheme = "https"
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return nil, fmt.Errorf("target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = wantScheme
+		u.Host = req.Host
+	} else {
+		if u.Scheme != wantScheme {
+			return nil, fmt.Errorf("cannot push URL with scheme %q from request with scheme %q", u.Scheme, wantScheme)
+		}
+		if u.Host == "" {
+			return nil, errors.New("URL must have a host")
+		}
+	}
+
+	header := http.Header{}
+	for k, vv := range opts.Header {
+		if strings.HasPrefix(k, ":") {
+			return nil, fmt.Errorf("promised request headers cannot include pseudo header %q", k)
+		}
+		// These headers are meaningful only if the request has a body,
+		// but PUSH_PROMISE requests cannot have a body.
+		// http://tools.ietf.org/html/rfc7540#section-8.2
+		// Also disallow Host, since the promised URL must be absolute.
+		switch strings.ToLower(k) {
+		case "content-length", "content-encoding", "trailer", "te", "expect", "host":
+			return nil, fmt.Errorf("promised request headers cannot include %q", k)
+		case "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+			return nil, fmt.Errorf("request header %q is not valid in HTTP/2", k)
+		}
+		header[k] = append([]string(nil), vv...)
+	}
+
+	return &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		ProtoMinor: 0,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       u.Host,
+		RequestURI: u.RequestURI(),
+	}, nil
+}
@@ -0,0 +1,183 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server Push", func() {
+	var (
+		s            *Server
+		session      *mockSession
+		headerStream *mockStream
+		pushedStream *mockStream
+		pusher       *pusher
+		req          *http.Request
+	)
+
+	// the request for https://www.example.com/, taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+	requestFrame := []byte{
+		0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+		0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+	}
+
+	decodeHeaders := func(data []byte) map[string]string {
+		fields, err := hpack.NewDecoder(4096, nil).DecodeFull(data)
+		Expect(err).ToNot(HaveOccurred())
+		headers := make(map[string]string)
+		for _, hf := range fields {
+			headers[hf.Name] = hf.Value
+		}
+		return headers
+	}
+
+	BeforeEach(func() {
+		s = &Server{Server: &http.Server{}}
+		session = newMockSession()
+		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
+		pushedStream = newMockStream(2)
+		close(pushedStream.unblockRead)
+		session.streamsToOpen = []quic.Stream{pushedStream}
+		headerStream = &mockStream{}
+		pusher = newPusher(s, session, headerStream, &sync.Mutex{})
+		var err error
+		req, err = http.NewRequest("GET", "https://www.example.com/", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("sends a PUSH_PROMISE and serves the pushed response", func() {
+		handlerCalled := make(chan *http.Request, 1)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled <- r
+			w.Write([]byte("pushed"))
+		})
+		header := http.Header{}
+		header.Set("Accept", "text/css")
+		err := pusher.push(req, 5, "/style.css", &http.PushOptions{Header: header})
+		Expect(err).ToNot(HaveOccurred())
+		var r *http.Request
+		Eventually(handlerCalled).Should(Receive(&r))
+		Expect(r.Method).To(Equal("GET"))
+		Expect(r.Host).To(Equal("www.example.com"))
+		Expect(r.URL.Path).To(Equal("/style.css"))
+		Expect(r.Header.Get("Accept")).To(Equal("text/css"))
+		Expect(r.Context().Value(StreamContextKey)).To(Equal(pushedStream))
+		Eventually(func() bool { return pushedStream.closed }).Should(BeTrue())
+		Expect(pushedStream.remoteClosed).To(BeTrue())
+		Expect(pushedStream.dataWritten.Bytes()).To(Equal([]byte("pushed")))
+
+		h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+		frame, err := h2framer.ReadFrame()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&http2.PushPromiseFrame{}))
+		pushPromise := frame.(*http2.PushPromiseFrame)
+		Expect(pushPromise.StreamID).To(BeEquivalentTo(5))
+		Expect(pushPromise.PromiseID).To(BeEquivalentTo(2))
+		Expect(decodeHeaders(pushPromise.HeaderBlockFragment())).To(Equal(map[string]string{
+			":method":    "GET",
+			":scheme":    "https",
+			":authority": "www.example.com",
+			":path":      "/style.css",
+			"accept":     "text/css",
+		}))
+		// the response is sent on the header stream, for the promised stream
+		frame, err = h2framer.ReadFrame()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&http2.HeadersFrame{}))
+		Expect(frame.Header().StreamID).To(BeEquivalentTo(2))
+	})
+
+	It("doesn't allow pushes from pushed responses", func() {
+		pushErr := make(chan error, 1)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pushErr <- w.(http.Pusher).Push("/foo.js", nil)
+		})
+		Expect(pusher.push(req, 5, "/style.css", nil)).To(Succeed())
+		Eventually(pushErr).Should(Receive(Equal(ErrRecursivePush)))
+	})
+
+	It("pushes from a handler", func() {
+		pushErr := make(chan error, 1)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				pushErr <- w.(http.Pusher).Push("/style.css", nil)
+			}
+		})
+		dataStream := newMockStream(5)
+		close(dataStream.unblockRead)
+		session.dataStream = dataStream
+		headerStream.dataToRead.Write(requestFrame)
+		err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream), pusher, newTrailerMap(), newSessionState(s, session), newPeerStreams(session, nil))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(pushErr).Should(Receive(BeNil()))
+		Eventually(func() bool { return pushedStream.closed }).Should(BeTrue())
+	})
+
+	It("doesn't push if the client disabled push", func() {
+		var settings bytes.Buffer
+		Expect(http2.NewFramer(&settings, nil).WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 0})).To(Succeed())
+		headerStream.dataToRead.Write(settings.Bytes())
+		err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream), pusher, newTrailerMap(), newSessionState(s, session), newPeerStreams(session, nil))
+		Expect(err).ToNot(HaveOccurred())
+		// the server responded with its own SETTINGS
+		written := headerStream.dataWritten.Len()
+		Expect(pusher.push(req, 5, "/style.css", nil)).To(MatchError(http.ErrNotSupported))
+		Expect(headerStream.dataWritten.Len()).To(Equal(written))
+	})
+
+	It("errors on invalid values for SETTINGS_ENABLE_PUSH", func() {
+		var settings bytes.Buffer
+		Expect(http2.NewFramer(&settings, nil).WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 2})).To(Succeed())
+		headerStream.dataToRead.Write(settings.Bytes())
+		err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream), pusher, newTrailerMap(), newSessionState(s, session), newPeerStreams(session, nil))
+		Expect(err).To(MatchError("InvalidHeadersStreamData: invalid value for SETTINGS_ENABLE_PUSH: 2"))
+	})
+
+	Context("validating the promised request", func() {
+		It("accepts absolute URLs", func() {
+			promise, err := newPromisedRequest(req, "https://www.example.com/foo?bar=baz", &http.PushOptions{Method: "HEAD"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(promise.Method).To(Equal("HEAD"))
+			Expect(promise.Host).To(Equal("www.example.com"))
+			Expect(promise.RequestURI).To(Equal("/foo?bar=baz"))
+		})
+
+		It("rejects relative paths", func() {
+			_, err := newPromisedRequest(req, "style.css", nil)
+			Expect(err).To(MatchError(`target must be an absolute URL or an absolute path: "style.css"`))
+		})
+
+		It("rejects other schemes", func() {
+			_, err := newPromisedRequest(req, "http://www.example.com/style.css", nil)
+			Expect(err).To(MatchError(`cannot push URL with scheme "http" from request with scheme "https"`))
+		})
+
+		It("rejects methods other than GET and HEAD", func() {
+			_, err := newPromisedRequest(req, "/style.css", &http.PushOptions{Method: "POST"})
+			Expect(err).To(MatchError(`method "POST" must be GET or HEAD`))
+		})
+
+		It("rejects headers that require a body", func() {
+			header := http.Header{}
+			header.Set("Content-Length", "42")
+			_, err := newPromisedRequest(req, "/style.css", &http.PushOptions{Header: header})
+			Expect(err).To(MatchError(`promised request headers cannot include "Content-Length"`))
+		})
+
+		It("rejects connection-specific headers", func() {
+			header := http.Header{}
+			header.Set("Connection", "close")
+			_, err := newPromisedRequest(req, "/style.css", &http.PushOptions{Header: header})
+			Expect(err).To(MatchError(`request header "Connection" is not valid in HTTP/2`))
+		})
+	})
+})
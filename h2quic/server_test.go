@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"strings"
@@ -29,11 +32,12 @@ type mockSession struct {
 	closed              bool
 	closedWithError     error
 	dataStream          quic.Stream
-	streamToAccept      quic.Stream
+	streamToAccept      quic.Stream // returned by the first call to AcceptStream
 	streamsToOpen       []quic.Stream
 	blockOpenStreamSync bool
 	blockOpenStreamChan chan struct{} // close this chan (or call Close) to make OpenStreamSync return
 	streamOpenErr       error
+	connectionState     quic.ConnectionState
 	ctx                 context.Context
 	ctxCancel           context.CancelFunc
 }
@@ -45,7 +49,17 @@ func newMockSession() *mockSession {
 func (s *mockSession) GetOrOpenStream(id protocol.StreamID) (quic.Stream, error) {
 	return s.dataStream, nil
 }
-func (s *mockSession) AcceptStream() (quic.Stream, error) { return s.streamToAccept, nil }
+func (s *mockSession) AcceptStream() (quic.Stream, error) {
+	if str := s.streamToAccept; str != nil {
+		s.streamToAccept = nil
+		return str, nil
+	}
+	<-s.ctx.Done()
+	return nil, errors.New("session closed")
+}
+func (s *mockSession) AcceptStreamContext(context.Context) (quic.Stream, error) {
+	return s.AcceptStream()
+}
 func (s *mockSession) OpenStream() (quic.Stream, error) {
 	if s.streamOpenErr != nil {
 		return nil, s.streamOpenErr
@@ -55,8 +69,15 @@ func (s *mockSession) OpenStream() (quic.Stream, error) {
 	return str, nil
 }
 func (s *mockSession) OpenStreamSync() (quic.Stream, error) {
+	return s.OpenStreamSyncContext(context.Background())
+}
+func (s *mockSession) OpenStreamSyncContext(ctx context.Context) (quic.Stream, error) {
 	if s.blockOpenStreamSync {
-		<-s.blockOpenStreamChan
+		select {
+		case <-s.blockOpenStreamChan:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 	return s.OpenStream()
 }
@@ -70,7 +91,7 @@ func (s *mockSession) Close(e error) error {
 	return nil
 }
 func (s *mockSession) LocalAddr() net.Addr {
-	panic("not implemented")
+	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 443}
 }
 func (s *mockSession) RemoteAddr() net.Addr {
 	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 42}
@@ -78,10 +99,39 @@ func (s *mockSession) RemoteAddr() net.Addr {
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
-func (s *mockSession) ConnectionState() quic.ConnectionState        { panic("not implemented") }
+func (s *mockSession) ConnectionState() quic.ConnectionState { return s.connectionState }
+func (s *mockSession) ExportKeyingMaterial(string, []byte, int) ([]byte, error) {
+	panic("not implemented")
+}
 func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) { panic("not implemented") }
 func (s *mockSession) OpenUniStream() (quic.SendStream, error)      { panic("not implemented") }
 func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)  { panic("not implemented") }
+func (s *mockSession) AddLocalAddress(net.Addr) error               { panic("not implemented") }
+func (s *mockSession) RemoveLocalAddress(net.Addr) error            { panic("not implemented") }
+func (s *mockSession) AcceptUniStreamContext(context.Context) (quic.ReceiveStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenUniStreamSyncContext(context.Context) (quic.SendStream, error) {
+	panic("not implemented")
+}
+
+// safeBuffer is a bytes.Buffer that can be written to and read from concurrently
+type safeBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
 
 var _ = Describe("H2 server", func() {
 	var (
@@ -114,12 +164,20 @@ var _ = Describe("H2 server", func() {
 			h2framer     *http2.Framer
 			hpackDecoder *hpack.Decoder
 			headerStream *mockStream
+			pusher       *pusher
+			trailers     *trailerMap
+			state        *sessionState
+			peers        *peerStreams
 		)
 
 		BeforeEach(func() {
 			headerStream = &mockStream{}
 			hpackDecoder = hpack.NewDecoder(4096, nil)
 			h2framer = http2.NewFramer(nil, headerStream)
+			pusher = newPusher(s, session, headerStream, &sync.Mutex{})
+			trailers = newTrailerMap()
+			state = newSessionState(s, session)
+			peers = newPeerStreams(session, nil)
 		})
 
 		It("handles a sample GET request", func() {
@@ -135,13 +193,66 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
 
+		It("sets the TLS connection state", func() {
+			cert := &x509.Certificate{Raw: []byte("foobar")}
+			session.connectionState = quic.ConnectionState{
+				HandshakeComplete:  true,
+				ServerName:         "www.example.com",
+				PeerCertificates:   []*x509.Certificate{cert},
+				NegotiatedProtocol: "h2",
+				CipherSuite:        tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			}
+			reqChan := make(chan *http.Request, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reqChan <- r
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			var r *http.Request
+			Eventually(reqChan).Should(Receive(&r))
+			Expect(r.TLS.HandshakeComplete).To(BeTrue())
+			Expect(r.TLS.ServerName).To(Equal("www.example.com"))
+			Expect(r.TLS.PeerCertificates).To(Equal([]*x509.Certificate{cert}))
+			Expect(r.TLS.NegotiatedProtocol).To(Equal("h2"))
+			Expect(r.TLS.NegotiatedProtocolIsMutual).To(BeTrue())
+			Expect(r.TLS.CipherSuite).To(Equal(tls.TLS_RSA_WITH_AES_128_GCM_SHA256))
+		})
+
+		It("makes the session, the stream and the connection state available in the context", func() {
+			session.connectionState = quic.ConnectionState{Version: protocol.VersionTLS}
+			reqChan := make(chan *http.Request, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reqChan <- r
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			var r *http.Request
+			Eventually(reqChan).Should(Receive(&r))
+			ctx := r.Context()
+			Expect(ctx.Value(SessionContextKey)).To(Equal(session))
+			Expect(ctx.Value(StreamContextKey)).To(Equal(dataStream))
+			Expect(ctx.Value(ConnectionStateContextKey)).To(Equal(quic.ConnectionState{Version: protocol.VersionTLS}))
+			Expect(ctx.Value(http.ServerContextKey)).To(Equal(s.Server))
+			Expect(ctx.Value(http.LocalAddrContextKey)).To(Equal(&net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 443}))
+		})
+
 		It("returns 200 with an empty handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 			headerStream.dataToRead.Write([]byte{
@@ -149,7 +260,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -165,7 +276,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -183,7 +294,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
@@ -198,7 +309,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -216,7 +327,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
 		})
@@ -231,7 +342,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -251,18 +362,404 @@ var _ = Describe("H2 server", func() {
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			dataStream.dataToRead.Write([]byte("foo=bar"))
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
 
+		It("populates the trailers of a request", func() {
+			trailerChan := make(chan http.Header, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Trailer).To(Equal(http.Header{"Foo": nil}))
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foobar")))
+				trailerChan <- r.Trailer
+			})
+			var headers bytes.Buffer
+			enc := hpack.NewEncoder(&headers)
+			enc.WriteField(hpack.HeaderField{Name: ":method", Value: "POST"})
+			enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+			enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com"})
+			enc.WriteField(hpack.HeaderField{Name: "trailer", Value: "Foo"})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			dataStream.dataToRead.Write([]byte("foobar"))
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(trailerChan).ShouldNot(Receive())
+			headers.Reset()
+			enc.WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err = s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(trailerChan).Should(Receive(Equal(http.Header{"Foo": []string{"bar"}})))
+		})
+
+		It("ignores trailers for streams that didn't announce trailers", func() {
+			var headers bytes.Buffer
+			hpack.NewEncoder(&headers).WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("errors if trailers don't end the stream", func() {
+			var headers bytes.Buffer
+			hpack.NewEncoder(&headers).WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).To(MatchError("InvalidHeadersStreamData: trailers must end the stream"))
+		})
+
+		It("handles requests with header blocks that span CONTINUATION frames", func() {
+			largeValue := strings.Repeat("a", 2*maxHeaderFragmentSize)
+			headerChan := make(chan http.Header, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headerChan <- r.Header
+			})
+			var headers bytes.Buffer
+			enc := hpack.NewEncoder(&headers)
+			enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+			enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+			enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com"})
+			enc.WriteField(hpack.HeaderField{Name: "foo", Value: largeValue})
+			Expect(writeHeaders(http2.NewFramer(&headerStream.dataToRead, nil), http2.HeadersFrameParam{
+				StreamID:      5,
+				EndStream:     true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			var hdr http.Header
+			Eventually(headerChan).Should(Receive(&hdr))
+			Expect(hdr.Get("foo")).To(Equal(largeValue))
+		})
+
+		It("rejects requests with header lists larger than MaxHeaderBytes", func() {
+			s.MaxHeaderBytes = 1000
+			var handlerCalled bool
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+			})
+			var headers bytes.Buffer
+			enc := hpack.NewEncoder(&headers)
+			enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+			enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+			enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com"})
+			for i := 0; i < 3; i++ {
+				enc.WriteField(hpack.HeaderField{Name: fmt.Sprintf("foo%d", i), Value: strings.Repeat("a", 500)})
+			}
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+			Expect(handlerCalled).To(BeFalse())
+			Expect(dataStream.remoteClosed).To(BeTrue())
+			h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+			frame, err := h2framer.ReadFrame()
+			Expect(err).ToNot(HaveOccurred())
+			fields, err := hpack.NewDecoder(4096, nil).DecodeFull(frame.(*http2.HeadersFrame).HeaderBlockFragment())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fields).To(ContainElement(hpack.HeaderField{Name: ":status", Value: "431"}))
+			Expect(dataStream.dataWritten.String()).To(ContainSubstring("HTTP Error 431"))
+		})
+
+		It("errors if the trailers are larger than MaxHeaderBytes", func() {
+			s.MaxHeaderBytes = 100
+			var headers bytes.Buffer
+			enc := hpack.NewEncoder(&headers)
+			enc.WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+			enc.WriteField(hpack.HeaderField{Name: "bar", Value: strings.Repeat("a", 400)})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).To(MatchError("InvalidHeadersStreamData: trailers too large"))
+		})
+
+		It("sets the read deadline when a ReadTimeout is configured", func() {
+			s.ReadTimeout = time.Minute
+			handlerCalled := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(handlerCalled).Should(BeClosed())
+			Expect(dataStream.readDeadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("reports the state of the session", func() {
+			var connStates []http.ConnState
+			var mutex sync.Mutex
+			s.ConnState = func(_ net.Conn, state http.ConnState) {
+				mutex.Lock()
+				connStates = append(connStates, state)
+				mutex.Unlock()
+			}
+			state = newSessionState(s, session)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() []http.ConnState {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return connStates
+			}).Should(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateIdle}))
+		})
+
+		Context("CONNECT requests", func() {
+			writeConnectRequest := func(id protocol.StreamID) {
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: ":method", Value: "CONNECT"})
+				enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.org:443"})
+				Expect(writeHeaders(http2.NewFramer(&headerStream.dataToRead, nil), http2.HeadersFrameParam{
+					StreamID:      uint32(id),
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+			}
+
+			It("hands the data stream of an extended CONNECT request over to the handler", func() {
+				connChan := make(chan net.Conn, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Proto).To(Equal("websocket"))
+					Expect(r.RequestURI).To(Equal("/chat"))
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).ToNot(HaveOccurred())
+					connChan <- conn
+				})
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: ":method", Value: "CONNECT"})
+				enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.org"})
+				enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/chat"})
+				enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+				enc.WriteField(hpack.HeaderField{Name: ":protocol", Value: "websocket"})
+				Expect(writeHeaders(http2.NewFramer(&headerStream.dataToRead, nil), http2.HeadersFrameParam{
+					StreamID:      5,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var conn net.Conn
+				Eventually(connChan).Should(Receive(&conn))
+				Consistently(func() bool { return dataStream.closed }).Should(BeFalse())
+				Expect(conn.Close()).To(Succeed())
+				Expect(dataStream.closed).To(BeTrue())
+			})
+
+			It("closes the data stream if the handler doesn't hijack the connection", func() {
+				reqChan := make(chan *http.Request, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					reqChan <- r
+				})
+				writeConnectRequest(5)
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var r *http.Request
+				Eventually(reqChan).Should(Receive(&r))
+				Expect(r.Method).To(Equal("CONNECT"))
+				Expect(r.Host).To(Equal("www.example.org:443"))
+				Expect(r.RequestURI).To(Equal("www.example.org:443"))
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				Expect(dataStream.reset).To(BeTrue())
+			})
+
+			It("only hands announced streams over to the tunnel once the client opened them", func() {
+				connChan := make(chan net.Conn, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).ToNot(HaveOccurred())
+					connChan <- conn
+				})
+				writeConnectRequest(5)
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var conn net.Conn
+				Eventually(connChan).Should(Receive(&conn))
+				acceptor := conn.(interface {
+					AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+				})
+				strChan := make(chan quic.Stream, 1)
+				go func() {
+					defer GinkgoRecover()
+					str, err := acceptor.AcceptAnnouncedStream(context.Background(), 9)
+					Expect(err).ToNot(HaveOccurred())
+					strChan <- str
+				}()
+				Consistently(strChan).ShouldNot(Receive())
+				session.streamToAccept = newMockStream(9)
+				go peers.run()
+				Eventually(strChan).Should(Receive(Equal(dataStream)))
+				// the stream can only be accepted once
+				_, err = acceptor.AcceptAnnouncedStream(context.Background(), 9)
+				Expect(err).To(MatchError("h2quic: stream 9 is already in use"))
+			})
+
+			It("stops waiting for an announced stream when the context is canceled", func() {
+				connChan := make(chan net.Conn, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).ToNot(HaveOccurred())
+					connChan <- conn
+				})
+				writeConnectRequest(5)
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var conn net.Conn
+				Eventually(connChan).Should(Receive(&conn))
+				acceptor := conn.(interface {
+					AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+				})
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				_, err = acceptor.AcceptAnnouncedStream(ctx, 9)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+			})
+
+			It("rejects requests on streams owned by a tunnel", func() {
+				connChan := make(chan net.Conn, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).ToNot(HaveOccurred())
+					connChan <- conn
+				})
+				writeConnectRequest(5)
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var conn net.Conn
+				Eventually(connChan).Should(Receive(&conn))
+				session.streamToAccept = newMockStream(9)
+				go peers.run()
+				_, err = conn.(interface {
+					AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+				}).AcceptAnnouncedStream(context.Background(), 9)
+				Expect(err).ToNot(HaveOccurred())
+				// the data stream of the tunnel and the stream announced on the tunnel can't be used for requests
+				writeConnectRequest(5)
+				err = s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).To(MatchError(qerr.Error(qerr.InvalidHeadersStreamData, "data stream 5 is already in use")))
+				writeConnectRequest(9)
+				err = s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).To(MatchError(qerr.Error(qerr.InvalidHeadersStreamData, "data stream 9 is already in use")))
+				// the streams are released when the tunnel is closed
+				Expect(conn.Close()).To(Succeed())
+				Expect(state.requestStarted(9)).To(BeTrue())
+			})
+
+			It("hands the data stream over to the handler when it hijacks the connection", func() {
+				var connStates []http.ConnState
+				var mutex sync.Mutex
+				s.ConnState = func(_ net.Conn, state http.ConnState) {
+					mutex.Lock()
+					connStates = append(connStates, state)
+					mutex.Unlock()
+				}
+				getConnStates := func() []http.ConnState {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return connStates
+				}
+				state = newSessionState(s, session)
+				headerStream.id = 3
+				connChan := make(chan net.Conn, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).ToNot(HaveOccurred())
+					connChan <- conn
+				})
+				writeConnectRequest(5)
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+				Expect(err).NotTo(HaveOccurred())
+				var conn net.Conn
+				Eventually(connChan).Should(Receive(&conn))
+				Expect(conn.RemoteAddr()).To(Equal(session.RemoteAddr()))
+				// the header stream and the data streams of active requests are used by h2quic
+				acceptor := conn.(interface {
+					AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+				})
+				_, err = acceptor.AcceptAnnouncedStream(context.Background(), headerStream.StreamID())
+				Expect(err).To(MatchError("h2quic: stream 3 is already in use"))
+				_, err = acceptor.AcceptAnnouncedStream(context.Background(), 5)
+				Expect(err).To(HaveOccurred())
+				Expect(state.requestStarted(7)).To(BeTrue())
+				_, err = acceptor.AcceptAnnouncedStream(context.Background(), 7)
+				Expect(err).To(MatchError("h2quic: stream 7 is already in use"))
+				state.requestFinished(7)
+				Consistently(func() bool { return dataStream.closed }).Should(BeFalse())
+				Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive}))
+				Expect(conn.Close()).To(Succeed())
+				Expect(dataStream.closed).To(BeTrue())
+				Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateIdle}))
+			})
+		})
+
+		It("logs panics to the ErrorLog", func() {
+			logBuf := &safeBuffer{}
+			s.ErrorLog = log.New(logBuf, "", 0)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("foobar")
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(logBuf.String).Should(ContainSubstring("http: panic serving: foobar"))
+		})
+
 		It("errors when non-header frames are received", func() {
 			headerStream.dataToRead.Write([]byte{
 				0x0, 0x0, 0x06, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
 				'f', 'o', 'o', 'b', 'a', 'r',
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
 		})
 
@@ -281,13 +778,68 @@ var _ = Describe("H2 server", func() {
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
 			dataStream.Close()
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
 
+		It("cancels the request context when the session is closed", func() {
+			ctxChan := make(chan context.Context, 1)
+			handlerReturned := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(handlerReturned)
+				ctxChan <- r.Context()
+				<-r.Context().Done()
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			var ctx context.Context
+			Eventually(ctxChan).Should(Receive(&ctx))
+			Consistently(ctx.Done()).ShouldNot(BeClosed())
+			session.Close(nil)
+			Eventually(ctx.Done()).Should(BeClosed())
+			Eventually(handlerReturned).Should(BeClosed())
+		})
+
+		It("sets the write deadline when a WriteTimeout is configured", func() {
+			s.WriteTimeout = time.Minute
+			handlerCalled := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(handlerCalled).Should(BeClosed())
+			Eventually(func() time.Time { return dataStream.writeDeadline }).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("resets the dataStream when the response can't be flushed", func() {
+			dataStream.writeErr = errors.New("deadline exceeded")
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("foobar"))
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, pusher, trailers, state, peers)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() bool { return dataStream.canceledWrite }).Should(BeTrue())
+		})
+
 	})
 
 	It("handles the header stream", func() {
@@ -307,6 +859,58 @@ var _ = Describe("H2 server", func() {
 		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 	})
 
+	It("announces support for extended CONNECT after the client sent its SETTINGS", func() {
+		headerStream := &mockStream{id: 3}
+		h2framer := http2.NewFramer(&headerStream.dataToRead, nil)
+		Expect(h2framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 0})).To(Succeed())
+		Expect(h2framer.WriteSettings()).To(Succeed())
+		headerStream.dataToRead.Write(bytes.Repeat([]byte{0}, 100))
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		// the header stream contains invalid data, so the session is closed after the settings were sent
+		Eventually(func() bool { return session.closed }).Should(BeTrue())
+		framer := http2.NewFramer(nil, &headerStream.dataWritten)
+		frame, err := framer.ReadFrame()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&http2.SettingsFrame{}))
+		val, ok := frame.(*http2.SettingsFrame).Value(settingEnableConnectProtocol)
+		Expect(ok).To(BeTrue())
+		Expect(val).To(BeEquivalentTo(1))
+		// the SETTINGS are only sent once
+		_, err = framer.ReadFrame()
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("only sends HEADERS frames to clients that don't send SETTINGS", func() {
+		s.CloseAfterFirstRequest = true
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("foobar"))
+		})
+		headerStream := &mockStream{id: 3}
+		headerStream.dataToRead.Write([]byte{
+			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+		})
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		Eventually(func() bool { return session.closed }).Should(BeTrue())
+		framer := http2.NewFramer(nil, &headerStream.dataWritten)
+		var numFrames int
+		for {
+			frame, err := framer.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&http2.HeadersFrame{}))
+			numFrames++
+		}
+		Expect(numFrames).ToNot(BeZero())
+		Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
 	It("closes the connection if it encounters an error on the header stream", func() {
 		var handlerCalled bool
 		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
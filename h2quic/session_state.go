@@ -0,0 +1,186 @@
+package h2quic
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+var errNotSupportedOnSession = errors.New("h2quic: operation not supported on a QUIC session")
+
+// sessionConn is the net.Conn that is passed to the ConnState callback of the http.Server.
+// It represents a QUIC session. It can't be read from or written to.
+type sessionConn struct {
+	session quic.Session
+}
+
+var _ net.Conn = &sessionConn{}
+
+// Session returns the QUIC session
+func (c *sessionConn) Session() quic.Session            { return c.session }
+func (c *sessionConn) Read([]byte) (int, error)         { return 0, errNotSupportedOnSession }
+func (c *sessionConn) Write([]byte) (int, error)        { return 0, errNotSupportedOnSession }
+func (c *sessionConn) Close() error                     { return c.session.Close(nil) }
+func (c *sessionConn) LocalAddr() net.Addr              { return c.session.LocalAddr() }
+func (c *sessionConn) RemoteAddr() net.Addr             { return c.session.RemoteAddr() }
+func (c *sessionConn) SetDeadline(time.Time) error      { return errNotSupportedOnSession }
+func (c *sessionConn) SetReadDeadline(time.Time) error  { return errNotSupportedOnSession }
+func (c *sessionConn) SetWriteDeadline(time.Time) error { return errNotSupportedOnSession }
+
+// A sessionState tracks the requests that are active on a session.
+// It reports the state of the session to the ConnState callback of the http.Server,
+// and closes the session if the client doesn't send a request in time.
+type sessionState struct {
+	server  *Server
+	session quic.Session
+	conn    *sessionConn
+
+	mutex          sync.Mutex
+	activeRequests int
+	requestStreams map[protocol.StreamID]struct{}          // the data streams of the active requests
+	tunnelStreams  map[protocol.StreamID]protocol.StreamID // the streams owned by tunnels, mapped to the data stream of the tunnel
+	closed         bool
+	idleTimer      *time.Timer
+	idleDeadline   time.Time
+	sentSettings   bool
+}
+
+// newSessionState creates the state of a new session.
+// The client has to send the first request before the ReadHeaderTimeout expires.
+func newSessionState(server *Server, session quic.Session) *sessionState {
+	s := &sessionState{
+		server:         server,
+		session:        session,
+		conn:           &sessionConn{session: session},
+		requestStreams: make(map[protocol.StreamID]struct{}),
+		tunnelStreams:  make(map[protocol.StreamID]protocol.StreamID),
+	}
+	s.setConnState(http.StateNew)
+	s.resetIdleTimer(server.readHeaderTimeout())
+	return s
+}
+
+// requestStarted is called when a request is received.
+// It returns false if the data stream is already used by another request, or owned by a tunnel.
+func (s *sessionState) requestStarted(id protocol.StreamID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isStreamInUse(id) {
+		return false
+	}
+	s.requestStreams[id] = struct{}{}
+	s.activeRequests++
+	if s.activeRequests > 1 || s.closed {
+		return true
+	}
+	s.setConnState(http.StateActive)
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleDeadline = time.Time{}
+	}
+	return true
+}
+
+// requestFinished is called when a request was handled.
+// If the request established a tunnel, the streams owned by the tunnel are released.
+// The session is closed if no new request is received before the IdleTimeout expires.
+func (s *sessionState) requestFinished(id protocol.StreamID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.requestStreams, id)
+	for str, tunnel := range s.tunnelStreams {
+		if tunnel == id {
+			delete(s.tunnelStreams, str)
+		}
+	}
+	s.activeRequests--
+	if s.activeRequests > 0 || s.closed {
+		return
+	}
+	s.setConnState(http.StateIdle)
+	s.resetIdleTimer(s.server.idleTimeout())
+}
+
+// claimStream is called when a stream is announced on the tunnel that uses the data stream of a request.
+// It returns false if the stream is already used by a request, or owned by a tunnel.
+func (s *sessionState) claimStream(tunnel, id protocol.StreamID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isStreamInUse(id) {
+		return false
+	}
+	s.tunnelStreams[id] = tunnel
+	return true
+}
+
+// isStreamInUse must be called with the mutex held
+func (s *sessionState) isStreamInUse(id protocol.StreamID) bool {
+	if _, ok := s.requestStreams[id]; ok {
+		return true
+	}
+	_, ok := s.tunnelStreams[id]
+	return ok
+}
+
+// shouldSendSettings says if the server still has to send its SETTINGS.
+// It only returns true the first time it is called.
+func (s *sessionState) shouldSendSettings() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.sentSettings {
+		return false
+	}
+	s.sentSettings = true
+	return true
+}
+
+// close is called when the session is closed
+func (s *sessionState) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	s.setConnState(http.StateClosed)
+}
+
+func (s *sessionState) setConnState(state http.ConnState) {
+	if hook := s.server.ConnState; hook != nil {
+		hook(s.conn, state)
+	}
+}
+
+// resetIdleTimer must be called with the mutex held
+func (s *sessionState) resetIdleTimer(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	s.idleDeadline = time.Now().Add(timeout)
+	if s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(timeout, s.onIdleTimeout)
+	} else {
+		s.idleTimer.Reset(timeout)
+	}
+}
+
+func (s *sessionState) onIdleTimeout() {
+	s.mutex.Lock()
+	// the timer might fire after a new request was started, or after it was reset
+	idle := !s.closed && s.activeRequests == 0 && !s.idleDeadline.IsZero() && !time.Now().Before(s.idleDeadline)
+	s.mutex.Unlock()
+	if !idle {
+		return
+	}
+	utils.Debugf("Closing idle session with %s", s.session.RemoteAddr())
+	s.session.Close(nil)
+}
@@ -0,0 +1,161 @@
+package h2quic
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session state", func() {
+	var (
+		s          *Server
+		session    *mockSession
+		mutex      sync.Mutex
+		connStates []http.ConnState
+		conns      []net.Conn
+	)
+
+	getConnStates := func() []http.ConnState {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]http.ConnState{}, connStates...)
+	}
+
+	BeforeEach(func() {
+		connStates = nil
+		conns = nil
+		s = &Server{Server: &http.Server{
+			ConnState: func(c net.Conn, state http.ConnState) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				conns = append(conns, c)
+				connStates = append(connStates, state)
+			},
+		}}
+		session = newMockSession()
+		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
+	})
+
+	It("reports the state of the session", func() {
+		state := newSessionState(s, session)
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew}))
+		state.requestStarted(5)
+		state.requestStarted(7)
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive}))
+		state.requestFinished(5)
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive}))
+		state.requestFinished(7)
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateIdle}))
+		state.requestStarted(5)
+		state.requestFinished(5)
+		state.close()
+		state.close()
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateActive, http.StateIdle, http.StateClosed}))
+		// all callbacks were called with the same net.Conn
+		for _, c := range conns {
+			Expect(c).To(Equal(conns[0]))
+		}
+	})
+
+	It("doesn't report state changes after the session was closed", func() {
+		state := newSessionState(s, session)
+		state.requestStarted(5)
+		state.close()
+		state.requestFinished(5)
+		Expect(getConnStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateClosed}))
+	})
+
+	It("doesn't start a request on a data stream that is already in use", func() {
+		state := newSessionState(s, session)
+		Expect(state.requestStarted(5)).To(BeTrue())
+		Expect(state.requestStarted(5)).To(BeFalse())
+		state.requestFinished(5)
+		Expect(state.requestStarted(5)).To(BeTrue())
+	})
+
+	It("tracks the streams owned by tunnels", func() {
+		state := newSessionState(s, session)
+		Expect(state.requestStarted(5)).To(BeTrue())
+		Expect(state.requestStarted(7)).To(BeTrue())
+		Expect(state.claimStream(5, 7)).To(BeFalse()) // used by a request
+		Expect(state.claimStream(5, 9)).To(BeTrue())
+		Expect(state.claimStream(5, 9)).To(BeFalse())
+		Expect(state.requestStarted(9)).To(BeFalse())
+		// the streams are released when the tunnel is closed
+		state.requestFinished(7)
+		Expect(state.requestStarted(9)).To(BeFalse())
+		state.requestFinished(5)
+		Expect(state.requestStarted(9)).To(BeTrue())
+	})
+
+	It("passes a net.Conn that represents the session", func() {
+		newSessionState(s, session)
+		Expect(conns).To(HaveLen(1))
+		c := conns[0]
+		Expect(c.LocalAddr()).To(Equal(session.LocalAddr()))
+		Expect(c.RemoteAddr()).To(Equal(session.RemoteAddr()))
+		Expect(c.(interface{ Session() quic.Session }).Session()).To(Equal(session))
+		_, err := c.Read([]byte{0})
+		Expect(err).To(MatchError(errNotSupportedOnSession))
+		_, err = c.Write([]byte{0})
+		Expect(err).To(MatchError(errNotSupportedOnSession))
+		Expect(c.Close()).To(Succeed())
+		Expect(session.closed).To(BeTrue())
+	})
+
+	Context("timeouts", func() {
+		It("closes the session if no request is received before the ReadHeaderTimeout", func() {
+			s.ReadHeaderTimeout = 50 * time.Millisecond
+			newSessionState(s, session)
+			Consistently(func() bool { return session.closed }, 25*time.Millisecond).Should(BeFalse())
+			Eventually(func() bool { return session.closed }).Should(BeTrue())
+			Expect(session.closedWithError).To(BeNil())
+		})
+
+		It("uses the ReadTimeout if no ReadHeaderTimeout is set", func() {
+			s.ReadTimeout = 50 * time.Millisecond
+			newSessionState(s, session)
+			Eventually(func() bool { return session.closed }).Should(BeTrue())
+		})
+
+		It("doesn't close the session if a request is received before the ReadHeaderTimeout", func() {
+			s.ReadHeaderTimeout = 50 * time.Millisecond
+			state := newSessionState(s, session)
+			state.requestStarted(5)
+			Consistently(func() bool { return session.closed }, 100*time.Millisecond).Should(BeFalse())
+			state.requestFinished(5)
+			// no IdleTimeout is set
+			Consistently(func() bool { return session.closed }, 100*time.Millisecond).Should(BeFalse())
+		})
+
+		It("closes the session when it was idle for longer than the IdleTimeout", func() {
+			s.IdleTimeout = 100 * time.Millisecond
+			state := newSessionState(s, session)
+			state.requestStarted(5)
+			Consistently(func() bool { return session.closed }, 150*time.Millisecond).Should(BeFalse())
+			state.requestFinished(5)
+			Consistently(func() bool { return session.closed }, 50*time.Millisecond).Should(BeFalse())
+			// a new request resets the idle timer
+			state.requestStarted(5)
+			state.requestFinished(5)
+			Consistently(func() bool { return session.closed }, 50*time.Millisecond).Should(BeFalse())
+			Eventually(func() bool { return session.closed }).Should(BeTrue())
+		})
+
+		It("doesn't close the session after it was closed", func() {
+			s.IdleTimeout = 20 * time.Millisecond
+			state := newSessionState(s, session)
+			state.requestStarted(5)
+			state.requestFinished(5)
+			state.close()
+			Consistently(func() bool { return session.closed }, 50*time.Millisecond).Should(BeFalse())
+		})
+	})
+})
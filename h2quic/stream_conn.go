@@ -0,0 +1,74 @@
+package h2quic
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A streamConn is a net.Conn that reads from and writes to the data stream of a request.
+// It is used for the tunnels established by CONNECT requests.
+type streamConn struct {
+	quic.Stream
+
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	closeOnce sync.Once
+	onClose   func() // might be nil
+
+	acceptStream func(context.Context, protocol.StreamID) (quic.Stream, error) // might be nil
+}
+
+var _ net.Conn = &streamConn{}
+
+func newStreamConn(str quic.Stream, localAddr, remoteAddr net.Addr, onClose func()) *streamConn {
+	return &streamConn{
+		Stream:     str,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		onClose:    onClose,
+	}
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// AcceptAnnouncedStream returns a stream that the peer opened, and announced on the tunnel.
+// It blocks until the peer opened the stream, or the context is done.
+// The stream is then owned by the tunnel. Streams used by h2quic, e.g. for a request, can't be accepted.
+// It returns nil if the peer already closed the stream.
+func (c *streamConn) AcceptAnnouncedStream(ctx context.Context, id protocol.StreamID) (quic.Stream, error) {
+	if id == c.Stream.StreamID() || c.acceptStream == nil {
+		return nil, fmt.Errorf("h2quic: stream %d can't be used by the tunnel", id)
+	}
+	return c.acceptStream(ctx, id)
+}
+
+// CloseWrite closes the write side of the stream.
+// The peer reads an EOF, but it can still send data.
+func (c *streamConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+// Close closes both directions of the stream.
+func (c *streamConn) Close() error {
+	err := c.Stream.Close()
+	// in gQUIC, the error code doesn't matter, so just use 0 here
+	c.Stream.CancelRead(0)
+	c.closeOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return err
+}
@@ -0,0 +1,93 @@
+package h2quic
+
+import (
+	"context"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream conn", func() {
+	var (
+		stream     *mockStream
+		conn       *streamConn
+		closeCalls int
+		localAddr  = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}
+		remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+	)
+
+	BeforeEach(func() {
+		closeCalls = 0
+		stream = newMockStream(5)
+		conn = newStreamConn(stream, localAddr, remoteAddr, func() { closeCalls++ })
+	})
+
+	It("returns the addresses", func() {
+		Expect(conn.LocalAddr()).To(Equal(localAddr))
+		Expect(conn.RemoteAddr()).To(Equal(remoteAddr))
+	})
+
+	It("reads and writes", func() {
+		stream.dataToRead.Write([]byte("foobar"))
+		b := make([]byte, 6)
+		n, err := conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+		_, err = conn.Write([]byte("raboof"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.dataWritten.Bytes()).To(Equal([]byte("raboof")))
+	})
+
+	It("sets deadlines", func() {
+		t := time.Now().Add(time.Hour)
+		Expect(conn.SetDeadline(t)).To(Succeed())
+		Expect(stream.readDeadline).To(Equal(t))
+		Expect(stream.writeDeadline).To(Equal(t))
+	})
+
+	It("accepts streams announced on the tunnel", func() {
+		str := newMockStream(7)
+		conn.acceptStream = func(_ context.Context, id protocol.StreamID) (quic.Stream, error) {
+			Expect(id).To(Equal(protocol.StreamID(7)))
+			return str, nil
+		}
+		s, err := conn.AcceptAnnouncedStream(context.Background(), 7)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(str))
+	})
+
+	It("doesn't accept its own stream", func() {
+		conn.acceptStream = func(context.Context, protocol.StreamID) (quic.Stream, error) {
+			Fail("the stream must not be accepted")
+			return nil, nil
+		}
+		_, err := conn.AcceptAnnouncedStream(context.Background(), 5)
+		Expect(err).To(MatchError("h2quic: stream 5 can't be used by the tunnel"))
+	})
+
+	It("doesn't accept streams if the tunnel doesn't support it", func() {
+		_, err := conn.AcceptAnnouncedStream(context.Background(), 7)
+		Expect(err).To(MatchError("h2quic: stream 7 can't be used by the tunnel"))
+	})
+
+	It("closes the write side", func() {
+		Expect(conn.CloseWrite()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+		Expect(stream.reset).To(BeFalse())
+		Expect(closeCalls).To(BeZero())
+	})
+
+	It("closes both directions", func() {
+		Expect(conn.Close()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+		Expect(stream.reset).To(BeTrue())
+		Expect(closeCalls).To(Equal(1))
+		Expect(conn.Close()).To(Succeed())
+		Expect(closeCalls).To(Equal(1))
+	})
+})
@@ -0,0 +1,217 @@
+package h2quic
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// Trailers are sent in a HEADERS frame on the header stream, after the body.
+// Since there's no ordering between the header stream and the data stream,
+// a receiver can't know if trailers will follow when it reaches the end of the body.
+// Trailers are therefore only awaited if they were announced in the Trailer header,
+// and the sender always sends a HEADERS frame for announced trailers, even if no trailer values are set.
+
+var errTrailersNotReceived = errors.New("h2quic: connection closed before the trailers were received")
+
+// A trailerMap holds the streams that are waiting for trailers.
+type trailerMap struct {
+	mutex  sync.Mutex
+	closed bool
+	chans  map[protocol.StreamID]chan http.Header
+}
+
+func newTrailerMap() *trailerMap {
+	return &trailerMap{chans: make(map[protocol.StreamID]chan http.Header)}
+}
+
+// expect registers a stream that announced trailers.
+// It must be called before the next frame is read from the header stream.
+func (m *trailerMap) expect(id protocol.StreamID) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return
+	}
+	m.chans[id] = make(chan http.Header, 1)
+}
+
+// get gets the channel that the trailers will be delivered on.
+// If the trailers won't arrive any more, the returned channel is closed.
+func (m *trailerMap) get(id protocol.StreamID) <-chan http.Header {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c, ok := m.chans[id]
+	if !ok {
+		c = make(chan http.Header)
+		close(c)
+	}
+	return c
+}
+
+func (m *trailerMap) remove(id protocol.StreamID) {
+	m.mutex.Lock()
+	delete(m.chans, id)
+	m.mutex.Unlock()
+}
+
+// deliver passes the trailers to the stream.
+// Trailers for streams that didn't announce trailers (or that were already closed) are dropped,
+// as are duplicate trailers.
+func (m *trailerMap) deliver(id protocol.StreamID, trailer http.Header) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.chans[id] <- trailer:
+	default:
+	}
+}
+
+// closeAll is called when the header stream is closed. No more trailers will be received.
+func (m *trailerMap) closeAll() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	// Trailers that were already delivered can still be received from the closed channels.
+	for _, c := range m.chans {
+		close(c)
+	}
+}
+
+// A trailerReceiver populates the Trailer of a request or a response.
+// The body calls wait when it reaches io.EOF.
+type trailerReceiver struct {
+	id       protocol.StreamID
+	trailers *trailerMap
+
+	trailer     http.Header // the Trailer of the request or response
+	trailerChan <-chan http.Header
+
+	done bool
+	err  error
+}
+
+// newTrailerReceiver creates a trailerReceiver for a stream that was registered using trailerMap.expect
+func newTrailerReceiver(trailers *trailerMap, id protocol.StreamID, trailer http.Header) *trailerReceiver {
+	return &trailerReceiver{
+		id:          id,
+		trailers:    trailers,
+		trailer:     trailer,
+		trailerChan: trailers.get(id),
+	}
+}
+
+// wait blocks until the trailers are received, and copies them into the Trailer
+func (r *trailerReceiver) wait() error {
+	if r.done {
+		return r.err
+	}
+	r.done = true
+	t, ok := <-r.trailerChan
+	if !ok {
+		r.err = errTrailersNotReceived
+		return r.err
+	}
+	r.trailers.remove(r.id)
+	for k, vv := range t {
+		r.trailer[k] = vv
+	}
+	return nil
+}
+
+// close is called when the body is closed, potentially before the trailers were received
+func (r *trailerReceiver) close() {
+	r.trailers.remove(r.id)
+}
+
+// isTrailers says if a header block contains trailers, i.e. if it doesn't contain any pseudo header fields
+func isTrailers(fields []hpack.HeaderField) bool {
+	for _, hf := range fields {
+		if hf.IsPseudo() {
+			return false
+		}
+	}
+	return true
+}
+
+func trailerFromHeaders(fields []hpack.HeaderField) http.Header {
+	trailer := make(http.Header)
+	for _, hf := range fields {
+		key := http.CanonicalHeaderKey(hf.Name)
+		trailer[key] = append(trailer[key], hf.Value)
+	}
+	return trailer
+}
+
+// encodeTrailers encodes the values of the declared trailers
+func encodeTrailers(header http.Header, declared []string) []byte {
+	var buf bytes.Buffer
+	enc := hpack.NewEncoder(&buf)
+	for _, k := range declared {
+		for _, v := range header[k] {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	return buf.Bytes()
+}
+
+// declaredTrailers returns the sorted keys of a Trailer map, omitting trailers that are not allowed
+func declaredTrailers(trailer http.Header) []string {
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		k = http.CanonicalHeaderKey(k)
+		if !validTrailerHeader(k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copied from net/http2/server.go
+
+// validTrailerHeader reports whether name is a valid header field name to appear
+// in trailers.
+// See: http://tools.ietf.org/html/rfc7230#section-4.1.2
+func validTrailerHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	if strings.HasPrefix(name, "If-") || badTrailer[name] {
+		return false
+	}
+	return true
+}
+
+var badTrailer = map[string]bool{
+	"Authorization":       true,
+	"Cache-Control":       true,
+	"Connection":          true,
+	"Content-Encoding":    true,
+	"Content-Length":      true,
+	"Content-Range":       true,
+	"Content-Type":        true,
+	"Expect":              true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Max-Forwards":        true,
+	"Pragma":              true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Range":               true,
+	"Realm":               true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Www-Authenticate":    true,
+}
@@ -0,0 +1,105 @@
+package h2quic
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2/hpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Trailers", func() {
+	Context("the trailer map", func() {
+		var trailers *trailerMap
+
+		BeforeEach(func() {
+			trailers = newTrailerMap()
+		})
+
+		It("delivers trailers", func() {
+			trailer := http.Header{"Foo": nil}
+			trailers.expect(5)
+			r := newTrailerReceiver(trailers, 5, trailer)
+			trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			Expect(r.wait()).To(Succeed())
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+			Expect(trailers.chans).To(BeEmpty())
+		})
+
+		It("delivers trailers before the receiver is created", func() {
+			trailer := http.Header{"Foo": nil}
+			trailers.expect(5)
+			trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			Expect(newTrailerReceiver(trailers, 5, trailer).wait()).To(Succeed())
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("blocks until the trailers are received", func() {
+			trailers.expect(5)
+			r := newTrailerReceiver(trailers, 5, http.Header{})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(r.wait()).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			trailers.deliver(5, http.Header{})
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("drops trailers for streams that didn't announce trailers", func() {
+			trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			Expect(trailers.chans).To(BeEmpty())
+		})
+
+		It("drops duplicate trailers", func() {
+			trailer := http.Header{}
+			trailers.expect(5)
+			trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			trailers.deliver(5, http.Header{"Foo": []string{"baz"}})
+			Expect(newTrailerReceiver(trailers, 5, trailer).wait()).To(Succeed())
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("removes streams when the receiver is closed", func() {
+			trailers.expect(5)
+			newTrailerReceiver(trailers, 5, http.Header{}).close()
+			Expect(trailers.chans).To(BeEmpty())
+		})
+
+		It("errors when the header stream is closed", func() {
+			trailers.expect(5)
+			r := newTrailerReceiver(trailers, 5, http.Header{})
+			trailers.closeAll()
+			Expect(r.wait()).To(MatchError(errTrailersNotReceived))
+			// the error is returned every time
+			Expect(r.wait()).To(MatchError(errTrailersNotReceived))
+		})
+
+		It("still returns trailers that were delivered before the header stream was closed", func() {
+			trailer := http.Header{}
+			trailers.expect(5)
+			trailers.deliver(5, http.Header{"Foo": []string{"bar"}})
+			trailers.closeAll()
+			Expect(newTrailerReceiver(trailers, 5, trailer).wait()).To(Succeed())
+			Expect(trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("doesn't expect trailers after the header stream was closed", func() {
+			trailers.closeAll()
+			trailers.expect(5)
+			Expect(newTrailerReceiver(trailers, 5, http.Header{}).wait()).To(MatchError(errTrailersNotReceived))
+		})
+	})
+
+	It("recognizes trailers", func() {
+		Expect(isTrailers([]hpack.HeaderField{{Name: "foo", Value: "bar"}})).To(BeTrue())
+		Expect(isTrailers([]hpack.HeaderField{{Name: ":status", Value: "200"}, {Name: "foo", Value: "bar"}})).To(BeFalse())
+	})
+
+	It("returns the sorted declared trailers", func() {
+		Expect(declaredTrailers(http.Header{"foo": nil, "Bar": nil, "Content-Type": nil, "If-Match": nil})).To(Equal([]string{"Bar", "Foo"}))
+	})
+})
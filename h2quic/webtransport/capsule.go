@@ -0,0 +1,66 @@
+package webtransport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A capsuleType is the type of a capsule sent on the control stream of a session.
+type capsuleType uint64
+
+const (
+	// capsuleDatagram carries a datagram
+	capsuleDatagram capsuleType = 0x0
+	// capsuleStream announces a bidirectional stream, by its stream ID
+	capsuleStream capsuleType = 0x1
+	// capsuleUniStream announces a unidirectional stream, by its stream ID
+	capsuleUniStream capsuleType = 0x2
+)
+
+// maxCapsuleSize is the maximum size of the payload of a capsule.
+// It is large enough for every datagram.
+const maxCapsuleSize = MaxDatagramSize
+
+// A capsule is sent on the control stream of a session.
+// It consists of its type and the length of the payload, both encoded as QUIC variable-length integers, followed by the payload.
+type capsule struct {
+	Type    capsuleType
+	Payload []byte
+}
+
+func parseCapsule(r *bufio.Reader) (*capsule, error) {
+	t, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	l, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if l > maxCapsuleSize {
+		return nil, fmt.Errorf("webtransport: capsule too large (%d bytes)", l)
+	}
+	payload := make([]byte, l)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return &capsule{Type: capsuleType(t), Payload: payload}, nil
+}
+
+func (c *capsule) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, uint64(c.Type))
+	utils.WriteVarInt(b, uint64(len(c.Payload)))
+	b.Write(c.Payload)
+}
+
+// unexpectedEOF converts an io.EOF in the middle of a capsule to an io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package webtransport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capsules", func() {
+	It("writes and parses capsules", func() {
+		b := &bytes.Buffer{}
+		(&capsule{Type: capsuleDatagram, Payload: []byte("foobar")}).Write(b)
+		(&capsule{Type: capsuleStream, Payload: []byte{0x5}}).Write(b)
+		r := bufio.NewReader(b)
+		c, err := parseCapsule(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(&capsule{Type: capsuleDatagram, Payload: []byte("foobar")}))
+		c, err = parseCapsule(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(&capsule{Type: capsuleStream, Payload: []byte{0x5}}))
+		_, err = parseCapsule(r)
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("writes capsules without a payload", func() {
+		b := &bytes.Buffer{}
+		(&capsule{Type: 0x1337}).Write(b)
+		c, err := parseCapsule(bufio.NewReader(b))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Type).To(Equal(capsuleType(0x1337)))
+		Expect(c.Payload).To(BeEmpty())
+	})
+
+	It("errors on capsules that are too large", func() {
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, uint64(capsuleDatagram))
+		utils.WriteVarInt(b, maxCapsuleSize+1)
+		_, err := parseCapsule(bufio.NewReader(b))
+		Expect(err).To(MatchError("webtransport: capsule too large (65536 bytes)"))
+	})
+
+	It("errors on EOF in the middle of a capsule", func() {
+		b := &bytes.Buffer{}
+		(&capsule{Type: capsuleDatagram, Payload: []byte("foobar")}).Write(b)
+		data := b.Bytes()
+		for i := 1; i < len(data); i++ {
+			_, err := parseCapsule(bufio.NewReader(bytes.NewReader(data[:i])))
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		}
+	})
+})
@@ -0,0 +1,95 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/h2quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// allows mocking of quic.DialAddrContext
+var dialAddrContext = quic.DialAddrContext
+
+// A Dialer dials WebTransport sessions.
+// Every session uses its own QUIC session, which is closed when the session is closed.
+type Dialer struct {
+	// TLSClientConfig specifies the TLS configuration to use.
+	// If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// QuicConfig is the quic.Config used for dialing the QUIC session.
+	// If nil, reasonable default values will be used.
+	QuicConfig *quic.Config
+}
+
+// Dial establishes a session with the server at urlStr, using the default Dialer.
+// See Dialer.Dial.
+func Dial(ctx context.Context, urlStr string, header http.Header) (*http.Response, *Session, error) {
+	return (&Dialer{}).Dial(ctx, urlStr, header)
+}
+
+// Dial establishes a session by sending an extended CONNECT request with the :protocol "webtransport" to urlStr.
+// The header is sent with the request, e.g. for authentication.
+// The response of the server is returned, also if it doesn't accept the session.
+// In that case, the returned error is not nil.
+// Canceling the context after Dial returned doesn't affect the session.
+func (d *Dialer) Dial(ctx context.Context, urlStr string, header http.Header) (*http.Response, *Session, error) {
+	req, err := http.NewRequest(http.MethodConnect, urlStr, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.URL.Scheme != "https" {
+		return nil, nil, fmt.Errorf("webtransport: unsupported scheme: %s", req.URL.Scheme)
+	}
+	req.Proto = Protocol
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	var mutex sync.Mutex
+	var sess quic.Session
+	rt := &h2quic.RoundTripper{
+		TLSClientConfig: d.TLSClientConfig,
+		QuicConfig:      d.QuicConfig,
+		Dial: func(_, addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if sess != nil {
+				return nil, errors.New("webtransport: QUIC session already dialed")
+			}
+			s, err := dialAddrContext(ctx, addr, tlsConf, config)
+			if err != nil {
+				return nil, err
+			}
+			sess = s
+			return s, nil
+		},
+	}
+	rsp, err := rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		rt.Close()
+		return nil, nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		rsp.Body.Close()
+		rt.Close()
+		return rsp, nil, fmt.Errorf("webtransport: the server responded with %s", rsp.Status)
+	}
+	conn, ok := rsp.Body.(controlStream)
+	mutex.Lock()
+	qsess := sess
+	mutex.Unlock()
+	if !ok || qsess == nil {
+		rsp.Body.Close()
+		rt.Close()
+		return rsp, nil, errors.New("webtransport: can't use the QUIC session")
+	}
+	rsp.Body = http.NoBody
+	return rsp, newSession(qsess, conn, protocol.PerspectiveClient, func() { rt.Close() }), nil
+}
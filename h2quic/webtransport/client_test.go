@@ -0,0 +1,52 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dial", func() {
+	origDialAddrContext := dialAddrContext
+
+	AfterEach(func() {
+		dialAddrContext = origDialAddrContext
+	})
+
+	It("only dials https URLs", func() {
+		_, _, err := Dial(context.Background(), "http://www.example.org/wt", nil)
+		Expect(err).To(MatchError("webtransport: unsupported scheme: http"))
+	})
+
+	It("errors on invalid URLs", func() {
+		_, _, err := Dial(context.Background(), "https://www.example.org/%zz", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("dials the QUIC session, using the context and the configuration of the Dialer", func() {
+		testErr := errors.New("handshake failed")
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "foobar")
+		d := &Dialer{
+			TLSClientConfig: &tls.Config{ServerName: "foo.bar"},
+			QuicConfig:      &quic.Config{KeepAlive: true},
+		}
+		var dialed bool
+		dialAddrContext = func(c context.Context, addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+			dialed = true
+			Expect(c.Value(ctxKey{})).To(Equal("foobar"))
+			Expect(addr).To(Equal("www.example.org:443"))
+			Expect(tlsConf.ServerName).To(Equal("foo.bar"))
+			Expect(config.KeepAlive).To(BeTrue())
+			return nil, testErr
+		}
+		_, _, err := d.Dial(ctx, "https://www.example.org/wt", nil)
+		Expect(err).To(MatchError(testErr))
+		Expect(dialed).To(BeTrue())
+	})
+})
@@ -0,0 +1,43 @@
+package webtransport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/h2quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// Upgrade establishes a session for an extended CONNECT request with the :protocol "webtransport".
+// It must be called by a handler of a h2quic.Server, which can authenticate the request before.
+// Upgrade sends a 200 response, unless the handler already sent a response.
+// If the request is not a WebTransport request, Upgrade responds with a 400, and returns an error.
+// The session is closed when the QUIC session is closed, but not when the handler returns.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if r.Method != http.MethodConnect || r.Proto != Protocol {
+		http.Error(w, "Not a WebTransport request", http.StatusBadRequest)
+		return nil, fmt.Errorf("webtransport: not a WebTransport request: %s %s", r.Method, r.Proto)
+	}
+	sess, ok := r.Context().Value(h2quic.SessionContextKey).(quic.Session)
+	if !ok {
+		http.Error(w, "WebTransport not supported", http.StatusInternalServerError)
+		return nil, errors.New("webtransport: the request was not received by a h2quic.Server")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebTransport not supported", http.StatusInternalServerError)
+		return nil, errors.New("webtransport: the http.ResponseWriter doesn't support hijacking")
+	}
+	c, _, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := c.(controlStream)
+	if !ok {
+		c.Close()
+		return nil, errors.New("webtransport: can't use the data stream of the request")
+	}
+	return newSession(sess, conn, protocol.PerspectiveServer, nil), nil
+}
@@ -0,0 +1,102 @@
+package webtransport
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/lucas-clemente/quic-go/h2quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type hijackableResponseWriter struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+var _ http.Hijacker = &hijackableResponseWriter{}
+
+func (w *hijackableResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+var _ = Describe("Upgrade", func() {
+	var (
+		qsess    *mockSession
+		rawConn  net.Conn
+		conn     net.Conn
+		peerConn net.Conn
+		req      *http.Request
+	)
+
+	BeforeEach(func() {
+		qsess = newMockSession()
+		rawConn, peerConn = net.Pipe()
+		conn = newMockControlStream(rawConn)
+		req = httptest.NewRequest(http.MethodConnect, "https://www.example.org/wt", nil)
+		req.Proto = Protocol
+		req = req.WithContext(context.WithValue(context.Background(), h2quic.SessionContextKey, qsess))
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		peerConn.Close()
+	})
+
+	It("establishes a session", func() {
+		w := &hijackableResponseWriter{ResponseRecorder: httptest.NewRecorder(), conn: conn}
+		sess, err := Upgrade(w, req)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(sess.conn).To(Equal(conn))
+		Expect(sess.session).To(Equal(qsess))
+		Expect(sess.perspective).To(Equal(protocol.PerspectiveServer))
+	})
+
+	It("errors if the data stream of the request can't be used", func() {
+		w := &hijackableResponseWriter{ResponseRecorder: httptest.NewRecorder(), conn: rawConn}
+		_, err := Upgrade(w, req)
+		Expect(err).To(MatchError("webtransport: can't use the data stream of the request"))
+		_, err = peerConn.Read([]byte{0})
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("rejects requests that are not extended CONNECT requests", func() {
+		req.Method = http.MethodGet
+		w := &hijackableResponseWriter{ResponseRecorder: httptest.NewRecorder(), conn: conn}
+		_, err := Upgrade(w, req)
+		Expect(err).To(MatchError("webtransport: not a WebTransport request: GET webtransport"))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects extended CONNECT requests for other protocols", func() {
+		req.Proto = "websocket"
+		w := &hijackableResponseWriter{ResponseRecorder: httptest.NewRecorder(), conn: conn}
+		_, err := Upgrade(w, req)
+		Expect(err).To(MatchError("webtransport: not a WebTransport request: CONNECT websocket"))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("errors if the request was not received by a h2quic.Server", func() {
+		req = req.WithContext(context.Background())
+		w := &hijackableResponseWriter{ResponseRecorder: httptest.NewRecorder(), conn: conn}
+		_, err := Upgrade(w, req)
+		Expect(err).To(MatchError("webtransport: the request was not received by a h2quic.Server"))
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("errors if the http.ResponseWriter can't be hijacked", func() {
+		w := httptest.NewRecorder()
+		_, err := Upgrade(w, req)
+		Expect(err).To(MatchError("webtransport: the http.ResponseWriter doesn't support hijacking"))
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
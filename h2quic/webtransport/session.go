@@ -0,0 +1,402 @@
+// Package webtransport implements sessions in the style of WebTransport on top of h2quic.
+//
+// A session is established by an extended CONNECT request with the :protocol "webtransport",
+// which is authenticated and routed like any other HTTP request.
+// The data stream of this request is used as the control stream of the session.
+// Both endpoints can then open bidirectional and unidirectional streams on the QUIC session, and send datagrams.
+//
+// Streams of a session are regular QUIC streams, which are announced to the peer on the control stream.
+// gQUIC doesn't support unidirectional streams, so they are bidirectional streams that are only used in one direction.
+// gQUIC doesn't support unreliable datagrams either, so datagrams are sent on the control stream.
+// They are delivered reliably and in order, but they are dropped if the application doesn't receive them fast enough.
+package webtransport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// Protocol is the value of the :protocol pseudo-header of the extended CONNECT request that establishes a session.
+// h2quic carries it in the Proto of the http.Request.
+const Protocol = "webtransport"
+
+// MaxDatagramSize is the maximum size of a datagram
+const MaxDatagramSize = 65535
+
+const (
+	// acceptQueueLen is the number of streams opened by the peer that are queued until the application accepts them
+	acceptQueueLen = 16
+	// datagramQueueLen is the number of datagrams that are queued until the application receives them
+	datagramQueueLen = 32
+)
+
+var (
+	// ErrSessionClosed is returned when a session was closed, either by the application or by the peer.
+	ErrSessionClosed = errors.New("webtransport: session closed")
+
+	errDatagramTooLarge = errors.New("webtransport: datagram too large")
+)
+
+// controlStream is the data stream of the extended CONNECT request.
+// It is implemented by the net.Conn that h2quic uses for the tunnel.
+type controlStream interface {
+	net.Conn
+	// AcceptAnnouncedStream returns a stream that the peer opened, and announced on the control stream.
+	// It blocks until the peer opened the stream.
+	// Streams used by h2quic, e.g. for an HTTP request, or by another session can't be accepted.
+	// It returns nil if the peer already reset the stream.
+	AcceptAnnouncedStream(context.Context, protocol.StreamID) (quic.Stream, error)
+}
+
+// A Session is a WebTransport session.
+// It is tied to the extended CONNECT request that established it.
+type Session struct {
+	session     quic.Session
+	conn        controlStream
+	perspective protocol.Perspective
+	onClose     func() // might be nil
+
+	writeMutex sync.Mutex
+	writeBuf   bytes.Buffer
+
+	acceptQueue    chan quic.Stream
+	uniAcceptQueue chan quic.ReceiveStream
+	datagramQueue  chan []byte
+
+	mutex    sync.Mutex
+	streams  map[protocol.StreamID]quic.Stream // the streams of this session, which are reset when the session is closed
+	closed   bool
+	closeErr error
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+}
+
+func newSession(sess quic.Session, conn controlStream, pers protocol.Perspective, onClose func()) *Session {
+	s := &Session{
+		session:        sess,
+		conn:           conn,
+		perspective:    pers,
+		onClose:        onClose,
+		acceptQueue:    make(chan quic.Stream, acceptQueueLen),
+		uniAcceptQueue: make(chan quic.ReceiveStream, acceptQueueLen),
+		datagramQueue:  make(chan []byte, datagramQueueLen),
+		streams:        make(map[protocol.StreamID]quic.Stream),
+	}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	go s.run()
+	return s
+}
+
+// run reads the capsules sent by the peer, until the control stream is closed
+func (s *Session) run() {
+	r := bufio.NewReader(s.conn)
+	for {
+		c, err := parseCapsule(r)
+		if err == nil {
+			err = s.handleCapsule(c)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = ErrSessionClosed
+			}
+			s.closeWithError(err)
+			return
+		}
+	}
+}
+
+func (s *Session) handleCapsule(c *capsule) error {
+	switch c.Type {
+	case capsuleDatagram:
+		select {
+		case s.datagramQueue <- c.Payload:
+		default:
+			utils.Debugf("webtransport: dropping a datagram of %d bytes, the receive queue is full", len(c.Payload))
+		}
+	case capsuleStream:
+		str, err := s.getAnnouncedStream(c.Payload)
+		if err != nil || str == nil {
+			return err
+		}
+		select {
+		case s.acceptQueue <- str:
+		case <-s.ctx.Done():
+		}
+	case capsuleUniStream:
+		str, err := s.getAnnouncedStream(c.Payload)
+		if err != nil || str == nil {
+			return err
+		}
+		// the peer doesn't read from this stream
+		str.Close()
+		select {
+		case s.uniAcceptQueue <- str:
+		case <-s.ctx.Done():
+		}
+	default:
+		// unknown capsules are ignored
+	}
+	return nil
+}
+
+// getAnnouncedStream returns the stream announced by the peer.
+// It blocks until the peer opened the stream, or the session is closed.
+// It returns nil if the peer already reset that stream.
+// The peer can only announce streams that it opened, and that are not used by h2quic or by a session.
+func (s *Session) getAnnouncedStream(payload []byte) (quic.Stream, error) {
+	r := bytes.NewReader(payload)
+	v, err := utils.ReadVarInt(r)
+	if err != nil || r.Len() > 0 {
+		return nil, errors.New("webtransport: invalid stream announcement")
+	}
+	id := protocol.StreamID(v)
+	if !s.isPeerInitiated(id) || s.hasStream(id) {
+		return nil, fmt.Errorf("webtransport: invalid stream announced: %d", id)
+	}
+	str, err := s.conn.AcceptAnnouncedStream(s.ctx, id)
+	if err != nil || str == nil {
+		if s.ctx.Err() != nil {
+			return nil, s.closeError()
+		}
+		return nil, err
+	}
+	if err := s.addStream(str); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// isPeerInitiated says if a stream was opened by the peer.
+// h2quic uses gQUIC, where streams opened by the client have odd IDs, and streams opened by the server have even IDs.
+func (s *Session) isPeerInitiated(id protocol.StreamID) bool {
+	if s.perspective == protocol.PerspectiveServer {
+		return id%2 == 1
+	}
+	return id%2 == 0
+}
+
+func (s *Session) hasStream(id protocol.StreamID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.streams[id]
+	return ok
+}
+
+// addStream adds a stream to the session.
+// If the session is already closed, the stream is reset.
+func (s *Session) addStream(str quic.Stream) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		resetStream(str)
+		return s.closeErr
+	}
+	s.streams[str.StreamID()] = str
+	return nil
+}
+
+// announceStream adds a stream opened by us to the session, and announces it to the peer
+func (s *Session) announceStream(str quic.Stream, t capsuleType) error {
+	if err := s.addStream(str); err != nil {
+		return err
+	}
+	var payload bytes.Buffer
+	utils.WriteVarInt(&payload, uint64(str.StreamID()))
+	if err := s.writeCapsule(&capsule{Type: t, Payload: payload.Bytes()}); err != nil {
+		resetStream(str)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) writeCapsule(c *capsule) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if s.ctx.Err() != nil {
+		return s.closeError()
+	}
+	s.writeBuf.Reset()
+	c.Write(&s.writeBuf)
+	_, err := s.conn.Write(s.writeBuf.Bytes())
+	return err
+}
+
+// AcceptStream returns the next bidirectional stream opened by the peer.
+// It blocks until a stream is opened, the context is done, or the session is closed.
+func (s *Session) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	select {
+	case str := <-s.acceptQueue:
+		return str, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, s.closeError()
+	}
+}
+
+// AcceptUniStream returns the next unidirectional stream opened by the peer.
+// It blocks until a stream is opened, the context is done, or the session is closed.
+func (s *Session) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	select {
+	case str := <-s.uniAcceptQueue:
+		return str, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, s.closeError()
+	}
+}
+
+// OpenStream opens a new bidirectional stream.
+// It returns an error if the stream limit of the QUIC session is reached.
+func (s *Session) OpenStream() (quic.Stream, error) {
+	str, err := s.session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.announceStream(str, capsuleStream); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// OpenStreamSync opens a new bidirectional stream.
+// It blocks until a stream can be opened, or the context is done.
+func (s *Session) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	str, err := s.session.OpenStreamSyncContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.announceStream(str, capsuleStream); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// OpenUniStream opens a new unidirectional stream.
+// It returns an error if the stream limit of the QUIC session is reached.
+func (s *Session) OpenUniStream() (quic.SendStream, error) {
+	str, err := s.session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openedUniStream(str); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// OpenUniStreamSync opens a new unidirectional stream.
+// It blocks until a stream can be opened, or the context is done.
+func (s *Session) OpenUniStreamSync(ctx context.Context) (quic.SendStream, error) {
+	str, err := s.session.OpenStreamSyncContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openedUniStream(str); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+func (s *Session) openedUniStream(str quic.Stream) error {
+	if err := s.announceStream(str, capsuleUniStream); err != nil {
+		return err
+	}
+	// The peer closes its side of the stream right away.
+	// Reading its FIN allows the stream to be completed.
+	go io.Copy(ioutil.Discard, str)
+	return nil
+}
+
+// SendDatagram sends a datagram.
+// Datagrams larger than MaxDatagramSize can't be sent.
+func (s *Session) SendDatagram(b []byte) error {
+	if len(b) > MaxDatagramSize {
+		return errDatagramTooLarge
+	}
+	return s.writeCapsule(&capsule{Type: capsuleDatagram, Payload: b})
+}
+
+// ReceiveDatagram returns the next datagram sent by the peer.
+// It blocks until a datagram is received, the context is done, or the session is closed.
+func (s *Session) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-s.datagramQueue:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, s.closeError()
+	}
+}
+
+// Context returns a context that is canceled when the session is closed
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// LocalAddr returns the local address of the QUIC session
+func (s *Session) LocalAddr() net.Addr {
+	return s.session.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (s *Session) RemoteAddr() net.Addr {
+	return s.session.RemoteAddr()
+}
+
+// Close closes the session.
+// The control stream is closed, and all streams of the session are reset.
+func (s *Session) Close() error {
+	s.closeWithError(ErrSessionClosed)
+	return nil
+}
+
+func (s *Session) closeWithError(err error) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	s.closeErr = err
+	streams := s.streams
+	s.streams = nil
+	s.mutex.Unlock()
+
+	s.ctxCancel()
+	for _, str := range streams {
+		resetStream(str)
+	}
+	s.conn.Close()
+	if s.onClose != nil {
+		s.onClose()
+	}
+}
+
+func (s *Session) closeError() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closeErr
+}
+
+// resetStream resets both directions of a stream.
+// Directions that were already completed are not affected.
+func resetStream(str quic.Stream) {
+	// in gQUIC, the error code doesn't matter, so just use 0 here
+	str.CancelWrite(0)
+	str.CancelRead(0)
+}
@@ -0,0 +1,534 @@
+package webtransport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockStream struct {
+	quic.Stream // only the methods used by the session are implemented
+
+	id protocol.StreamID
+
+	mutex         sync.Mutex
+	dataToRead    bytes.Buffer
+	closed        bool
+	canceledRead  bool
+	canceledWrite bool
+}
+
+func newMockStream(id protocol.StreamID) *mockStream {
+	return &mockStream{id: id}
+}
+
+func (s *mockStream) StreamID() protocol.StreamID { return s.id }
+func (s *mockStream) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dataToRead.Read(p)
+}
+func (s *mockStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	return nil
+}
+func (s *mockStream) CancelRead(quic.ErrorCode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.canceledRead = true
+	return nil
+}
+func (s *mockStream) CancelWrite(quic.ErrorCode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.canceledWrite = true
+	return nil
+}
+func (s *mockStream) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+func (s *mockStream) isReset() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.canceledRead && s.canceledWrite
+}
+
+type mockControlStream struct {
+	net.Conn
+
+	mutex          sync.Mutex
+	streams        map[protocol.StreamID]quic.Stream // the streams opened by the peer, nil if the peer already reset the stream
+	streamOpened   chan struct{}                     // closed when the peer opens a stream
+	requestStreams map[protocol.StreamID]bool        // the streams used by h2quic
+	acceptErr      error
+}
+
+var _ controlStream = &mockControlStream{}
+
+func newMockControlStream(conn net.Conn) *mockControlStream {
+	return &mockControlStream{
+		Conn:           conn,
+		streams:        make(map[protocol.StreamID]quic.Stream),
+		streamOpened:   make(chan struct{}),
+		requestStreams: map[protocol.StreamID]bool{3: true},
+	}
+}
+
+// openStream is called when the peer opens a stream
+func (c *mockControlStream) openStream(id protocol.StreamID, str quic.Stream) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.streams[id] = str
+	close(c.streamOpened)
+	c.streamOpened = make(chan struct{})
+}
+
+func (c *mockControlStream) AcceptAnnouncedStream(ctx context.Context, id protocol.StreamID) (quic.Stream, error) {
+	for {
+		c.mutex.Lock()
+		if c.acceptErr != nil || c.requestStreams[id] {
+			c.mutex.Unlock()
+			if c.acceptErr != nil {
+				return nil, c.acceptErr
+			}
+			return nil, fmt.Errorf("stream %d is already in use", id)
+		}
+		str, ok := c.streams[id]
+		streamOpened := c.streamOpened
+		c.mutex.Unlock()
+		if ok {
+			return str, nil
+		}
+		select {
+		case <-streamOpened:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type mockSession struct {
+	quic.Session // only the methods used by the session are implemented
+
+	streamsToOpen []quic.Stream
+	openStreamErr error
+}
+
+func newMockSession() *mockSession {
+	return &mockSession{}
+}
+
+func (s *mockSession) OpenStream() (quic.Stream, error) {
+	if s.openStreamErr != nil {
+		return nil, s.openStreamErr
+	}
+	str := s.streamsToOpen[0]
+	s.streamsToOpen = s.streamsToOpen[1:]
+	return str, nil
+}
+func (s *mockSession) OpenStreamSyncContext(ctx context.Context) (quic.Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.OpenStream()
+}
+func (s *mockSession) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 443}
+}
+func (s *mockSession) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 42}
+}
+
+var _ = Describe("Session", func() {
+	var (
+		sess       *Session
+		qsess      *mockSession
+		conn       *mockControlStream
+		peerConn   net.Conn // the peer's side of the control stream
+		onClose    chan struct{}
+		capsules   chan *capsule // the capsules sent by the session
+		peerReader sync.WaitGroup
+	)
+
+	writeCapsule := func(t capsuleType, payload []byte) {
+		b := &bytes.Buffer{}
+		(&capsule{Type: t, Payload: payload}).Write(b)
+		_, err := peerConn.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	announceStream := func(t capsuleType, id protocol.StreamID) {
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, uint64(id))
+		writeCapsule(t, b.Bytes())
+	}
+
+	BeforeEach(func() {
+		qsess = newMockSession()
+		var c net.Conn
+		c, peerConn = net.Pipe()
+		conn = newMockControlStream(c)
+		conn.requestStreams[1] = true // the data stream of the CONNECT request
+		closeChan := make(chan struct{})
+		onClose = closeChan
+		sess = newSession(qsess, conn, protocol.PerspectiveServer, func() { close(closeChan) })
+		capsuleChan := make(chan *capsule, 100)
+		capsules = capsuleChan
+		peerReader.Add(1)
+		go func(peerConn net.Conn) {
+			defer peerReader.Done()
+			defer close(capsuleChan)
+			r := bufio.NewReader(peerConn)
+			for {
+				c, err := parseCapsule(r)
+				if err != nil {
+					return
+				}
+				capsuleChan <- c
+			}
+		}(peerConn)
+	})
+
+	AfterEach(func() {
+		sess.Close()
+		peerConn.Close()
+		peerReader.Wait()
+	})
+
+	It("returns the addresses of the QUIC session", func() {
+		Expect(sess.LocalAddr()).To(Equal(qsess.LocalAddr()))
+		Expect(sess.RemoteAddr()).To(Equal(qsess.RemoteAddr()))
+	})
+
+	Context("accepting streams", func() {
+		It("accepts bidirectional streams announced by the peer", func() {
+			str := newMockStream(5)
+			conn.streams[5] = str
+			announceStream(capsuleStream, 5)
+			s, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str))
+			Expect(str.isClosed()).To(BeFalse())
+		})
+
+		It("accepts unidirectional streams announced by the peer", func() {
+			str := newMockStream(7)
+			conn.streams[7] = str
+			announceStream(capsuleUniStream, 7)
+			s, err := sess.AcceptUniStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str))
+			// the write side is closed right away
+			Expect(str.isClosed()).To(BeTrue())
+		})
+
+		It("ignores streams that the peer already reset", func() {
+			str := newMockStream(7)
+			conn.streams[5] = nil
+			conn.streams[7] = str
+			announceStream(capsuleStream, 5)
+			announceStream(capsuleStream, 7)
+			s, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str))
+		})
+
+		It("waits until the peer opened an announced stream", func() {
+			announceStream(capsuleStream, 5)
+			strChan := make(chan quic.Stream, 1)
+			go func() {
+				defer GinkgoRecover()
+				s, err := sess.AcceptStream(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				strChan <- s
+			}()
+			Consistently(strChan).ShouldNot(Receive())
+			str := newMockStream(5)
+			conn.openStream(5, str)
+			Eventually(strChan).Should(Receive(Equal(str)))
+		})
+
+		It("stops waiting for an announced stream when the session is closed", func() {
+			announceStream(capsuleStream, 5)
+			time.Sleep(10 * time.Millisecond) // make sure the announcement is processed
+			Expect(sess.Close()).To(Succeed())
+			Eventually(onClose).Should(BeClosed())
+			// the stream is not used by the session any more
+			str := newMockStream(5)
+			conn.openStream(5, str)
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError(ErrSessionClosed))
+			Consistently(str.isReset).Should(BeFalse())
+		})
+
+		It("ignores unknown capsules", func() {
+			str := newMockStream(5)
+			conn.streams[5] = str
+			writeCapsule(0x1337, []byte("foobar"))
+			announceStream(capsuleStream, 5)
+			s, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str))
+		})
+
+		It("stops accepting when the context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := sess.AcceptStream(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			_, err = sess.AcceptUniStream(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("closes the session if the stream can't be obtained", func() {
+			testErr := errors.New("invalid stream ID")
+			conn.acceptErr = testErr
+			announceStream(capsuleStream, 9)
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError(testErr))
+			Eventually(onClose).Should(BeClosed())
+		})
+
+		It("knows which streams were opened by the peer", func() {
+			Expect(sess.isPeerInitiated(5)).To(BeTrue())
+			Expect(sess.isPeerInitiated(4)).To(BeFalse())
+			clientSess := &Session{perspective: protocol.PerspectiveClient}
+			Expect(clientSess.isPeerInitiated(4)).To(BeTrue())
+			Expect(clientSess.isPeerInitiated(5)).To(BeFalse())
+		})
+
+		It("closes the session if the peer announces a stream that it didn't open", func() {
+			conn.streams[4] = newMockStream(4)
+			announceStream(capsuleStream, 4)
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError("webtransport: invalid stream announced: 4"))
+			Eventually(onClose).Should(BeClosed())
+		})
+
+		It("closes the session if the peer announces the header stream", func() {
+			conn.streams[3] = newMockStream(3)
+			announceStream(capsuleUniStream, 3)
+			_, err := sess.AcceptUniStream(context.Background())
+			Expect(err).To(MatchError("stream 3 is already in use"))
+			Eventually(onClose).Should(BeClosed())
+		})
+
+		It("closes the session if the peer announces the stream of an HTTP request", func() {
+			str := newMockStream(7)
+			conn.streams[7] = str
+			conn.mutex.Lock()
+			conn.requestStreams[7] = true
+			conn.mutex.Unlock()
+			announceStream(capsuleStream, 7)
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError("stream 7 is already in use"))
+			Eventually(onClose).Should(BeClosed())
+			// the stream is not used by the session, so it is not reset
+			Expect(str.isReset()).To(BeFalse())
+		})
+
+		It("closes the session if the peer announces a stream twice", func() {
+			str := newMockStream(5)
+			conn.streams[5] = str
+			announceStream(capsuleStream, 5)
+			announceStream(capsuleUniStream, 5)
+			s, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str))
+			Eventually(onClose).Should(BeClosed())
+			_, err = sess.AcceptUniStream(context.Background())
+			Expect(err).To(MatchError("webtransport: invalid stream announced: 5"))
+			// the stream was accepted, so it is reset when the session is closed
+			Expect(str.isReset()).To(BeTrue())
+		})
+
+		It("closes the session if the announcement is invalid", func() {
+			writeCapsule(capsuleStream, []byte{0x5, 0x0})
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError("webtransport: invalid stream announcement"))
+		})
+	})
+
+	Context("opening streams", func() {
+		expectAnnouncement := func(t capsuleType, id protocol.StreamID) {
+			var c *capsule
+			Eventually(capsules).Should(Receive(&c))
+			Expect(c.Type).To(Equal(t))
+			announced, err := utils.ReadVarInt(bytes.NewReader(c.Payload))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(announced).To(BeEquivalentTo(id))
+		}
+
+		It("opens and announces bidirectional streams", func() {
+			str1 := newMockStream(4)
+			str2 := newMockStream(6)
+			qsess.streamsToOpen = []quic.Stream{str1, str2}
+			s, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str1))
+			expectAnnouncement(capsuleStream, 4)
+			s, err = sess.OpenStreamSync(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str2))
+			expectAnnouncement(capsuleStream, 6)
+		})
+
+		It("opens and announces unidirectional streams", func() {
+			str1 := newMockStream(4)
+			str2 := newMockStream(6)
+			qsess.streamsToOpen = []quic.Stream{str1, str2}
+			s, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str1))
+			expectAnnouncement(capsuleUniStream, 4)
+			s, err = sess.OpenUniStreamSync(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(str2))
+			expectAnnouncement(capsuleUniStream, 6)
+		})
+
+		It("returns errors when opening a stream fails", func() {
+			testErr := errors.New("too many open streams")
+			qsess.openStreamErr = testErr
+			_, err := sess.OpenStream()
+			Expect(err).To(MatchError(testErr))
+			_, err = sess.OpenUniStream()
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("returns the error of the context when opening a stream synchronously", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := sess.OpenStreamSync(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			_, err = sess.OpenUniStreamSync(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("resets streams opened after the session was closed", func() {
+			str := newMockStream(4)
+			qsess.streamsToOpen = []quic.Stream{str}
+			Expect(sess.Close()).To(Succeed())
+			_, err := sess.OpenStream()
+			Expect(err).To(MatchError(ErrSessionClosed))
+			Expect(str.isReset()).To(BeTrue())
+		})
+	})
+
+	Context("datagrams", func() {
+		It("sends datagrams", func() {
+			Expect(sess.SendDatagram([]byte("foobar"))).To(Succeed())
+			var c *capsule
+			Eventually(capsules).Should(Receive(&c))
+			Expect(c).To(Equal(&capsule{Type: capsuleDatagram, Payload: []byte("foobar")}))
+		})
+
+		It("doesn't send datagrams that are too large", func() {
+			Expect(sess.SendDatagram(make([]byte, MaxDatagramSize+1))).To(MatchError(errDatagramTooLarge))
+		})
+
+		It("receives datagrams", func() {
+			writeCapsule(capsuleDatagram, []byte("foo"))
+			writeCapsule(capsuleDatagram, []byte("bar"))
+			b, err := sess.ReceiveDatagram(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal([]byte("foo")))
+			b, err = sess.ReceiveDatagram(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal([]byte("bar")))
+		})
+
+		It("drops datagrams if the queue is full", func() {
+			for i := 0; i <= datagramQueueLen; i++ {
+				writeCapsule(capsuleDatagram, []byte{byte(i)})
+			}
+			// make sure that all datagrams were processed
+			str := newMockStream(5)
+			conn.streams[5] = str
+			announceStream(capsuleStream, 5)
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < datagramQueueLen; i++ {
+				b, err := sess.ReceiveDatagram(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b).To(Equal([]byte{byte(i)}))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err = sess.ReceiveDatagram(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("closing", func() {
+		It("resets all streams, and closes the control stream", func() {
+			str1 := newMockStream(4)
+			qsess.streamsToOpen = []quic.Stream{str1}
+			_, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			str2 := newMockStream(5)
+			conn.streams[5] = str2
+			announceStream(capsuleStream, 5)
+			_, err = sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.Close()).To(Succeed())
+			Expect(str1.isReset()).To(BeTrue())
+			Expect(str2.isReset()).To(BeTrue())
+			Expect(onClose).To(BeClosed())
+			Expect(sess.Context().Done()).To(BeClosed())
+			// the peer reads an EOF
+			Eventually(capsules).Should(BeClosed())
+		})
+
+		It("returns ErrSessionClosed after the session was closed", func() {
+			Expect(sess.Close()).To(Succeed())
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError(ErrSessionClosed))
+			_, err = sess.AcceptUniStream(context.Background())
+			Expect(err).To(MatchError(ErrSessionClosed))
+			_, err = sess.ReceiveDatagram(context.Background())
+			Expect(err).To(MatchError(ErrSessionClosed))
+			Expect(sess.SendDatagram([]byte("foobar"))).To(MatchError(ErrSessionClosed))
+		})
+
+		It("closes the session when the peer closes the control stream", func() {
+			Expect(peerConn.Close()).To(Succeed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			Expect(onClose).To(BeClosed())
+			_, err := sess.AcceptStream(context.Background())
+			Expect(err).To(MatchError(ErrSessionClosed))
+		})
+
+		It("only closes once", func() {
+			Expect(sess.Close()).To(Succeed())
+			Expect(sess.Close()).To(Succeed())
+		})
+	})
+
+	It("unblocks accepting when the session is closed", func() {
+		errChan := make(chan error)
+		go func() {
+			_, err := sess.AcceptStream(context.Background())
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(sess.Close()).To(Succeed())
+		Eventually(errChan).Should(Receive(MatchError(ErrSessionClosed)))
+	})
+})
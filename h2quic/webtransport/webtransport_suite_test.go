@@ -0,0 +1,13 @@
+package webtransport
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWebtransport(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "WebTransport Suite")
+}
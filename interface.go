@@ -22,6 +22,17 @@ type Cookie = handshake.Cookie
 // ConnectionState records basic details about the QUIC connection.
 type ConnectionState = handshake.ConnectionState
 
+// CachedServerState is the state that a gQUIC client caches for a server.
+type CachedServerState = handshake.CachedServerState
+
+// A ServerConfigKey contains the values needed to generate a gQUIC server config.
+// See Config.ServerConfigKeys.
+type ServerConfigKey = handshake.ServerConfigKey
+
+// A ServerStateCache caches the server config, the source-address token and the certificate chain of gQUIC servers.
+// Implementations are provided by NewLRUServerStateCache and NewFileServerStateCache.
+type ServerStateCache = handshake.ServerStateCache
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
@@ -114,8 +125,14 @@ type StreamError interface {
 type Session interface {
 	// AcceptStream returns the next stream opened by the peer, blocking until one is available.
 	AcceptStream() (Stream, error)
+	// AcceptStreamContext works like AcceptStream.
+	// If the context is done before a stream is available, the context's error is returned.
+	AcceptStreamContext(context.Context) (Stream, error)
 	// AcceptUniStream returns the next unidirectional stream opened by the peer, blocking until one is available.
 	AcceptUniStream() (ReceiveStream, error)
+	// AcceptUniStreamContext works like AcceptUniStream.
+	// If the context is done before a stream is available, the context's error is returned.
+	AcceptUniStreamContext(context.Context) (ReceiveStream, error)
 	// OpenStream opens a new bidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// TODO(#1152): Enable testing for the special error
@@ -123,6 +140,9 @@ type Session interface {
 	// OpenStreamSync opens a new bidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
 	OpenStreamSync() (Stream, error)
+	// OpenStreamSyncContext works like OpenStreamSync.
+	// If the context is done before the stream can be opened, the context's error is returned.
+	OpenStreamSyncContext(context.Context) (Stream, error)
 	// OpenUniStream opens a new outgoing unidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// TODO(#1152): Enable testing for the special error
@@ -130,6 +150,9 @@ type Session interface {
 	// OpenUniStreamSync opens a new outgoing unidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
 	OpenUniStreamSync() (SendStream, error)
+	// OpenUniStreamSyncContext works like OpenUniStreamSync.
+	// If the context is done before the stream can be opened, the context's error is returned.
+	OpenUniStreamSyncContext(context.Context) (SendStream, error)
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
@@ -142,12 +165,32 @@ type Session interface {
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// ExportKeyingMaterial derives keying material from the secrets of the session, e.g. for channel binding.
+	// It can only be used once the handshake completed.
+	// For IETF QUIC, it is the TLS 1.3 exporter (RFC 5705), using the given label and context.
+	// For gQUIC, the keying material is derived from the forward-secure shared secret, using HKDF-SHA256
+	// with the client and server nonce as salt, and "QUIC exporter", a 0x00 byte, the connection ID (8 bytes, big endian),
+	// the length of the label (1 byte), the label and the SHA-256 hash of the context as info.
+	// Warning: This API should not be considered stable and might change soon.
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
+	// AddLocalAddress opens an additional path from the given local address.
+	// It can only be used by the client, after the handshake completed, if both peers enabled multipath.
+	// Warning: This API should not be considered stable and might change soon.
+	AddLocalAddress(net.Addr) error
+	// RemoveLocalAddress closes the path that uses the given local address.
+	// Data that is outstanding on this path is retransmitted on the remaining paths.
+	// The path that the session was established on can't be removed.
+	// Warning: This API should not be considered stable and might change soon.
+	RemoveLocalAddress(net.Addr) error
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
 type Config struct {
 	// The QUIC versions that can be negotiated.
 	// If not set, it uses all versions available.
+	// gQUIC can't authenticate the client. If the tls.Config of a server requires client certificates,
+	// i.e. if its ClientAuth is tls.RequireAnyClientCert or tls.RequireAndVerifyClientCert, the server only uses the versions that use TLS.
+	// If no versions are set in that case, the server uses IETF QUIC.
 	// Warning: This API should not be considered stable and will change soon.
 	Versions []VersionNumber
 	// Ask the server to omit the connection ID sent in the Public Header.
@@ -187,6 +230,56 @@ type Config struct {
 	MaxIncomingUniStreams int
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
 	KeepAlive bool
+	// AckSendDelay is the maximum time that sending of an ACK for a retransmittable packet is delayed.
+	// If not set, it will default to 25ms.
+	AckSendDelay time.Duration
+	// RetransmittablePacketsBeforeAck is the number of retransmittable packets that an ACK is sent for when doing ACK decimation.
+	// If not set, it will default to 10.
+	RetransmittablePacketsBeforeAck int
+	// DisableAckDecimation disables ACK decimation.
+	// If set, an ACK is sent for every second retransmittable packet.
+	DisableAckDecimation bool
+	// PeerAckSendDelay and PeerRetransmittablePacketsBeforeAck are sent to the peer in an ACK_FREQUENCY frame,
+	// asking it to change the rate at which it sends ACKs.
+	// This is only possible if the peer supports the ACK frequency extension.
+	// If neither value is set, no ACK_FREQUENCY frame is sent.
+	// This value doesn't have any effect in Google QUIC.
+	PeerAckSendDelay time.Duration
+	// See PeerAckSendDelay.
+	PeerRetransmittablePacketsBeforeAck int
+	// EnableMultipath enables the use of multiple paths for a single connection.
+	// Multipath is only used if both peers enable it.
+	// Additional paths can be opened by the client, see Session.AddLocalAddress.
+	// This value doesn't have any effect in IETF QUIC.
+	EnableMultipath bool
+	// FECGroupSize enables forward error correction (FEC).
+	// After every FECGroupSize packets, an FEC frame is sent, which allows the peer to recover a single lost packet of this group,
+	// without waiting for a retransmission.
+	// Smaller values increase the redundancy, at the cost of a higher bandwidth overhead.
+	// If there's no more data to send, the FEC frame is sent for the packets of the current group right away.
+	// FEC is only used if both peers enable it. Values larger than 32 are reduced to 32.
+	// When using multipath, only the packets sent on the initial path are protected.
+	// If not set, FEC is disabled.
+	FECGroupSize int
+	// ServerStateCache is used by the client to cache the server config, the source-address token and the certificate chain.
+	// When dialing a server that is in the cache, the client can skip the round trip needed to obtain these values.
+	// This value doesn't have any effect in IETF QUIC, and is only valid for the client.
+	ServerStateCache ServerStateCache
+	// ServerConfigKeys are the keys used to generate the gQUIC server configs.
+	// When running multiple servers behind a load balancer, using the same keys on all servers allows clients
+	// to reuse the server config when connecting to a different server.
+	// Server configs are rotated according to their NotBefore and Expiry times.
+	// If not set, a random server config is generated, which never expires.
+	// The key exchange algorithms and AEADs offered in the server config are taken from the
+	// CurvePreferences and the CipherSuites of the tls.Config.
+	// This option is only valid for the server, and doesn't have any effect in IETF QUIC.
+	ServerConfigKeys []ServerConfigKey
+	// CookieKeys are the keys used to protect the source-address tokens (gQUIC) and the cookies (IETF QUIC).
+	// New tokens are encrypted using the first key, and tokens encrypted with any of the keys are accepted.
+	// This allows sharing the keys between multiple servers, and rotating them.
+	// If not set, a random key is generated.
+	// This option is only valid for the server.
+	CookieKeys [][32]byte
 }
 
 // A Listener for incoming QUIC connections
@@ -197,4 +290,7 @@ type Listener interface {
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
 	Accept() (Session, error)
+	// AcceptContext works like Accept.
+	// If the context is done before a new session is available, the context's error is returned.
+	AcceptContext(context.Context) (Session, error)
 }
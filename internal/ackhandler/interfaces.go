@@ -30,6 +30,9 @@ type SentPacketHandler interface {
 	GetStopWaitingFrame(force bool) *wire.StopWaitingFrame
 	GetLowestPacketNotConfirmedAcked() protocol.PacketNumber
 	DequeuePacketForRetransmission() (packet *Packet)
+	// QueueAllForRetransmission queues all outstanding packets for retransmission.
+	// It is used when the path that the packets were sent on is closed.
+	QueueAllForRetransmission() error
 	GetPacketNumberLen(protocol.PacketNumber) protocol.PacketNumberLen
 
 	GetAlarmTimeout() time.Time
@@ -40,6 +43,7 @@ type SentPacketHandler interface {
 type ReceivedPacketHandler interface {
 	ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error
 	IgnoreBelow(protocol.PacketNumber)
+	ReceivedAckFrequencyFrame(*wire.AckFrequencyFrame) error
 
 	GetAlarmTimeout() time.Time
 	GetAckFrame() *wire.AckFrame
@@ -1,12 +1,14 @@
 package ackhandler
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
 )
 
 type receivedPacketHandler struct {
@@ -19,6 +21,15 @@ type receivedPacketHandler struct {
 	ackSendDelay time.Duration
 	rttStats     *congestion.RTTStats
 
+	// number of retransmittable packets that an ACK is sent for, when not (yet) doing ack decimation
+	packetsBeforeAck int
+	// number of retransmittable packets that an ACK is sent for, when doing ack decimation
+	decimationPacketsBeforeAck int
+	ackDecimation              bool
+
+	receivedAckFrequencyFrame    bool
+	largestAckFrequencySeqNumber uint64
+
 	packetsReceivedSinceLastAck                int
 	retransmittablePacketsReceivedSinceLastAck int
 	ackQueued                                  bool
@@ -29,12 +40,8 @@ type receivedPacketHandler struct {
 }
 
 const (
-	// maximum delay that can be applied to an ACK for a retransmittable packet
-	ackSendDelay = 25 * time.Millisecond
 	// initial maximum number of retransmittable packets received before sending an ack.
 	initialRetransmittablePacketsBeforeAck = 2
-	// number of retransmittable that an ACK is sent for
-	retransmittablePacketsBeforeAck = 10
 	// 1/5 RTT delay when doing ack decimation
 	ackDecimationDelay = 1.0 / 4
 	// 1/8 RTT delay when doing ack decimation
@@ -49,15 +56,28 @@ const (
 	// Set to the number of nacks needed for fast retransmit plus one for protection
 	// against an ack loss
 	maxPacketsAfterNewMissing = 4
+	// Maximum packet tolerance that the peer can request in an ACK_FREQUENCY frame.
+	maxAckFrequencyPacketTolerance = 1000
 )
 
-// NewReceivedPacketHandler creates a new receivedPacketHandler
-func NewReceivedPacketHandler(rttStats *congestion.RTTStats, version protocol.VersionNumber) ReceivedPacketHandler {
+// NewReceivedPacketHandler creates a new receivedPacketHandler.
+// ackSendDelay is the maximum delay that is applied to an ACK for a retransmittable packet.
+// When doing ack decimation, an ACK is sent for every retransmittablePacketsBeforeAck retransmittable packets.
+func NewReceivedPacketHandler(
+	rttStats *congestion.RTTStats,
+	ackSendDelay time.Duration,
+	retransmittablePacketsBeforeAck int,
+	ackDecimation bool,
+	version protocol.VersionNumber,
+) ReceivedPacketHandler {
 	return &receivedPacketHandler{
-		packetHistory: newReceivedPacketHistory(),
-		ackSendDelay:  ackSendDelay,
-		rttStats:      rttStats,
-		version:       version,
+		packetHistory:              newReceivedPacketHistory(),
+		ackSendDelay:               ackSendDelay,
+		packetsBeforeAck:           utils.Min(initialRetransmittablePacketsBeforeAck, retransmittablePacketsBeforeAck),
+		decimationPacketsBeforeAck: retransmittablePacketsBeforeAck,
+		ackDecimation:              ackDecimation,
+		rttStats:                   rttStats,
+		version:                    version,
 	}
 }
 
@@ -124,21 +144,21 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 	if !h.ackQueued && shouldInstigateAck {
 		h.retransmittablePacketsReceivedSinceLastAck++
 
-		if packetNumber > minReceivedBeforeAckDecimation {
-			// ack up to 10 packets at once
-			if h.retransmittablePacketsReceivedSinceLastAck >= retransmittablePacketsBeforeAck {
+		if h.ackDecimation && packetNumber > minReceivedBeforeAckDecimation {
+			// ack up to 10 packets at once (by default)
+			if h.retransmittablePacketsReceivedSinceLastAck >= h.decimationPacketsBeforeAck {
 				h.ackQueued = true
 			} else if h.ackAlarm.IsZero() {
 				// wait for the minimum of the ack decimation delay or the delayed ack time before sending an ack
-				ackDelay := utils.MinDuration(ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
+				ackDelay := utils.MinDuration(h.ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
 				h.ackAlarm = rcvTime.Add(ackDelay)
 			}
 		} else {
-			// send an ACK every 2 retransmittable packets
-			if h.retransmittablePacketsReceivedSinceLastAck >= initialRetransmittablePacketsBeforeAck {
+			// send an ACK every 2 retransmittable packets (by default)
+			if h.retransmittablePacketsReceivedSinceLastAck >= h.packetsBeforeAck {
 				h.ackQueued = true
 			} else if h.ackAlarm.IsZero() {
-				h.ackAlarm = rcvTime.Add(ackSendDelay)
+				h.ackAlarm = rcvTime.Add(h.ackSendDelay)
 			}
 		}
 		// If there are new missing packets to report, set a short timer to send an ACK.
@@ -158,6 +178,27 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 	}
 }
 
+// ReceivedAckFrequencyFrame handles an ACK_FREQUENCY frame.
+// The peer takes control over the ack frequency, so ack decimation is disabled.
+func (h *receivedPacketHandler) ReceivedAckFrequencyFrame(f *wire.AckFrequencyFrame) error {
+	if f.PacketTolerance == 0 {
+		return qerr.Error(qerr.InvalidFrameData, "ACK_FREQUENCY frame with a packet tolerance of 0")
+	}
+	if f.UpdateMaxAckDelay < protocol.MinAckDelay {
+		return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("ACK_FREQUENCY frame with a max ack delay smaller than the min_ack_delay (%s < %s)", f.UpdateMaxAckDelay, protocol.MinAckDelay))
+	}
+	// ignore reordered and retransmitted frames
+	if h.receivedAckFrequencyFrame && f.SequenceNumber <= h.largestAckFrequencySeqNumber {
+		return nil
+	}
+	h.receivedAckFrequencyFrame = true
+	h.largestAckFrequencySeqNumber = f.SequenceNumber
+	h.ackDecimation = false
+	h.packetsBeforeAck = int(utils.MinUint64(f.PacketTolerance, maxAckFrequencyPacketTolerance))
+	h.ackSendDelay = f.UpdateMaxAckDelay
+	return nil
+}
+
 func (h *receivedPacketHandler) GetAckFrame() *wire.AckFrame {
 	if !h.ackQueued && (h.ackAlarm.IsZero() || h.ackAlarm.After(time.Now())) {
 		return nil
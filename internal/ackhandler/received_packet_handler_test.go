@@ -19,7 +19,13 @@ var _ = Describe("receivedPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats = &congestion.RTTStats{}
-		handler = NewReceivedPacketHandler(rttStats, protocol.VersionWhatever).(*receivedPacketHandler)
+		handler = NewReceivedPacketHandler(
+			rttStats,
+			protocol.DefaultMaxAckDelay,
+			protocol.DefaultRetransmittablePacketsBeforeAck,
+			true,
+			protocol.VersionWhatever,
+		).(*receivedPacketHandler)
 	})
 
 	Context("accepting packets", func() {
@@ -140,6 +146,52 @@ var _ = Describe("receivedPacketHandler", func() {
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 			})
 
+			It("queues an ACK for the configured number of retransmittable packets, if they are arriving fast", func() {
+				handler = NewReceivedPacketHandler(rttStats, protocol.DefaultMaxAckDelay, 5, true, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck10Packets()
+				p := protocol.PacketNumber(10000)
+				for i := 0; i < 4; i++ {
+					err := handler.ReceivedPacket(p, time.Now(), true)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(handler.ackQueued).To(BeFalse())
+					p++
+				}
+				err := handler.ReceivedPacket(p, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeTrue())
+			})
+
+			It("queues an ACK for every retransmittable packet, if configured to do so", func() {
+				handler = NewReceivedPacketHandler(rttStats, protocol.DefaultMaxAckDelay, 1, true, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck10Packets()
+				for p := protocol.PacketNumber(11); p < 20; p++ {
+					err := handler.ReceivedPacket(p, time.Time{}, true)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(handler.ackQueued).To(BeTrue())
+					Expect(handler.GetAckFrame()).ToNot(BeNil())
+				}
+			})
+
+			It("queues an ACK for every second retransmittable packet, if ack decimation is disabled", func() {
+				handler = NewReceivedPacketHandler(rttStats, protocol.DefaultMaxAckDelay, protocol.DefaultRetransmittablePacketsBeforeAck, false, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck10Packets()
+				err := handler.ReceivedPacket(10000, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeFalse())
+				err = handler.ReceivedPacket(10001, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeTrue())
+			})
+
+			It("uses the configured ack send delay", func() {
+				handler = NewReceivedPacketHandler(rttStats, 100*time.Millisecond, protocol.DefaultRetransmittablePacketsBeforeAck, true, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck10Packets()
+				rcvTime := time.Now()
+				err := handler.ReceivedPacket(11, rcvTime, true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(100 * time.Millisecond)))
+			})
+
 			It("only sets the timer when receiving a retransmittable packets", func() {
 				receiveAndAck10Packets()
 				err := handler.ReceivedPacket(11, time.Now(), false)
@@ -150,7 +202,7 @@ var _ = Describe("receivedPacketHandler", func() {
 				err = handler.ReceivedPacket(12, rcvTime, true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
-				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
+				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(protocol.DefaultMaxAckDelay)))
 			})
 
 			It("queues an ACK if it was reported missing before", func() {
@@ -200,6 +252,81 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 		})
 
+		Context("handling ACK_FREQUENCY frames", func() {
+			It("uses the packet tolerance and the max ack delay requested by the peer", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:    0,
+					PacketTolerance:   3,
+					UpdateMaxAckDelay: 50 * time.Millisecond,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackDecimation).To(BeFalse())
+				Expect(handler.packetsBeforeAck).To(Equal(3))
+				Expect(handler.ackSendDelay).To(Equal(50 * time.Millisecond))
+			})
+
+			It("acks after the requested number of packets", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					PacketTolerance:   3,
+					UpdateMaxAckDelay: 50 * time.Millisecond,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				err = handler.ReceivedPacket(1, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.GetAckFrame()).ToNot(BeNil())
+				rcvTime := time.Now()
+				for p := protocol.PacketNumber(2); p < 4; p++ {
+					err := handler.ReceivedPacket(p, rcvTime, true)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(handler.ackQueued).To(BeFalse())
+				}
+				err = handler.ReceivedPacket(4, rcvTime, true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeTrue())
+			})
+
+			It("ignores reordered frames", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:    2,
+					PacketTolerance:   3,
+					UpdateMaxAckDelay: 50 * time.Millisecond,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				err = handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:    1,
+					PacketTolerance:   5,
+					UpdateMaxAckDelay: 10 * time.Millisecond,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.packetsBeforeAck).To(Equal(3))
+				Expect(handler.ackSendDelay).To(Equal(50 * time.Millisecond))
+			})
+
+			It("limits the packet tolerance", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					PacketTolerance:   1 << 40,
+					UpdateMaxAckDelay: 50 * time.Millisecond,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.packetsBeforeAck).To(Equal(maxAckFrequencyPacketTolerance))
+			})
+
+			It("errors on a packet tolerance of 0", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					UpdateMaxAckDelay: 50 * time.Millisecond,
+				})
+				Expect(err).To(MatchError("InvalidFrameData: ACK_FREQUENCY frame with a packet tolerance of 0"))
+			})
+
+			It("errors when the requested max ack delay is smaller than the min_ack_delay", func() {
+				err := handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					PacketTolerance:   3,
+					UpdateMaxAckDelay: 500 * time.Microsecond,
+				})
+				Expect(err).To(MatchError("InvalidFrameData: ACK_FREQUENCY frame with a max ack delay smaller than the min_ack_delay (500µs < 1ms)"))
+			})
+		})
+
 		Context("ACK generation", func() {
 			BeforeEach(func() {
 				handler.ackQueued = true
@@ -20,6 +20,9 @@ func IsFrameRetransmittable(f wire.Frame) bool {
 		return false
 	case *wire.AckFrame:
 		return false
+	case *wire.FECFrame:
+		// FEC frames are only useful when they arrive shortly after the packets they protect
+		return false
 	default:
 		return true
 	}
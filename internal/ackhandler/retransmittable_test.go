@@ -12,6 +12,7 @@ var _ = Describe("retransmittable frames", func() {
 	for fl, el := range map[wire.Frame]bool{
 		&wire.AckFrame{}:             false,
 		&wire.StopWaitingFrame{}:     false,
+		&wire.FECFrame{}:             false,
 		&wire.BlockedFrame{}:         true,
 		&wire.ConnectionCloseFrame{}: true,
 		&wire.GoawayFrame{}:          true,
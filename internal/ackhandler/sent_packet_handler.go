@@ -27,6 +27,15 @@ const (
 	minRTOTimeout = 200 * time.Millisecond
 	// maxRTOTimeout is the maximum RTO time
 	maxRTOTimeout = 60 * time.Second
+	// Maximum reordering in packet number space before packet-threshold loss detection considers a packet lost.
+	// Only used for versions that use probe timeouts.
+	packetThreshold = 3
+	// The timer granularity. Loss detection and probe timeouts are never set shorter than this.
+	timerGranularity = time.Millisecond
+	// The max_ack_delay that the peer is assumed to use, if it did not advertise a max_ack_delay.
+	defaultMaxAckDelay = 25 * time.Millisecond
+	// The number of (non backed-off) probe timeouts after which persistent congestion is declared.
+	persistentCongestionThreshold = 3
 )
 
 type sentPacketHandler struct {
@@ -60,6 +69,11 @@ type sentPacketHandler struct {
 	// The number of times an RTO has been sent without receiving an ack.
 	rtoCount uint32
 
+	// useProbeTimeouts says if probe timeouts and packet-threshold loss detection is used (instead of RTOs)
+	useProbeTimeouts bool
+	// The number of times a PTO has been sent without receiving an ack.
+	ptoCount uint32
+
 	// The time at which the next packet will be considered lost based on early transmit or exceeding the reordering window in time.
 	lossTime time.Time
 
@@ -68,7 +82,7 @@ type sentPacketHandler struct {
 }
 
 // NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats) SentPacketHandler {
+func NewSentPacketHandler(rttStats *congestion.RTTStats, version protocol.VersionNumber) SentPacketHandler {
 	congestion := congestion.NewCubicSender(
 		congestion.DefaultClock{},
 		rttStats,
@@ -77,11 +91,17 @@ func NewSentPacketHandler(rttStats *congestion.RTTStats) SentPacketHandler {
 		protocol.DefaultMaxCongestionWindow,
 	)
 
+	useProbeTimeouts := version.UsesProbeTimeouts()
+	if useProbeTimeouts {
+		rttStats.SetMaxAckDelay(defaultMaxAckDelay)
+	}
+
 	return &sentPacketHandler{
 		packetHistory:      newSentPacketHistory(),
 		stopWaitingManager: stopWaitingManager{},
 		rttStats:           rttStats,
 		congestion:         congestion,
+		useProbeTimeouts:   useProbeTimeouts,
 	}
 }
 
@@ -207,7 +227,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		}
 	}
 
-	if err := h.detectLostPackets(rcvTime); err != nil {
+	if err := h.detectLostPackets(rcvTime, ackedPackets); err != nil {
 		return err
 	}
 	h.updateLossDetectionAlarm()
@@ -278,17 +298,25 @@ func (h *sentPacketHandler) updateLossDetectionAlarm() {
 	} else if !h.lossTime.IsZero() {
 		// Early retransmit timer or time loss detection.
 		h.alarm = h.lossTime
+	} else if h.useProbeTimeouts {
+		// PTO
+		h.alarm = h.lastSentRetransmittablePacketTime.Add(h.computePTOTimeout())
 	} else {
 		// RTO
 		h.alarm = h.lastSentRetransmittablePacketTime.Add(h.computeRTOTimeout())
 	}
 }
 
-func (h *sentPacketHandler) detectLostPackets(now time.Time) error {
+// detectLostPackets declares packets lost.
+// ackedPackets are the packets that were acknowledged by the ACK that triggered loss detection.
+func (h *sentPacketHandler) detectLostPackets(now time.Time, ackedPackets []*Packet) error {
 	h.lossTime = time.Time{}
 
 	maxRTT := float64(utils.MaxDuration(h.rttStats.LatestRTT(), h.rttStats.SmoothedRTT()))
 	delayUntilLost := time.Duration((1.0 + timeReorderingFraction) * maxRTT)
+	if h.useProbeTimeouts {
+		delayUntilLost = utils.MaxDuration(delayUntilLost, timerGranularity)
+	}
 
 	var lostPackets []*Packet
 	h.packetHistory.Iterate(func(packet *Packet) (bool, error) {
@@ -302,6 +330,8 @@ func (h *sentPacketHandler) detectLostPackets(now time.Time) error {
 		timeSinceSent := now.Sub(packet.SendTime)
 		if timeSinceSent > delayUntilLost {
 			lostPackets = append(lostPackets, packet)
+		} else if h.useProbeTimeouts && h.largestAcked >= packet.PacketNumber+packetThreshold {
+			lostPackets = append(lostPackets, packet)
 		} else if h.lossTime.IsZero() {
 			// Note: This conditional is only entered once per call
 			h.lossTime = now.Add(delayUntilLost - timeSinceSent)
@@ -317,9 +347,33 @@ func (h *sentPacketHandler) detectLostPackets(now time.Time) error {
 		p.includedInBytesInFlight = false
 		h.congestion.OnPacketLost(p.PacketNumber, p.Length, h.bytesInFlight)
 	}
+	if h.useProbeTimeouts && h.inPersistentCongestion(lostPackets, ackedPackets) {
+		utils.Debugf("\tPersistent congestion detected. Collapsing the congestion window.")
+		h.congestion.OnRetransmissionTimeout(true)
+	}
 	return nil
 }
 
+// inPersistentCongestion says if the lost packets span a period longer than the persistent congestion duration,
+// without any packet sent during that period having been acknowledged.
+func (h *sentPacketHandler) inPersistentCongestion(lostPackets, ackedPackets []*Packet) bool {
+	// We need an RTT sample to determine the persistent congestion duration.
+	if len(lostPackets) < 2 || h.rttStats.SmoothedRTT() == 0 {
+		return false
+	}
+	first := lostPackets[0]
+	last := lostPackets[len(lostPackets)-1]
+	if last.SendTime.Sub(first.SendTime) < persistentCongestionThreshold*h.probeTimeout() {
+		return false
+	}
+	for _, p := range ackedPackets {
+		if p.PacketNumber > first.PacketNumber && p.PacketNumber < last.PacketNumber {
+			return false
+		}
+	}
+	return true
+}
+
 func (h *sentPacketHandler) OnAlarm() error {
 	now := time.Now()
 
@@ -330,7 +384,11 @@ func (h *sentPacketHandler) OnAlarm() error {
 		err = h.queueHandshakePacketsForRetransmission()
 	} else if !h.lossTime.IsZero() {
 		// Early retransmit or time loss detection
-		err = h.detectLostPackets(now)
+		err = h.detectLostPackets(now, nil)
+	} else if h.useProbeTimeouts {
+		// PTO
+		h.ptoCount++
+		err = h.queueProbePackets()
 	} else {
 		// RTO
 		h.rtoCount++
@@ -355,6 +413,7 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet) error {
 		return nil
 	}
 	h.rtoCount = 0
+	h.ptoCount = 0
 	h.handshakeCount = 0
 	// TODO(#497): h.tlpCount = 0
 
@@ -481,6 +540,20 @@ func (h *sentPacketHandler) queueRTOs() error {
 	return nil
 }
 
+// queue the oldest two packets as probe packets
+// In contrast to RTOs, these packets are not declared lost, and the congestion window is not reduced.
+func (h *sentPacketHandler) queueProbePackets() error {
+	for i := 0; i < 2; i++ {
+		if p := h.packetHistory.FirstOutstanding(); p != nil {
+			utils.Debugf("\tQueueing packet %#x as a probe packet (PTO), %d outstanding", p.PacketNumber, h.packetHistory.Len())
+			if err := h.queuePacketForRetransmission(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (h *sentPacketHandler) queueHandshakePacketsForRetransmission() error {
 	var handshakePackets []*Packet
 	h.packetHistory.Iterate(func(p *Packet) (bool, error) {
@@ -497,6 +570,22 @@ func (h *sentPacketHandler) queueHandshakePacketsForRetransmission() error {
 	return nil
 }
 
+func (h *sentPacketHandler) QueueAllForRetransmission() error {
+	var packets []*Packet
+	h.packetHistory.Iterate(func(p *Packet) (bool, error) {
+		if !p.queuedForRetransmission {
+			packets = append(packets, p)
+		}
+		return true, nil
+	})
+	for _, p := range packets {
+		if err := h.queuePacketForRetransmission(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *sentPacketHandler) queuePacketForRetransmission(p *Packet) error {
 	if _, err := h.packetHistory.QueuePacketForRetransmission(p.PacketNumber); err != nil {
 		return err
@@ -528,6 +617,25 @@ func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
 	return utils.MinDuration(rto, maxRTOTimeout)
 }
 
+// probeTimeout is the probe timeout, without exponential backoff applied.
+// It accounts for the maximum time the peer might delay sending an ACK.
+func (h *sentPacketHandler) probeTimeout() time.Duration {
+	if h.rttStats.SmoothedRTT() == 0 {
+		return 2 * defaultInitialRTT
+	}
+	return h.rttStats.SmoothedRTT() + utils.MaxDuration(4*h.rttStats.MeanDeviation(), timerGranularity) + h.rttStats.MaxAckDelay()
+}
+
+func (h *sentPacketHandler) computePTOTimeout() time.Duration {
+	pto := h.probeTimeout()
+	// Exponential backoff
+	// Stop shifting once the maximum is reached, so that the duration can't overflow.
+	for i := uint32(0); i < h.ptoCount && pto < maxRTOTimeout; i++ {
+		pto <<= 1
+	}
+	return utils.MinDuration(pto, maxRTOTimeout)
+}
+
 func (h *sentPacketHandler) skippedPacketsAcked(ackFrame *wire.AckFrame) bool {
 	for _, p := range h.skippedPackets {
 		if ackFrame.AcksPacket(p) {
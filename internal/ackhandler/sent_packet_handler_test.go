@@ -61,7 +61,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats).(*sentPacketHandler)
+		handler = NewSentPacketHandler(rttStats, protocol.VersionWhatever).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -544,6 +544,19 @@ var _ = Describe("SentPacketHandler", func() {
 				Expect(handler.GetStopWaitingFrame(false)).To(Equal(&wire.StopWaitingFrame{LeastUnacked: 6}))
 			})
 		})
+
+		It("queues all outstanding packets for retransmission", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3}))
+			handler.queuePacketForRetransmission(getPacket(2))
+			Expect(handler.QueueAllForRetransmission()).To(Succeed())
+			var retransmissions []protocol.PacketNumber
+			for p := handler.DequeuePacketForRetransmission(); p != nil; p = handler.DequeuePacketForRetransmission() {
+				retransmissions = append(retransmissions, p.PacketNumber)
+			}
+			Expect(retransmissions).To(Equal([]protocol.PacketNumber{2, 1, 3}))
+		})
 	})
 
 	Context("congestion", func() {
@@ -760,6 +773,138 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("probe timeouts", func() {
+		var cong *mocks.MockSendAlgorithm
+
+		BeforeEach(func() {
+			handler = NewSentPacketHandler(&congestion.RTTStats{}, protocol.VersionTLS).(*sentPacketHandler)
+			handler.SetHandshakeComplete()
+			cong = mocks.NewMockSendAlgorithm(mockCtrl)
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().TimeUntilSend(gomock.Any()).AnyTimes()
+			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			handler.congestion = cong
+		})
+
+		It("uses probe timeouts for IETF QUIC", func() {
+			Expect(handler.useProbeTimeouts).To(BeTrue())
+			Expect(handler.rttStats.MaxAckDelay()).To(Equal(defaultMaxAckDelay))
+		})
+
+		It("uses the default PTO", func() {
+			Expect(handler.computePTOTimeout()).To(Equal(2 * defaultInitialRTT))
+		})
+
+		It("uses the PTO from rttStats, including the max_ack_delay", func() {
+			rtt := time.Second
+			handler.rttStats.UpdateRTT(rtt, 0, time.Now())
+			Expect(handler.computePTOTimeout()).To(Equal(rtt + rtt/2*4 + defaultMaxAckDelay))
+		})
+
+		It("uses the timer granularity as a lower bound for the RTT variance", func() {
+			rtt := 100 * time.Microsecond
+			handler.rttStats.UpdateRTT(rtt, 0, time.Now())
+			Expect(handler.computePTOTimeout()).To(Equal(rtt + timerGranularity + defaultMaxAckDelay))
+		})
+
+		It("implements exponential backoff", func() {
+			handler.ptoCount = 0
+			Expect(handler.computePTOTimeout()).To(Equal(2 * defaultInitialRTT))
+			handler.ptoCount = 1
+			Expect(handler.computePTOTimeout()).To(Equal(4 * defaultInitialRTT))
+			handler.ptoCount = 2
+			Expect(handler.computePTOTimeout()).To(Equal(8 * defaultInitialRTT))
+		})
+
+		It("limits the PTO to the maximum RTO after many consecutive PTOs", func() {
+			for i := protocol.PacketNumber(1); i <= 200; i++ {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+			}
+			for i := 0; i < 100; i++ {
+				Expect(handler.OnAlarm()).To(Succeed())
+				Expect(handler.computePTOTimeout()).To(BeNumerically(">", 0))
+				Expect(handler.computePTOTimeout()).To(BeNumerically("<=", maxRTOTimeout))
+			}
+			Expect(handler.ptoCount).To(BeEquivalentTo(100))
+			Expect(handler.computePTOTimeout()).To(Equal(maxRTOTimeout))
+			Expect(time.Until(handler.GetAlarmTimeout())).To(BeNumerically("~", maxRTOTimeout, time.Second))
+		})
+
+		It("queues two probe packets if the PTO expires, without reducing the congestion window", func() {
+			// note that we don't EXPECT calls to OnPacketLost or OnRetransmissionTimeout
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3}))
+			Expect(handler.lossTime.IsZero()).To(BeTrue())
+			Expect(time.Until(handler.GetAlarmTimeout())).To(BeNumerically("~", handler.computePTOTimeout(), 10*time.Millisecond))
+
+			handler.OnAlarm()
+			Expect(handler.ptoCount).To(BeEquivalentTo(1))
+			p := handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			p = handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(2)))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(3)))
+		})
+
+		It("resets the PTO count when receiving an ACK", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			handler.ptoCount = 3
+			err := handler.ReceivedAck(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, protocol.EncryptionForwardSecure, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.ptoCount).To(BeZero())
+		})
+
+		It("declares packets lost using the packet threshold", func() {
+			cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), gomock.Any(), gomock.Any())
+			cong.EXPECT().OnPacketLost(protocol.PacketNumber(2), gomock.Any(), gomock.Any())
+			for i := protocol.PacketNumber(1); i <= 5; i++ {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+			}
+			err := handler.ReceivedAck(&wire.AckFrame{LargestAcked: 5, LowestAcked: 5}, 1, protocol.EncryptionForwardSecure, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.DequeuePacketForRetransmission().PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			Expect(handler.DequeuePacketForRetransmission().PacketNumber).To(Equal(protocol.PacketNumber(2)))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			// packets 3 and 4 will be declared lost by the time threshold
+			Expect(handler.lossTime.IsZero()).To(BeFalse())
+		})
+
+		It("detects persistent congestion", func() {
+			now := time.Now()
+			handler.rttStats.UpdateRTT(10*time.Millisecond, 0, now)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-10 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-5 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: now.Add(-10 * time.Millisecond)}))
+			gomock.InOrder(
+				cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), gomock.Any(), gomock.Any()),
+				cong.EXPECT().OnPacketLost(protocol.PacketNumber(2), gomock.Any(), gomock.Any()),
+				cong.EXPECT().OnRetransmissionTimeout(true),
+			)
+			err := handler.ReceivedAck(&wire.AckFrame{LargestAcked: 3, LowestAcked: 3}, 1, protocol.EncryptionForwardSecure, now)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("doesn't detect persistent congestion if a packet sent in between was acknowledged", func() {
+			now := time.Now()
+			handler.rttStats.UpdateRTT(10*time.Millisecond, 0, now)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-10 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-5 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: now.Add(-time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 4, SendTime: now.Add(-10 * time.Millisecond)}))
+			// note that we don't EXPECT a call to OnRetransmissionTimeout
+			cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), gomock.Any(), gomock.Any())
+			cong.EXPECT().OnPacketLost(protocol.PacketNumber(3), gomock.Any(), gomock.Any())
+			ack := createAck([]wire.AckRange{{First: 4, Last: 4}, {First: 2, Last: 2}})
+			err := handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
 	Context("handshake packets", func() {
 		BeforeEach(func() {
 			handler.handshakeComplete = false
@@ -31,6 +31,7 @@ type RTTStats struct {
 	latestRTT          time.Duration
 	smoothedRTT        time.Duration
 	meanDeviation      time.Duration
+	maxAckDelay        time.Duration
 
 	numMinRTTsamplesRemaining uint32
 
@@ -76,6 +77,16 @@ func (r *RTTStats) GetHalfWindowRTT() time.Duration { return r.halfWindowRTT.rtt
 // MeanDeviation gets the mean deviation
 func (r *RTTStats) MeanDeviation() time.Duration { return r.meanDeviation }
 
+// MaxAckDelay gets the max_ack_delay advertised by the peer.
+// It is zero if ACK delays are not limited.
+func (r *RTTStats) MaxAckDelay() time.Duration { return r.maxAckDelay }
+
+// SetMaxAckDelay sets the max_ack_delay advertised by the peer.
+// ACK delays reported by the peer are capped to this value when calculating RTT samples.
+func (r *RTTStats) SetMaxAckDelay(mad time.Duration) {
+	r.maxAckDelay = mad
+}
+
 // SetRecentMinRTTwindow sets how old a recent min rtt sample can be.
 func (r *RTTStats) SetRecentMinRTTwindow(recentMinRTTwindow time.Duration) {
 	r.recentMinRTTwindow = recentMinRTTwindow
@@ -97,6 +108,13 @@ func (r *RTTStats) UpdateRTT(sendDelta, ackDelay time.Duration, now time.Time) {
 	}
 	r.updateRecentMinRTT(sendDelta, now)
 
+	// The peer is not allowed to delay ACKs by more than the max_ack_delay.
+	// Larger values are caused by scheduling delays at the peer, and don't
+	// reflect the path characteristics.
+	if r.maxAckDelay > 0 && ackDelay > r.maxAckDelay {
+		ackDelay = r.maxAckDelay
+	}
+
 	// Correct for ackDelay if information received from the peer results in a
 	// an RTT sample at least as large as minRTT. Otherwise, only use the
 	// sendDelta.
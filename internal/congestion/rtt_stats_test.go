@@ -38,6 +38,15 @@ var _ = Describe("RTT stats", func() {
 		Expect(rttStats.SmoothedRTT()).To(Equal((287500 * time.Microsecond)))
 	})
 
+	It("caps the ACK delay at the max_ack_delay", func() {
+		rttStats.SetMaxAckDelay(25 * time.Millisecond)
+		Expect(rttStats.MaxAckDelay()).To(Equal(25 * time.Millisecond))
+		rttStats.UpdateRTT(100*time.Millisecond, 0, time.Time{})
+		// the peer reports an ACK delay of 50ms, but only 25ms are subtracted
+		rttStats.UpdateRTT(150*time.Millisecond, 50*time.Millisecond, time.Time{})
+		Expect(rttStats.LatestRTT()).To(Equal(125 * time.Millisecond))
+	})
+
 	It("MinRTT", func() {
 		rttStats.UpdateRTT((200 * time.Millisecond), 0, time.Time{})
 		Expect(rttStats.MinRTT()).To(Equal((200 * time.Millisecond)))
@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+type aesHeaderProtector struct {
+	encrypter cipher.Block
+	decrypter cipher.Block
+}
+
+var _ HeaderProtector = &aesHeaderProtector{}
+
+// NewAESHeaderProtector creates a HeaderProtector using AES-ECB
+func NewAESHeaderProtector(otherKey []byte, myKey []byte) (HeaderProtector, error) {
+	encrypter, err := aes.NewCipher(myKey)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := aes.NewCipher(otherKey)
+	if err != nil {
+		return nil, err
+	}
+	return &aesHeaderProtector{
+		encrypter: encrypter,
+		decrypter: decrypter,
+	}, nil
+}
+
+func (p *aesHeaderProtector) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(p.encrypter, sample, firstByte, pnBytes)
+}
+
+func (p *aesHeaderProtector) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(p.decrypter, sample, firstByte, pnBytes)
+}
+
+func (p *aesHeaderProtector) apply(block cipher.Block, sample []byte, firstByte *byte, pnBytes []byte) {
+	if len(sample) != HeaderProtectionSampleLen {
+		panic("invalid header protection sample size")
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, sample)
+	applyHeaderProtectionMask(mask, firstByte, pnBytes)
+}
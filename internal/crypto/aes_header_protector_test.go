@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AES header protection", func() {
+	var (
+		clientHP, serverHP HeaderProtector
+		sample             []byte
+	)
+
+	BeforeEach(func() {
+		keyClient := []byte("0123456789abcdef")
+		keyServer := []byte("fedcba9876543210")
+		var err error
+		clientHP, err = NewAESHeaderProtector(keyServer, keyClient)
+		Expect(err).ToNot(HaveOccurred())
+		serverHP, err = NewAESHeaderProtector(keyClient, keyServer)
+		Expect(err).ToNot(HaveOccurred())
+		sample = []byte("this is a sample")
+	})
+
+	It("computes the mask using AES-ECB", func() {
+		// test vector from RFC 9001, appendix A.2
+		key, err := hex.DecodeString("9f50449e04a0e810283a1e9933adedd2")
+		Expect(err).ToNot(HaveOccurred())
+		sample, err := hex.DecodeString("d1b1c98dd7689fb8ec11d242b123dc9b")
+		Expect(err).ToNot(HaveOccurred())
+		hp, err := NewAESHeaderProtector(key, key)
+		Expect(err).ToNot(HaveOccurred())
+		firstByte := byte(0)
+		pn := make([]byte, 4)
+		hp.EncryptHeader(sample, &firstByte, pn)
+		Expect(firstByte).To(Equal(byte(0x43 & 0x23)))
+		Expect(pn).To(Equal([]byte{0x7b, 0x9a, 0xec, 0x36}))
+	})
+
+	It("protects and unprotects short headers", func() {
+		firstByte := byte(0x51)
+		pn := []byte{0x13, 0x37}
+		clientHP.EncryptHeader(sample, &firstByte, pn)
+		// the omit connection ID bit and bit 4 and 5 are not protected
+		Expect(firstByte & 0xd8).To(Equal(byte(0x50)))
+		Expect(pn).ToNot(Equal([]byte{0x13, 0x37}))
+		serverHP.DecryptHeader(sample, &firstByte, pn)
+		Expect(firstByte).To(Equal(byte(0x51)))
+		Expect(pn).To(Equal([]byte{0x13, 0x37}))
+	})
+
+	It("doesn't protect the type byte of long headers", func() {
+		firstByte := byte(0x82)
+		pn := []byte{0xde, 0xad, 0xbe, 0xef}
+		serverHP.EncryptHeader(sample, &firstByte, pn)
+		Expect(firstByte).To(Equal(byte(0x82)))
+		Expect(pn).ToNot(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+		clientHP.DecryptHeader(sample, &firstByte, pn)
+		Expect(pn).To(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+	})
+
+	It("uses different keys for both directions", func() {
+		firstByte := byte(0x82)
+		pn := []byte{0xde, 0xad, 0xbe, 0xef}
+		clientHP.EncryptHeader(sample, &firstByte, pn)
+		clientHP.DecryptHeader(sample, &firstByte, pn)
+		Expect(pn).ToNot(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+	})
+
+	It("errors when the key is invalid", func() {
+		_, err := NewAESHeaderProtector([]byte("foo"), []byte("bar"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("panics if the sample has the wrong size", func() {
+		firstByte := byte(0x82)
+		Expect(func() { clientHP.EncryptHeader([]byte("short"), &firstByte, []byte{0, 0}) }).To(Panic())
+	})
+})
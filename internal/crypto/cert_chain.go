@@ -2,57 +2,70 @@ package crypto
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"strings"
 )
 
-// A CertChain holds a certificate and a private key
+// A CertChain selects the certificate for the SNI sent by the client
 type CertChain interface {
-	SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error)
-	GetCertsCompressed(sni string, commonSetHashes, cachedHashes []byte) ([]byte, error)
-	GetLeafCert(sni string) ([]byte, error)
+	GetCertificate(sni string) (Certificate, error)
 }
 
-// proofSource stores a key and a certificate for the server proof
+// A Certificate holds a certificate chain and the corresponding private key
+type Certificate interface {
+	SignServerProof(chlo []byte, serverConfigData []byte) ([]byte, error)
+	GetCertsCompressed(commonSetHashes, cachedHashes []byte) ([]byte, error)
+	GetLeafCert() []byte
+}
+
+// certChain selects the certificate from a tls.Config
 type certChain struct {
 	config *tls.Config
 }
 
 var _ CertChain = &certChain{}
 
+type certificate struct {
+	cert *tls.Certificate
+}
+
+var _ Certificate = &certificate{}
+
 var errNoMatchingCertificate = errors.New("no matching certificate found")
 
-// NewCertChain loads the key and cert from files
+// NewCertChain creates a CertChain that uses the certificates of a tls.Config.
+// The certificate is selected every time GetCertificate is called.
+// If the tls.Config uses GetCertificate or GetConfigForClient, certificates can be changed without restarting the server.
 func NewCertChain(tlsConfig *tls.Config) CertChain {
 	return &certChain{config: tlsConfig}
 }
 
-// SignServerProof signs CHLO and server config for use in the server proof
-func (c *certChain) SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error) {
+// GetCertificate selects the certificate for an SNI
+func (c *certChain) GetCertificate(sni string) (Certificate, error) {
 	cert, err := c.getCertForSNI(sni)
 	if err != nil {
 		return nil, err
 	}
+	if len(cert.Certificate) == 0 {
+		return nil, errNoMatchingCertificate
+	}
+	return &certificate{cert: cert}, nil
+}
 
-	return signServerProof(cert, chlo, serverConfigData)
+// SignServerProof signs CHLO and server config for use in the server proof
+func (c *certificate) SignServerProof(chlo []byte, serverConfigData []byte) ([]byte, error) {
+	return signServerProof(c.cert, chlo, serverConfigData)
 }
 
 // GetCertsCompressed gets the certificate in the format described by the QUIC crypto doc
-func (c *certChain) GetCertsCompressed(sni string, pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
-	cert, err := c.getCertForSNI(sni)
-	if err != nil {
-		return nil, err
-	}
-	return getCompressedCert(cert.Certificate, pCommonSetHashes, pCachedHashes)
+func (c *certificate) GetCertsCompressed(pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
+	return getCompressedCert(c.cert.Certificate, pCommonSetHashes, pCachedHashes)
 }
 
 // GetLeafCert gets the leaf certificate
-func (c *certChain) GetLeafCert(sni string) ([]byte, error) {
-	cert, err := c.getCertForSNI(sni)
-	if err != nil {
-		return nil, err
-	}
-	return cert.Certificate[0], nil
+func (c *certificate) GetLeafCert() []byte {
+	return c.cert.Certificate[0]
 }
 
 func (c *certChain) getCertForSNI(sni string) (*tls.Certificate, error) {
@@ -74,11 +87,15 @@ func (c *certChain) getCertForSNI(sni string) (*tls.Certificate, error) {
 		return nil, errNoMatchingCertificate
 	}
 
-	if len(conf.Certificates) == 1 || conf.NameToCertificate == nil {
+	if len(conf.Certificates) == 1 {
 		// There's only one choice, so no point doing any work.
 		return &conf.Certificates[0], nil
 	}
 
+	if conf.NameToCertificate == nil {
+		return getCertForSNIFromLeaves(conf.Certificates, sni), nil
+	}
+
 	name := strings.ToLower(sni)
 	for len(name) > 0 && name[len(name)-1] == '.' {
 		name = name[:len(name)-1]
@@ -103,6 +120,31 @@ func (c *certChain) getCertForSNI(sni string) (*tls.Certificate, error) {
 	return &conf.Certificates[0], nil
 }
 
+// getCertForSNIFromLeaves selects the first certificate that is valid for the SNI.
+// If none matches, the first certificate is returned.
+func getCertForSNIFromLeaves(certs []tls.Certificate, sni string) *tls.Certificate {
+	if sni == "" {
+		return &certs[0]
+	}
+	for i := range certs {
+		leaf := certs[i].Leaf
+		if leaf == nil {
+			if len(certs[i].Certificate) == 0 {
+				continue
+			}
+			var err error
+			leaf, err = x509.ParseCertificate(certs[i].Certificate[0])
+			if err != nil {
+				continue
+			}
+		}
+		if leaf.VerifyHostname(sni) == nil {
+			return &certs[i]
+		}
+	}
+	return &certs[0]
+}
+
 func maybeGetConfigForClient(c *tls.Config, sni string) (*tls.Config, error) {
 	if c.GetConfigForClient == nil {
 		return c, nil
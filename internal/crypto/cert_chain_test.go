@@ -5,6 +5,7 @@ import (
 	"compress/flate"
 	"compress/zlib"
 	"crypto/tls"
+	"crypto/x509"
 	"reflect"
 
 	"github.com/lucas-clemente/quic-go/internal/testdata"
@@ -42,7 +43,9 @@ var _ = Describe("Proof", func() {
 					},
 				},
 			}
-			certCompressed, err := kd.GetCertsCompressed("", nil, nil)
+			c, err := kd.GetCertificate("")
+			Expect(err).ToNot(HaveOccurred())
+			certCompressed, err := c.GetCertsCompressed(nil, nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(certCompressed).To(Equal(append([]byte{
 				0x01, 0x00,
@@ -51,20 +54,25 @@ var _ = Describe("Proof", func() {
 		})
 
 		It("errors when it can't retrieve a certificate", func() {
-			_, err := cc.GetCertsCompressed("invalid domain", nil, nil)
+			_, err := cc.GetCertificate("invalid domain")
 			Expect(err).To(MatchError(errNoMatchingCertificate))
 		})
-	})
 
-	Context("signing server configs", func() {
-		It("errors when it can't retrieve a certificate for the requested SNI", func() {
-			_, err := cc.SignServerProof("invalid", []byte("chlo"), []byte("scfg"))
+		It("errors when the certificate is empty", func() {
+			config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return &tls.Certificate{}, nil
+			}
+			_, err := cc.GetCertificate("quic.clemente.io")
 			Expect(err).To(MatchError(errNoMatchingCertificate))
 		})
+	})
 
+	Context("signing server configs", func() {
 		It("signs the server config", func() {
 			config.Certificates = []tls.Certificate{cert}
-			proof, err := cc.SignServerProof("", []byte("chlo"), []byte("scfg"))
+			c, err := cc.GetCertificate("")
+			Expect(err).ToNot(HaveOccurred())
+			proof, err := c.SignServerProof([]byte("chlo"), []byte("scfg"))
 			Expect(err).ToNot(HaveOccurred())
 			Expect(proof).ToNot(BeEmpty())
 		})
@@ -117,16 +125,61 @@ var _ = Describe("Proof", func() {
 			Expect(cert.Certificate[0]).ToNot(BeNil())
 		})
 
+		It("selects the certificate by the names in the leaf certificate", func() {
+			cert1 := tls.Certificate{
+				Certificate: [][]byte{[]byte("cert1")},
+				Leaf:        &x509.Certificate{DNSNames: []string{"quic.clemente.io"}},
+			}
+			cert2 := tls.Certificate{
+				Certificate: [][]byte{[]byte("cert2")},
+				Leaf:        &x509.Certificate{DNSNames: []string{"*.example.org"}},
+			}
+			config.Certificates = []tls.Certificate{cert1, cert2}
+			c, err := cc.getCertForSNI("quic.clemente.io")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Certificate[0]).To(Equal([]byte("cert1")))
+			c, err = cc.getCertForSNI("www.example.org")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Certificate[0]).To(Equal([]byte("cert2")))
+			// use the first certificate if nothing matches
+			c, err = cc.getCertForSNI("foo.bar")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Certificate[0]).To(Equal([]byte("cert1")))
+		})
+
+		It("parses the leaf certificate if it's not set", func() {
+			config.Certificates = []tls.Certificate{
+				{Certificate: [][]byte{[]byte("invalid")}},
+				cert,
+			}
+			c, err := cc.getCertForSNI("quic.clemente.io")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Certificate).To(Equal(cert.Certificate))
+		})
+
 		It("gets leaf certificates", func() {
 			config.Certificates = []tls.Certificate{cert}
-			cert2, err := cc.GetLeafCert("")
+			c, err := cc.GetCertificate("")
 			Expect(err).ToNot(HaveOccurred())
-			Expect(cert2).To(Equal(cert.Certificate[0]))
+			Expect(c.GetLeafCert()).To(Equal(cert.Certificate[0]))
 		})
 
-		It("errors when it can't retrieve a leaf certificate", func() {
-			_, err := cc.GetLeafCert("invalid domain")
-			Expect(err).To(MatchError(errNoMatchingCertificate))
+		It("picks up a new certificate returned by GetCertificate", func() {
+			certs := []*tls.Certificate{
+				{Certificate: [][]byte{[]byte("old")}},
+				{Certificate: [][]byte{[]byte("new")}},
+			}
+			var i int
+			config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certs[i], nil
+			}
+			c, err := cc.GetCertificate("quic.clemente.io")
+			Expect(err).ToNot(HaveOccurred())
+			i = 1
+			Expect(c.GetLeafCert()).To(Equal([]byte("old")))
+			c, err = cc.GetCertificate("quic.clemente.io")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.GetLeafCert()).To(Equal([]byte("new")))
 		})
 
 		It("respects GetConfigForClient", func() {
@@ -97,16 +97,34 @@ func (c *certManager) VerifyServerProof(proof, chlo, serverConfigData []byte) bo
 	return verifyServerProof(proof, c.chain[0], chlo, serverConfigData)
 }
 
-// Verify verifies the certificate chain
+// Verify verifies the certificate chain.
+// Unless InsecureSkipVerify is set, the chain is verified against the RootCAs of the tls.Config.
+// Afterwards, the VerifyPeerCertificate callback of the tls.Config is called, even if InsecureSkipVerify is set.
 func (c *certManager) Verify(hostname string) error {
 	if len(c.chain) == 0 {
 		return errNoCertificateChain
 	}
 
-	if c.config != nil && c.config.InsecureSkipVerify {
-		return nil
+	var verifiedChains [][]*x509.Certificate
+	if c.config == nil || !c.config.InsecureSkipVerify {
+		var err error
+		verifiedChains, err = c.verifyChain(hostname)
+		if err != nil {
+			return err
+		}
 	}
 
+	if c.config != nil && c.config.VerifyPeerCertificate != nil {
+		rawCerts := make([][]byte, len(c.chain))
+		for i, cert := range c.chain {
+			rawCerts[i] = cert.Raw
+		}
+		return c.config.VerifyPeerCertificate(rawCerts, verifiedChains)
+	}
+	return nil
+}
+
+func (c *certManager) verifyChain(hostname string) ([][]*x509.Certificate, error) {
 	leafCert := c.chain[0]
 
 	var opts x509.VerifyOptions
@@ -130,6 +148,5 @@ func (c *certManager) Verify(hostname string) error {
 		opts.Intermediates = intermediates
 	}
 
-	_, err := leafCert.Verify(opts)
-	return err
+	return leafCert.Verify(opts)
 }
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"errors"
 	"math/big"
 	"runtime"
 	"time"
@@ -268,6 +269,28 @@ var _ = Describe("Cert Manager", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("calls VerifyPeerCertificate if InsecureSkipVerify is set", func() {
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+			}
+			_, leafCert := getCertificate(template)
+			testErr := errors.New("rejected")
+			var called bool
+			cm.config = &tls.Config{
+				InsecureSkipVerify: true,
+				VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+					called = true
+					Expect(rawCerts).To(Equal([][]byte{leafCert.Raw}))
+					Expect(verifiedChains).To(BeNil())
+					return testErr
+				},
+			}
+			cm.chain = []*x509.Certificate{leafCert}
+			err := cm.Verify("quic.clemente.io")
+			Expect(err).To(MatchError(testErr))
+			Expect(called).To(BeTrue())
+		})
+
 		It("uses the time specified in a client TLS config", func() {
 			if runtime.GOOS == "windows" {
 				// certificate validation works different on windows, see https://golang.org/src/crypto/x509/verify.go line 238
@@ -317,10 +340,45 @@ var _ = Describe("Cert Manager", func() {
 			}
 
 			templateRoot := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+			}
+			rootKey, rootCert := getCertificate(templateRoot)
+			template := &x509.Certificate{
 				SerialNumber: big.NewInt(1),
 				NotBefore:    time.Now().Add(-time.Hour),
 				NotAfter:     time.Now().Add(time.Hour),
-				IsCA:         true,
+				Subject:      pkix.Name{CommonName: "google.com"},
+			}
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			leafCert := generateCertificate(template, rootCert, &key.PublicKey, rootKey)
+
+			rootCAPool := x509.NewCertPool()
+			rootCAPool.AddCert(rootCert)
+
+			cm.chain = []*x509.Certificate{leafCert}
+			cm.config = &tls.Config{
+				RootCAs: rootCAPool,
+			}
+			err = cm.Verify("google.com")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("calls VerifyPeerCertificate with the verified chains", func() {
+			if runtime.GOOS == "windows" {
+				// certificate validation works different on windows, see https://golang.org/src/crypto/x509/verify.go line 238
+				Skip("windows")
+			}
+
+			templateRoot := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				IsCA:                  true,
 				BasicConstraintsValid: true,
 			}
 			rootKey, rootCert := getCertificate(templateRoot)
@@ -328,7 +386,7 @@ var _ = Describe("Cert Manager", func() {
 				SerialNumber: big.NewInt(1),
 				NotBefore:    time.Now().Add(-time.Hour),
 				NotAfter:     time.Now().Add(time.Hour),
-				Subject:      pkix.Name{CommonName: "google.com"},
+				DNSNames:     []string{"google.com"},
 			}
 			key, err := rsa.GenerateKey(rand.Reader, 1024)
 			Expect(err).ToNot(HaveOccurred())
@@ -337,12 +395,19 @@ var _ = Describe("Cert Manager", func() {
 			rootCAPool := x509.NewCertPool()
 			rootCAPool.AddCert(rootCert)
 
+			var chains [][]*x509.Certificate
 			cm.chain = []*x509.Certificate{leafCert}
 			cm.config = &tls.Config{
 				RootCAs: rootCAPool,
+				VerifyPeerCertificate: func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+					chains = verifiedChains
+					return nil
+				},
 			}
 			err = cm.Verify("google.com")
 			Expect(err).ToNot(HaveOccurred())
+			Expect(chains).To(HaveLen(1))
+			Expect(chains[0]).To(Equal([]*x509.Certificate{leafCert, rootCert}))
 		})
 	})
 })
@@ -0,0 +1,65 @@
+package crypto
+
+import "encoding/binary"
+
+// chacha20XORKeyStream XORs src with the ChaCha20 key stream defined in RFC 7539, section 2.4, and writes the result to dst.
+// dst and src may overlap entirely or not at all.
+func chacha20XORKeyStream(dst, src []byte, key *[32]byte, nonce []byte, counter uint32) {
+	var block [64]byte
+	for len(src) > 0 {
+		chacha20Block(&block, key, nonce, counter)
+		counter++
+		n := len(src)
+		if n > len(block) {
+			n = len(block)
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ block[i]
+		}
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// chacha20Block computes one block of the ChaCha20 key stream, see RFC 7539, section 2.3
+func chacha20Block(out *[64]byte, key *[32]byte, nonce []byte, counter uint32) {
+	var in [16]uint32
+	in[0], in[1], in[2], in[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		in[4+i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	in[12] = counter
+	in[13] = binary.LittleEndian.Uint32(nonce[0:])
+	in[14] = binary.LittleEndian.Uint32(nonce[4:])
+	in[15] = binary.LittleEndian.Uint32(nonce[8:])
+
+	x := in
+	for i := 0; i < 10; i++ {
+		chacha20QuarterRound(&x, 0, 4, 8, 12)
+		chacha20QuarterRound(&x, 1, 5, 9, 13)
+		chacha20QuarterRound(&x, 2, 6, 10, 14)
+		chacha20QuarterRound(&x, 3, 7, 11, 15)
+		chacha20QuarterRound(&x, 0, 5, 10, 15)
+		chacha20QuarterRound(&x, 1, 6, 11, 12)
+		chacha20QuarterRound(&x, 2, 7, 8, 13)
+		chacha20QuarterRound(&x, 3, 4, 9, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+in[i])
+	}
+}
+
+func chacha20QuarterRound(x *[16]uint32, a, b, c, d int) {
+	x[a] += x[b]
+	x[d] ^= x[a]
+	x[d] = x[d]<<16 | x[d]>>16
+	x[c] += x[d]
+	x[b] ^= x[c]
+	x[b] = x[b]<<12 | x[b]>>20
+	x[a] += x[b]
+	x[d] ^= x[a]
+	x[d] = x[d]<<8 | x[d]>>24
+	x[c] += x[d]
+	x[b] ^= x[c]
+	x[b] = x[b]<<7 | x[b]>>25
+}
@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// gQUIC truncates the tag of ChaCha20-Poly1305 to 12 bytes
+const chacha20Poly1305TagLen = 12
+
+// chacha20Poly1305 implements the ChaCha20-Poly1305 AEAD defined in RFC 7539, with a truncated tag.
+type chacha20Poly1305 struct {
+	key [32]byte
+}
+
+var _ cipher.AEAD = &chacha20Poly1305{}
+
+func newChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	c := &chacha20Poly1305{}
+	copy(c.key[:], key)
+	return c, nil
+}
+
+func (c *chacha20Poly1305) NonceSize() int {
+	return 12
+}
+
+func (c *chacha20Poly1305) Overhead() int {
+	return chacha20Poly1305TagLen
+}
+
+func (c *chacha20Poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.NonceSize() {
+		panic("chacha20poly1305: bad nonce length passed to Seal")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+chacha20Poly1305TagLen)
+	// the first block of the key stream is used for the Poly1305 key, see RFC 7539, section 2.8
+	chacha20XORKeyStream(out, plaintext, &c.key, nonce, 1)
+	tag := c.tag(nonce, out[:len(plaintext)], additionalData)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+func (c *chacha20Poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.NonceSize() {
+		panic("chacha20poly1305: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < chacha20Poly1305TagLen {
+		return nil, errors.New("chacha20poly1305: message authentication failed")
+	}
+	tagOffset := len(ciphertext) - chacha20Poly1305TagLen
+	tag := c.tag(nonce, ciphertext[:tagOffset], additionalData)
+	if subtle.ConstantTimeCompare(tag[:chacha20Poly1305TagLen], ciphertext[tagOffset:]) != 1 {
+		return nil, errors.New("chacha20poly1305: message authentication failed")
+	}
+	ret, out := sliceForAppend(dst, tagOffset)
+	chacha20XORKeyStream(out, ciphertext[:tagOffset], &c.key, nonce, 1)
+	return ret, nil
+}
+
+// tag computes the (untruncated) Poly1305 tag, see RFC 7539, section 2.8
+func (c *chacha20Poly1305) tag(nonce, ciphertext, additionalData []byte) []byte {
+	var polyKey [32]byte
+	chacha20XORKeyStream(polyKey[:], polyKey[:], &c.key, nonce, 0)
+	var padding [16]byte
+	p := newPoly1305(&polyKey)
+	p.Write(additionalData)
+	p.Write(padding[:(16-len(additionalData)%16)%16])
+	p.Write(ciphertext)
+	p.Write(padding[:(16-len(ciphertext)%16)%16])
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[0:], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+	p.Write(lengths[:])
+	return p.Sum(nil)
+}
+
+// sliceForAppend extends in by n bytes.
+// It returns the extended slice, and the slice containing the n new bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
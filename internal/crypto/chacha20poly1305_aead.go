@@ -1,5 +1,3 @@
-// +build ignore
-
 package crypto
 
 import (
@@ -7,8 +5,6 @@ import (
 	"encoding/binary"
 	"errors"
 
-	"github.com/aead/chacha20"
-
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -19,21 +15,18 @@ type aeadChacha20Poly1305 struct {
 	decrypter cipher.AEAD
 }
 
+var _ AEAD = &aeadChacha20Poly1305{}
+
 // NewAEADChacha20Poly1305 creates a AEAD using chacha20poly1305
 func NewAEADChacha20Poly1305(otherKey []byte, myKey []byte, otherIV []byte, myIV []byte) (AEAD, error) {
 	if len(myKey) != 32 || len(otherKey) != 32 || len(myIV) != 4 || len(otherIV) != 4 {
 		return nil, errors.New("chacha20poly1305: expected 32-byte keys and 4-byte IVs")
 	}
-	// copy because ChaCha20Poly1305 expects array pointers
-	var MyKey, OtherKey [32]byte
-	copy(MyKey[:], myKey)
-	copy(OtherKey[:], otherKey)
-
-	encrypter, err := chacha20.NewChaCha20Poly1305WithTagSize(&MyKey, 12)
+	encrypter, err := newChaCha20Poly1305(myKey)
 	if err != nil {
 		return nil, err
 	}
-	decrypter, err := chacha20.NewChaCha20Poly1305WithTagSize(&OtherKey, 12)
+	decrypter, err := newChaCha20Poly1305(otherKey)
 	if err != nil {
 		return nil, err
 	}
@@ -59,3 +52,7 @@ func (aead *aeadChacha20Poly1305) makeNonce(iv []byte, packetNumber protocol.Pac
 	binary.LittleEndian.PutUint64(res[4:12], uint64(packetNumber))
 	return res
 }
+
+func (aead *aeadChacha20Poly1305) Overhead() int {
+	return aead.encrypter.Overhead()
+}
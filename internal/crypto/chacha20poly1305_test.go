@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChaCha20-Poly1305", func() {
+	Context("AEAD", func() {
+		// test vector from RFC 7539, section 2.8.2
+		var key, nonce, aad, plaintext, ciphertext []byte
+
+		BeforeEach(func() {
+			key = make([]byte, 32)
+			for i := range key {
+				key[i] = byte(0x80 + i)
+			}
+			var err error
+			nonce, err = hex.DecodeString("070000004041424344454647")
+			Expect(err).ToNot(HaveOccurred())
+			aad, err = hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+			Expect(err).ToNot(HaveOccurred())
+			plaintext = []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+			ciphertext, err = hex.DecodeString("d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" + "1ae10b594f09e26a7e902ecbd0600691")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("truncates the tag", func() {
+			aead, err := newChaCha20Poly1305(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aead.Overhead()).To(Equal(12))
+			Expect(aead.Seal(nil, nonce, plaintext, aad)).To(Equal(ciphertext[:len(plaintext)+12]))
+		})
+
+		It("opens", func() {
+			aead, err := newChaCha20Poly1305(key)
+			Expect(err).ToNot(HaveOccurred())
+			text, err := aead.Open(nil, nonce, ciphertext[:len(plaintext)+12], aad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(text).To(Equal(plaintext))
+		})
+
+		It("seals and opens in place", func() {
+			aead, err := newChaCha20Poly1305(key)
+			Expect(err).ToNot(HaveOccurred())
+			buf := make([]byte, len(plaintext), len(plaintext)+16)
+			copy(buf, plaintext)
+			sealed := aead.Seal(buf[:0], nonce, buf, aad)
+			Expect(sealed).To(Equal(ciphertext[:len(plaintext)+12]))
+			text, err := aead.Open(sealed[:0], nonce, sealed, aad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(text).To(Equal(plaintext))
+		})
+
+		It("fails to open modified messages", func() {
+			aead, err := newChaCha20Poly1305(key)
+			Expect(err).ToNot(HaveOccurred())
+			sealed := ciphertext[:len(plaintext)+12]
+			sealed[len(sealed)-1] ^= 1
+			_, err = aead.Open(nil, nonce, sealed, aad)
+			Expect(err).To(MatchError("chacha20poly1305: message authentication failed"))
+			sealed[len(sealed)-1] ^= 1
+			sealed[0] ^= 1
+			_, err = aead.Open(nil, nonce, sealed, aad)
+			Expect(err).To(MatchError("chacha20poly1305: message authentication failed"))
+			_, err = aead.Open(nil, nonce, sealed[:10], aad)
+			Expect(err).To(MatchError("chacha20poly1305: message authentication failed"))
+		})
+
+		It("rejects invalid keys", func() {
+			_, err := newChaCha20Poly1305(key[1:])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -17,16 +17,22 @@ var _ KeyExchange = &curve25519KEX{}
 
 // NewCurve25519KEX creates a new KeyExchange using Curve25519, see https://cr.yp.to/ecdh.html
 func NewCurve25519KEX() (KeyExchange, error) {
-	c := &curve25519KEX{}
-	if _, err := rand.Read(c.secret[:]); err != nil {
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
 		return nil, errors.New("Curve25519: could not create private key")
 	}
+	return NewCurve25519KEXFromPrivateKey(secret), nil
+}
+
+// NewCurve25519KEXFromPrivateKey creates a new KeyExchange using Curve25519, using the given private key
+func NewCurve25519KEXFromPrivateKey(secret [32]byte) KeyExchange {
+	c := &curve25519KEX{secret: secret}
 	// See https://cr.yp.to/ecdh.html
 	c.secret[0] &= 248
 	c.secret[31] &= 127
 	c.secret[31] |= 64
 	curve25519.ScalarBaseMult(&c.public, &c.secret)
-	return c, nil
+	return c
 }
 
 func (c *curve25519KEX) PublicKey() []byte {
@@ -24,4 +24,19 @@ var _ = Describe("ProofRsa", func() {
 		_, err = a.CalculateSharedKey(nil)
 		Expect(err).To(MatchError("Curve25519: expected public key of 32 byte"))
 	})
+
+	It("uses a given private key", func() {
+		var secret [32]byte
+		copy(secret[:], "foobar")
+		a := NewCurve25519KEXFromPrivateKey(secret)
+		b := NewCurve25519KEXFromPrivateKey(secret)
+		Expect(a.PublicKey()).To(Equal(b.PublicKey()))
+		c, err := NewCurve25519KEX()
+		Expect(err).ToNot(HaveOccurred())
+		sA, err := a.CalculateSharedKey(c.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		sC, err := c.CalculateSharedKey(b.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sA).To(Equal(sC))
+	})
 })
@@ -0,0 +1,32 @@
+package crypto
+
+const (
+	// HeaderProtectionSampleOffset is the offset of the header protection sample, counted from the start of the packet number
+	HeaderProtectionSampleOffset = 4
+	// HeaderProtectionSampleLen is the length of the header protection sample
+	HeaderProtectionSampleLen = 16
+)
+
+// For short headers, the key phase bit and the packet number length are protected.
+// All other bits of the first byte are needed to parse the header before removing header protection.
+const shortHeaderFirstByteMask = 0x23
+
+// A HeaderProtector applies and removes header protection for IETF QUIC packets.
+// The sample is taken from the ciphertext of the packet.
+// pnBytes are the bytes of the packet number (up to 4 bytes).
+type HeaderProtector interface {
+	EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+}
+
+// applyHeaderProtectionMask XORs the mask onto the header.
+// Since XOR is its own inverse, it is used for both applying and removing header protection.
+// For long headers, only the packet number is protected.
+func applyHeaderProtectionMask(mask []byte, firstByte *byte, pnBytes []byte) {
+	if *firstByte&0x80 == 0 {
+		*firstByte ^= mask[0] & shortHeaderFirstByteMask
+	}
+	for i := range pnBytes {
+		pnBytes[i] ^= mask[i+1]
+	}
+}
@@ -50,9 +50,31 @@ func DeriveAESKeys(tls TLSExporter, pers protocol.Perspective) (AEAD, error) {
 	return NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
 }
 
+// DeriveHeaderProtector derives the header protection keys and creates a matching HeaderProtector.
+// Only AES-GCM cipher suites are offered, so AES-ECB is used.
+func DeriveHeaderProtector(tls TLSExporter, pers protocol.Perspective) (HeaderProtector, error) {
+	var myLabel, otherLabel string
+	if pers == protocol.PerspectiveClient {
+		myLabel = clientExporterLabel
+		otherLabel = serverExporterLabel
+	} else {
+		myLabel = serverExporterLabel
+		otherLabel = clientExporterLabel
+	}
+	myKey, err := computeHeaderProtectionKey(tls, myLabel)
+	if err != nil {
+		return nil, err
+	}
+	otherKey, err := computeHeaderProtectionKey(tls, otherLabel)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESHeaderProtector(otherKey, myKey)
+}
+
 func computeKeyAndIV(tls TLSExporter, label string) (key, iv []byte, err error) {
 	cs := tls.GetCipherSuite()
-	secret, err := tls.ComputeExporter(label, nil, cs.Hash.Size())
+	secret, err := computeExporterSecret(tls, label)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -60,3 +82,15 @@ func computeKeyAndIV(tls TLSExporter, label string) (key, iv []byte, err error)
 	iv = qhkdfExpand(secret, "iv", cs.IvLen)
 	return key, iv, nil
 }
+
+func computeHeaderProtectionKey(tls TLSExporter, label string) ([]byte, error) {
+	secret, err := computeExporterSecret(tls, label)
+	if err != nil {
+		return nil, err
+	}
+	return qhkdfExpand(secret, "hp", tls.GetCipherSuite().KeyLen), nil
+}
+
+func computeExporterSecret(tls TLSExporter, label string) ([]byte, error) {
+	return tls.ComputeExporter(label, nil, tls.GetCipherSuite().Hash.Size())
+}
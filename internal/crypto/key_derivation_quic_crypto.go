@@ -3,6 +3,7 @@ package crypto
 import (
 	"bytes"
 	"crypto/sha256"
+	"errors"
 	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -11,28 +12,92 @@ import (
 	"golang.org/x/crypto/hkdf"
 )
 
-// DeriveKeysChacha20 derives the client and server keys and creates a matching chacha20poly1305 AEAD instance
-// func DeriveKeysChacha20(version protocol.VersionNumber, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte) (AEAD, error) {
-// 	otherKey, myKey, otherIV, myIV, err := deriveKeys(version, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, 32)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return NewAEADChacha20Poly1305(otherKey, myKey, otherIV, myIV)
-// }
+// A QuicCryptoAEAD is an AEAD algorithm that can be negotiated in gQUIC
+type QuicCryptoAEAD uint8
+
+const (
+	// QuicCryptoAESGCM is AES-128-GCM with a 12 byte tag
+	QuicCryptoAESGCM QuicCryptoAEAD = iota
+	// QuicCryptoChaCha20Poly1305 is ChaCha20-Poly1305 with a 12 byte tag
+	QuicCryptoChaCha20Poly1305
+)
 
 // DeriveQuicCryptoAESKeys derives the client and server keys and creates a matching AES-GCM AEAD instance
 func DeriveQuicCryptoAESKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+	return deriveQuicCryptoKeys(nil, QuicCryptoAESGCM, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+}
+
+// DeriveQuicCryptoKeys derives the client and server keys and creates a matching AEAD instance
+func DeriveQuicCryptoKeys(aeadType QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+	return deriveQuicCryptoKeys(nil, aeadType, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+}
+
+// DeriveQuicCryptoKeysWithKeyLog returns a function that works like DeriveQuicCryptoKeys,
+// and additionally writes the derived keys to the key log.
+func DeriveQuicCryptoKeysWithKeyLog(keyLog io.Writer) func(QuicCryptoAEAD, bool, []byte, []byte, protocol.ConnectionID, []byte, []byte, []byte, []byte, protocol.Perspective) (AEAD, error) {
+	return func(aeadType QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+		return deriveQuicCryptoKeys(keyLog, aeadType, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+	}
+}
+
+func deriveQuicCryptoKeys(keyLog io.Writer, aeadType QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+	var keyLen int
+	switch aeadType {
+	case QuicCryptoAESGCM:
+		keyLen = 16
+	case QuicCryptoChaCha20Poly1305:
+		keyLen = 32
+	default:
+		return nil, errors.New("unknown AEAD")
+	}
 	var swap bool
 	if pers == protocol.PerspectiveClient {
 		swap = true
 	}
-	otherKey, myKey, otherIV, myIV, err := deriveKeys(forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, 16, swap)
+	otherKey, myKey, otherIV, myIV, err := deriveKeys(forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, keyLen, swap)
 	if err != nil {
 		return nil, err
 	}
+	if keyLog != nil {
+		var err error
+		if pers == protocol.PerspectiveClient {
+			err = writeQuicCryptoKeyLog(keyLog, forwardSecure, connID, myKey, otherKey, myIV, otherIV)
+		} else {
+			err = writeQuicCryptoKeyLog(keyLog, forwardSecure, connID, otherKey, myKey, otherIV, myIV)
+		}
+		if err != nil {
+			utils.Errorf("Writing the key log failed: %s", err.Error())
+		}
+	}
+	if aeadType == QuicCryptoChaCha20Poly1305 {
+		return NewAEADChacha20Poly1305(otherKey, myKey, otherIV, myIV)
+	}
 	return NewAEADAESGCM12(otherKey, myKey, otherIV, myIV)
 }
 
+// ExportQuicCryptoKeyingMaterial is the gQUIC equivalent of the TLS exporter.
+// It uses HKDF-SHA256 with the forward-secure shared secret as secret, the client nonce and the server nonce as salt,
+// and "QUIC exporter", a 0x00 byte, the connection ID, the length of the label, the label and the SHA-256 hash of the context as info.
+func ExportQuicCryptoKeyingMaterial(sharedSecret, nonces []byte, connID protocol.ConnectionID, label string, context []byte, length int) ([]byte, error) {
+	if len(label) > 255 {
+		return nil, errors.New("exporter label too long")
+	}
+	var info bytes.Buffer
+	info.Write([]byte("QUIC exporter\x00"))
+	utils.BigEndian.WriteUint64(&info, uint64(connID))
+	info.WriteByte(uint8(len(label)))
+	info.Write([]byte(label))
+	contextHash := sha256.Sum256(context)
+	info.Write(contextHash[:])
+
+	r := hkdf.New(sha256.New, sharedSecret, nonces, info.Bytes())
+	out := make([]byte, length)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // deriveKeys derives the keys and the IVs
 // swap should be set true if generating the values for the client, and false for the server
 func deriveKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo, scfg, cert, divNonce []byte, keyLen int, swap bool) ([]byte, []byte, []byte, []byte, error) {
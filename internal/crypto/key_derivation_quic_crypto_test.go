@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"strings"
+
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 
 	. "github.com/onsi/ginkgo"
@@ -8,83 +10,48 @@ import (
 )
 
 var _ = Describe("QUIC Crypto Key Derivation", func() {
-	// Context("chacha20poly1305", func() {
-	// 	It("derives non-fs keys", func() {
-	// 		aead, err := DeriveKeysChacha20(
-	// 			protocol.Version32,
-	// 			false,
-	// 			[]byte("0123456789012345678901"),
-	// 			[]byte("nonce"),
-	// 			protocol.ConnectionID(42),
-	// 			[]byte("chlo"),
-	// 			[]byte("scfg"),
-	// 			[]byte("cert"),
-	// 			nil,
-	// 		)
-	// 		Expect(err).ToNot(HaveOccurred())
-	// 		chacha := aead.(*aeadChacha20Poly1305)
-	// 		// If the IVs match, the keys will match too, since the keys are read earlier
-	// 		Expect(chacha.myIV).To(Equal([]byte{0xf0, 0xf5, 0x4c, 0xa8}))
-	// 		Expect(chacha.otherIV).To(Equal([]byte{0x75, 0xd8, 0xa2, 0x8d}))
-	// 	})
-	//
-	// 	It("derives fs keys", func() {
-	// 		aead, err := DeriveKeysChacha20(
-	// 			protocol.Version32,
-	// 			true,
-	// 			[]byte("0123456789012345678901"),
-	// 			[]byte("nonce"),
-	// 			protocol.ConnectionID(42),
-	// 			[]byte("chlo"),
-	// 			[]byte("scfg"),
-	// 			[]byte("cert"),
-	// 			nil,
-	// 		)
-	// 		Expect(err).ToNot(HaveOccurred())
-	// 		chacha := aead.(*aeadChacha20Poly1305)
-	// 		// If the IVs match, the keys will match too, since the keys are read earlier
-	// 		Expect(chacha.myIV).To(Equal([]byte{0xf5, 0x73, 0x11, 0x79}))
-	// 		Expect(chacha.otherIV).To(Equal([]byte{0xf7, 0x26, 0x4d, 0x2c}))
-	// 	})
-	//
-	// 	It("does not use diversification nonces in FS key derivation", func() {
-	// 		aead, err := DeriveKeysChacha20(
-	// 			protocol.Version33,
-	// 			true,
-	// 			[]byte("0123456789012345678901"),
-	// 			[]byte("nonce"),
-	// 			protocol.ConnectionID(42),
-	// 			[]byte("chlo"),
-	// 			[]byte("scfg"),
-	// 			[]byte("cert"),
-	// 			[]byte("divnonce"),
-	// 		)
-	// 		Expect(err).ToNot(HaveOccurred())
-	// 		chacha := aead.(*aeadChacha20Poly1305)
-	// 		// If the IVs match, the keys will match too, since the keys are read earlier
-	// 		Expect(chacha.myIV).To(Equal([]byte{0xf5, 0x73, 0x11, 0x79}))
-	// 		Expect(chacha.otherIV).To(Equal([]byte{0xf7, 0x26, 0x4d, 0x2c}))
-	// 	})
-	//
-	// 	It("uses diversification nonces in initial key derivation", func() {
-	// 		aead, err := DeriveKeysChacha20(
-	// 			protocol.Version33,
-	// 			false,
-	// 			[]byte("0123456789012345678901"),
-	// 			[]byte("nonce"),
-	// 			protocol.ConnectionID(42),
-	// 			[]byte("chlo"),
-	// 			[]byte("scfg"),
-	// 			[]byte("cert"),
-	// 			[]byte("divnonce"),
-	// 		)
-	// 		Expect(err).ToNot(HaveOccurred())
-	// 		chacha := aead.(*aeadChacha20Poly1305)
-	// 		// If the IVs match, the keys will match too, since the keys are read earlier
-	// 		Expect(chacha.myIV).To(Equal([]byte{0xc4, 0x12, 0x25, 0x64}))
-	// 		Expect(chacha.otherIV).To(Equal([]byte{0x75, 0xd8, 0xa2, 0x8d}))
-	// 	})
-	// })
+	Context("ChaCha20-Poly1305", func() {
+		It("derives keys that the peer can use", func() {
+			derive := func(pers protocol.Perspective) AEAD {
+				aead, err := DeriveQuicCryptoKeys(
+					QuicCryptoChaCha20Poly1305,
+					false,
+					[]byte("0123456789012345678901"),
+					[]byte("nonce"),
+					protocol.ConnectionID(42),
+					[]byte("chlo"),
+					[]byte("scfg"),
+					[]byte("cert"),
+					[]byte("divnoncedivnoncedivnoncedivnonce"),
+					pers,
+				)
+				Expect(err).ToNot(HaveOccurred())
+				return aead
+			}
+			client := derive(protocol.PerspectiveClient)
+			server := derive(protocol.PerspectiveServer)
+			Expect(client).To(BeAssignableToTypeOf(&aeadChacha20Poly1305{}))
+			sealed := client.Seal(nil, []byte("foobar"), 42, []byte("aad"))
+			Expect(sealed).To(HaveLen(6 + 12))
+			opened, err := server.Open(nil, sealed, 42, []byte("aad"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal([]byte("foobar")))
+		})
+
+		It("uses different keys than AES-GCM", func() {
+			// the key length is 32 bytes instead of 16, so the IVs are read from a different offset
+			chacha, err := DeriveQuicCryptoKeys(QuicCryptoChaCha20Poly1305, true, []byte("secret"), []byte("nonce"), 42, nil, nil, nil, nil, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			aesgcm, err := DeriveQuicCryptoKeys(QuicCryptoAESGCM, true, []byte("secret"), []byte("nonce"), 42, nil, nil, nil, nil, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chacha.(*aeadChacha20Poly1305).myIV).ToNot(Equal(aesgcm.(*aeadAESGCM12).myIV))
+		})
+
+		It("errors for unknown AEADs", func() {
+			_, err := DeriveQuicCryptoKeys(42, true, []byte("secret"), []byte("nonce"), 42, nil, nil, nil, nil, protocol.PerspectiveServer)
+			Expect(err).To(MatchError("unknown AEAD"))
+		})
+	})
 
 	Context("AES-GCM", func() {
 		It("derives non-forward secure keys", func() {
@@ -194,4 +161,41 @@ var _ = Describe("QUIC Crypto Key Derivation", func() {
 			Expect(aesgcm.otherIV).To(Equal([]byte{0xf2, 0x7a, 0xcc, 0x42}))
 		})
 	})
+
+	Context("exporting keying material", func() {
+		export := func(connID protocol.ConnectionID, label string, context []byte) []byte {
+			out, err := ExportQuicCryptoKeyingMaterial([]byte("0123456789012345678901"), []byte("nonce"), connID, label, context, 32)
+			Expect(err).ToNot(HaveOccurred())
+			return out
+		}
+
+		It("exports keying material", func() {
+			out := export(42, "label", []byte("context"))
+			Expect(out).To(HaveLen(32))
+			Expect(export(42, "label", []byte("context"))).To(Equal(out))
+		})
+
+		It("depends on the label, the context and the connection ID", func() {
+			out := export(42, "label", []byte("context"))
+			Expect(export(43, "label", []byte("context"))).ToNot(Equal(out))
+			Expect(export(42, "other label", []byte("context"))).ToNot(Equal(out))
+			Expect(export(42, "label", []byte("other context"))).ToNot(Equal(out))
+		})
+
+		It("exports keying material of the requested length", func() {
+			out, err := ExportQuicCryptoKeyingMaterial([]byte("secret"), []byte("nonce"), 42, "label", nil, 1000)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).To(HaveLen(1000))
+		})
+
+		It("errors if too much keying material is requested", func() {
+			_, err := ExportQuicCryptoKeyingMaterial([]byte("secret"), []byte("nonce"), 42, "label", nil, 255*32+1)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors if the label is too long", func() {
+			_, err := ExportQuicCryptoKeyingMaterial([]byte("secret"), []byte("nonce"), 42, strings.Repeat("a", 256), nil, 32)
+			Expect(err).To(MatchError("exporter label too long"))
+		})
+	})
 })
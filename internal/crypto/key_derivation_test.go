@@ -12,6 +12,7 @@ import (
 
 type mockTLSExporter struct {
 	hash          crypto.Hash
+	suite         mint.CipherSuite
 	computerError error
 }
 
@@ -21,6 +22,7 @@ func (c *mockTLSExporter) Handshake() mint.Alert { panic("not implemented") }
 
 func (c *mockTLSExporter) GetCipherSuite() mint.CipherSuiteParams {
 	return mint.CipherSuiteParams{
+		Suite:  c.suite,
 		Hash:   c.hash,
 		KeyLen: 32,
 		IvLen:  12,
@@ -51,4 +53,29 @@ var _ = Describe("Key Derivation", func() {
 		_, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, protocol.PerspectiveClient)
 		Expect(err).To(MatchError(testErr))
 	})
+
+	Context("header protection", func() {
+		sample := []byte("0123456789abcdef")
+
+		It("derives AES header protection keys", func() {
+			clientHP, err := DeriveHeaderProtector(&mockTLSExporter{hash: crypto.SHA256, suite: mint.TLS_AES_128_GCM_SHA256}, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientHP).To(BeAssignableToTypeOf(&aesHeaderProtector{}))
+			serverHP, err := DeriveHeaderProtector(&mockTLSExporter{hash: crypto.SHA256, suite: mint.TLS_AES_128_GCM_SHA256}, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			firstByte := byte(0x12)
+			pn := []byte{0xde, 0xad, 0xbe, 0xef}
+			clientHP.EncryptHeader(sample, &firstByte, pn)
+			Expect(pn).ToNot(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+			serverHP.DecryptHeader(sample, &firstByte, pn)
+			Expect(firstByte).To(Equal(byte(0x12)))
+			Expect(pn).To(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+		})
+
+		It("fails when computing the exporter fails", func() {
+			testErr := errors.New("test error")
+			_, err := DeriveHeaderProtector(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, protocol.PerspectiveClient)
+			Expect(err).To(MatchError(testErr))
+		})
+	})
 })
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// Labels used in the key log.
+// The lines are written in the NSS key log format: <label> <identifier> <secret>.
+// For gQUIC the identifier is the connection ID.
+// For IETF QUIC the identifier is the client random of the TLS ClientHello.
+const (
+	keyLogLabelClient1RTTSecret = "QUIC_CLIENT_1RTT_SECRET"
+	keyLogLabelServer1RTTSecret = "QUIC_SERVER_1RTT_SECRET"
+
+	keyLogLabelClientInitialKey       = "GQUIC_CLIENT_INITIAL_KEY"
+	keyLogLabelClientInitialIV        = "GQUIC_CLIENT_INITIAL_IV"
+	keyLogLabelServerInitialKey       = "GQUIC_SERVER_INITIAL_KEY"
+	keyLogLabelServerInitialIV        = "GQUIC_SERVER_INITIAL_IV"
+	keyLogLabelClientForwardSecureKey = "GQUIC_CLIENT_FORWARD_SECURE_KEY"
+	keyLogLabelClientForwardSecureIV  = "GQUIC_CLIENT_FORWARD_SECURE_IV"
+	keyLogLabelServerForwardSecureKey = "GQUIC_SERVER_FORWARD_SECURE_KEY"
+	keyLogLabelServerForwardSecureIV  = "GQUIC_SERVER_FORWARD_SECURE_IV"
+)
+
+// the key log writer is shared between all connections
+var keyLogMutex sync.Mutex
+
+type keyLogEntry struct {
+	label  string
+	secret []byte
+}
+
+func writeKeyLog(w io.Writer, id []byte, entries []keyLogEntry) error {
+	var lines []byte
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s %x %x\n", e.label, id, e.secret)...)
+	}
+	keyLogMutex.Lock()
+	defer keyLogMutex.Unlock()
+	_, err := w.Write(lines)
+	return err
+}
+
+// WriteTLSKeyLog writes the 1-RTT secrets of IETF QUIC to the key log.
+// The secrets are exported from the TLS connection, so they can only be logged after the handshake completed.
+func WriteTLSKeyLog(w io.Writer, tls TLSExporter, clientRandom []byte) error {
+	clientSecret, err := computeExporterSecret(tls, clientExporterLabel)
+	if err != nil {
+		return err
+	}
+	serverSecret, err := computeExporterSecret(tls, serverExporterLabel)
+	if err != nil {
+		return err
+	}
+	return writeKeyLog(w, clientRandom, []keyLogEntry{
+		{keyLogLabelClient1RTTSecret, clientSecret},
+		{keyLogLabelServer1RTTSecret, serverSecret},
+	})
+}
+
+func writeQuicCryptoKeyLog(w io.Writer, forwardSecure bool, connID protocol.ConnectionID, clientKey, serverKey, clientIV, serverIV []byte) error {
+	id := &bytes.Buffer{}
+	utils.BigEndian.WriteUint64(id, uint64(connID))
+	if forwardSecure {
+		return writeKeyLog(w, id.Bytes(), []keyLogEntry{
+			{keyLogLabelClientForwardSecureKey, clientKey},
+			{keyLogLabelClientForwardSecureIV, clientIV},
+			{keyLogLabelServerForwardSecureKey, serverKey},
+			{keyLogLabelServerForwardSecureIV, serverIV},
+		})
+	}
+	return writeKeyLog(w, id.Bytes(), []keyLogEntry{
+		{keyLogLabelClientInitialKey, clientKey},
+		{keyLogLabelClientInitialIV, clientIV},
+		{keyLogLabelServerInitialKey, serverKey},
+		{keyLogLabelServerInitialIV, serverIV},
+	})
+}
@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key Log", func() {
+	Context("IETF QUIC", func() {
+		clientRandom := bytes.Repeat([]byte{0xab}, 32)
+
+		It("logs the 1-RTT secrets", func() {
+			b := &bytes.Buffer{}
+			Expect(WriteTLSKeyLog(b, &mockTLSExporter{hash: crypto.SHA256}, clientRandom)).To(Succeed())
+			Expect(b.String()).To(Equal(fmt.Sprintf(
+				"QUIC_CLIENT_1RTT_SECRET %x %x\nQUIC_SERVER_1RTT_SECRET %x %x\n",
+				clientRandom, []byte("EXPORTER-QUIC client 1rtt"),
+				clientRandom, []byte("EXPORTER-QUIC server 1rtt"),
+			)))
+		})
+
+		It("returns the error when the secrets can't be exported", func() {
+			b := &bytes.Buffer{}
+			testErr := errors.New("test error")
+			Expect(WriteTLSKeyLog(b, &mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, clientRandom)).To(MatchError(testErr))
+			Expect(b.Len()).To(BeZero())
+		})
+	})
+
+	Context("gQUIC", func() {
+		deriveKeys := func(forwardSecure bool, pers protocol.Perspective) string {
+			b := &bytes.Buffer{}
+			_, err := DeriveQuicCryptoKeysWithKeyLog(b)(
+				QuicCryptoAESGCM,
+				forwardSecure,
+				[]byte("0123456789012345678901"),
+				[]byte("nonce"),
+				protocol.ConnectionID(0xdeadbeef),
+				[]byte("chlo"),
+				[]byte("scfg"),
+				[]byte("cert"),
+				[]byte("divnoncedivnoncedivnoncedivnonce"),
+				pers,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			return b.String()
+		}
+
+		It("logs the initial keys", func() {
+			log := deriveKeys(false, protocol.PerspectiveClient)
+			lines := strings.Split(strings.TrimSuffix(log, "\n"), "\n")
+			Expect(lines).To(HaveLen(4))
+			for i, label := range []string{"GQUIC_CLIENT_INITIAL_KEY", "GQUIC_CLIENT_INITIAL_IV", "GQUIC_SERVER_INITIAL_KEY", "GQUIC_SERVER_INITIAL_IV"} {
+				Expect(lines[i]).To(HavePrefix(label + " 00000000deadbeef "))
+			}
+			// client and server log the same keys
+			Expect(deriveKeys(false, protocol.PerspectiveServer)).To(Equal(log))
+		})
+
+		It("logs the forward-secure keys", func() {
+			log := deriveKeys(true, protocol.PerspectiveServer)
+			lines := strings.Split(strings.TrimSuffix(log, "\n"), "\n")
+			Expect(lines).To(HaveLen(4))
+			for i, label := range []string{"GQUIC_CLIENT_FORWARD_SECURE_KEY", "GQUIC_CLIENT_FORWARD_SECURE_IV", "GQUIC_SERVER_FORWARD_SECURE_KEY", "GQUIC_SERVER_FORWARD_SECURE_IV"} {
+				Expect(lines[i]).To(HavePrefix(label + " 00000000deadbeef "))
+			}
+			Expect(deriveKeys(true, protocol.PerspectiveClient)).To(Equal(log))
+		})
+
+		It("logs the keys used by the AEAD", func() {
+			b := &bytes.Buffer{}
+			aead, err := DeriveQuicCryptoKeysWithKeyLog(b)(QuicCryptoAESGCM, true, []byte("secret"), []byte("nonce"), 42, nil, nil, nil, nil, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			var clientKey, clientIV []byte
+			for _, line := range strings.Split(b.String(), "\n") {
+				var label string
+				var id, secret []byte
+				if _, err := fmt.Sscanf(line, "%s %x %x", &label, &id, &secret); err != nil {
+					continue
+				}
+				switch label {
+				case "GQUIC_CLIENT_FORWARD_SECURE_KEY":
+					clientKey = secret
+				case "GQUIC_CLIENT_FORWARD_SECURE_IV":
+					clientIV = secret
+				}
+			}
+			Expect(aead.(*aeadAESGCM12).myIV).To(Equal(clientIV))
+			Expect(clientKey).To(HaveLen(16))
+		})
+	})
+})
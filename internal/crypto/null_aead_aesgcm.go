@@ -28,6 +28,21 @@ func newNullAEADAESGCM(connectionID protocol.ConnectionID, pers protocol.Perspec
 	return NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
 }
 
+// NewNullHeaderProtector creates the HeaderProtector used for packets sent with the null AEAD
+func NewNullHeaderProtector(pers protocol.Perspective, connectionID protocol.ConnectionID) (HeaderProtector, error) {
+	clientSecret, serverSecret := computeSecrets(connectionID)
+
+	var mySecret, otherSecret []byte
+	if pers == protocol.PerspectiveClient {
+		mySecret = clientSecret
+		otherSecret = serverSecret
+	} else {
+		mySecret = serverSecret
+		otherSecret = clientSecret
+	}
+	return NewAESHeaderProtector(computeNullHeaderProtectionKey(otherSecret), computeNullHeaderProtectionKey(mySecret))
+}
+
 func computeSecrets(connectionID protocol.ConnectionID) (clientSecret, serverSecret []byte) {
 	connID := make([]byte, 8)
 	binary.BigEndian.PutUint64(connID, uint64(connectionID))
@@ -42,3 +57,7 @@ func computeNullAEADKeyAndIV(secret []byte) (key, iv []byte) {
 	iv = qhkdfExpand(secret, "iv", 12)
 	return
 }
+
+func computeNullHeaderProtectionKey(secret []byte) []byte {
+	return qhkdfExpand(secret, "hp", 16)
+}
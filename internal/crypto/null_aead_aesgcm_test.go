@@ -81,4 +81,24 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		_, err = serverAEAD.Open(nil, clientMessage, 42, []byte("aad"))
 		Expect(err).To(MatchError("cipher: message authentication failed"))
 	})
+
+	It("protects and unprotects headers", func() {
+		connectionID := protocol.ConnectionID(0x1234567890)
+		clientHP, err := NewNullHeaderProtector(protocol.PerspectiveClient, connectionID)
+		Expect(err).ToNot(HaveOccurred())
+		serverHP, err := NewNullHeaderProtector(protocol.PerspectiveServer, connectionID)
+		Expect(err).ToNot(HaveOccurred())
+
+		sample := []byte("0123456789abcdef")
+		firstByte := byte(0x82)
+		pn := []byte{0x13, 0x37, 0xbe, 0xef}
+		clientHP.EncryptHeader(sample, &firstByte, pn)
+		Expect(pn).ToNot(Equal([]byte{0x13, 0x37, 0xbe, 0xef}))
+		serverHP.DecryptHeader(sample, &firstByte, pn)
+		Expect(pn).To(Equal([]byte{0x13, 0x37, 0xbe, 0xef}))
+		serverHP.EncryptHeader(sample, &firstByte, pn)
+		clientHP.DecryptHeader(sample, &firstByte, pn)
+		Expect(pn).To(Equal([]byte{0x13, 0x37, 0xbe, 0xef}))
+		Expect(firstByte).To(Equal(byte(0x82)))
+	})
 })
@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+type p256KEX struct {
+	secret []byte
+	public []byte
+}
+
+var _ KeyExchange = &p256KEX{}
+
+// NewP256KEX creates a new KeyExchange using ECDH on the NIST P-256 curve
+func NewP256KEX() (KeyExchange, error) {
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return nil, errors.New("P-256: could not create private key")
+	}
+	return NewP256KEXFromPrivateKey(secret), nil
+}
+
+// NewP256KEXFromPrivateKey creates a new KeyExchange using ECDH on the NIST P-256 curve, using the given private key.
+// Any 32 byte value can be used, it is mapped to a valid scalar in the range [1, n-1].
+func NewP256KEXFromPrivateKey(secret [32]byte) KeyExchange {
+	curve := elliptic.P256()
+	nMinus1 := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	k := new(big.Int).SetBytes(secret[:])
+	k.Mod(k, nMinus1)
+	k.Add(k, big.NewInt(1))
+	c := &p256KEX{secret: padTo32Bytes(k.Bytes())}
+	x, y := curve.ScalarBaseMult(c.secret)
+	c.public = elliptic.Marshal(curve, x, y)
+	return c
+}
+
+// PublicKey returns the public key as an uncompressed point
+func (c *p256KEX) PublicKey() []byte {
+	return c.public
+}
+
+// CalculateSharedKey returns the x coordinate of the shared point
+func (c *p256KEX) CalculateSharedKey(otherPublic []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, otherPublic)
+	if x == nil {
+		return nil, errors.New("P-256: invalid public key")
+	}
+	sx, _ := curve.ScalarMult(x, y, c.secret)
+	return padTo32Bytes(sx.Bytes()), nil
+}
+
+// padTo32Bytes left-pads a big-endian integer with zeros
+func padTo32Bytes(b []byte) []byte {
+	res := make([]byte, 32)
+	copy(res[32-len(b):], b)
+	return res
+}
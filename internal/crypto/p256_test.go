@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("P-256", func() {
+	It("works", func() {
+		a, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		b, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.PublicKey()).To(HaveLen(65))
+		sA, err := a.CalculateSharedKey(b.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		sB, err := b.CalculateSharedKey(a.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sA).To(HaveLen(32))
+		Expect(sA).To(Equal(sB))
+	})
+
+	It("rejects invalid public keys", func() {
+		a, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = a.CalculateSharedKey(nil)
+		Expect(err).To(MatchError("P-256: invalid public key"))
+		// a point that is not on the curve
+		invalid := make([]byte, 65)
+		invalid[0] = 4
+		invalid[64] = 1
+		_, err = a.CalculateSharedKey(invalid)
+		Expect(err).To(MatchError("P-256: invalid public key"))
+	})
+
+	It("uses a given private key", func() {
+		var secret [32]byte
+		copy(secret[:], "foobar")
+		a := NewP256KEXFromPrivateKey(secret)
+		b := NewP256KEXFromPrivateKey(secret)
+		Expect(a.PublicKey()).To(Equal(b.PublicKey()))
+		c, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		sA, err := a.CalculateSharedKey(c.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		sC, err := c.CalculateSharedKey(b.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sA).To(Equal(sC))
+	})
+
+	It("accepts private keys that are larger than the group order", func() {
+		var secret [32]byte
+		for i := range secret {
+			secret[i] = 0xff
+		}
+		a := NewP256KEXFromPrivateKey(secret)
+		Expect(a.PublicKey()).To(HaveLen(65))
+	})
+	It("pads small private keys", func() {
+		// the zero key is mapped to the scalar 1
+		var secret [32]byte
+		a := NewP256KEXFromPrivateKey(secret)
+		Expect(a.(*p256KEX).secret).To(Equal(append(make([]byte, 31), 1)))
+		curve := elliptic.P256()
+		Expect(a.PublicKey()).To(Equal(elliptic.Marshal(curve, curve.Params().Gx, curve.Params().Gy)))
+	})
+})
@@ -0,0 +1,158 @@
+package crypto
+
+import "encoding/binary"
+
+const poly1305TagLen = 16
+
+// poly1305 is the one-time authenticator defined in RFC 7539, section 2.5.
+// It uses 26 bit limbs, so that all products fit into an uint64.
+type poly1305 struct {
+	r, h [5]uint32
+	s    [4]uint32
+
+	buf    [16]byte
+	bufLen int
+}
+
+func newPoly1305(key *[32]byte) *poly1305 {
+	p := &poly1305{}
+	p.r[0] = binary.LittleEndian.Uint32(key[0:]) & 0x3ffffff
+	p.r[1] = (binary.LittleEndian.Uint32(key[3:]) >> 2) & 0x3ffff03
+	p.r[2] = (binary.LittleEndian.Uint32(key[6:]) >> 4) & 0x3ffc0ff
+	p.r[3] = (binary.LittleEndian.Uint32(key[9:]) >> 6) & 0x3f03fff
+	p.r[4] = (binary.LittleEndian.Uint32(key[12:]) >> 8) & 0x00fffff
+	for i := range p.s {
+		p.s[i] = binary.LittleEndian.Uint32(key[16+4*i:])
+	}
+	return p
+}
+
+func (p *poly1305) Write(data []byte) {
+	if p.bufLen > 0 {
+		n := copy(p.buf[p.bufLen:], data)
+		p.bufLen += n
+		data = data[n:]
+		if p.bufLen < len(p.buf) {
+			return
+		}
+		p.block(p.buf[:], 1<<24)
+		p.bufLen = 0
+	}
+	for len(data) >= 16 {
+		p.block(data[:16], 1<<24)
+		data = data[16:]
+	}
+	p.bufLen = copy(p.buf[:], data)
+}
+
+// Sum appends the tag to b.
+// The poly1305 must not be used after calling Sum.
+func (p *poly1305) Sum(b []byte) []byte {
+	if p.bufLen > 0 {
+		// pad the final block with a 1 bit, instead of setting the 2^128 bit
+		p.buf[p.bufLen] = 1
+		for i := p.bufLen + 1; i < len(p.buf); i++ {
+			p.buf[i] = 0
+		}
+		p.block(p.buf[:], 0)
+	}
+
+	const mask = 0x3ffffff
+	h0, h1, h2, h3, h4 := p.h[0], p.h[1], p.h[2], p.h[3], p.h[4]
+	c := h1 >> 26
+	h1 &= mask
+	h2 += c
+	c = h2 >> 26
+	h2 &= mask
+	h3 += c
+	c = h3 >> 26
+	h3 &= mask
+	h4 += c
+	c = h4 >> 26
+	h4 &= mask
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= mask
+	h1 += c
+
+	// compute h - (2^130 - 5), and use it if it doesn't underflow
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= mask
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= mask
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= mask
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= mask
+	g4 := h4 + c - 1<<26
+
+	selectG := (g4 >> 31) - 1
+	selectH := ^selectG
+	h0 = h0&selectH | g0&selectG
+	h1 = h1&selectH | g1&selectG
+	h2 = h2&selectH | g2&selectG
+	h3 = h3&selectH | g3&selectG
+	h4 = h4&selectH | g4&selectG
+
+	// h mod 2^128, plus s
+	h0 = h0 | h1<<26
+	h1 = h1>>6 | h2<<20
+	h2 = h2>>12 | h3<<14
+	h3 = h3>>18 | h4<<8
+	f := uint64(h0) + uint64(p.s[0])
+	h0 = uint32(f)
+	f = uint64(h1) + uint64(p.s[1]) + f>>32
+	h1 = uint32(f)
+	f = uint64(h2) + uint64(p.s[2]) + f>>32
+	h2 = uint32(f)
+	f = uint64(h3) + uint64(p.s[3]) + f>>32
+	h3 = uint32(f)
+
+	var tag [poly1305TagLen]byte
+	binary.LittleEndian.PutUint32(tag[0:], h0)
+	binary.LittleEndian.PutUint32(tag[4:], h1)
+	binary.LittleEndian.PutUint32(tag[8:], h2)
+	binary.LittleEndian.PutUint32(tag[12:], h3)
+	return append(b, tag[:]...)
+}
+
+// block adds a 16 byte block to the accumulator, and multiplies it by r
+func (p *poly1305) block(m []byte, hibit uint32) {
+	const mask = 0x3ffffff
+	r0, r1, r2, r3, r4 := uint64(p.r[0]), uint64(p.r[1]), uint64(p.r[2]), uint64(p.r[3]), uint64(p.r[4])
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+
+	h0 := uint64(p.h[0] + binary.LittleEndian.Uint32(m[0:])&mask)
+	h1 := uint64(p.h[1] + (binary.LittleEndian.Uint32(m[3:])>>2)&mask)
+	h2 := uint64(p.h[2] + (binary.LittleEndian.Uint32(m[6:])>>4)&mask)
+	h3 := uint64(p.h[3] + (binary.LittleEndian.Uint32(m[9:])>>6)&mask)
+	h4 := uint64(p.h[4] + (binary.LittleEndian.Uint32(m[12:])>>8 | hibit))
+
+	d0 := h0*r0 + h1*s4 + h2*s3 + h3*s2 + h4*s1
+	d1 := h0*r1 + h1*r0 + h2*s4 + h3*s3 + h4*s2
+	d2 := h0*r2 + h1*r1 + h2*r0 + h3*s4 + h4*s3
+	d3 := h0*r3 + h1*r2 + h2*r1 + h3*r0 + h4*s4
+	d4 := h0*r4 + h1*r3 + h2*r2 + h3*r1 + h4*r0
+
+	c := d0 >> 26
+	p.h[0] = uint32(d0) & mask
+	d1 += c
+	c = d1 >> 26
+	p.h[1] = uint32(d1) & mask
+	d2 += c
+	c = d2 >> 26
+	p.h[2] = uint32(d2) & mask
+	d3 += c
+	c = d3 >> 26
+	p.h[3] = uint32(d3) & mask
+	d4 += c
+	c = d4 >> 26
+	p.h[4] = uint32(d4) & mask
+	p.h[0] += uint32(c) * 5
+	p.h[1] += p.h[0] >> 26
+	p.h[0] &= mask
+}
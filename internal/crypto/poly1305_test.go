@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Poly1305", func() {
+	// test vector from RFC 7539, section 2.5.2
+	var key [32]byte
+	msg := []byte("Cryptographic Forum Research Group")
+
+	BeforeEach(func() {
+		k, err := hex.DecodeString("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b")
+		Expect(err).ToNot(HaveOccurred())
+		copy(key[:], k)
+	})
+
+	It("computes the tag", func() {
+		p := newPoly1305(&key)
+		p.Write(msg)
+		Expect(hex.EncodeToString(p.Sum(nil))).To(Equal("a8061dc1305136c6c22b8baf0c0127a9"))
+	})
+
+	It("computes the tag when the message is written in pieces", func() {
+		p := newPoly1305(&key)
+		p.Write(msg[:3])
+		p.Write(msg[3:20])
+		p.Write(msg[20:])
+		Expect(hex.EncodeToString(p.Sum(nil))).To(Equal("a8061dc1305136c6c22b8baf0c0127a9"))
+	})
+})
@@ -0,0 +1,151 @@
+package handshake
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"runtime"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+)
+
+// hasAESHardwareSupport says if AES-GCM is implemented in hardware.
+// Without hardware support, ChaCha20-Poly1305 is faster, and not vulnerable to cache-timing attacks.
+// The Go standard library uses assembly implementations of AES-GCM on these architectures.
+var hasAESHardwareSupport = runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" || runtime.GOARCH == "s390x"
+
+// algorithmPreferences are the key exchange algorithms and AEADs, in order of preference
+type algorithmPreferences struct {
+	kexs  []Tag
+	aeads []Tag
+}
+
+// newAlgorithmPreferences derives the preferences from the tls.Config.
+// The key exchange algorithms are taken from the CurvePreferences, the AEADs from the CipherSuites.
+// Curves and cipher suites that can't be used with gQUIC are ignored.
+// If no preferences are set, Curve25519 is preferred over P-256,
+// and AES-GCM is preferred over ChaCha20-Poly1305 if the CPU supports AES.
+func newAlgorithmPreferences(tlsConf *tls.Config) algorithmPreferences {
+	var prefs algorithmPreferences
+	if tlsConf != nil {
+		for _, c := range tlsConf.CurvePreferences {
+			switch c {
+			case tls.X25519:
+				prefs.kexs = appendTagOnce(prefs.kexs, TagC255)
+			case tls.CurveP256:
+				prefs.kexs = appendTagOnce(prefs.kexs, TagP256)
+			}
+		}
+		for _, cs := range tlsConf.CipherSuites {
+			switch cs {
+			case uint16(mint.TLS_AES_128_GCM_SHA256),
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_RSA_WITH_AES_128_GCM_SHA256:
+				prefs.aeads = appendTagOnce(prefs.aeads, TagAESG)
+			case uint16(mint.TLS_CHACHA20_POLY1305_SHA256),
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:
+				prefs.aeads = appendTagOnce(prefs.aeads, TagCC20)
+			}
+		}
+	}
+	if len(prefs.kexs) == 0 {
+		prefs.kexs = []Tag{TagC255, TagP256}
+	}
+	if len(prefs.aeads) == 0 {
+		if hasAESHardwareSupport {
+			prefs.aeads = []Tag{TagAESG, TagCC20}
+		} else {
+			prefs.aeads = []Tag{TagCC20, TagAESG}
+		}
+	}
+	return prefs
+}
+
+func appendTagOnce(tags []Tag, tag Tag) []Tag {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
+
+// encodeTags encodes a list of tags, as used in the KEXS and AEAD tag
+func encodeTags(tags []Tag) []byte {
+	b := make([]byte, 4*len(tags))
+	for i, t := range tags {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(t))
+	}
+	return b
+}
+
+// decodeTags decodes a list of tags, as used in the KEXS and AEAD tag
+func decodeTags(data []byte) ([]Tag, error) {
+	if len(data)%4 != 0 {
+		return nil, errors.New("invalid tag list length")
+	}
+	tags := make([]Tag, len(data)/4)
+	for i := range tags {
+		tags[i] = Tag(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return tags, nil
+}
+
+// selectAlgorithm selects the first preferred algorithm that was offered by the peer
+func selectAlgorithm(preferred, offered []Tag) (Tag, bool) {
+	for _, p := range preferred {
+		for _, o := range offered {
+			if p == o {
+				return p, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func newKEX(kex Tag) (crypto.KeyExchange, error) {
+	switch kex {
+	case TagC255:
+		return crypto.NewCurve25519KEX()
+	case TagP256:
+		return crypto.NewP256KEX()
+	default:
+		return nil, errors.New("unsupported key exchange algorithm")
+	}
+}
+
+func quicCryptoAEAD(aead Tag) crypto.QuicCryptoAEAD {
+	if aead == TagCC20 {
+		return crypto.QuicCryptoChaCha20Poly1305
+	}
+	return crypto.QuicCryptoAESGCM
+}
+
+// cipherSuiteForAEAD returns the TLS 1.3 cipher suite that uses the same AEAD.
+// It returns 0 if no AEAD was negotiated yet.
+func cipherSuiteForAEAD(aead Tag) uint16 {
+	switch aead {
+	case TagAESG:
+		return uint16(mint.TLS_AES_128_GCM_SHA256)
+	case TagCC20:
+		return uint16(mint.TLS_CHACHA20_POLY1305_SHA256)
+	default:
+		return 0
+	}
+}
+
+// curveIDForKEX returns the TLS curve that corresponds to the key exchange algorithm.
+// It returns 0 if no key exchange algorithm was negotiated yet.
+func curveIDForKEX(kex Tag) tls.CurveID {
+	switch kex {
+	case TagC255:
+		return tls.X25519
+	case TagP256:
+		return tls.CurveP256
+	default:
+		return 0
+	}
+}
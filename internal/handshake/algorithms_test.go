@@ -0,0 +1,92 @@
+package handshake
+
+import (
+	"crypto/tls"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Algorithm Preferences", func() {
+	var origHasAESHardwareSupport bool
+
+	BeforeEach(func() {
+		origHasAESHardwareSupport = hasAESHardwareSupport
+	})
+
+	AfterEach(func() {
+		hasAESHardwareSupport = origHasAESHardwareSupport
+	})
+
+	It("prefers Curve25519 and AES-GCM, if the CPU supports AES", func() {
+		hasAESHardwareSupport = true
+		prefs := newAlgorithmPreferences(nil)
+		Expect(prefs.kexs).To(Equal([]Tag{TagC255, TagP256}))
+		Expect(prefs.aeads).To(Equal([]Tag{TagAESG, TagCC20}))
+	})
+
+	It("prefers ChaCha20-Poly1305, if the CPU doesn't support AES", func() {
+		hasAESHardwareSupport = false
+		prefs := newAlgorithmPreferences(&tls.Config{})
+		Expect(prefs.aeads).To(Equal([]Tag{TagCC20, TagAESG}))
+	})
+
+	It("uses the curve preferences", func() {
+		prefs := newAlgorithmPreferences(&tls.Config{
+			CurvePreferences: []tls.CurveID{tls.CurveP384, tls.CurveP256, tls.X25519},
+		})
+		Expect(prefs.kexs).To(Equal([]Tag{TagP256, TagC255}))
+	})
+
+	It("uses the cipher suites", func() {
+		hasAESHardwareSupport = false
+		prefs := newAlgorithmPreferences(&tls.Config{
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				uint16(mint.TLS_AES_128_GCM_SHA256),
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			},
+		})
+		Expect(prefs.aeads).To(Equal([]Tag{TagAESG, TagCC20}))
+	})
+
+	It("only allows AES-GCM, if no ChaCha20-Poly1305 cipher suite is configured", func() {
+		prefs := newAlgorithmPreferences(&tls.Config{
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		Expect(prefs.aeads).To(Equal([]Tag{TagAESG}))
+	})
+
+	It("encodes and decodes tags", func() {
+		data := encodeTags([]Tag{TagC255, TagP256})
+		Expect(data).To(Equal([]byte("C255P256")))
+		tags, err := decodeTags(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tags).To(Equal([]Tag{TagC255, TagP256}))
+		_, err = decodeTags([]byte("C255P"))
+		Expect(err).To(MatchError("invalid tag list length"))
+	})
+
+	It("selects an algorithm", func() {
+		tag, ok := selectAlgorithm([]Tag{TagCC20, TagAESG}, []Tag{TagAESG, TagCC20})
+		Expect(ok).To(BeTrue())
+		Expect(tag).To(Equal(TagCC20))
+		_, ok = selectAlgorithm([]Tag{TagCC20}, []Tag{TagAESG})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("maps the algorithms", func() {
+		Expect(quicCryptoAEAD(TagAESG)).To(Equal(crypto.QuicCryptoAESGCM))
+		Expect(quicCryptoAEAD(TagCC20)).To(Equal(crypto.QuicCryptoChaCha20Poly1305))
+		Expect(cipherSuiteForAEAD(TagAESG)).To(Equal(uint16(mint.TLS_AES_128_GCM_SHA256)))
+		Expect(cipherSuiteForAEAD(TagCC20)).To(Equal(uint16(mint.TLS_CHACHA20_POLY1305_SHA256)))
+		Expect(cipherSuiteForAEAD(0)).To(BeZero())
+		Expect(curveIDForKEX(TagC255)).To(Equal(tls.X25519))
+		Expect(curveIDForKEX(TagP256)).To(Equal(tls.CurveP256))
+		Expect(curveIDForKEX(0)).To(BeZero())
+	})
+})
@@ -0,0 +1,48 @@
+package handshake
+
+import (
+	"bytes"
+	"errors"
+)
+
+// encodeALPN encodes a list of application protocols for the ALPN tag.
+// The encoding is the same as the protocol name list of the TLS ALPN extension:
+// every protocol is prefixed by a 1 byte length.
+func encodeALPN(protos []string) ([]byte, error) {
+	b := &bytes.Buffer{}
+	for _, p := range protos {
+		if len(p) == 0 || len(p) > 255 {
+			return nil, errors.New("invalid ALPN protocol name length")
+		}
+		b.WriteByte(uint8(len(p)))
+		b.WriteString(p)
+	}
+	return b.Bytes(), nil
+}
+
+// decodeALPN decodes the value of the ALPN tag
+func decodeALPN(data []byte) ([]string, error) {
+	var protos []string
+	for len(data) > 0 {
+		l := int(data[0])
+		if l == 0 || len(data) < 1+l {
+			return nil, errors.New("invalid ALPN tag")
+		}
+		protos = append(protos, string(data[1:1+l]))
+		data = data[1+l:]
+	}
+	return protos, nil
+}
+
+// negotiateALPN selects the first protocol offered by the client that is supported by the server.
+// This is the same order of preference as used by mint.
+func negotiateALPN(offered, supported []string) (string, bool) {
+	for _, o := range offered {
+		for _, s := range supported {
+			if o == s {
+				return o, true
+			}
+		}
+	}
+	return "", false
+}
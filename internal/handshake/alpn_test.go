@@ -0,0 +1,41 @@
+package handshake
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ALPN", func() {
+	It("encodes and decodes protocols", func() {
+		data, err := encodeALPN([]string{"h2", "hq"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte{2, 'h', '2', 2, 'h', 'q'}))
+		protos, err := decodeALPN(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(protos).To(Equal([]string{"h2", "hq"}))
+	})
+
+	It("refuses to encode invalid protocol names", func() {
+		_, err := encodeALPN([]string{""})
+		Expect(err).To(MatchError("invalid ALPN protocol name length"))
+		_, err = encodeALPN([]string{strings.Repeat("a", 256)})
+		Expect(err).To(MatchError("invalid ALPN protocol name length"))
+	})
+
+	It("errors on invalid data", func() {
+		_, err := decodeALPN([]byte{3, 'h', '2'})
+		Expect(err).To(MatchError("invalid ALPN tag"))
+		_, err = decodeALPN([]byte{0})
+		Expect(err).To(MatchError("invalid ALPN tag"))
+	})
+
+	It("negotiates a protocol", func() {
+		proto, ok := negotiateALPN([]string{"foo", "h2", "hq"}, []string{"hq", "h2"})
+		Expect(ok).To(BeTrue())
+		Expect(proto).To(Equal("h2"))
+		_, ok = negotiateALPN([]string{"foo"}, []string{"hq", "h2"})
+		Expect(ok).To(BeFalse())
+	})
+})
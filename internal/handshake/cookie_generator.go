@@ -32,9 +32,10 @@ type CookieGenerator struct {
 	cookieProtector mint.CookieProtector
 }
 
-// NewCookieGenerator initializes a new CookieGenerator
-func NewCookieGenerator() (*CookieGenerator, error) {
-	cookieProtector, err := mint.NewDefaultCookieProtector()
+// NewCookieGenerator initializes a new CookieGenerator.
+// The keys are used to protect the cookies, see NewCookieProtector.
+func NewCookieGenerator(keys [][32]byte) (*CookieGenerator, error) {
+	cookieProtector, err := NewCookieProtector(keys)
 	if err != nil {
 		return nil, err
 	}
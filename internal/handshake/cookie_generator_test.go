@@ -14,7 +14,7 @@ var _ = Describe("Cookie Generator", func() {
 
 	BeforeEach(func() {
 		var err error
-		cookieGen, err = NewCookieGenerator()
+		cookieGen, err = NewCookieGenerator(nil)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -19,8 +19,8 @@ type CookieHandler struct {
 var _ mint.CookieHandler = &CookieHandler{}
 
 // NewCookieHandler creates a new CookieHandler.
-func NewCookieHandler(callback func(net.Addr, *Cookie) bool) (*CookieHandler, error) {
-	cookieGenerator, err := NewCookieGenerator()
+func NewCookieHandler(callback func(net.Addr, *Cookie) bool, keys [][32]byte) (*CookieHandler, error) {
+	cookieGenerator, err := NewCookieGenerator(keys)
 	if err != nil {
 		return nil, err
 	}
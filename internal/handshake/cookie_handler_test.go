@@ -37,7 +37,7 @@ var _ = Describe("Cookie Handler", func() {
 	BeforeEach(func() {
 		callbackReturn = false
 		var err error
-		ch, err = NewCookieHandler(mockCallback)
+		ch, err = NewCookieHandler(mockCallback, nil)
 		Expect(err).ToNot(HaveOccurred())
 		addr := &net.UDPAddr{IP: net.IPv4(42, 43, 44, 45), Port: 46}
 		conn = mint.NewConn(&mockConn{remoteAddr: addr}, &mint.Config{}, false)
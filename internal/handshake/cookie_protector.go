@@ -0,0 +1,90 @@
+package handshake
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bifurcation/mint"
+	"golang.org/x/crypto/hkdf"
+)
+
+const cookieNonceSize = 32
+
+// A cookieProtector encrypts cookies using the first key, and accepts cookies encrypted with any of the keys.
+// This allows rotating the keys, and sharing them between multiple servers.
+type cookieProtector struct {
+	keys [][32]byte
+}
+
+var _ mint.CookieProtector = &cookieProtector{}
+
+// NewCookieProtector creates a CookieProtector that uses the given keys.
+// New cookies are encrypted using the first key, and cookies encrypted with any of the keys are accepted.
+// If no keys are given, a random key is generated.
+func NewCookieProtector(keys [][32]byte) (mint.CookieProtector, error) {
+	if len(keys) == 0 {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		keys = [][32]byte{key}
+	}
+	return &cookieProtector{keys: keys}, nil
+}
+
+// NewToken encodes data into a new token.
+func (p *cookieProtector) NewToken(data []byte) ([]byte, error) {
+	nonce := make([]byte, cookieNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	aead, aeadNonce, err := p.createAEAD(p.keys[0], nonce)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, aead.Seal(nil, aeadNonce, data, nil)...), nil
+}
+
+// DecodeToken decodes a token.
+func (p *cookieProtector) DecodeToken(token []byte) ([]byte, error) {
+	if len(token) < cookieNonceSize {
+		return nil, fmt.Errorf("Token too short: %d", len(token))
+	}
+	nonce := token[:cookieNonceSize]
+	for _, key := range p.keys {
+		aead, aeadNonce, err := p.createAEAD(key, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if data, err := aead.Open(nil, aeadNonce, token[cookieNonceSize:], nil); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("failed to decrypt token")
+}
+
+func (p *cookieProtector) createAEAD(secret [32]byte, nonce []byte) (cipher.AEAD, []byte, error) {
+	h := hkdf.New(sha256.New, secret[:], nonce, []byte("quic-go cookie source"))
+	key := make([]byte, 32) // use a 32 byte key, in order to select AES-256
+	if _, err := io.ReadFull(h, key); err != nil {
+		return nil, nil, err
+	}
+	aeadNonce := make([]byte, 12)
+	if _, err := io.ReadFull(h, aeadNonce); err != nil {
+		return nil, nil, err
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, aeadNonce, nil
+}
@@ -0,0 +1,73 @@
+package handshake
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cookie Protector", func() {
+	var key1, key2 [32]byte
+
+	BeforeEach(func() {
+		copy(key1[:], "foo")
+		copy(key2[:], "bar")
+	})
+
+	It("encodes and decodes tokens", func() {
+		cp, err := NewCookieProtector(nil)
+		Expect(err).ToNot(HaveOccurred())
+		token, err := cp.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).ToNot(ContainSubstring("foobar"))
+		decoded, err := cp.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("foobar")))
+	})
+
+	It("uses a random key if no keys are given", func() {
+		cp1, err := NewCookieProtector(nil)
+		Expect(err).ToNot(HaveOccurred())
+		cp2, err := NewCookieProtector(nil)
+		Expect(err).ToNot(HaveOccurred())
+		token, err := cp1.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cp2.DecodeToken(token)
+		Expect(err).To(MatchError("failed to decrypt token"))
+	})
+
+	It("decodes tokens created by a different protector using the same key", func() {
+		cp1, err := NewCookieProtector([][32]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		cp2, err := NewCookieProtector([][32]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := cp1.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := cp2.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("foobar")))
+	})
+
+	It("accepts tokens encrypted with an older key", func() {
+		cpOld, err := NewCookieProtector([][32]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		cpNew, err := NewCookieProtector([][32]byte{key2, key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := cpOld.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := cpNew.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("foobar")))
+		// new tokens are encrypted with the first key
+		token, err = cpNew.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cpOld.DecodeToken(token)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects short tokens", func() {
+		cp, err := NewCookieProtector(nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cp.DecodeToken([]byte("foobar"))
+		Expect(err).To(MatchError("Token too short: 6"))
+	})
+})
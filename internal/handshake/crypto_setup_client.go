@@ -28,6 +28,7 @@ type cryptoSetupClient struct {
 
 	cryptoStream io.ReadWriter
 
+	cache        ServerStateCache
 	serverConfig *serverConfigClient
 
 	stk              []byte
@@ -36,6 +37,7 @@ type cryptoSetupClient struct {
 	proof            []byte
 	chloForSignature []byte
 	lastSentCHLO     []byte
+	certData         []byte // the certificate chain, as sent by the server
 	certManager      crypto.CertManager
 
 	divNonceChan         chan []byte
@@ -43,6 +45,11 @@ type cryptoSetupClient struct {
 
 	clientHelloCounter int
 	serverVerified     bool // has the certificate chain and the proof already been verified
+	receivedREJ        bool
+	didResume          bool
+	algorithms         algorithmPreferences
+	kex                Tag // the key exchange algorithm used for the forward-secure keys
+	aead               Tag // the AEAD used for the forward-secure keys
 	keyDerivation      QuicCryptoKeyDerivationFunction
 
 	receivedSecurePacket bool
@@ -54,6 +61,13 @@ type cryptoSetupClient struct {
 	handshakeEvent chan<- struct{}
 
 	params *TransportParameters
+
+	nextProtos         []string
+	negotiatedProtocol string
+
+	// needed to export keying material
+	forwardSecureSecret []byte
+	forwardSecureNonces []byte
 }
 
 var _ CryptoSetup = &cryptoSetupClient{}
@@ -71,6 +85,7 @@ func NewCryptoSetupClient(
 	connID protocol.ConnectionID,
 	version protocol.VersionNumber,
 	tlsConfig *tls.Config,
+	cache ServerStateCache,
 	params *TransportParameters,
 	paramsChan chan<- TransportParameters,
 	handshakeEvent chan<- struct{},
@@ -81,24 +96,37 @@ func NewCryptoSetupClient(
 	if err != nil {
 		return nil, err
 	}
+	var nextProtos []string
+	var keyDerivation QuicCryptoKeyDerivationFunction = crypto.DeriveQuicCryptoKeys
+	if tlsConfig != nil {
+		nextProtos = tlsConfig.NextProtos
+		if tlsConfig.KeyLogWriter != nil {
+			keyDerivation = crypto.DeriveQuicCryptoKeysWithKeyLog(tlsConfig.KeyLogWriter)
+		}
+	}
 	return &cryptoSetupClient{
 		cryptoStream:       cryptoStream,
 		hostname:           hostname,
 		connID:             connID,
 		version:            version,
 		certManager:        crypto.NewCertManager(tlsConfig),
+		cache:              cache,
 		params:             params,
-		keyDerivation:      crypto.DeriveQuicCryptoAESKeys,
+		algorithms:         newAlgorithmPreferences(tlsConfig),
+		keyDerivation:      keyDerivation,
 		nullAEAD:           nullAEAD,
 		paramsChan:         paramsChan,
 		handshakeEvent:     handshakeEvent,
 		initialVersion:     initialVersion,
 		negotiatedVersions: negotiatedVersions,
 		divNonceChan:       make(chan []byte),
+		nextProtos:         nextProtos,
 	}, nil
 }
 
 func (h *cryptoSetupClient) HandleCryptoStream() error {
+	h.restoreFromCache()
+
 	messageChan := make(chan HandshakeMessage)
 	errorChan := make(chan error, 1)
 
@@ -155,6 +183,7 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 			if err != nil {
 				return err
 			}
+			h.saveToCache()
 			// blocks until the session has received the parameters
 			h.paramsChan <- *params
 			h.handshakeEvent <- struct{}{}
@@ -167,6 +196,7 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 
 func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 	var err error
+	h.receivedREJ = true
 
 	if stk, ok := cryptoData[TagSTK]; ok {
 		h.stk = stk
@@ -178,7 +208,13 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 
 	// TODO: what happens if the server sends a different server config in two packets?
 	if scfg, ok := cryptoData[TagSCFG]; ok {
-		h.serverConfig, err = parseServerConfig(scfg)
+		// The server config we used (e.g. restored from the cache) was replaced by a new one.
+		// The client nonce depends on the OBIT, and the proof has to be verified for the new server config.
+		if h.serverConfig != nil && !bytes.Equal(h.serverConfig.Get(), scfg) {
+			h.nonc = nil
+			h.serverVerified = false
+		}
+		h.serverConfig, err = parseServerConfig(scfg, h.algorithms)
 		if err != nil {
 			return err
 		}
@@ -206,11 +242,12 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 		if err != nil {
 			return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 		}
+		h.certData = crt
 
 		err = h.certManager.Verify(h.hostname)
 		if err != nil {
 			utils.Infof("Certificate validation failed: %s", err.Error())
-			return qerr.ProofInvalid
+			return &qerr.CertificateVerificationError{Err: err}
 		}
 	}
 
@@ -262,6 +299,7 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) (*Trans
 	leafCert := h.certManager.GetLeafCert()
 
 	h.forwardSecureAEAD, err = h.keyDerivation(
+		quicCryptoAEAD(h.serverConfig.aead),
 		true,
 		ephermalSharedSecret,
 		nonce,
@@ -275,11 +313,28 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) (*Trans
 	if err != nil {
 		return nil, err
 	}
+	h.forwardSecureSecret = ephermalSharedSecret
+	h.kex = h.serverConfig.kexAlgorithm
+	h.aead = h.serverConfig.aead
+	h.forwardSecureNonces = nonce
 
 	params, err := readHelloMap(cryptoData)
 	if err != nil {
 		return nil, qerr.InvalidCryptoMessageParameter
 	}
+
+	if alpn, ok := cryptoData[TagALPN]; ok {
+		protos, err := decodeALPN(alpn)
+		if err != nil || len(protos) != 1 {
+			return nil, qerr.Error(qerr.InvalidCryptoMessageParameter, "invalid ALPN tag")
+		}
+		if _, ok := negotiateALPN(protos, h.nextProtos); !ok {
+			return nil, qerr.Error(qerr.InvalidCryptoMessageParameter, "server selected an application protocol that wasn't offered")
+		}
+		h.negotiatedProtocol = protos[0]
+	}
+	// The SHLO is received in response to the first CHLO, if the client used a cached server config.
+	h.didResume = !h.receivedREJ
 	return params, nil
 }
 
@@ -379,13 +434,30 @@ func (h *cryptoSetupClient) SetDiversificationNonce(data []byte) {
 	h.divNonceChan <- data
 }
 
+func (h *cryptoSetupClient) GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	panic("header protection not used for gQUIC")
+}
+
 func (h *cryptoSetupClient) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	return ConnectionState{
-		HandshakeComplete: h.forwardSecureAEAD != nil,
-		PeerCertificates:  h.certManager.GetChain(),
+		HandshakeComplete:  h.forwardSecureAEAD != nil,
+		PeerCertificates:   h.certManager.GetChain(),
+		NegotiatedProtocol: h.negotiatedProtocol,
+		CipherSuite:        cipherSuiteForAEAD(h.aead),
+		CurveID:            curveIDForKEX(h.kex),
+		DidResume:          h.didResume,
+	}
+}
+
+func (h *cryptoSetupClient) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.forwardSecureAEAD == nil {
+		return nil, errHandshakeNotComplete
 	}
+	return crypto.ExportQuicCryptoKeyingMaterial(h.forwardSecureSecret, h.forwardSecureNonces, h.connID, label, context, length)
 }
 
 func (h *cryptoSetupClient) sendCHLO() error {
@@ -432,6 +504,14 @@ func (h *cryptoSetupClient) getTags() (map[Tag][]byte, error) {
 	binary.BigEndian.PutUint32(versionTag, uint32(h.initialVersion))
 	tags[TagVER] = versionTag
 
+	if len(h.nextProtos) > 0 {
+		alpn, err := encodeALPN(h.nextProtos)
+		if err != nil {
+			return nil, err
+		}
+		tags[TagALPN] = alpn
+	}
+
 	if len(h.stk) > 0 {
 		tags[TagSTK] = h.stk
 	}
@@ -450,8 +530,8 @@ func (h *cryptoSetupClient) getTags() (map[Tag][]byte, error) {
 
 			tags[TagNONC] = h.nonc
 			tags[TagXLCT] = xlct
-			tags[TagKEXS] = []byte("C255")
-			tags[TagAEAD] = []byte("AESG")
+			tags[TagKEXS] = encodeTags([]Tag{h.serverConfig.kexAlgorithm})
+			tags[TagAEAD] = encodeTags([]Tag{h.serverConfig.aead})
 			tags[TagPUBS] = h.serverConfig.kex.PublicKey() // TODO: check if 3 bytes need to be prepended
 		}
 	}
@@ -490,6 +570,7 @@ func (h *cryptoSetupClient) maybeUpgradeCrypto() error {
 		}
 
 		h.secureAEAD, err = h.keyDerivation(
+			quicCryptoAEAD(h.serverConfig.aead),
 			false,
 			h.serverConfig.sharedSecret,
 			nonce,
@@ -530,3 +611,70 @@ func (h *cryptoSetupClient) generateClientNonce() error {
 	h.nonc = nonc
 	return nil
 }
+
+// restoreFromCache restores the server config, the STK and the certificate chain from the cache.
+// This allows sending a complete CHLO right away, and saves the REJ round trip.
+func (h *cryptoSetupClient) restoreFromCache() {
+	if h.cache == nil {
+		return
+	}
+	state, ok := h.cache.Get(h.hostname)
+	if !ok || state == nil {
+		return
+	}
+	if err := h.restoreState(state); err != nil {
+		utils.Debugf("Not using the cached server state for %s: %s", h.hostname, err.Error())
+		h.serverConfig = nil
+		h.stk = nil
+		h.certData = nil
+		h.proof = nil
+		h.chloForSignature = nil
+		h.nonc = nil
+		h.cache.Put(h.hostname, nil)
+	}
+}
+
+func (h *cryptoSetupClient) restoreState(state *CachedServerState) error {
+	scfg, err := parseServerConfig(state.ServerConfig, h.algorithms)
+	if err != nil {
+		return err
+	}
+	if scfg.IsExpired() {
+		return qerr.CryptoServerConfigExpired
+	}
+	// The cache might have been modified, so the certificate chain and the signature of the server config are verified again.
+	// This also makes sure that the certificate chain hasn't expired in the meantime.
+	if err := h.certManager.SetData(state.CertificateChain); err != nil {
+		return err
+	}
+	if err := h.certManager.Verify(h.hostname); err != nil {
+		return err
+	}
+	if !h.certManager.VerifyServerProof(state.ServerProof, state.SignedCHLO, scfg.Get()) {
+		return qerr.ProofInvalid
+	}
+	h.serverConfig = scfg
+	h.stk = state.SourceAddressToken
+	h.certData = state.CertificateChain
+	h.proof = state.ServerProof
+	h.chloForSignature = state.SignedCHLO
+	if err := h.generateClientNonce(); err != nil {
+		return err
+	}
+	h.serverVerified = true
+	return nil
+}
+
+// saveToCache saves the state of the server after a successful handshake
+func (h *cryptoSetupClient) saveToCache() {
+	if h.cache == nil || h.serverConfig == nil || len(h.certData) == 0 || len(h.proof) == 0 {
+		return
+	}
+	h.cache.Put(h.hostname, &CachedServerState{
+		ServerConfig:       h.serverConfig.Get(),
+		SourceAddressToken: h.stk,
+		CertificateChain:   h.certData,
+		ServerProof:        h.proof,
+		SignedCHLO:         h.chloForSignature,
+	})
+}
@@ -2,12 +2,14 @@ package handshake
 
 import (
 	"bytes"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/mocks/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -19,6 +21,7 @@ import (
 )
 
 type keyDerivationValues struct {
+	aead          crypto.QuicCryptoAEAD
 	forwardSecure bool
 	sharedSecret  []byte
 	nonces        []byte
@@ -82,6 +85,23 @@ func (m *mockCertManager) GetChain() []*x509.Certificate {
 	return m.chain
 }
 
+type mockServerStateCache map[string]*CachedServerState
+
+var _ ServerStateCache = mockServerStateCache{}
+
+func (c mockServerStateCache) Get(hostname string) (*CachedServerState, bool) {
+	state, ok := c[hostname]
+	return state, ok
+}
+
+func (c mockServerStateCache) Put(hostname string, state *CachedServerState) {
+	if state == nil {
+		delete(c, hostname)
+		return
+	}
+	c[hostname] = state
+}
+
 var _ = Describe("Client Crypto Setup", func() {
 	var (
 		cs                      *cryptoSetupClient
@@ -98,8 +118,9 @@ var _ = Describe("Client Crypto Setup", func() {
 			TagPUBS: {0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f},
 			TagVER:  {},
 		}
-		keyDerivation := func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+		keyDerivation := func(aead crypto.QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
 			keyDerivationCalledWith = &keyDerivationValues{
+				aead:          aead,
 				forwardSecure: forwardSecure,
 				sharedSecret:  sharedSecret,
 				nonces:        nonces,
@@ -125,6 +146,7 @@ var _ = Describe("Client Crypto Setup", func() {
 			0,
 			version,
 			nil,
+			nil,
 			&TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
 			paramsChan,
 			handshakeEvent,
@@ -257,11 +279,13 @@ var _ = Describe("Client Crypto Setup", func() {
 			})
 
 			Context("verifying the certificate chain", func() {
-				It("returns a ProofInvalid error if the certificate chain is not valid", func() {
+				It("returns a CertificateVerificationError if the certificate chain is not valid", func() {
 					tagMap[TagCERT] = []byte("cert")
-					certManager.verifyError = errors.New("invalid")
+					testErr := errors.New("invalid")
+					certManager.verifyError = testErr
 					err := cs.handleREJMessage(tagMap)
-					Expect(err).To(MatchError(qerr.ProofInvalid))
+					Expect(err).To(Equal(&qerr.CertificateVerificationError{Err: testErr}))
+					Expect(qerr.ToQuicError(err).ErrorCode).To(Equal(qerr.ProofInvalid))
 				})
 
 				It("verifies the certificate", func() {
@@ -337,7 +361,7 @@ var _ = Describe("Client Crypto Setup", func() {
 				HandshakeMessage{Tag: TagSCFG, Data: scfg}.Write(b)
 				tagMap[TagSCFG] = b.Bytes()
 				// make sure we actually set TagEXPY correct
-				serverConfig, err := parseServerConfig(b.Bytes())
+				serverConfig, err := parseServerConfig(b.Bytes(), cs.algorithms)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(serverConfig.expiry.Year()).To(Equal(2012))
 				// now try to read this server config in the crypto setup
@@ -371,7 +395,7 @@ var _ = Describe("Client Crypto Setup", func() {
 				b := &bytes.Buffer{}
 				HandshakeMessage{Tag: TagSHLO, Data: make(map[Tag][]byte)}.Write(b)
 				tagMap[TagSCFG] = b.Bytes()
-				_, origErr := parseServerConfig(b.Bytes())
+				_, origErr := parseServerConfig(b.Bytes(), cs.algorithms)
 				err := cs.handleREJMessage(tagMap)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(MatchError(origErr))
@@ -384,7 +408,9 @@ var _ = Describe("Client Crypto Setup", func() {
 			kex, err := crypto.NewCurve25519KEX()
 			Expect(err).ToNot(HaveOccurred())
 			serverConfig := &serverConfigClient{
-				kex: kex,
+				kexAlgorithm: TagC255,
+				aead:         TagAESG,
+				kex:          kex,
 			}
 			cs.serverConfig = serverConfig
 			cs.receivedSecurePacket = true
@@ -444,6 +470,41 @@ var _ = Describe("Client Crypto Setup", func() {
 			Expect(params.IdleTimeout).To(Equal(13 * time.Second))
 		})
 
+		It("reads the negotiated application protocol", func() {
+			cs.nextProtos = []string{"h2", "hq"}
+			shloMap[TagALPN] = []byte{2, 'h', 'q'}
+			_, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().NegotiatedProtocol).To(Equal("hq"))
+		})
+
+		It("rejects application protocols that weren't offered", func() {
+			cs.nextProtos = []string{"h2"}
+			shloMap[TagALPN] = []byte{2, 'h', 'q'}
+			_, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "server selected an application protocol that wasn't offered")))
+		})
+
+		It("rejects SHLOs that select more than one application protocol", func() {
+			cs.nextProtos = []string{"h2", "hq"}
+			shloMap[TagALPN] = []byte{2, 'h', '2', 2, 'h', 'q'}
+			_, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "invalid ALPN tag")))
+		})
+
+		It("reports 0-RTT, if the SHLO was received without a REJ", func() {
+			_, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().DidResume).To(BeTrue())
+		})
+
+		It("doesn't report 0-RTT, if the server sent a REJ", func() {
+			cs.receivedREJ = true
+			_, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().DidResume).To(BeFalse())
+		})
+
 		It("closes the handshakeEvent chan when receiving an SHLO", func() {
 			HandshakeMessage{Tag: TagSHLO, Data: shloMap}.Write(&stream.dataToRead)
 			done := make(chan struct{})
@@ -544,6 +605,19 @@ var _ = Describe("Client Crypto Setup", func() {
 			}
 		})
 
+		It("offers the application protocols", func() {
+			cs.nextProtos = []string{"h2", "hq"}
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).To(HaveKeyWithValue(TagALPN, []byte{2, 'h', '2', 2, 'h', 'q'}))
+		})
+
+		It("doesn't send an ALPN tag, if no application protocols are configured", func() {
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).ToNot(HaveKey(TagALPN))
+		})
+
 		It("doesn't send a CCS if there are no common certificate sets available", func() {
 			certManager.commonCertificateHashes = nil
 			tags, err := cs.getTags()
@@ -593,7 +667,7 @@ var _ = Describe("Client Crypto Setup", func() {
 			cs.nonc = []byte("client-nonce")
 			kex, err := crypto.NewCurve25519KEX()
 			Expect(err).ToNot(HaveOccurred())
-			cs.serverConfig = &serverConfigClient{kex: kex}
+			cs.serverConfig = &serverConfigClient{kexAlgorithm: TagC255, aead: TagAESG, kex: kex}
 			xlct := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8}
 			certManager.leafCertHash = binary.LittleEndian.Uint64(xlct)
 			tags, err := cs.getTags()
@@ -605,6 +679,19 @@ var _ = Describe("Client Crypto Setup", func() {
 			Expect(tags[TagAEAD]).To(Equal([]byte("AESG")))
 		})
 
+		It("sends the key exchange algorithm and the AEAD selected from the server config", func() {
+			certManager.leafCert = []byte("leafcert")
+			cs.nonc = []byte("client-nonce")
+			kex, err := crypto.NewP256KEX()
+			Expect(err).ToNot(HaveOccurred())
+			cs.serverConfig = &serverConfigClient{kexAlgorithm: TagP256, aead: TagCC20, kex: kex}
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags[TagPUBS]).To(Equal(kex.PublicKey()))
+			Expect(tags[TagKEXS]).To(Equal([]byte("P256")))
+			Expect(tags[TagAEAD]).To(Equal([]byte("CC20")))
+		})
+
 		It("doesn't send more than MaxClientHellos CHLOs", func() {
 			Expect(cs.clientHelloCounter).To(BeZero())
 			for i := 1; i <= protocol.MaxClientHellos; i++ {
@@ -636,6 +723,8 @@ var _ = Describe("Client Crypto Setup", func() {
 			kex, err := crypto.NewCurve25519KEX()
 			Expect(err).ToNot(HaveOccurred())
 			cs.serverConfig = &serverConfigClient{
+				kexAlgorithm: TagC255,
+				aead:         TagAESG,
 				kex:          kex,
 				obit:         []byte("obit"),
 				sharedSecret: []byte("sharedSecret"),
@@ -666,6 +755,15 @@ var _ = Describe("Client Crypto Setup", func() {
 			Expect(handshakeEvent).ToNot(BeClosed())
 		})
 
+		It("uses the AEAD selected from the server config", func() {
+			cs.serverVerified = true
+			cs.serverConfig.aead = TagCC20
+			err := cs.maybeUpgradeCrypto()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyDerivationCalledWith.aead).To(Equal(crypto.QuicCryptoChaCha20Poly1305))
+			Expect(handshakeEvent).To(Receive())
+		})
+
 		It("uses the server nonce, if the server sent one", func() {
 			cs.serverVerified = true
 			cs.sno = []byte("server nonce")
@@ -863,6 +961,25 @@ var _ = Describe("Client Crypto Setup", func() {
 				doSHLO()
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeTrue())
+				Expect(state.CipherSuite).To(Equal(uint16(mint.TLS_AES_128_GCM_SHA256)))
+				Expect(state.CurveID).To(Equal(tls.X25519))
+			})
+		})
+
+		Context("exporting keying material", func() {
+			It("errors before the handshake completes", func() {
+				_, err := cs.ExportKeyingMaterial("label", nil, 32)
+				Expect(err).To(MatchError(errHandshakeNotComplete))
+			})
+
+			It("exports keying material derived from the forward-secure secret", func() {
+				doSHLO()
+				out, err := cs.ExportKeyingMaterial("label", []byte("context"), 32)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.forwardSecureSecret).ToNot(BeEmpty())
+				expected, err := crypto.ExportQuicCryptoKeyingMaterial(cs.forwardSecureSecret, append(cs.nonc, cs.sno...), cs.connID, "label", []byte("context"), 32)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(out).To(Equal(expected))
 			})
 		})
 
@@ -913,6 +1030,159 @@ var _ = Describe("Client Crypto Setup", func() {
 		})
 	})
 
+	Context("caching the server state", func() {
+		var (
+			cache mockServerStateCache
+			scfg  []byte
+		)
+
+		BeforeEach(func() {
+			b := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagSCFG, Data: getDefaultServerConfigClient()}.Write(b)
+			scfg = b.Bytes()
+			cache = make(mockServerStateCache)
+			cs.cache = cache
+			certManager.verifyServerProofResult = true
+		})
+
+		It("restores the state from the cache", func() {
+			cache["hostname"] = &CachedServerState{
+				ServerConfig:       scfg,
+				SourceAddressToken: []byte("stk"),
+				CertificateChain:   []byte("cert"),
+				ServerProof:        []byte("proof"),
+				SignedCHLO:         []byte("chlo"),
+			}
+			cs.restoreFromCache()
+			Expect(cs.serverConfig).ToNot(BeNil())
+			Expect(cs.serverConfig.Get()).To(Equal(scfg))
+			Expect(cs.stk).To(Equal([]byte("stk")))
+			Expect(certManager.setDataCalledWith).To(Equal([]byte("cert")))
+			Expect(certManager.verifyCalled).To(BeTrue())
+			Expect(certManager.verifyServerProofCalled).To(BeTrue())
+			Expect(cs.proof).To(Equal([]byte("proof")))
+			Expect(cs.chloForSignature).To(Equal([]byte("chlo")))
+			Expect(cs.nonc).To(HaveLen(32))
+			Expect(cs.serverVerified).To(BeTrue())
+		})
+
+		It("doesn't use an expired server config", func() {
+			serverConfig := getDefaultServerConfigClient()
+			serverConfig[TagEXPY] = []byte{0x80, 0x54, 0x72, 0x4F, 0, 0, 0, 0} // 2012-03-28
+			b := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagSCFG, Data: serverConfig}.Write(b)
+			cache["hostname"] = &CachedServerState{ServerConfig: b.Bytes(), CertificateChain: []byte("cert")}
+			cs.restoreFromCache()
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cache).To(BeEmpty())
+		})
+
+		It("doesn't use the cached state if the certificate chain is invalid", func() {
+			certManager.verifyError = errors.New("expired")
+			cache["hostname"] = &CachedServerState{
+				ServerConfig:       scfg,
+				SourceAddressToken: []byte("stk"),
+				CertificateChain:   []byte("cert"),
+			}
+			cs.restoreFromCache()
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.stk).To(BeNil())
+			Expect(cs.nonc).To(BeEmpty())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cache).To(BeEmpty())
+		})
+
+		It("doesn't use the cached state if the signature of the server config is invalid", func() {
+			certManager.verifyServerProofResult = false
+			cache["hostname"] = &CachedServerState{
+				ServerConfig:       scfg,
+				SourceAddressToken: []byte("stk"),
+				CertificateChain:   []byte("cert"),
+				ServerProof:        []byte("forged proof"),
+				SignedCHLO:         []byte("chlo"),
+			}
+			cs.restoreFromCache()
+			Expect(certManager.verifyServerProofCalled).To(BeTrue())
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.stk).To(BeNil())
+			Expect(cs.proof).To(BeNil())
+			Expect(cs.nonc).To(BeEmpty())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cache).To(BeEmpty())
+		})
+
+		It("doesn't save the state if the server config wasn't signed", func() {
+			cs.serverConfig = &serverConfigClient{raw: scfg}
+			cs.certData = []byte("cert")
+			cs.saveToCache()
+			Expect(cache).To(BeEmpty())
+		})
+
+		It("saves the state when the handshake completes", func() {
+			kex, err := crypto.NewCurve25519KEX()
+			Expect(err).ToNot(HaveOccurred())
+			cs.serverConfig = &serverConfigClient{raw: scfg, kexAlgorithm: TagC255, aead: TagAESG, kex: kex}
+			cs.stk = []byte("stk")
+			cs.certData = []byte("cert")
+			cs.proof = []byte("proof")
+			cs.chloForSignature = []byte("chlo")
+			cs.receivedSecurePacket = true
+			HandshakeMessage{Tag: TagSHLO, Data: shloMap}.Write(&stream.dataToRead)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, errMockStreamClosing.Error())))
+				close(done)
+			}()
+			Eventually(handshakeEvent).Should(BeClosed())
+			Expect(cache).To(HaveKeyWithValue("hostname", &CachedServerState{
+				ServerConfig:       scfg,
+				SourceAddressToken: []byte("stk"),
+				CertificateChain:   []byte("cert"),
+				ServerProof:        []byte("proof"),
+				SignedCHLO:         []byte("chlo"),
+			}))
+			// make the go routine return
+			stream.close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("saves the certificate chain sent by the server", func() {
+			err := cs.handleREJMessage(map[Tag][]byte{TagCERT: []byte("cert")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.certData).To(Equal([]byte("cert")))
+		})
+
+		It("generates a new client nonce when the server sends a different server config", func() {
+			cache["hostname"] = &CachedServerState{ServerConfig: scfg, CertificateChain: []byte("cert")}
+			cs.restoreFromCache()
+			nonc := cs.nonc
+			Expect(cs.serverVerified).To(BeTrue())
+			serverConfig := getDefaultServerConfigClient()
+			serverConfig[TagOBIT] = []byte{0xde, 0xca, 0xfb, 0xad, 0xde, 0xca, 0xfb, 0xad}
+			b := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagSCFG, Data: serverConfig}.Write(b)
+			err := cs.handleREJMessage(map[Tag][]byte{TagSCFG: b.Bytes()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.nonc).ToNot(Equal(nonc))
+			Expect(cs.nonc[4:12]).To(Equal(serverConfig[TagOBIT]))
+			Expect(cs.serverVerified).To(BeFalse())
+		})
+
+		It("keeps the client nonce when the server sends the same server config", func() {
+			cache["hostname"] = &CachedServerState{ServerConfig: scfg, CertificateChain: []byte("cert")}
+			cs.restoreFromCache()
+			nonc := cs.nonc
+			err := cs.handleREJMessage(map[Tag][]byte{TagSCFG: scfg, TagSTK: []byte("new stk")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.nonc).To(Equal(nonc))
+			Expect(cs.stk).To(Equal([]byte("new stk")))
+			Expect(cs.serverVerified).To(BeTrue())
+		})
+	})
+
 	Context("Diversification Nonces", func() {
 		It("sets a diversification nonce", func() {
 			done := make(chan struct{})
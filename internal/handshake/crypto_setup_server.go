@@ -3,6 +3,7 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -16,10 +17,10 @@ import (
 )
 
 // QuicCryptoKeyDerivationFunction is used for key derivation
-type QuicCryptoKeyDerivationFunction func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error)
+type QuicCryptoKeyDerivationFunction func(aead crypto.QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error)
 
-// KeyExchangeFunction is used to make a new KEX
-type KeyExchangeFunction func() (crypto.KeyExchange, error)
+// KeyExchangeFunction is used to make a new KEX for the key exchange algorithm
+type KeyExchangeFunction func(Tag) (crypto.KeyExchange, error)
 
 // The CryptoSetupServer handles all things crypto for the Session
 type cryptoSetupServer struct {
@@ -27,7 +28,8 @@ type cryptoSetupServer struct {
 
 	connID               protocol.ConnectionID
 	remoteAddr           net.Addr
-	scfg                 *ServerConfig
+	serverConfigs        *ServerConfigManager
+	scfg                 *ServerConfig // the server config used for the current CHLO
 	diversificationNonce []byte
 
 	version           protocol.VersionNumber
@@ -53,7 +55,18 @@ type cryptoSetupServer struct {
 
 	params *TransportParameters
 
-	sni string // need to fill out the ConnectionState
+	nextProtos         []string
+	negotiatedProtocol string
+
+	sni       string // need to fill out the ConnectionState
+	sentREJ   bool
+	didResume bool
+	kex       Tag // the key exchange algorithm selected by the client
+	aead      Tag // the AEAD selected by the client
+
+	// needed to export keying material
+	forwardSecureSecret []byte
+	forwardSecureNonces []byte
 }
 
 var _ CryptoSetup = &cryptoSetupServer{}
@@ -73,8 +86,9 @@ func NewCryptoSetup(
 	connID protocol.ConnectionID,
 	remoteAddr net.Addr,
 	version protocol.VersionNumber,
-	scfg *ServerConfig,
+	serverConfigs *ServerConfigManager,
 	params *TransportParameters,
+	tlsConf *tls.Config,
 	supportedVersions []protocol.VersionNumber,
 	acceptSTK func(net.Addr, *Cookie) bool,
 	paramsChan chan<- TransportParameters,
@@ -84,14 +98,24 @@ func NewCryptoSetup(
 	if err != nil {
 		return nil, err
 	}
+	var nextProtos []string
+	var keyDerivation QuicCryptoKeyDerivationFunction = crypto.DeriveQuicCryptoKeys
+	if tlsConf != nil {
+		nextProtos = tlsConf.NextProtos
+		if tlsConf.KeyLogWriter != nil {
+			keyDerivation = crypto.DeriveQuicCryptoKeysWithKeyLog(tlsConf.KeyLogWriter)
+		}
+	}
 	return &cryptoSetupServer{
 		cryptoStream:      cryptoStream,
 		connID:            connID,
 		remoteAddr:        remoteAddr,
 		version:           version,
 		supportedVersions: supportedVersions,
-		scfg:              scfg,
-		keyDerivation:     crypto.DeriveQuicCryptoAESKeys,
+		nextProtos:        nextProtos,
+		serverConfigs:     serverConfigs,
+		scfg:              serverConfigs.Current(),
+		keyDerivation:     keyDerivation,
 		keyExchange:       getEphermalKEX,
 		nullAEAD:          nullAEAD,
 		params:            params,
@@ -161,7 +185,16 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 	var reply []byte
 	var err error
 
-	certUncompressed, err := h.scfg.certChain.GetLeafCert(sni)
+	// use the server config requested by the client, as long as it hasn't expired
+	if scfg := h.serverConfigs.Get(cryptoData[TagSCID]); scfg != nil {
+		h.scfg = scfg
+	} else {
+		h.scfg = h.serverConfigs.Current()
+	}
+
+	// Select the certificate only once per CHLO.
+	// The certificate might be replaced at any time, and we must send the same certificate that was used for the proof.
+	cert, err := h.scfg.certChain.GetCertificate(sni)
 	if err != nil {
 		return false, err
 	}
@@ -176,9 +209,9 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 		h.paramsChan <- *params
 	}
 
-	if !h.isInchoateCHLO(cryptoData, certUncompressed) {
+	if !h.isInchoateCHLO(cryptoData, cert.GetLeafCert()) {
 		// We have a CHLO with a proper server config ID, do a 0-RTT handshake
-		reply, err = h.handleCHLO(sni, chloData, cryptoData)
+		reply, err = h.handleCHLO(cert, chloData, cryptoData)
 		if err != nil {
 			return false, err
 		}
@@ -191,10 +224,12 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 	}
 
 	// We have an inchoate or non-matching CHLO, we now send a rejection
-	reply, err = h.handleInchoateCHLO(sni, chloData, cryptoData)
+	h.scfg = h.serverConfigs.Current()
+	reply, err = h.handleInchoateCHLO(cert, chloData, cryptoData)
 	if err != nil {
 		return false, err
 	}
+	h.sentREJ = true
 	_, err = h.cryptoStream.Write(reply)
 	return false, err
 }
@@ -303,7 +338,7 @@ func (h *cryptoSetupServer) acceptSTK(token []byte) bool {
 	return h.acceptSTKCallback(h.remoteAddr, stk)
 }
 
-func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoData map[Tag][]byte) ([]byte, error) {
+func (h *cryptoSetupServer) handleInchoateCHLO(cert crypto.Certificate, chlo []byte, cryptoData map[Tag][]byte) ([]byte, error) {
 	token, err := h.scfg.cookieGenerator.NewToken(h.remoteAddr)
 	if err != nil {
 		return nil, err
@@ -316,7 +351,7 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 	}
 
 	if h.acceptSTK(cryptoData[TagSTK]) {
-		proof, err := h.scfg.Sign(sni, chlo)
+		proof, err := h.scfg.Sign(cert, chlo)
 		if err != nil {
 			return nil, err
 		}
@@ -324,7 +359,7 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 		commonSetHashes := cryptoData[TagCCS]
 		cachedCertsHashes := cryptoData[TagCCRT]
 
-		certCompressed, err := h.scfg.GetCertsCompressed(sni, commonSetHashes, cachedCertsHashes)
+		certCompressed, err := cert.GetCertsCompressed(commonSetHashes, cachedCertsHashes)
 		if err != nil {
 			return nil, err
 		}
@@ -344,9 +379,21 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 	return serverReply.Bytes(), nil
 }
 
-func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[Tag][]byte) ([]byte, error) {
+func (h *cryptoSetupServer) handleCHLO(cert crypto.Certificate, data []byte, cryptoData map[Tag][]byte) ([]byte, error) {
 	// We have a CHLO matching our server config, we can continue with the 0-RTT handshake
-	sharedSecret, err := h.scfg.kex.CalculateSharedKey(cryptoData[TagPUBS])
+	// The client selects exactly one of the key exchange algorithms and AEADs offered in the server config.
+	kexTags, err := decodeTags(cryptoData[TagKEXS])
+	if err != nil || len(kexTags) != 1 || h.scfg.getKEX(kexTags[0]) == nil {
+		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
+	}
+	aeadTags, err := decodeTags(cryptoData[TagAEAD])
+	if err != nil || len(aeadTags) != 1 || !h.scfg.supportsAEAD(aeadTags[0]) {
+		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
+	}
+	kexTag := kexTags[0]
+	aeadType := quicCryptoAEAD(aeadTags[0])
+
+	sharedSecret, err := h.scfg.getKEX(kexTag).CalculateSharedKey(cryptoData[TagPUBS])
 	if err != nil {
 		return nil, err
 	}
@@ -354,10 +401,7 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	certUncompressed, err := h.scfg.certChain.GetLeafCert(sni)
-	if err != nil {
-		return nil, err
-	}
+	certUncompressed := cert.GetLeafCert()
 
 	serverNonce := make([]byte, 32)
 	if _, err = rand.Read(serverNonce); err != nil {
@@ -375,17 +419,8 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 		return nil, err
 	}
 
-	aead := cryptoData[TagAEAD]
-	if !bytes.Equal(aead, []byte("AESG")) {
-		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
-	}
-
-	kexs := cryptoData[TagKEXS]
-	if !bytes.Equal(kexs, []byte("C255")) {
-		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
-	}
-
 	h.secureAEAD, err = h.keyDerivation(
+		aeadType,
 		false,
 		sharedSecret,
 		clientNonce,
@@ -405,7 +440,7 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	var fsNonce bytes.Buffer
 	fsNonce.Write(clientNonce)
 	fsNonce.Write(serverNonce)
-	ephermalKex, err := h.keyExchange()
+	ephermalKex, err := h.keyExchange(kexTag)
 	if err != nil {
 		return nil, err
 	}
@@ -415,6 +450,7 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	}
 
 	h.forwardSecureAEAD, err = h.keyDerivation(
+		aeadType,
 		true,
 		ephermalSharedSecret,
 		fsNonce.Bytes(),
@@ -428,6 +464,10 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	if err != nil {
 		return nil, err
 	}
+	h.forwardSecureSecret = ephermalSharedSecret
+	h.forwardSecureNonces = fsNonce.Bytes()
+	h.kex = kexTag
+	h.aead = aeadTags[0]
 
 	replyMap := h.params.getHelloMap()
 	// add crypto parameters
@@ -438,6 +478,18 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	replyMap[TagPUBS] = ephermalKex.PublicKey()
 	replyMap[TagSNO] = serverNonce
 	replyMap[TagVER] = verTag.Bytes()
+	if alpn, ok := cryptoData[TagALPN]; ok {
+		offered, err := decodeALPN(alpn)
+		if err != nil {
+			return nil, qerr.Error(qerr.InvalidCryptoMessageParameter, err.Error())
+		}
+		if proto, ok := negotiateALPN(offered, h.nextProtos); ok {
+			replyMap[TagALPN], _ = encodeALPN([]string{proto})
+			h.negotiatedProtocol = proto
+		}
+	}
+	// If the server didn't send a REJ, the client used a cached server config for a 0-RTT handshake.
+	h.didResume = !h.sentREJ
 
 	// note that the SHLO *has* to fit into one packet
 	message := HandshakeMessage{
@@ -459,13 +511,30 @@ func (h *cryptoSetupServer) SetDiversificationNonce(data []byte) {
 	panic("not needed for cryptoSetupServer")
 }
 
+func (h *cryptoSetupServer) GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	panic("header protection not used for gQUIC")
+}
+
 func (h *cryptoSetupServer) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	return ConnectionState{
-		ServerName:        h.sni,
-		HandshakeComplete: h.receivedForwardSecurePacket,
+		ServerName:         h.sni,
+		HandshakeComplete:  h.receivedForwardSecurePacket,
+		NegotiatedProtocol: h.negotiatedProtocol,
+		CipherSuite:        cipherSuiteForAEAD(h.aead),
+		CurveID:            curveIDForKEX(h.kex),
+		DidResume:          h.didResume,
+	}
+}
+
+func (h *cryptoSetupServer) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.forwardSecureAEAD == nil {
+		return nil, errHandshakeNotComplete
 	}
+	return crypto.ExportQuicCryptoKeyingMaterial(h.forwardSecureSecret, h.forwardSecureNonces, h.connID, label, context, length)
 }
 
 func (h *cryptoSetupServer) validateClientNonce(nonce []byte) error {
@@ -2,6 +2,7 @@ package handshake
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -43,23 +44,28 @@ func (m *mockKEX) CalculateSharedKey(otherPublic []byte) ([]byte, error) {
 }
 
 type mockSigner struct {
-	gotCHLO bool
+	gotCHLO      bool
+	requestedSNI []string
 }
 
-func (s *mockSigner) SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error) {
+func (s *mockSigner) GetCertificate(sni string) (crypto.Certificate, error) {
+	s.requestedSNI = append(s.requestedSNI, sni)
+	return s, nil
+}
+func (s *mockSigner) SignServerProof(chlo []byte, serverConfigData []byte) ([]byte, error) {
 	if len(chlo) > 0 {
 		s.gotCHLO = true
 	}
 	return []byte("proof"), nil
 }
-func (*mockSigner) GetCertsCompressed(sni string, common, cached []byte) ([]byte, error) {
+func (*mockSigner) GetCertsCompressed(common, cached []byte) ([]byte, error) {
 	return []byte("certcompressed"), nil
 }
-func (*mockSigner) GetLeafCert(sni string) ([]byte, error) {
-	return []byte("certuncompressed"), nil
+func (*mockSigner) GetLeafCert() []byte {
+	return []byte("certuncompressed")
 }
 
-func mockQuicCryptoKeyDerivation(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+func mockQuicCryptoKeyDerivation(_ crypto.QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
 	return mockcrypto.NewMockAEAD(mockCtrl), nil
 }
 
@@ -164,8 +170,9 @@ var _ = Describe("Server Crypto Setup", func() {
 			protocol.ConnectionID(42),
 			remoteAddr,
 			version,
-			scfg,
+			&ServerConfigManager{configs: []*ServerConfig{scfg}, now: time.Now},
 			&TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
+			&tls.Config{NextProtos: []string{"hq", "h2"}},
 			supportedVersions,
 			nil,
 			paramsChan,
@@ -179,11 +186,32 @@ var _ = Describe("Server Crypto Setup", func() {
 		sourceAddrValid = true
 		cs.acceptSTKCallback = func(_ net.Addr, _ *Cookie) bool { return sourceAddrValid }
 		cs.keyDerivation = mockQuicCryptoKeyDerivation
-		cs.keyExchange = func() (crypto.KeyExchange, error) { return &mockKEX{ephermal: true}, nil }
+		cs.keyExchange = func(Tag) (crypto.KeyExchange, error) { return &mockKEX{ephermal: true}, nil }
 		cs.nullAEAD = mockcrypto.NewMockAEAD(mockCtrl)
 		cs.cryptoStream = stream
 	})
 
+	It("logs the keys, if the tls.Config has a KeyLogWriter", func() {
+		keyLog := &bytes.Buffer{}
+		csInt, err := NewCryptoSetup(
+			stream,
+			protocol.ConnectionID(42),
+			nil,
+			version,
+			&ServerConfigManager{configs: []*ServerConfig{scfg}, now: time.Now},
+			&TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
+			&tls.Config{KeyLogWriter: keyLog},
+			supportedVersions,
+			nil,
+			paramsChan,
+			handshakeEvent,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = csInt.(*cryptoSetupServer).keyDerivation(crypto.QuicCryptoAESGCM, true, []byte("secret"), []byte("nonce"), 42, nil, nil, nil, nil, protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keyLog.String()).To(ContainSubstring("GQUIC_CLIENT_FORWARD_SECURE_KEY 000000000000002a "))
+	})
+
 	Context("diversification nonce", func() {
 		BeforeEach(func() {
 			cs.secureAEAD = mockcrypto.NewMockAEAD(mockCtrl)
@@ -191,7 +219,8 @@ var _ = Describe("Server Crypto Setup", func() {
 
 			Expect(cs.DiversificationNonce()).To(BeEmpty())
 			// Div nonce is created after CHLO
-			cs.handleCHLO("", nil, map[Tag][]byte{TagNONC: nonce32})
+			_, err := cs.handleCHLO(signer, nil, map[Tag][]byte{TagNONC: nonce32, TagAEAD: aead, TagKEXS: kexs})
+			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("returns diversification nonces", func() {
@@ -206,9 +235,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		BeforeEach(func() {
 			xlct = make([]byte, 8)
-			var err error
-			cert, err = cs.scfg.certChain.GetLeafCert("")
-			Expect(err).ToNot(HaveOccurred())
+			cert = signer.GetLeafCert()
 			binary.LittleEndian.PutUint64(xlct, crypto.HashCert(cert))
 			fullCHLO = map[Tag][]byte{
 				TagSCID: scfg.ID,
@@ -257,7 +284,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		It("generates REJ messages", func() {
 			sourceAddrValid = false
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), nil)
+			response, err := cs.handleInchoateCHLO(signer, bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response).To(HavePrefix("REJ"))
 			Expect(response).To(ContainSubstring("initial public"))
@@ -268,7 +295,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		It("REJ messages don't include cert or proof without STK", func() {
 			sourceAddrValid = false
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), nil)
+			response, err := cs.handleInchoateCHLO(signer, bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response).To(HavePrefix("REJ"))
 			Expect(response).ToNot(ContainSubstring("certcompressed"))
@@ -278,7 +305,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		It("REJ messages include cert and proof with valid STK", func() {
 			sourceAddrValid = true
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), map[Tag][]byte{
+			response, err := cs.handleInchoateCHLO(signer, bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), map[Tag][]byte{
 				TagSTK: validSTK,
 				TagSNI: []byte("foo"),
 			})
@@ -291,7 +318,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		It("generates SHLO messages", func() {
 			var checkedSecure, checkedForwardSecure bool
-			cs.keyDerivation = func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+			cs.keyDerivation = func(aead crypto.QuicCryptoAEAD, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
 				if forwardSecure {
 					Expect(nonces).To(HaveLen(expectedFSNonceLen))
 					checkedForwardSecure = true
@@ -304,7 +331,7 @@ var _ = Describe("Server Crypto Setup", func() {
 				return mockcrypto.NewMockAEAD(mockCtrl), nil
 			}
 
-			response, err := cs.handleCHLO("", []byte("chlo-data"), map[Tag][]byte{
+			response, err := cs.handleCHLO(signer, []byte("chlo-data"), map[Tag][]byte{
 				TagPUBS: []byte("pubs-c"),
 				TagNONC: nonce32,
 				TagAEAD: aead,
@@ -327,6 +354,53 @@ var _ = Describe("Server Crypto Setup", func() {
 			Expect(checkedForwardSecure).To(BeTrue())
 		})
 
+		It("uses the key exchange algorithm and the AEAD selected by the client", func() {
+			cs.scfg.kexs = append(cs.scfg.kexs, serverConfigKEX{tag: TagP256, kex: &mockKEX{}})
+			cs.scfg.aeads = []Tag{TagAESG, TagCC20}
+			var usedAEADs []crypto.QuicCryptoAEAD
+			cs.keyDerivation = func(aead crypto.QuicCryptoAEAD, _ bool, _, _ []byte, _ protocol.ConnectionID, _, _, _, _ []byte, _ protocol.Perspective) (crypto.AEAD, error) {
+				usedAEADs = append(usedAEADs, aead)
+				return mockcrypto.NewMockAEAD(mockCtrl), nil
+			}
+			var ephermalKEXTag Tag
+			cs.keyExchange = func(tag Tag) (crypto.KeyExchange, error) {
+				ephermalKEXTag = tag
+				return &mockKEX{ephermal: true}, nil
+			}
+			_, err := cs.handleCHLO(signer, []byte("chlo-data"), map[Tag][]byte{
+				TagPUBS: []byte("pubs-c"),
+				TagNONC: nonce32,
+				TagAEAD: []byte("CC20"),
+				TagKEXS: []byte("P256"),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usedAEADs).To(Equal([]crypto.QuicCryptoAEAD{crypto.QuicCryptoChaCha20Poly1305, crypto.QuicCryptoChaCha20Poly1305}))
+			Expect(ephermalKEXTag).To(Equal(TagP256))
+			state := cs.ConnectionState()
+			Expect(state.CipherSuite).To(Equal(uint16(mint.TLS_CHACHA20_POLY1305_SHA256)))
+			Expect(state.CurveID).To(Equal(tls.CurveP256))
+		})
+
+		It("rejects a key exchange algorithm that is not offered in the server config", func() {
+			_, err := cs.handleCHLO(signer, []byte("chlo-data"), map[Tag][]byte{
+				TagPUBS: []byte("pubs-c"),
+				TagNONC: nonce32,
+				TagAEAD: aead,
+				TagKEXS: []byte("P256"),
+			})
+			Expect(err).To(MatchError(qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")))
+		})
+
+		It("rejects CHLOs that select multiple AEADs", func() {
+			_, err := cs.handleCHLO(signer, []byte("chlo-data"), map[Tag][]byte{
+				TagPUBS: []byte("pubs-c"),
+				TagNONC: nonce32,
+				TagAEAD: []byte("AESGAESG"),
+				TagKEXS: kexs,
+			})
+			Expect(err).To(MatchError(qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")))
+		})
+
 		It("handles long handshake", func() {
 			HandshakeMessage{
 				Tag: TagCHLO,
@@ -345,6 +419,7 @@ var _ = Describe("Server Crypto Setup", func() {
 			Expect(stream.dataWritten.Bytes()).To(ContainSubstring("SHLO"))
 			Expect(handshakeEvent).To(Receive()) // for the switch to forward secure
 			Expect(handshakeEvent).ToNot(BeClosed())
+			Expect(cs.ConnectionState().DidResume).To(BeFalse())
 		})
 
 		It("rejects client nonces that have the wrong length", func() {
@@ -378,6 +453,85 @@ var _ = Describe("Server Crypto Setup", func() {
 			Expect(handshakeEvent).To(Receive()) // for the switch to secure
 			Expect(handshakeEvent).To(Receive()) // for the switch to forward secure
 			Expect(handshakeEvent).ToNot(BeClosed())
+			Expect(cs.ConnectionState().DidResume).To(BeTrue())
+		})
+
+		It("selects the certificate only once per CHLO", func() {
+			done, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(done).To(BeTrue())
+			Expect(signer.requestedSNI).To(Equal([]string{"quic.clemente.io"}))
+		})
+
+		Context("negotiating the application protocol", func() {
+			readSHLO := func() HandshakeMessage {
+				msg, err := ParseHandshakeMessage(&stream.dataWritten)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(msg.Tag).To(Equal(TagSHLO))
+				return msg
+			}
+
+			It("selects the first protocol offered by the client that the server supports", func() {
+				fullCHLO[TagALPN] = []byte{3, 'f', 'o', 'o', 2, 'h', '2', 2, 'h', 'q'}
+				_, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(readSHLO().Data).To(HaveKeyWithValue(TagALPN, []byte{2, 'h', '2'}))
+				Expect(cs.ConnectionState().NegotiatedProtocol).To(Equal("h2"))
+			})
+
+			It("doesn't select a protocol, if there's no overlap", func() {
+				fullCHLO[TagALPN] = []byte{3, 'f', 'o', 'o'}
+				_, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(readSHLO().Data).ToNot(HaveKey(TagALPN))
+				Expect(cs.ConnectionState().NegotiatedProtocol).To(BeEmpty())
+			})
+
+			It("errors on invalid ALPN tags", func() {
+				fullCHLO[TagALPN] = []byte{5, 'h', 'q'}
+				_, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+				Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "invalid ALPN tag")))
+			})
+		})
+
+		Context("rotating server configs", func() {
+			var newScfg *ServerConfig
+
+			BeforeEach(func() {
+				var err error
+				newScfg, err = NewServerConfig(&mockKEX{}, signer)
+				Expect(err).ToNot(HaveOccurred())
+				newScfg.notBefore = time.Now().Add(-time.Second)
+				newScfg.cookieGenerator = scfg.cookieGenerator
+				cs.serverConfigs.configs = append(cs.serverConfigs.configs, newScfg)
+			})
+
+			It("accepts CHLOs for an older server config that hasn't expired yet", func() {
+				HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+				err := cs.HandleCryptoStream()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stream.dataWritten.Bytes()).To(HavePrefix("SHLO"))
+				Expect(cs.scfg).To(Equal(scfg))
+			})
+
+			It("sends the current server config in a REJ", func() {
+				delete(fullCHLO, TagPUBS)
+				done, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(done).To(BeFalse())
+				Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
+				Expect(stream.dataWritten.Bytes()).To(ContainSubstring(string(newScfg.ID)))
+				Expect(cs.scfg).To(Equal(newScfg))
+			})
+
+			It("rejects CHLOs for expired server configs", func() {
+				scfg.expiry = time.Now().Add(-time.Second)
+				done, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.MinClientHelloSize), fullCHLO)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(done).To(BeFalse())
+				Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
+				Expect(stream.dataWritten.Bytes()).To(ContainSubstring(string(newScfg.ID)))
+			})
 		})
 
 		It("recognizes inchoate CHLOs missing SCID", func() {
@@ -526,7 +680,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 	Context("escalating crypto", func() {
 		doCHLO := func() {
-			_, err := cs.handleCHLO("", []byte("chlo-data"), map[Tag][]byte{
+			_, err := cs.handleCHLO(signer, []byte("chlo-data"), map[Tag][]byte{
 				TagPUBS: []byte("pubs-c"),
 				TagNONC: nonce32,
 				TagAEAD: aead,
@@ -665,6 +819,7 @@ var _ = Describe("Server Crypto Setup", func() {
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeFalse())
 				Expect(state.ServerName).To(Equal("server name"))
+				Expect(state.CipherSuite).To(BeZero())
 			})
 
 			It("reports after the handshake completes", func() {
@@ -675,6 +830,26 @@ var _ = Describe("Server Crypto Setup", func() {
 				Expect(err).ToNot(HaveOccurred())
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeTrue())
+				Expect(state.CipherSuite).To(Equal(uint16(mint.TLS_AES_128_GCM_SHA256)))
+				Expect(state.CurveID).To(Equal(tls.X25519))
+			})
+		})
+
+		Context("exporting keying material", func() {
+			It("errors before the handshake completes", func() {
+				_, err := cs.ExportKeyingMaterial("label", nil, 32)
+				Expect(err).To(MatchError(errHandshakeNotComplete))
+			})
+
+			It("exports keying material derived from the forward-secure secret", func() {
+				doCHLO()
+				out, err := cs.ExportKeyingMaterial("label", []byte("context"), 32)
+				Expect(err).ToNot(HaveOccurred())
+				// the mockKEX returns "shared ephermal" as the forward-secure secret
+				expected, err := crypto.ExportQuicCryptoKeyingMaterial([]byte("shared ephermal"), cs.forwardSecureNonces, cs.connID, "label", []byte("context"), 32)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(out).To(Equal(expected))
+				Expect(cs.forwardSecureNonces).To(HavePrefix(string(nonce32)))
 			})
 		})
 
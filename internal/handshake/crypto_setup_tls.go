@@ -9,6 +9,7 @@ import (
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
 )
 
 // ErrCloseSessionForRetry is returned by HandleCryptoStream when the server wishes to perform a stateless retry
@@ -17,6 +18,9 @@ var ErrCloseSessionForRetry = errors.New("closing session in order to recreate a
 // KeyDerivationFunction is used for key derivation
 type KeyDerivationFunction func(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, error)
 
+// HeaderProtectorDerivationFunction is used for the derivation of the header protection keys
+type HeaderProtectorDerivationFunction func(crypto.TLSExporter, protocol.Perspective) (crypto.HeaderProtector, error)
+
 type cryptoSetupTLS struct {
 	mutex sync.RWMutex
 
@@ -26,6 +30,10 @@ type cryptoSetupTLS struct {
 	nullAEAD      crypto.AEAD
 	aead          crypto.AEAD
 
+	headerProtectorDerivation HeaderProtectorDerivationFunction
+	nullHeaderProtector       crypto.HeaderProtector
+	headerProtector           crypto.HeaderProtector
+
 	tls            MintTLS
 	cryptoStream   *CryptoStreamConn
 	handshakeEvent chan<- struct{}
@@ -36,16 +44,19 @@ func NewCryptoSetupTLSServer(
 	tls MintTLS,
 	cryptoStream *CryptoStreamConn,
 	nullAEAD crypto.AEAD,
+	nullHeaderProtector crypto.HeaderProtector,
 	handshakeEvent chan<- struct{},
 	version protocol.VersionNumber,
 ) CryptoSetup {
 	return &cryptoSetupTLS{
-		tls:            tls,
-		cryptoStream:   cryptoStream,
-		nullAEAD:       nullAEAD,
-		perspective:    protocol.PerspectiveServer,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+		tls:                       tls,
+		cryptoStream:              cryptoStream,
+		nullAEAD:                  nullAEAD,
+		nullHeaderProtector:       nullHeaderProtector,
+		perspective:               protocol.PerspectiveServer,
+		keyDerivation:             crypto.DeriveAESKeys,
+		headerProtectorDerivation: crypto.DeriveHeaderProtector,
+		handshakeEvent:            handshakeEvent,
 	}
 }
 
@@ -62,13 +73,19 @@ func NewCryptoSetupTLSClient(
 	if err != nil {
 		return nil, err
 	}
+	nullHeaderProtector, err := crypto.NewNullHeaderProtector(protocol.PerspectiveClient, connID)
+	if err != nil {
+		return nil, err
+	}
 
 	return &cryptoSetupTLS{
-		perspective:    protocol.PerspectiveClient,
-		tls:            tls,
-		nullAEAD:       nullAEAD,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+		perspective:               protocol.PerspectiveClient,
+		tls:                       tls,
+		nullAEAD:                  nullAEAD,
+		nullHeaderProtector:       nullHeaderProtector,
+		keyDerivation:             crypto.DeriveAESKeys,
+		headerProtectorDerivation: crypto.DeriveHeaderProtector,
+		handshakeEvent:            handshakeEvent,
 	}, nil
 }
 
@@ -84,7 +101,12 @@ func (h *cryptoSetupTLS) HandleCryptoStream() error {
 handshakeLoop:
 	for {
 		if alert := h.tls.Handshake(); alert != mint.AlertNoAlert {
-			return fmt.Errorf("TLS handshake error: %s (Alert %d)", alert.String(), alert)
+			err := fmt.Errorf("TLS handshake error: %s (Alert %d)", alert.String(), alert)
+			// mint only sends this alert if the server's certificate chain was rejected
+			if alert == mint.AlertBadCertificate && h.perspective == protocol.PerspectiveClient {
+				return &qerr.CertificateVerificationError{Err: err}
+			}
+			return err
 		}
 		switch h.tls.State() {
 		case mint.StateClientStart: // this happens if a stateless retry is performed
@@ -98,8 +120,13 @@ handshakeLoop:
 	if err != nil {
 		return err
 	}
+	headerProtector, err := h.headerProtectorDerivation(h.tls, h.perspective)
+	if err != nil {
+		return err
+	}
 	h.mutex.Lock()
 	h.aead = aead
+	h.headerProtector = headerProtector
 	h.mutex.Unlock()
 
 	h.handshakeEvent <- struct{}{}
@@ -157,6 +184,26 @@ func (h *cryptoSetupTLS) GetSealerForCryptoStream() (protocol.EncryptionLevel, S
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
 
+// GetHeaderProtector gets the HeaderProtector for packets sent with the given encryption level.
+// Long header packets are protected using the keys derived from the connection ID,
+// short header packets using the 1-RTT keys.
+func (h *cryptoSetupTLS) GetHeaderProtector(encLevel protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	switch encLevel {
+	case protocol.EncryptionUnencrypted:
+		return h.nullHeaderProtector, nil
+	case protocol.EncryptionForwardSecure:
+		if h.headerProtector == nil {
+			return nil, errors.New("CryptoSetup: no 1-RTT header protection keys yet")
+		}
+		return h.headerProtector, nil
+	default:
+		return nil, fmt.Errorf("CryptoSetup: no header protector for encryption level %s", encLevel.String())
+	}
+}
+
 func (h *cryptoSetupTLS) DiversificationNonce() []byte {
 	panic("diversification nonce not needed for TLS")
 }
@@ -171,7 +218,19 @@ func (h *cryptoSetupTLS) ConnectionState() ConnectionState {
 	mintConnState := h.tls.ConnectionState()
 	return ConnectionState{
 		// TODO: set the ServerName, once mint exports it
-		HandshakeComplete: h.aead != nil,
-		PeerCertificates:  mintConnState.PeerCertificates,
+		HandshakeComplete:  h.aead != nil,
+		PeerCertificates:   mintConnState.PeerCertificates,
+		VerifiedChains:     mintConnState.VerifiedChains,
+		NegotiatedProtocol: mintConnState.NextProto,
+		CipherSuite:        uint16(mintConnState.CipherSuite.Suite),
+	}
+}
+
+func (h *cryptoSetupTLS) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.aead == nil {
+		return nil, errHandshakeNotComplete
 	}
+	return h.tls.ComputeExporter(label, context, length)
 }
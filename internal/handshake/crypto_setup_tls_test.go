@@ -9,6 +9,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/mocks/crypto"
 	"github.com/lucas-clemente/quic-go/internal/mocks/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -18,6 +19,10 @@ func mockKeyDerivation(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, e
 	return mockcrypto.NewMockAEAD(mockCtrl), nil
 }
 
+func mockHeaderProtectorDerivation(crypto.TLSExporter, protocol.Perspective) (crypto.HeaderProtector, error) {
+	return crypto.NewAESHeaderProtector(make([]byte, 16), make([]byte, 16))
+}
+
 var _ = Describe("TLS Crypto Setup", func() {
 	var (
 		cs             *cryptoSetupTLS
@@ -30,10 +35,12 @@ var _ = Describe("TLS Crypto Setup", func() {
 			nil,
 			NewCryptoStreamConn(nil),
 			nil, // AEAD
+			nil, // header protector
 			handshakeEvent,
 			protocol.VersionTLS,
 		).(*cryptoSetupTLS)
 		cs.nullAEAD = mockcrypto.NewMockAEAD(mockCtrl)
+		cs.headerProtectorDerivation = mockHeaderProtectorDerivation
 	})
 
 	It("errors when the handshake fails", func() {
@@ -55,6 +62,20 @@ var _ = Describe("TLS Crypto Setup", func() {
 		Expect(handshakeEvent).To(BeClosed())
 	})
 
+	It("errors when deriving the header protection keys fails", func() {
+		testErr := errors.New("test error")
+		cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+		cs.keyDerivation = mockKeyDerivation
+		cs.headerProtectorDerivation = func(crypto.TLSExporter, protocol.Perspective) (crypto.HeaderProtector, error) {
+			return nil, testErr
+		}
+		err := cs.HandleCryptoStream()
+		Expect(err).To(MatchError(testErr))
+		Expect(handshakeEvent).ToNot(Receive())
+	})
+
 	It("handshakes until it is connected", func() {
 		cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert).Times(10)
@@ -87,6 +108,30 @@ var _ = Describe("TLS Crypto Setup", func() {
 			Expect(state.HandshakeComplete).To(BeTrue())
 			Expect(state.PeerCertificates).To(BeNil())
 		})
+
+		It("exports keying material after the handshake completed", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			_, err := cs.ExportKeyingMaterial("label", []byte("context"), 32)
+			Expect(err).To(MatchError(errHandshakeNotComplete))
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ComputeExporter("label", []byte("context"), 32).Return([]byte("exported"), nil)
+			Expect(cs.ExportKeyingMaterial("label", []byte("context"), 32)).To(Equal([]byte("exported")))
+		})
+
+		It("reports the negotiated application protocol and cipher suite", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{
+				NextProto:   "hq",
+				CipherSuite: mint.CipherSuiteParams{Suite: mint.TLS_CHACHA20_POLY1305_SHA256},
+			})
+			state := cs.ConnectionState()
+			Expect(state.NegotiatedProtocol).To(Equal("hq"))
+			Expect(state.CipherSuite).To(Equal(uint16(mint.TLS_CHACHA20_POLY1305_SHA256)))
+			Expect(state.DidResume).To(BeFalse())
+		})
 	})
 
 	Context("escalating crypto", func() {
@@ -198,6 +243,44 @@ var _ = Describe("TLS Crypto Setup", func() {
 				Expect(seal).To(BeNil())
 			})
 		})
+
+		Context("header protection", func() {
+			var nullHP crypto.HeaderProtector
+
+			BeforeEach(func() {
+				var err error
+				nullHP, err = crypto.NewNullHeaderProtector(protocol.PerspectiveServer, 0x1337)
+				Expect(err).ToNot(HaveOccurred())
+				cs.nullHeaderProtector = nullHP
+			})
+
+			It("uses the null header protector for unencrypted packets", func() {
+				doHandshake()
+				hp, err := cs.GetHeaderProtector(protocol.EncryptionUnencrypted)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hp).To(Equal(nullHP))
+			})
+
+			It("uses the 1-RTT header protector for forward-secure packets", func() {
+				doHandshake()
+				hp, err := cs.GetHeaderProtector(protocol.EncryptionForwardSecure)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hp).ToNot(BeNil())
+				Expect(hp).ToNot(Equal(nullHP))
+			})
+
+			It("errors if the 1-RTT header protector is not available", func() {
+				hp, err := cs.GetHeaderProtector(protocol.EncryptionForwardSecure)
+				Expect(err).To(MatchError("CryptoSetup: no 1-RTT header protection keys yet"))
+				Expect(hp).To(BeNil())
+			})
+
+			It("errors for secure (not forward-secure) packets", func() {
+				doHandshake()
+				_, err := cs.GetHeaderProtector(protocol.EncryptionSecure)
+				Expect(err).To(MatchError("CryptoSetup: no header protector for encryption level encrypted (not forward-secure)"))
+			})
+		})
 	})
 })
 
@@ -229,4 +312,19 @@ var _ = Describe("TLS Crypto Setup, for the client", func() {
 		Expect(err).To(MatchError(ErrCloseSessionForRetry))
 	})
 
+	It("returns a CertificateVerificationError when the server's certificate is rejected", func() {
+		alert := mint.AlertBadCertificate
+		cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(alert)
+		err := cs.HandleCryptoStream()
+		Expect(err).To(BeAssignableToTypeOf(&qerr.CertificateVerificationError{}))
+		Expect(err.(*qerr.CertificateVerificationError).Err).To(MatchError(fmt.Errorf("TLS handshake error: %s (Alert %d)", alert.String(), alert)))
+	})
+
+	It("derives the header protection keys for unencrypted packets from the connection ID", func() {
+		hp, err := cs.GetHeaderProtector(protocol.EncryptionUnencrypted)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hp).ToNot(BeNil())
+	})
+
 })
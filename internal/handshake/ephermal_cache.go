@@ -8,14 +8,18 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
+type ephermalKEX struct {
+	kex     crypto.KeyExchange
+	created time.Time
+}
+
 var (
-	kexLifetime    = protocol.EphermalKeyLifetime
-	kexCurrent     crypto.KeyExchange
-	kexCurrentTime time.Time
-	kexMutex       sync.RWMutex
+	kexLifetime = protocol.EphermalKeyLifetime
+	kexCurrent  = make(map[Tag]ephermalKEX) // one KEX per key exchange algorithm
+	kexMutex    sync.RWMutex
 )
 
-// getEphermalKEX returns the currently active KEX, which changes every protocol.EphermalKeyLifetime
+// getEphermalKEX returns the currently active KEX for the key exchange algorithm, which changes every protocol.EphermalKeyLifetime
 // See the explanation from the QUIC crypto doc:
 //
 // A single connection is the usual scope for forward security, but the security
@@ -23,26 +27,24 @@ var (
 // used for all connections for 60 seconds is negligible. Thus we can amortise
 // the Diffie-Hellman key generation at the server over all the connections in a
 // small time span.
-func getEphermalKEX() (crypto.KeyExchange, error) {
+func getEphermalKEX(tag Tag) (crypto.KeyExchange, error) {
 	kexMutex.RLock()
-	res := kexCurrent
-	t := kexCurrentTime
+	res, ok := kexCurrent[tag]
 	kexMutex.RUnlock()
-	if res != nil && time.Since(t) < kexLifetime {
-		return res, nil
+	if ok && time.Since(res.created) < kexLifetime {
+		return res.kex, nil
 	}
 
 	kexMutex.Lock()
 	defer kexMutex.Unlock()
 	// Check if still unfulfilled
-	if kexCurrent == nil || time.Since(kexCurrentTime) > kexLifetime {
-		kex, err := crypto.NewCurve25519KEX()
+	if res, ok := kexCurrent[tag]; !ok || time.Since(res.created) > kexLifetime {
+		kex, err := newKEX(tag)
 		if err != nil {
 			return nil, err
 		}
-		kexCurrent = kex
-		kexCurrentTime = time.Now()
-		return kexCurrent, nil
+		kexCurrent[tag] = ephermalKEX{kex: kex, created: time.Now()}
+		return kex, nil
 	}
-	return kexCurrent, nil
+	return kexCurrent[tag].kex, nil
 }
@@ -10,10 +10,10 @@ import (
 
 var _ = Describe("Ephermal KEX", func() {
 	It("has a consistent KEX", func() {
-		kex1, err := getEphermalKEX()
+		kex1, err := getEphermalKEX(TagC255)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(kex1).ToNot(BeNil())
-		kex2, err := getEphermalKEX()
+		kex2, err := getEphermalKEX(TagC255)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(kex2).ToNot(BeNil())
 		Expect(kex1).To(Equal(kex2))
@@ -24,12 +24,29 @@ var _ = Describe("Ephermal KEX", func() {
 		defer func() {
 			kexLifetime = protocol.EphermalKeyLifetime
 		}()
-		kex, err := getEphermalKEX()
+		kex, err := getEphermalKEX(TagC255)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(kex).ToNot(BeNil())
 		time.Sleep(kexLifetime)
-		kex2, err := getEphermalKEX()
+		kex2, err := getEphermalKEX(TagC255)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(kex2).ToNot(Equal(kex))
 	})
+
+	It("uses one KEX per key exchange algorithm", func() {
+		c255, err := getEphermalKEX(TagC255)
+		Expect(err).ToNot(HaveOccurred())
+		p256, err := getEphermalKEX(TagP256)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c255.PublicKey()).To(HaveLen(32))
+		Expect(p256.PublicKey()).To(HaveLen(65))
+		p256Again, err := getEphermalKEX(TagP256)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p256Again).To(Equal(p256))
+	})
+
+	It("errors for unknown key exchange algorithms", func() {
+		_, err := getEphermalKEX(TagAESG)
+		Expect(err).To(MatchError("unsupported key exchange algorithm"))
+	})
 })
@@ -1,8 +1,11 @@
 package handshake
 
 import (
+	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"io"
+	"time"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -35,6 +38,9 @@ type MintTLS interface {
 	SetCryptoStream(io.ReadWriter)
 }
 
+// errHandshakeNotComplete is returned by CryptoSetup.ExportKeyingMaterial if the handshake is not yet complete
+var errHandshakeNotComplete = errors.New("keying material can only be exported after the handshake completed")
+
 // CryptoSetup is a crypto setup
 type CryptoSetup interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error)
@@ -43,10 +49,14 @@ type CryptoSetup interface {
 	DiversificationNonce() []byte   // only needed for cryptoSetupServer
 	SetDiversificationNonce([]byte) // only needed for cryptoSetupClient
 	ConnectionState() ConnectionState
+	// ExportKeyingMaterial returns errHandshakeNotComplete before the handshake completed
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
 	GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer)
+	// only needed for IETF QUIC
+	GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error)
 }
 
 // ConnectionState records basic details about the QUIC connection.
@@ -55,4 +65,47 @@ type ConnectionState struct {
 	HandshakeComplete bool                // handshake is complete
 	ServerName        string              // server name requested by client, if any (server side only)
 	PeerCertificates  []*x509.Certificate // certificate chain presented by remote peer
+	// VerifiedChains are the verified chains built from PeerCertificates.
+	// On the server side, they are only set if the certificate of the client was verified (IETF QUIC only).
+	VerifiedChains [][]*x509.Certificate
+	// NegotiatedProtocol is the application protocol negotiated using the tls.Config.NextProtos.
+	// For gQUIC, which doesn't use TLS, it is negotiated using the (unofficial) ALPN tag.
+	NegotiatedProtocol string
+	// Version is the QUIC version in use.
+	Version protocol.VersionNumber
+	// CipherSuite is the TLS 1.3 cipher suite in use.
+	// For gQUIC, it is the cipher suite that uses the same AEAD.
+	CipherSuite uint16
+	// CurveID is the key exchange algorithm in use: tls.X25519 or tls.CurveP256.
+	// It is only set for gQUIC, since mint doesn't expose the negotiated group.
+	CurveID tls.CurveID
+	// DidResume is set if the handshake completed without a full round trip, using state cached from a previous connection.
+	// This is only possible for gQUIC (0-RTT handshake).
+	DidResume bool
+	// PeerIdleTimeout, PeerStreamFlowControlWindow, PeerConnectionFlowControlWindow and PeerMaxPacketSize
+	// are the values of the transport parameters sent by the peer.
+	// They are 0 as long as the transport parameters haven't been received.
+	PeerIdleTimeout                 time.Duration
+	PeerStreamFlowControlWindow     uint64
+	PeerConnectionFlowControlWindow uint64
+	PeerMaxPacketSize               uint64
+}
+
+// CachedServerState is the state a gQUIC client caches for a server.
+// It allows the client to skip the REJ round trip when connecting to the same server again.
+type CachedServerState struct {
+	ServerConfig       []byte // the server config (SCFG)
+	SourceAddressToken []byte // the source-address token (STK)
+	CertificateChain   []byte // the certificate chain, as sent by the server (compressed)
+	ServerProof        []byte // the signature of the server config (PROF)
+	SignedCHLO         []byte // the CHLO covered by the signature of the server config
+}
+
+// A ServerStateCache caches the CachedServerState, indexed by hostname.
+// It has to be safe for concurrent use.
+type ServerStateCache interface {
+	// Get returns the state cached for a hostname.
+	Get(hostname string) (*CachedServerState, bool)
+	// Put adds a state to the cache. A nil state deletes the entry.
+	Put(hostname string, state *CachedServerState)
 }
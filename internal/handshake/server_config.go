@@ -3,21 +3,38 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 )
 
 // ServerConfig is a server config
 type ServerConfig struct {
-	kex             crypto.KeyExchange
+	kexs            []serverConfigKEX // in order of preference
+	aeads           []Tag             // in order of preference
 	certChain       crypto.CertChain
 	ID              []byte
 	obit            []byte
+	notBefore       time.Time
+	expiry          time.Time // a zero value means that the server config never expires
 	cookieGenerator *CookieGenerator
 }
 
-// NewServerConfig creates a new server config
+type serverConfigKEX struct {
+	tag Tag
+	kex crypto.KeyExchange
+}
+
+// NewServerConfig creates a new server config, which uses Curve25519 and AES-GCM
 func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*ServerConfig, error) {
+	return newServerConfig([]serverConfigKEX{{tag: TagC255, kex: kex}}, []Tag{TagAESG}, certChain)
+}
+
+// newServerConfig creates a new server config, offering the given key exchange algorithms and AEADs
+func newServerConfig(kexs []serverConfigKEX, aeads []Tag, certChain crypto.CertChain) (*ServerConfig, error) {
 	id := make([]byte, 16)
 	_, err := rand.Read(id)
 	if err != nil {
@@ -29,17 +46,51 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 		return nil, err
 	}
 
-	cookieGenerator, err := NewCookieGenerator()
+	cookieGenerator, err := NewCookieGenerator(nil)
 
 	if err != nil {
 		return nil, err
 	}
 
 	return &ServerConfig{
-		kex:             kex,
+		kexs:            kexs,
+		aeads:           aeads,
+		certChain:       certChain,
+		ID:              id,
+		obit:            obit,
+		cookieGenerator: cookieGenerator,
+	}, nil
+}
+
+// newServerConfigFromKey creates a server config from a ServerConfigKey.
+// P-256 is only offered if the key contains a P-256 private key.
+func newServerConfigFromKey(key *ServerConfigKey, prefs algorithmPreferences, certChain crypto.CertChain, cookieGenerator *CookieGenerator) (*ServerConfig, error) {
+	var kexs []serverConfigKEX
+	for _, tag := range prefs.kexs {
+		switch tag {
+		case TagC255:
+			kexs = append(kexs, serverConfigKEX{tag: TagC255, kex: crypto.NewCurve25519KEXFromPrivateKey(key.PrivateKey)})
+		case TagP256:
+			if key.P256PrivateKey != [32]byte{} {
+				kexs = append(kexs, serverConfigKEX{tag: TagP256, kex: crypto.NewP256KEXFromPrivateKey(key.P256PrivateKey)})
+			}
+		}
+	}
+	if len(kexs) == 0 {
+		return nil, errors.New("server config key doesn't contain a private key for any of the preferred key exchange algorithms")
+	}
+	id := make([]byte, len(key.ID))
+	copy(id, key.ID[:])
+	obit := make([]byte, len(key.Orbit))
+	copy(obit, key.Orbit[:])
+	return &ServerConfig{
+		kexs:            kexs,
+		aeads:           prefs.aeads,
 		certChain:       certChain,
 		ID:              id,
 		obit:            obit,
+		notBefore:       key.NotBefore,
+		expiry:          key.Expiry,
 		cookieGenerator: cookieGenerator,
 	}, nil
 }
@@ -47,27 +98,66 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 // Get the server config binary representation
 func (s *ServerConfig) Get() []byte {
 	var serverConfig bytes.Buffer
+	kexs := make([]Tag, len(s.kexs))
+	var pubs []byte
+	for i, k := range s.kexs {
+		kexs[i] = k.tag
+		// every public value is prepended by a 3 byte little endian length field
+		pub := k.kex.PublicKey()
+		pubs = append(pubs, byte(len(pub)), byte(len(pub)>>8), byte(len(pub)>>16))
+		pubs = append(pubs, pub...)
+	}
 	msg := HandshakeMessage{
 		Tag: TagSCFG,
 		Data: map[Tag][]byte{
 			TagSCID: s.ID,
-			TagKEXS: []byte("C255"),
-			TagAEAD: []byte("AESG"),
-			TagPUBS: append([]byte{0x20, 0x00, 0x00}, s.kex.PublicKey()...),
+			TagKEXS: encodeTags(kexs),
+			TagAEAD: encodeTags(s.aeads),
+			TagPUBS: pubs,
 			TagOBIT: s.obit,
-			TagEXPY: {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			TagEXPY: s.getExpiry(),
 		},
 	}
 	msg.Write(&serverConfig)
 	return serverConfig.Bytes()
 }
 
-// Sign the server config and CHLO with the server's keyData
-func (s *ServerConfig) Sign(sni string, chlo []byte) ([]byte, error) {
-	return s.certChain.SignServerProof(sni, chlo, s.Get())
+// getKEX returns the key exchange for the algorithm, or nil if the algorithm is not offered
+func (s *ServerConfig) getKEX(tag Tag) crypto.KeyExchange {
+	for _, k := range s.kexs {
+		if k.tag == tag {
+			return k.kex
+		}
+	}
+	return nil
+}
+
+// supportsAEAD says if the AEAD is offered
+func (s *ServerConfig) supportsAEAD(tag Tag) bool {
+	for _, a := range s.aeads {
+		if a == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ServerConfig) getExpiry() []byte {
+	expy := make([]byte, 8)
+	if s.expiry.IsZero() {
+		binary.LittleEndian.PutUint64(expy, math.MaxUint64)
+	} else {
+		binary.LittleEndian.PutUint64(expy, uint64(s.expiry.Unix()))
+	}
+	return expy
+}
+
+// IsExpired says if the server config has expired
+func (s *ServerConfig) IsExpired(now time.Time) bool {
+	return !s.expiry.IsZero() && !now.Before(s.expiry)
 }
 
-// GetCertsCompressed returns the certificate data
-func (s *ServerConfig) GetCertsCompressed(sni string, commonSetHashes, compressedHashes []byte) ([]byte, error) {
-	return s.certChain.GetCertsCompressed(sni, commonSetHashes, compressedHashes)
+// Sign the server config and CHLO with the key of the certificate
+func (s *ServerConfig) Sign(cert crypto.Certificate, chlo []byte) ([]byte, error) {
+	return cert.SignServerProof(chlo, s.Get())
 }
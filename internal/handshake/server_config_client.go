@@ -18,6 +18,8 @@ type serverConfigClient struct {
 	obit   []byte
 	expiry time.Time
 
+	kexAlgorithm Tag // the key exchange algorithm selected from the KEXS
+	aead         Tag // the AEAD selected from the AEAD tag
 	kex          crypto.KeyExchange
 	sharedSecret []byte
 }
@@ -26,8 +28,9 @@ var (
 	errMessageNotServerConfig = errors.New("ServerConfig must have TagSCFG")
 )
 
-// parseServerConfig parses a server config
-func parseServerConfig(data []byte) (*serverConfigClient, error) {
+// parseServerConfig parses a server config.
+// It selects the key exchange algorithm and the AEAD according to the preferences.
+func parseServerConfig(data []byte, prefs algorithmPreferences) (*serverConfigClient, error) {
 	message, err := ParseHandshakeMessage(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
@@ -37,7 +40,7 @@ func parseServerConfig(data []byte) (*serverConfigClient, error) {
 	}
 
 	scfg := &serverConfigClient{raw: data}
-	err = scfg.parseValues(message.Data)
+	err = scfg.parseValues(message.Data, prefs)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +48,7 @@ func parseServerConfig(data []byte) (*serverConfigClient, error) {
 	return scfg, nil
 }
 
-func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
+func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte, prefs algorithmPreferences) error {
 	// SCID
 	scfgID, ok := tagMap[TagSCID]
 	if !ok {
@@ -57,42 +60,39 @@ func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
 	s.ID = scfgID
 
 	// KEXS
-	// TODO: setup Key Exchange
-	kexs, ok := tagMap[TagKEXS]
+	kexsData, ok := tagMap[TagKEXS]
 	if !ok {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "KEXS")
 	}
-	if len(kexs)%4 != 0 {
+	kexs, err := decodeTags(kexsData)
+	if err != nil {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "KEXS")
 	}
-	c255Foundat := -1
-
-	for i := 0; i < len(kexs)/4; i++ {
-		if bytes.Equal(kexs[4*i:4*i+4], []byte("C255")) {
-			c255Foundat = i
+	var kexFound bool
+	s.kexAlgorithm, kexFound = selectAlgorithm(prefs.kexs, kexs)
+	if !kexFound {
+		return qerr.Error(qerr.CryptoNoSupport, "KEXS: none of the key exchange algorithms is supported")
+	}
+	kexIndex := -1
+	for i, k := range kexs {
+		if k == s.kexAlgorithm {
+			kexIndex = i
 			break
 		}
 	}
-	if c255Foundat < 0 {
-		return qerr.Error(qerr.CryptoNoSupport, "KEXS: Could not find C255, other key exchanges are not supported")
-	}
 
 	// AEAD
-	aead, ok := tagMap[TagAEAD]
+	aeadData, ok := tagMap[TagAEAD]
 	if !ok {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "AEAD")
 	}
-	if len(aead)%4 != 0 {
+	aeads, err := decodeTags(aeadData)
+	if err != nil {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "AEAD")
 	}
-	var aesgFound bool
-	for i := 0; i < len(aead)/4; i++ {
-		if bytes.Equal(aead[4*i:4*i+4], []byte("AESG")) {
-			aesgFound = true
-			break
-		}
-	}
-	if !aesgFound {
+	var aeadFound bool
+	s.aead, aeadFound = selectAlgorithm(prefs.aeads, aeads)
+	if !aeadFound {
 		return qerr.Error(qerr.CryptoNoSupport, "AEAD")
 	}
 
@@ -128,21 +128,24 @@ func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
 		}{lastLen, pubs[i+3 : i+3+int(lastLen)]})
 	}
 
-	if c255Foundat >= len(pubsKexs) {
+	if kexIndex >= len(pubsKexs) {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "KEXS not in PUBS")
 	}
 
-	if pubsKexs[c255Foundat].Length != 32 {
+	expectedPubLen := uint32(32) // Curve25519
+	if s.kexAlgorithm == TagP256 {
+		expectedPubLen = 65 // an uncompressed point
+	}
+	if pubsKexs[kexIndex].Length != expectedPubLen {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "PUBS")
 	}
 
-	var err error
-	s.kex, err = crypto.NewCurve25519KEX()
+	s.kex, err = newKEX(s.kexAlgorithm)
 	if err != nil {
 		return err
 	}
 
-	s.sharedSecret, err = s.kex.CalculateSharedKey(pubsKexs[c255Foundat].Value)
+	s.sharedSecret, err = s.kex.CalculateSharedKey(pubsKexs[kexIndex].Value)
 	if err != nil {
 		return err
 	}
@@ -23,6 +23,10 @@ func getDefaultServerConfigClient() map[Tag][]byte {
 
 var _ = Describe("Server Config", func() {
 	var tagMap map[Tag][]byte
+	prefs := algorithmPreferences{
+		kexs:  []Tag{TagC255, TagP256},
+		aeads: []Tag{TagAESG, TagCC20},
+	}
 
 	BeforeEach(func() {
 		tagMap = getDefaultServerConfigClient()
@@ -32,7 +36,7 @@ var _ = Describe("Server Config", func() {
 		tagMap[TagSCID] = []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf}
 		b := &bytes.Buffer{}
 		HandshakeMessage{Tag: TagSCFG, Data: tagMap}.Write(b)
-		scfg, err := parseServerConfig(b.Bytes())
+		scfg, err := parseServerConfig(b.Bytes(), prefs)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(scfg.ID).To(Equal(tagMap[TagSCID]))
 	})
@@ -40,7 +44,7 @@ var _ = Describe("Server Config", func() {
 	It("saves the raw server config", func() {
 		b := &bytes.Buffer{}
 		HandshakeMessage{Tag: TagSCFG, Data: tagMap}.Write(b)
-		scfg, err := parseServerConfig(b.Bytes())
+		scfg, err := parseServerConfig(b.Bytes(), prefs)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(scfg.raw).To(Equal(b.Bytes()))
 	})
@@ -57,28 +61,28 @@ var _ = Describe("Server Config", func() {
 		It("rejects a handshake message with the wrong message tag", func() {
 			var serverConfig bytes.Buffer
 			HandshakeMessage{Tag: TagCHLO, Data: make(map[Tag][]byte)}.Write(&serverConfig)
-			_, err := parseServerConfig(serverConfig.Bytes())
+			_, err := parseServerConfig(serverConfig.Bytes(), prefs)
 			Expect(err).To(MatchError(errMessageNotServerConfig))
 		})
 
 		It("errors on invalid handshake messages", func() {
 			var serverConfig bytes.Buffer
 			HandshakeMessage{Tag: TagSCFG, Data: make(map[Tag][]byte)}.Write(&serverConfig)
-			_, err := parseServerConfig(serverConfig.Bytes()[:serverConfig.Len()-2])
+			_, err := parseServerConfig(serverConfig.Bytes()[:serverConfig.Len()-2], prefs)
 			Expect(err).To(MatchError("unexpected EOF"))
 		})
 
 		It("passes on errors encountered when reading the TagMap", func() {
 			var serverConfig bytes.Buffer
 			HandshakeMessage{Tag: TagSCFG, Data: make(map[Tag][]byte)}.Write(&serverConfig)
-			_, err := parseServerConfig(serverConfig.Bytes())
+			_, err := parseServerConfig(serverConfig.Bytes(), prefs)
 			Expect(err).To(MatchError("CryptoMessageParameterNotFound: SCID"))
 		})
 
 		It("reads an example Handshake Message", func() {
 			var serverConfig bytes.Buffer
 			HandshakeMessage{Tag: TagSCFG, Data: tagMap}.Write(&serverConfig)
-			scfg, err := parseServerConfig(serverConfig.Bytes())
+			scfg, err := parseServerConfig(serverConfig.Bytes(), prefs)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(scfg.ID).To(Equal(tagMap[TagSCID]))
 			Expect(scfg.obit).To(Equal(tagMap[TagOBIT]))
@@ -96,20 +100,20 @@ var _ = Describe("Server Config", func() {
 			It("parses the ServerConfig ID", func() {
 				id := []byte{0xb2, 0xa4, 0xbb, 0x8f, 0xf6, 0x51, 0x28, 0xfd, 0x4d, 0xf7, 0xb3, 0x9a, 0x91, 0xe7, 0x91, 0xfb}
 				tagMap[TagSCID] = id
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(scfg.ID).To(Equal(id))
 			})
 
 			It("errors if the ServerConfig ID is missing", func() {
 				delete(tagMap, TagSCID)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: SCID"))
 			})
 
 			It("rejects ServerConfig IDs that have the wrong length", func() {
 				tagMap[TagSCID] = bytes.Repeat([]byte{'F'}, 17) // 1 byte too long
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: SCID"))
 			})
 		})
@@ -117,19 +121,40 @@ var _ = Describe("Server Config", func() {
 		Context("KEXS", func() {
 			It("rejects KEXS values that have the wrong length", func() {
 				tagMap[TagKEXS] = bytes.Repeat([]byte{'F'}, 5) // 1 byte too long
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: KEXS"))
 			})
 
-			It("rejects KEXS values other than C255", func() {
-				tagMap[TagKEXS] = []byte("P256")
-				err := scfg.parseValues(tagMap)
-				Expect(err).To(MatchError("CryptoNoSupport: KEXS: Could not find C255, other key exchanges are not supported"))
+			It("rejects unsupported KEXS values", func() {
+				tagMap[TagKEXS] = []byte("P384")
+				err := scfg.parseValues(tagMap, prefs)
+				Expect(err).To(MatchError("CryptoNoSupport: KEXS: none of the key exchange algorithms is supported"))
+			})
+
+			It("rejects KEXS values that are not preferred", func() {
+				tagMap[TagKEXS] = []byte("C255")
+				err := scfg.parseValues(tagMap, algorithmPreferences{kexs: []Tag{TagP256}, aeads: prefs.aeads})
+				Expect(err).To(MatchError("CryptoNoSupport: KEXS: none of the key exchange algorithms is supported"))
+			})
+
+			It("selects the preferred key exchange algorithm", func() {
+				c255, err := crypto.NewCurve25519KEX()
+				Expect(err).ToNot(HaveOccurred())
+				p256, err := crypto.NewP256KEX()
+				Expect(err).ToNot(HaveOccurred())
+				tagMap[TagKEXS] = []byte("C255P256")
+				tagMap[TagPUBS] = append(append([]byte{0x20, 0x00, 0x00}, c255.PublicKey()...), append([]byte{0x41, 0x00, 0x00}, p256.PublicKey()...)...)
+				err = scfg.parseValues(tagMap, algorithmPreferences{kexs: []Tag{TagP256, TagC255}, aeads: prefs.aeads})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.kexAlgorithm).To(Equal(TagP256))
+				sharedSecret, err := p256.CalculateSharedKey(scfg.kex.PublicKey())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.sharedSecret).To(Equal(sharedSecret))
 			})
 
 			It("errors if the KEXS is missing", func() {
 				delete(tagMap, TagKEXS)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: KEXS"))
 			})
 		})
@@ -137,31 +162,41 @@ var _ = Describe("Server Config", func() {
 		Context("AEAD", func() {
 			It("rejects AEAD values that have the wrong length", func() {
 				tagMap[TagAEAD] = bytes.Repeat([]byte{'F'}, 5) // 1 byte too long
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: AEAD"))
 			})
 
-			It("rejects AEAD values other than AESG", func() {
+			It("rejects unsupported AEAD values", func() {
 				tagMap[TagAEAD] = []byte("S20P")
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoNoSupport: AEAD"))
 			})
 
 			It("recognizes AESG in the list of AEADs, at the first position", func() {
 				tagMap[TagAEAD] = []byte("AESGS20P")
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
 			It("recognizes AESG in the list of AEADs, not at the first position", func() {
 				tagMap[TagAEAD] = []byte("S20PAESG")
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("selects the preferred AEAD", func() {
+				tagMap[TagAEAD] = []byte("AESGCC20")
+				err := scfg.parseValues(tagMap, prefs)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.aead).To(Equal(TagAESG))
+				err = scfg.parseValues(tagMap, algorithmPreferences{kexs: prefs.kexs, aeads: []Tag{TagCC20, TagAESG}})
 				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.aead).To(Equal(TagCC20))
 			})
 
 			It("errors if the AEAD is missing", func() {
 				delete(tagMap, TagAEAD)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: AEAD"))
 			})
 		})
@@ -171,7 +206,7 @@ var _ = Describe("Server Config", func() {
 				serverKex, err := crypto.NewCurve25519KEX()
 				Expect(err).ToNot(HaveOccurred())
 				tagMap[TagPUBS] = append([]byte{0x20, 0x00, 0x00}, serverKex.PublicKey()...)
-				err = scfg.parseValues(tagMap)
+				err = scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				sharedSecret, err := serverKex.CalculateSharedKey(scfg.kex.PublicKey())
 				Expect(err).ToNot(HaveOccurred())
@@ -180,13 +215,13 @@ var _ = Describe("Server Config", func() {
 
 			It("rejects PUBS values that have the wrong length", func() {
 				tagMap[TagPUBS] = bytes.Repeat([]byte{'F'}, 100) // completely wrong length
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: PUBS"))
 			})
 
 			It("rejects PUBS values that have a zero length", func() {
 				tagMap[TagPUBS] = bytes.Repeat([]byte{0}, 100) // completely wrong length
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: PUBS"))
 			})
 
@@ -196,16 +231,23 @@ var _ = Describe("Server Config", func() {
 				tagMap[TagKEXS] = []byte("P256C255") // have another KEXS before C255
 				// 3 byte len + 1 byte empty + C255
 				tagMap[TagPUBS] = append([]byte{0x01, 0x00, 0x00, 0x00}, append([]byte{0x20, 0x00, 0x00}, serverKex.PublicKey()...)...)
-				err = scfg.parseValues(tagMap)
+				err = scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				sharedSecret, err := serverKex.CalculateSharedKey(scfg.kex.PublicKey())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(scfg.sharedSecret).To(Equal(sharedSecret))
 			})
 
+			It("rejects P-256 PUBS values that have the wrong length", func() {
+				tagMap[TagKEXS] = []byte("P256")
+				tagMap[TagPUBS] = append([]byte{0x20, 0x00, 0x00}, bytes.Repeat([]byte{0}, 32)...)
+				err := scfg.parseValues(tagMap, prefs)
+				Expect(err).To(MatchError("CryptoInvalidValueLength: PUBS"))
+			})
+
 			It("errors if the PUBS is missing", func() {
 				delete(tagMap, TagPUBS)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: PUBS"))
 			})
 		})
@@ -214,20 +256,20 @@ var _ = Describe("Server Config", func() {
 			It("parses the OBIT value", func() {
 				obit := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8}
 				tagMap[TagOBIT] = obit
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(scfg.obit).To(Equal(obit))
 			})
 
 			It("errors if the OBIT is missing", func() {
 				delete(tagMap, TagOBIT)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: OBIT"))
 			})
 
 			It("rejets OBIT values that have the wrong length", func() {
 				tagMap[TagOBIT] = bytes.Repeat([]byte{'F'}, 7) // 1 byte too short
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: OBIT"))
 			})
 		})
@@ -235,7 +277,7 @@ var _ = Describe("Server Config", func() {
 		Context("EXPY", func() {
 			It("parses the expiry date", func() {
 				tagMap[TagEXPY] = []byte{0xdc, 0x89, 0x0e, 0x59, 0, 0, 0, 0} // UNIX Timestamp 0x590e89dc = 1494125020
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				year, month, day := scfg.expiry.UTC().Date()
 				Expect(year).To(Equal(2017))
@@ -245,19 +287,19 @@ var _ = Describe("Server Config", func() {
 
 			It("errors if the EXPY is missing", func() {
 				delete(tagMap, TagEXPY)
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoMessageParameterNotFound: EXPY"))
 			})
 
 			It("rejects EXPY values that have the wrong length", func() {
 				tagMap[TagEXPY] = bytes.Repeat([]byte{'F'}, 9) // 1 byte too long
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).To(MatchError("CryptoInvalidValueLength: EXPY"))
 			})
 
 			It("deals with absurdly large timestamps", func() {
 				tagMap[TagEXPY] = bytes.Repeat([]byte{0xff}, 8) // this would overflow the int64
-				err := scfg.parseValues(tagMap)
+				err := scfg.parseValues(tagMap, prefs)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(scfg.expiry.After(time.Now())).To(BeTrue())
 			})
@@ -0,0 +1,128 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+)
+
+// A ServerConfigKey contains the values needed to generate a server config (SCFG).
+// Servers that use the same keys send the same server config,
+// which allows clients to reuse it when connecting to a different server.
+type ServerConfigKey struct {
+	ID         [16]byte // the server config ID (SCID)
+	Orbit      [8]byte  // the orbit (OBIT)
+	PrivateKey [32]byte // the Curve25519 private key
+	// P256PrivateKey is the P-256 private key.
+	// If it is not set, the server config doesn't offer P-256.
+	P256PrivateKey [32]byte
+	// NotBefore is the time from which on the server config is sent to clients.
+	// It is sent until the NotBefore time of a newer server config is reached.
+	NotBefore time.Time
+	// Expiry is the time at which the server config expires. It is sent to clients in the EXPY tag.
+	// Until then, clients may still use the server config, even if a newer server config is already sent.
+	// The time between the NotBefore time of the next server config and the Expiry is the overlap window.
+	// A zero value means that the server config never expires.
+	Expiry time.Time
+}
+
+var errNoValidServerConfig = errors.New("no valid server config")
+
+// A ServerConfigManager manages the server configs of a server.
+// It rotates the server configs according to their NotBefore and Expiry times.
+type ServerConfigManager struct {
+	configs []*ServerConfig // sorted by notBefore
+
+	now func() time.Time
+}
+
+// NewServerConfigManager creates a new ServerConfigManager.
+// If no keys are given, a random server config is generated, which never expires.
+// The cookieKeys are used to protect the source-address tokens, see NewCookieProtector.
+// The key exchange algorithms and AEADs offered are determined by the CurvePreferences and the CipherSuites of the tls.Config.
+func NewServerConfigManager(keys []ServerConfigKey, cookieKeys [][32]byte, certChain crypto.CertChain, tlsConf *tls.Config) (*ServerConfigManager, error) {
+	cookieGenerator, err := NewCookieGenerator(cookieKeys)
+	if err != nil {
+		return nil, err
+	}
+	prefs := newAlgorithmPreferences(tlsConf)
+	m := &ServerConfigManager{now: time.Now}
+	if len(keys) == 0 {
+		kexs := make([]serverConfigKEX, len(prefs.kexs))
+		for i, tag := range prefs.kexs {
+			kex, err := newKEX(tag)
+			if err != nil {
+				return nil, err
+			}
+			kexs[i] = serverConfigKEX{tag: tag, kex: kex}
+		}
+		scfg, err := newServerConfig(kexs, prefs.aeads, certChain)
+		if err != nil {
+			return nil, err
+		}
+		scfg.cookieGenerator = cookieGenerator
+		m.configs = []*ServerConfig{scfg}
+		return m, nil
+	}
+
+	now := m.now()
+	var hasValidConfig bool
+	for i := range keys {
+		key := &keys[i]
+		if !key.Expiry.IsZero() && !key.NotBefore.Before(key.Expiry) {
+			return nil, errors.New("server config expires before it becomes valid")
+		}
+		scfg, err := newServerConfigFromKey(key, prefs, certChain, cookieGenerator)
+		if err != nil {
+			return nil, err
+		}
+		if !scfg.IsExpired(now) {
+			hasValidConfig = true
+		}
+		m.configs = append(m.configs, scfg)
+	}
+	if !hasValidConfig {
+		return nil, errNoValidServerConfig
+	}
+	sort.SliceStable(m.configs, func(i, j int) bool {
+		return m.configs[i].notBefore.Before(m.configs[j].notBefore)
+	})
+	return m, nil
+}
+
+// Current returns the server config that is sent to clients.
+// This is the most recent server config that is valid.
+func (m *ServerConfigManager) Current() *ServerConfig {
+	now := m.now()
+	for i := len(m.configs) - 1; i >= 0; i-- {
+		scfg := m.configs[i]
+		if !scfg.notBefore.After(now) && !scfg.IsExpired(now) {
+			return scfg
+		}
+	}
+	// None of the server configs is valid (yet).
+	// Use the server config that becomes valid first.
+	for _, scfg := range m.configs {
+		if !scfg.IsExpired(now) {
+			return scfg
+		}
+	}
+	return m.configs[len(m.configs)-1]
+}
+
+// Get returns the server config with the given ID.
+// Server configs that are not valid yet are accepted as well, in order to tolerate clock skew between servers.
+// It returns nil if there's no such server config, or if it has already expired.
+func (m *ServerConfigManager) Get(id []byte) *ServerConfig {
+	now := m.now()
+	for _, scfg := range m.configs {
+		if bytes.Equal(scfg.ID, id) && !scfg.IsExpired(now) {
+			return scfg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServerConfigManager", func() {
+	getKey := func(id byte, notBefore, expiry time.Time) ServerConfigKey {
+		key := ServerConfigKey{NotBefore: notBefore, Expiry: expiry}
+		key.ID[0] = id
+		key.Orbit[0] = id
+		key.PrivateKey[0] = id
+		return key
+	}
+
+	It("generates a random server config if no keys are given", func() {
+		m, err := NewServerConfigManager(nil, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.configs).To(HaveLen(1))
+		scfg := m.Current()
+		Expect(scfg.ID).To(HaveLen(16))
+		Expect(scfg.IsExpired(time.Now().Add(100 * 365 * 24 * time.Hour))).To(BeFalse())
+		Expect(m.Get(scfg.ID)).To(Equal(scfg))
+	})
+
+	It("offers the key exchange algorithms and AEADs from the tls.Config", func() {
+		m, err := NewServerConfigManager(nil, nil, nil, &tls.Config{
+			CurvePreferences: []tls.CurveID{tls.CurveP256},
+			CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		msg, err := ParseHandshakeMessage(bytes.NewReader(m.Current().Get()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Data[TagKEXS]).To(Equal([]byte("P256")))
+		Expect(msg.Data[TagAEAD]).To(Equal([]byte("CC20AESG")))
+		Expect(msg.Data[TagPUBS]).To(HaveLen(3 + 65))
+	})
+
+	It("offers Curve25519 and P-256 by default", func() {
+		m, err := NewServerConfigManager(nil, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		msg, err := ParseHandshakeMessage(bytes.NewReader(m.Current().Get()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Data[TagKEXS]).To(Equal([]byte("C255P256")))
+	})
+
+	It("only offers P-256 if the key contains a P-256 private key", func() {
+		key := getKey(1, time.Now().Add(-time.Hour), time.Time{})
+		m, err := NewServerConfigManager([]ServerConfigKey{key}, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Current().getKEX(TagC255)).ToNot(BeNil())
+		Expect(m.Current().getKEX(TagP256)).To(BeNil())
+		key.P256PrivateKey[0] = 42
+		m, err = NewServerConfigManager([]ServerConfigKey{key}, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Current().getKEX(TagP256)).ToNot(BeNil())
+	})
+
+	It("errors if a key doesn't contain a private key for any of the preferred key exchange algorithms", func() {
+		keys := []ServerConfigKey{getKey(1, time.Now().Add(-time.Hour), time.Time{})}
+		_, err := NewServerConfigManager(keys, nil, nil, &tls.Config{CurvePreferences: []tls.CurveID{tls.CurveP256}})
+		Expect(err).To(MatchError("server config key doesn't contain a private key for any of the preferred key exchange algorithms"))
+	})
+
+	It("generates the same server config from the same key", func() {
+		keys := []ServerConfigKey{getKey(1, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))}
+		m1, err := NewServerConfigManager(keys, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		m2, err := NewServerConfigManager(keys, nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m1.Current().Get()).To(Equal(m2.Current().Get()))
+	})
+
+	It("shares the cookie keys", func() {
+		var cookieKey [32]byte
+		copy(cookieKey[:], "foobar")
+		keys := []ServerConfigKey{getKey(1, time.Now().Add(-time.Hour), time.Time{})}
+		m1, err := NewServerConfigManager(keys, [][32]byte{cookieKey}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		m2, err := NewServerConfigManager(keys, [][32]byte{cookieKey}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		token, err := m1.Current().cookieGenerator.NewToken(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = m2.Current().cookieGenerator.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("errors if a server config expires before it becomes valid", func() {
+		keys := []ServerConfigKey{getKey(1, time.Now(), time.Now().Add(-time.Hour))}
+		_, err := NewServerConfigManager(keys, nil, nil, nil)
+		Expect(err).To(MatchError("server config expires before it becomes valid"))
+	})
+
+	It("errors if all server configs have expired", func() {
+		keys := []ServerConfigKey{getKey(1, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))}
+		_, err := NewServerConfigManager(keys, nil, nil, nil)
+		Expect(err).To(MatchError(errNoValidServerConfig))
+	})
+
+	Context("rotating", func() {
+		var (
+			m   *ServerConfigManager
+			now time.Time
+		)
+
+		BeforeEach(func() {
+			now = time.Now()
+			keys := []ServerConfigKey{
+				getKey(2, now.Add(time.Hour), now.Add(3*time.Hour)),
+				getKey(1, now.Add(-time.Hour), now.Add(90*time.Minute)), // 30 minutes overlap
+			}
+			var err error
+			m, err = NewServerConfigManager(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("uses the most recent server config that is valid", func() {
+			Expect(m.Current().ID[0]).To(Equal(byte(1)))
+			m.now = func() time.Time { return now.Add(time.Hour) }
+			Expect(m.Current().ID[0]).To(Equal(byte(2)))
+		})
+
+		It("accepts older server configs until they expire", func() {
+			m.now = func() time.Time { return now.Add(80 * time.Minute) }
+			id := m.configs[0].ID
+			Expect(m.Get(id)).ToNot(BeNil())
+			m.now = func() time.Time { return now.Add(90 * time.Minute) }
+			Expect(m.Get(id)).To(BeNil())
+		})
+
+		It("accepts server configs that are not valid yet", func() {
+			Expect(m.Get(m.configs[1].ID)).To(Equal(m.configs[1]))
+		})
+
+		It("returns nil for unknown server config IDs", func() {
+			Expect(m.Get([]byte("foobar"))).To(BeNil())
+		})
+
+		It("uses the next server config if none is valid yet", func() {
+			m.configs = m.configs[1:]
+			Expect(m.Current().ID[0]).To(Equal(byte(2)))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package handshake
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 
@@ -42,4 +43,64 @@ var _ = Describe("ServerConfig", func() {
 		expected.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
 		Expect(scfg.Get()).To(Equal(expected.Bytes()))
 	})
+
+	It("offers multiple key exchange algorithms and AEADs", func() {
+		p256, err := crypto.NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		scfg, err := newServerConfig(
+			[]serverConfigKEX{{tag: TagP256, kex: p256}, {tag: TagC255, kex: kex}},
+			[]Tag{TagCC20, TagAESG},
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		msg, err := ParseHandshakeMessage(bytes.NewReader(scfg.Get()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Data[TagKEXS]).To(Equal([]byte("P256C255")))
+		Expect(msg.Data[TagAEAD]).To(Equal([]byte("CC20AESG")))
+		pubs := append([]byte{0x41, 0, 0}, p256.PublicKey()...)
+		pubs = append(pubs, 0x20, 0, 0)
+		pubs = append(pubs, kex.PublicKey()...)
+		Expect(msg.Data[TagPUBS]).To(Equal(pubs))
+		Expect(scfg.getKEX(TagP256)).To(Equal(p256))
+		Expect(scfg.getKEX(TagC255)).To(Equal(kex))
+		Expect(scfg.supportsAEAD(TagCC20)).To(BeTrue())
+		Expect(scfg.supportsAEAD(TagAESG)).To(BeTrue())
+	})
+
+	It("sets the expiry", func() {
+		scfg, err := NewServerConfig(kex, nil)
+		Expect(err).NotTo(HaveOccurred())
+		scfg.expiry = time.Unix(0x01020304, 0)
+		msg, err := ParseHandshakeMessage(bytes.NewReader(scfg.Get()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Data[TagEXPY]).To(Equal([]byte{0x4, 0x3, 0x2, 0x1, 0, 0, 0, 0}))
+	})
+
+	It("says if it is expired", func() {
+		scfg, err := NewServerConfig(kex, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scfg.IsExpired(time.Now())).To(BeFalse())
+		scfg.expiry = time.Now().Add(time.Hour)
+		Expect(scfg.IsExpired(time.Now())).To(BeFalse())
+		Expect(scfg.IsExpired(time.Now().Add(time.Hour))).To(BeTrue())
+	})
+
+	It("creates a server config from a key", func() {
+		key := &ServerConfigKey{
+			NotBefore: time.Now(),
+			Expiry:    time.Now().Add(time.Hour),
+		}
+		copy(key.ID[:], "foobar")
+		copy(key.Orbit[:], "raboof")
+		key.PrivateKey[0] = 42
+		key.P256PrivateKey[0] = 42
+		scfg, err := newServerConfigFromKey(key, newAlgorithmPreferences(nil), nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(scfg.ID).To(Equal(key.ID[:]))
+		Expect(scfg.obit).To(Equal(key.Orbit[:]))
+		Expect(scfg.getKEX(TagC255).PublicKey()).To(Equal(crypto.NewCurve25519KEXFromPrivateKey(key.PrivateKey).PublicKey()))
+		Expect(scfg.getKEX(TagP256).PublicKey()).To(Equal(crypto.NewP256KEXFromPrivateKey(key.P256PrivateKey).PublicKey()))
+		Expect(scfg.notBefore).To(Equal(key.NotBefore))
+		Expect(scfg.expiry).To(Equal(key.Expiry))
+	})
 })
@@ -31,6 +31,12 @@ const (
 	TagSVID Tag = 'S' + 'V'<<8 + 'I'<<16 + 'D'<<24
 	// TagTCID is truncation of the connection ID
 	TagTCID Tag = 'T' + 'C'<<8 + 'I'<<16 + 'D'<<24
+	// TagMPTH indicates support for multipath (unofficial tag by us)
+	TagMPTH Tag = 'M' + 'P'<<8 + 'T'<<16 + 'H'<<24
+	// TagFECS indicates support for forward error correction (unofficial tag by us)
+	TagFECS Tag = 'F' + 'E'<<8 + 'C'<<16 + 'S'<<24
+	// TagALPN are the application protocols offered by the client, or the protocol selected by the server (unofficial tag by us)
+	TagALPN Tag = 'A' + 'L'<<8 + 'P'<<16 + 'N'<<24
 	// TagPDMD is the proof demand
 	TagPDMD Tag = 'P' + 'D'<<8 + 'M'<<16 + 'D'<<24
 	// TagSRBF is the socket receive buffer
@@ -78,6 +84,14 @@ const (
 	TagAEAD Tag = 'A' + 'E'<<8 + 'A'<<16 + 'D'<<24
 	// TagPUBS is the public value for the KEX
 	TagPUBS Tag = 'P' + 'U'<<8 + 'B'<<16 + 'S'<<24
+	// TagC255 is the Curve25519 key exchange
+	TagC255 Tag = 'C' + '2'<<8 + '5'<<16 + '5'<<24
+	// TagP256 is the P-256 key exchange
+	TagP256 Tag = 'P' + '2'<<8 + '5'<<16 + '6'<<24
+	// TagAESG is AES-GCM with a 12 byte tag
+	TagAESG Tag = 'A' + 'E'<<8 + 'S'<<16 + 'G'<<24
+	// TagCC20 is ChaCha20-Poly1305 with a 12 byte tag
+	TagCC20 Tag = 'C' + 'C'<<8 + '2'<<16 + '0'<<24
 	// TagOBIT is the client orbit
 	TagOBIT Tag = 'O' + 'B'<<8 + 'I'<<16 + 'T'<<24
 	// TagEXPY is the server config expiry
@@ -17,6 +17,9 @@ const (
 	maxPacketSizeParameterID         transportParameterID = 0x5
 	statelessResetTokenParameterID   transportParameterID = 0x6
 	initialMaxStreamsUniParameterID  transportParameterID = 0x8
+	maxAckDelayParameterID           transportParameterID = 0xb
+	minAckDelayParameterID           transportParameterID = 0xde1a
+	enableFECParameterID             transportParameterID = 0xfec0
 )
 
 type transportParameter struct {
@@ -34,6 +34,24 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.OmitConnectionID).To(BeTrue())
 			})
 
+			It("reads if multipath is enabled", func() {
+				params, err := readHelloMap(map[Tag][]byte{TagMPTH: {1, 0, 0, 0}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.EnableMultipath).To(BeTrue())
+				params, err = readHelloMap(map[Tag][]byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.EnableMultipath).To(BeFalse())
+			})
+
+			It("reads if FEC is enabled", func() {
+				params, err := readHelloMap(map[Tag][]byte{TagFECS: {1, 0, 0, 0}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.EnableFEC).To(BeTrue())
+				params, err = readHelloMap(map[Tag][]byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.EnableFEC).To(BeFalse())
+			})
+
 			It("doesn't allow idle timeouts below the minimum remote idle timeout", func() {
 				t := 2 * time.Second
 				Expect(t).To(BeNumerically("<", protocol.MinRemoteIdleTimeout))
@@ -63,6 +81,18 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(err).To(MatchError(errMalformedTag))
 			})
 
+			It("errors when given an invalid MPTH value", func() {
+				values := map[Tag][]byte{TagMPTH: {1, 0, 0}} // 1 byte too short
+				_, err := readHelloMap(values)
+				Expect(err).To(MatchError(errMalformedTag))
+			})
+
+			It("errors when given an invalid FECS value", func() {
+				values := map[Tag][]byte{TagFECS: {1, 0, 0}} // 1 byte too short
+				_, err := readHelloMap(values)
+				Expect(err).To(MatchError(errMalformedTag))
+			})
+
 			It("errors when given an invalid ICSL value", func() {
 				values := map[Tag][]byte{TagICSL: {2, 0, 0}} // 1 byte too short
 				_, err := readHelloMap(values)
@@ -87,6 +117,8 @@ var _ = Describe("Transport Parameters", func() {
 				entryMap := params.getHelloMap()
 				Expect(entryMap).To(HaveLen(4))
 				Expect(entryMap).ToNot(HaveKey(TagTCID))
+				Expect(entryMap).ToNot(HaveKey(TagMPTH))
+				Expect(entryMap).ToNot(HaveKey(TagFECS))
 				Expect(entryMap).To(HaveKeyWithValue(TagSFCW, []byte{0xef, 0xbe, 0xad, 0xde}))
 				Expect(entryMap).To(HaveKeyWithValue(TagCFCW, []byte{0xad, 0xfb, 0xca, 0xde}))
 				Expect(entryMap).To(HaveKeyWithValue(TagICSL, []byte{0xad, 0xaa, 0xaa, 0xba}))
@@ -98,6 +130,18 @@ var _ = Describe("Transport Parameters", func() {
 				entryMap := params.getHelloMap()
 				Expect(entryMap).To(HaveKeyWithValue(TagTCID, []byte{0, 0, 0, 0}))
 			})
+
+			It("announces multipath support", func() {
+				params := &TransportParameters{EnableMultipath: true}
+				entryMap := params.getHelloMap()
+				Expect(entryMap).To(HaveKeyWithValue(TagMPTH, []byte{1, 0, 0, 0}))
+			})
+
+			It("announces FEC support", func() {
+				params := &TransportParameters{EnableFEC: true}
+				entryMap := params.getHelloMap()
+				Expect(entryMap).To(HaveKeyWithValue(TagFECS, []byte{1, 0, 0, 0}))
+			})
 		})
 	})
 
@@ -118,8 +162,11 @@ var _ = Describe("Transport Parameters", func() {
 				MaxUniStreams:               7331,
 				OmitConnectionID:            true,
 				IdleTimeout:                 42 * time.Second,
+				MaxAckDelay:                 37 * time.Millisecond,
+				MinAckDelay:                 time.Millisecond,
+				EnableFEC:                   true,
 			}
-			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, OmitConnectionID: true, IdleTimeout: 42s}"))
+			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, OmitConnectionID: true, IdleTimeout: 42s, MaxAckDelay: 37ms, MinAckDelay: 1ms, EnableFEC: true}"))
 		})
 
 		Context("parsing", func() {
@@ -145,6 +192,31 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.IdleTimeout).To(Equal(0x1337 * time.Second))
 				Expect(params.OmitConnectionID).To(BeFalse())
 				Expect(params.MaxPacketSize).To(Equal(protocol.ByteCount(0x7331)))
+				Expect(params.MaxAckDelay).To(BeZero())
+				Expect(params.MinAckDelay).To(BeZero())
+				Expect(params.EnableFEC).To(BeFalse())
+			})
+
+			It("reads the max_ack_delay and the min_ack_delay", func() {
+				parameters[maxAckDelayParameterID] = []byte{0x0, 0x42}
+				parameters[minAckDelayParameterID] = []byte{0x0, 0x0, 0x13, 0x37}
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.MaxAckDelay).To(Equal(0x42 * time.Millisecond))
+				Expect(params.MinAckDelay).To(Equal(0x1337 * time.Microsecond))
+			})
+
+			It("reads if FEC is enabled", func() {
+				parameters[enableFECParameterID] = []byte{}
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.EnableFEC).To(BeTrue())
+			})
+
+			It("rejects the parameters if enable_fec has the wrong length", func() {
+				parameters[enableFECParameterID] = []byte{0x1} // should be empty
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for enable_fec: 1 (expected empty)"))
 			})
 
 			It("saves if it should omit the connection ID", func() {
@@ -229,6 +301,18 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(err).To(MatchError("invalid value for max_packet_size: 1199 (minimum 1200)"))
 			})
 
+			It("rejects the parameters if max_ack_delay has the wrong length", func() {
+				parameters[maxAckDelayParameterID] = []byte{0x11} // should be 2 bytes
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for max_ack_delay: 1 (expected 2)"))
+			})
+
+			It("rejects the parameters if min_ack_delay has the wrong length", func() {
+				parameters[minAckDelayParameterID] = []byte{0x11, 0x22} // should be 4 bytes
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for min_ack_delay: 2 (expected 4)"))
+			})
+
 			It("ignores unknown parameters", func() {
 				parameters[1337] = []byte{42}
 				_, err := readTransportParameters(paramsMapToList(parameters))
@@ -273,6 +357,21 @@ var _ = Describe("Transport Parameters", func() {
 				values := paramsListToMap(params.getTransportParameters())
 				Expect(values).To(HaveKeyWithValue(omitConnectionIDParameterID, []byte{}))
 			})
+
+			It("sends the max_ack_delay and the min_ack_delay", func() {
+				params.MaxAckDelay = 0x1337 * time.Millisecond
+				params.MinAckDelay = 0xdecaf * time.Microsecond
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(8))
+				Expect(values).To(HaveKeyWithValue(maxAckDelayParameterID, []byte{0x13, 0x37}))
+				Expect(values).To(HaveKeyWithValue(minAckDelayParameterID, []byte{0x0, 0xd, 0xec, 0xaf}))
+			})
+
+			It("announces FEC support", func() {
+				params.EnableFEC = true
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveKeyWithValue(enableFECParameterID, []byte{}))
+			})
 		})
 	})
 })
@@ -28,6 +28,15 @@ type TransportParameters struct {
 
 	OmitConnectionID bool
 	IdleTimeout      time.Duration
+
+	MaxAckDelay time.Duration // only used for IETF QUIC
+	// MinAckDelay is only used for IETF QUIC.
+	// It is only set if the peer supports the ACK frequency extension.
+	MinAckDelay time.Duration
+
+	EnableMultipath bool // only used for gQUIC
+	// EnableFEC is set if the peer is able to recover lost packets using FEC frames.
+	EnableFEC bool
 }
 
 // readHelloMap reads the transport parameters from the tags sent in a gQUIC handshake message
@@ -40,6 +49,20 @@ func readHelloMap(tags map[Tag][]byte) (*TransportParameters, error) {
 		}
 		params.OmitConnectionID = (v == 0)
 	}
+	if value, ok := tags[TagMPTH]; ok {
+		v, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
+		if err != nil {
+			return nil, errMalformedTag
+		}
+		params.EnableMultipath = (v == 1)
+	}
+	if value, ok := tags[TagFECS]; ok {
+		v, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
+		if err != nil {
+			return nil, errMalformedTag
+		}
+		params.EnableFEC = (v == 1)
+	}
 	if value, ok := tags[TagMIDS]; ok {
 		v, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
 		if err != nil {
@@ -91,6 +114,12 @@ func (p *TransportParameters) getHelloMap() map[Tag][]byte {
 	if p.OmitConnectionID {
 		tags[TagTCID] = []byte{0, 0, 0, 0}
 	}
+	if p.EnableMultipath {
+		tags[TagMPTH] = []byte{1, 0, 0, 0}
+	}
+	if p.EnableFEC {
+		tags[TagFECS] = []byte{1, 0, 0, 0}
+	}
 	return tags
 }
 
@@ -146,6 +175,21 @@ func readTransportParameters(paramsList []transportParameter) (*TransportParamet
 				return nil, fmt.Errorf("invalid value for max_packet_size: %d (minimum 1200)", maxPacketSize)
 			}
 			params.MaxPacketSize = maxPacketSize
+		case maxAckDelayParameterID:
+			if len(p.Value) != 2 {
+				return nil, fmt.Errorf("wrong length for max_ack_delay: %d (expected 2)", len(p.Value))
+			}
+			params.MaxAckDelay = time.Duration(binary.BigEndian.Uint16(p.Value)) * time.Millisecond
+		case minAckDelayParameterID:
+			if len(p.Value) != 4 {
+				return nil, fmt.Errorf("wrong length for min_ack_delay: %d (expected 4)", len(p.Value))
+			}
+			params.MinAckDelay = time.Duration(binary.BigEndian.Uint32(p.Value)) * time.Microsecond
+		case enableFECParameterID:
+			if len(p.Value) != 0 {
+				return nil, fmt.Errorf("wrong length for enable_fec: %d (expected empty)", len(p.Value))
+			}
+			params.EnableFEC = true
 		}
 	}
 
@@ -181,11 +225,24 @@ func (p *TransportParameters) getTransportParameters() []transportParameter {
 	if p.OmitConnectionID {
 		params = append(params, transportParameter{omitConnectionIDParameterID, []byte{}})
 	}
+	if p.MaxAckDelay != 0 {
+		maxAckDelay := make([]byte, 2)
+		binary.BigEndian.PutUint16(maxAckDelay, uint16(p.MaxAckDelay/time.Millisecond))
+		params = append(params, transportParameter{maxAckDelayParameterID, maxAckDelay})
+	}
+	if p.MinAckDelay != 0 {
+		minAckDelay := make([]byte, 4)
+		binary.BigEndian.PutUint32(minAckDelay, uint32(p.MinAckDelay/time.Microsecond))
+		params = append(params, transportParameter{minAckDelayParameterID, minAckDelay})
+	}
+	if p.EnableFEC {
+		params = append(params, transportParameter{enableFECParameterID, []byte{}})
+	}
 	return params
 }
 
 // String returns a string representation, intended for logging.
 // It should only used for IETF QUIC.
 func (p *TransportParameters) String() string {
-	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, OmitConnectionID: %t, IdleTimeout: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.OmitConnectionID, p.IdleTimeout)
+	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, OmitConnectionID: %t, IdleTimeout: %s, MaxAckDelay: %s, MinAckDelay: %s, EnableFEC: %t}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.OmitConnectionID, p.IdleTimeout, p.MaxAckDelay, p.MinAckDelay, p.EnableFEC)
 }
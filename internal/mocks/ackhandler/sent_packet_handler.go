@@ -109,6 +109,18 @@ func (mr *MockSentPacketHandlerMockRecorder) OnAlarm() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnAlarm", reflect.TypeOf((*MockSentPacketHandler)(nil).OnAlarm))
 }
 
+// QueueAllForRetransmission mocks base method
+func (m *MockSentPacketHandler) QueueAllForRetransmission() error {
+	ret := m.ctrl.Call(m, "QueueAllForRetransmission")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueAllForRetransmission indicates an expected call of QueueAllForRetransmission
+func (mr *MockSentPacketHandlerMockRecorder) QueueAllForRetransmission() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueAllForRetransmission", reflect.TypeOf((*MockSentPacketHandler)(nil).QueueAllForRetransmission))
+}
+
 // ReceivedAck mocks base method
 func (m *MockSentPacketHandler) ReceivedAck(arg0 *wire.AckFrame, arg1 protocol.PacketNumber, arg2 protocol.EncryptionLevel, arg3 time.Time) error {
 	ret := m.ctrl.Call(m, "ReceivedAck", arg0, arg1, arg2, arg3)
@@ -85,3 +85,9 @@ const MinInitialPacketSize = 1200
 // * one failure due to an incorrect or missing source-address token
 // * one failure due the server's certificate chain being unavailable and the server being unwilling to send it without a valid source-address token
 const MaxClientHellos = 3
+
+// A PathID identifies a path of a multipath connection (only used for gQUIC)
+type PathID uint8
+
+// InitialPathID is the PathID of the path that the connection was established on
+const InitialPathID PathID = 0
@@ -63,12 +63,35 @@ const DefaultMaxIncomingStreams = 100
 // DefaultMaxIncomingUniStreams is the maximum number of unidirectional streams that a peer may open
 const DefaultMaxIncomingUniStreams = 100
 
+// DefaultMaxAckDelay is the default maximum delay that is applied to an ACK for a retransmittable packet
+const DefaultMaxAckDelay = 25 * time.Millisecond
+
+// DefaultRetransmittablePacketsBeforeAck is the default number of retransmittable packets that an ACK is sent for, when doing ACK decimation
+const DefaultRetransmittablePacketsBeforeAck = 10
+
+// MinAckDelay is the minimum ACK delay that the peer may request in an ACK_FREQUENCY frame.
+// It is sent in the min_ack_delay transport parameter.
+const MinAckDelay = time.Millisecond
+
 // MaxStreamsMultiplier is the slack the client is allowed for the maximum number of streams per connection, needed e.g. when packets are out of order or dropped. The minimum of this procentual increase and the absolute increment specified by MaxStreamsMinimumIncrement is used.
 const MaxStreamsMultiplier = 1.1
 
 // MaxStreamsMinimumIncrement is the slack the client is allowed for the maximum number of streams per connection, needed e.g. when packets are out of order or dropped. The minimum of this absolute increment and the procentual increase specified by MaxStreamsMultiplier is used.
 const MaxStreamsMinimumIncrement = 10
 
+// MaxPaths is the maximum number of paths (including the initial path) a multipath session uses.
+const MaxPaths = 4
+
+// MaxFECGroupSize is the maximum number of packets protected by a single FEC frame.
+const MaxFECGroupSize = 32
+
+// MaxFECGroupSpan is the maximum difference between the packet numbers of the first and the last packet in an FEC group.
+const MaxFECGroupSpan = 63
+
+// FECPacketSizeReduction is the number of bytes that packets protected by FEC are shorter than the maximum packet size.
+// This makes sure that the FEC frame protecting these packets fits into a single packet.
+const FECPacketSizeReduction = 64
+
 // MaxSessionUnprocessedPackets is the max number of packets stored in each session that are not yet processed.
 const MaxSessionUnprocessedPackets = DefaultMaxCongestionWindow
 
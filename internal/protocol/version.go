@@ -82,6 +82,12 @@ func (vn VersionNumber) UsesStopWaitingFrames() bool {
 	return vn == Version39
 }
 
+// UsesProbeTimeouts tells if this version uses probe timeouts and packet-threshold loss detection,
+// instead of gQUIC's retransmission timeouts
+func (vn VersionNumber) UsesProbeTimeouts() bool {
+	return vn == VersionTLS
+}
+
 // StreamContributesToConnectionFlowControl says if a stream contributes to connection-level flow control
 func (vn VersionNumber) StreamContributesToConnectionFlowControl(id StreamID) bool {
 	if id == vn.CryptoStreamID() {
@@ -75,6 +75,11 @@ var _ = Describe("Version", func() {
 		Expect(VersionTLS.UsesStopWaitingFrames()).To(BeFalse())
 	})
 
+	It("tells if a version uses probe timeouts", func() {
+		Expect(Version39.UsesProbeTimeouts()).To(BeFalse())
+		Expect(VersionTLS.UsesProbeTimeouts()).To(BeTrue())
+	})
+
 	It("says if a stream contributes to connection-level flowcontrol, for gQUIC", func() {
 		Expect(Version39.StreamContributesToConnectionFlowControl(1)).To(BeFalse())
 		Expect(Version39.StreamContributesToConnectionFlowControl(2)).To(BeTrue())
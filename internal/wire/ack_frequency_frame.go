@@ -0,0 +1,55 @@
+package wire
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// An AckFrequencyFrame is an ACK_FREQUENCY frame.
+// It is used to ask the peer to change the rate at which it sends ACKs.
+type AckFrequencyFrame struct {
+	SequenceNumber    uint64
+	PacketTolerance   uint64
+	UpdateMaxAckDelay time.Duration
+}
+
+// parseAckFrequencyFrame parses an ACK_FREQUENCY frame
+func parseAckFrequencyFrame(r *bytes.Reader, _ protocol.VersionNumber) (*AckFrequencyFrame, error) {
+	// read the Type byte
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+	seq, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	tolerance, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	delay, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	return &AckFrequencyFrame{
+		SequenceNumber:    seq,
+		PacketTolerance:   tolerance,
+		UpdateMaxAckDelay: time.Duration(delay) * time.Microsecond,
+	}, nil
+}
+
+func (f *AckFrequencyFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	b.WriteByte(0xaf)
+	utils.WriteVarInt(b, f.SequenceNumber)
+	utils.WriteVarInt(b, f.PacketTolerance)
+	utils.WriteVarInt(b, uint64(f.UpdateMaxAckDelay/time.Microsecond))
+	return nil
+}
+
+// Length of a written frame
+func (f *AckFrequencyFrame) Length(protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(f.SequenceNumber) + utils.VarIntLen(f.PacketTolerance) + utils.VarIntLen(uint64(f.UpdateMaxAckDelay/time.Microsecond))
+}
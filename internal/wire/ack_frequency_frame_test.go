@@ -0,0 +1,69 @@
+package wire
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ACK_FREQUENCY frame", func() {
+	Context("parsing", func() {
+		It("accepts sample frame", func() {
+			data := []byte{0xaf}
+			data = append(data, encodeVarInt(0x42)...)    // sequence number
+			data = append(data, encodeVarInt(0x1337)...)  // packet tolerance
+			data = append(data, encodeVarInt(0xdecaf)...) // update max ack delay
+			b := bytes.NewReader(data)
+			f, err := parseAckFrequencyFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.SequenceNumber).To(BeEquivalentTo(0x42))
+			Expect(f.PacketTolerance).To(BeEquivalentTo(0x1337))
+			Expect(f.UpdateMaxAckDelay).To(Equal(0xdecaf * time.Microsecond))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0xaf}
+			data = append(data, encodeVarInt(0x42)...)
+			data = append(data, encodeVarInt(0x1337)...)
+			data = append(data, encodeVarInt(0xdecaf)...)
+			_, err := parseAckFrequencyFrame(bytes.NewReader(data), protocol.VersionWhatever)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseAckFrequencyFrame(bytes.NewReader(data[0:i]), protocol.VersionWhatever)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("writing", func() {
+		It("writes a sample frame", func() {
+			b := &bytes.Buffer{}
+			frame := AckFrequencyFrame{
+				SequenceNumber:    0x42,
+				PacketTolerance:   0x1337,
+				UpdateMaxAckDelay: 0xdecaf * time.Microsecond,
+			}
+			err := frame.Write(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			expected := []byte{0xaf}
+			expected = append(expected, encodeVarInt(0x42)...)
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0xdecaf)...)
+			Expect(b.Bytes()).To(Equal(expected))
+		})
+
+		It("has the correct min length", func() {
+			frame := AckFrequencyFrame{
+				SequenceNumber:    0x42,
+				PacketTolerance:   0x1337,
+				UpdateMaxAckDelay: 0xdecaf * time.Microsecond,
+			}
+			Expect(frame.Length(protocol.VersionWhatever)).To(Equal(1 + utils.VarIntLen(0x42) + utils.VarIntLen(0x1337) + utils.VarIntLen(0xdecaf)))
+		})
+	})
+})
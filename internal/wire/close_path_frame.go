@@ -0,0 +1,36 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A ClosePathFrame is a CLOSE_PATH frame (only used for gQUIC multipath)
+type ClosePathFrame struct {
+	PathID protocol.PathID
+}
+
+// parseClosePathFrame parses a CLOSE_PATH frame
+func parseClosePathFrame(r *bytes.Reader, _ protocol.VersionNumber) (*ClosePathFrame, error) {
+	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+		return nil, err
+	}
+	pathID, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	return &ClosePathFrame{PathID: protocol.PathID(pathID)}, nil
+}
+
+// Write writes a CLOSE_PATH frame
+func (f *ClosePathFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	b.WriteByte(0x08)
+	b.WriteByte(uint8(f.PathID))
+	return nil
+}
+
+// Length of a written frame
+func (f *ClosePathFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return 2
+}
@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A FECFrame is an FEC frame.
+// It contains the XOR of a group of packets, such that a single lost packet of this group can be recovered.
+type FECFrame struct {
+	// PacketNumbers are the packet numbers of the protected packets, in ascending order
+	PacketNumbers []protocol.PacketNumber
+	Data          []byte
+}
+
+// parseFECFrame parses an FEC frame
+func parseFECFrame(r *bytes.Reader, _ protocol.VersionNumber) (*FECFrame, error) {
+	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+		return nil, err
+	}
+	numPackets, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if numPackets == 0 || numPackets > protocol.MaxFECGroupSize {
+		return nil, errors.New("invalid number of packets")
+	}
+	frame := &FECFrame{PacketNumbers: make([]protocol.PacketNumber, numPackets)}
+	pn, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	frame.PacketNumbers[0] = protocol.PacketNumber(pn)
+	for i := 1; i < int(numPackets); i++ {
+		gap, err := utils.ReadVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		frame.PacketNumbers[i] = frame.PacketNumbers[i-1] + protocol.PacketNumber(gap) + 1
+	}
+	dataLen, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if dataLen > uint64(r.Len()) {
+		return nil, io.EOF
+	}
+	frame.Data = make([]byte, dataLen)
+	if _, err := io.ReadFull(r, frame.Data); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Write writes an FEC frame
+func (f *FECFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	if len(f.PacketNumbers) == 0 {
+		return errors.New("FEC frame doesn't protect any packets")
+	}
+	if version.UsesIETFFrameFormat() {
+		b.WriteByte(0xfe)
+	} else {
+		b.WriteByte(0x09)
+	}
+	utils.WriteVarInt(b, uint64(len(f.PacketNumbers)))
+	utils.WriteVarInt(b, uint64(f.PacketNumbers[0]))
+	for i := 1; i < len(f.PacketNumbers); i++ {
+		utils.WriteVarInt(b, uint64(f.PacketNumbers[i]-f.PacketNumbers[i-1]-1))
+	}
+	utils.WriteVarInt(b, uint64(len(f.Data)))
+	b.Write(f.Data)
+	return nil
+}
+
+// Length of a written frame
+func (f *FECFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	length := 1 + utils.VarIntLen(uint64(len(f.PacketNumbers)))
+	if len(f.PacketNumbers) > 0 {
+		length += utils.VarIntLen(uint64(f.PacketNumbers[0]))
+	}
+	for i := 1; i < len(f.PacketNumbers); i++ {
+		length += utils.VarIntLen(uint64(f.PacketNumbers[i] - f.PacketNumbers[i-1] - 1))
+	}
+	return length + utils.VarIntLen(uint64(len(f.Data))) + protocol.ByteCount(len(f.Data))
+}
@@ -0,0 +1,107 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FEC frame", func() {
+	Context("parsing", func() {
+		It("accepts sample frame", func() {
+			data := []byte{0x09}
+			data = append(data, encodeVarInt(3)...)      // number of packets
+			data = append(data, encodeVarInt(0x1337)...) // first packet number
+			data = append(data, encodeVarInt(0)...)      // gap
+			data = append(data, encodeVarInt(1)...)      // gap
+			data = append(data, encodeVarInt(6)...)      // data length
+			data = append(data, []byte("foobar")...)
+			b := bytes.NewReader(data)
+			f, err := parseFECFrame(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.PacketNumbers).To(Equal([]protocol.PacketNumber{0x1337, 0x1338, 0x133a}))
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors when the frame doesn't protect any packets", func() {
+			data := []byte{0x09}
+			data = append(data, encodeVarInt(0)...)
+			_, err := parseFECFrame(bytes.NewReader(data), versionBigEndian)
+			Expect(err).To(MatchError("invalid number of packets"))
+		})
+
+		It("errors when the frame protects too many packets", func() {
+			data := []byte{0x09}
+			data = append(data, encodeVarInt(protocol.MaxFECGroupSize+1)...)
+			_, err := parseFECFrame(bytes.NewReader(data), versionBigEndian)
+			Expect(err).To(MatchError("invalid number of packets"))
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x09}
+			data = append(data, encodeVarInt(2)...)
+			data = append(data, encodeVarInt(0x1337)...)
+			data = append(data, encodeVarInt(0)...)
+			data = append(data, encodeVarInt(6)...)
+			data = append(data, []byte("foobar")...)
+			_, err := parseFECFrame(bytes.NewReader(data), versionBigEndian)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseFECFrame(bytes.NewReader(data[0:i]), versionBigEndian)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("writing", func() {
+		It("writes a sample frame, for gQUIC", func() {
+			b := &bytes.Buffer{}
+			frame := FECFrame{
+				PacketNumbers: []protocol.PacketNumber{0x1337, 0x1338, 0x133a},
+				Data:          []byte("foobar"),
+			}
+			err := frame.Write(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			expected := []byte{0x09}
+			expected = append(expected, encodeVarInt(3)...)
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0)...)
+			expected = append(expected, encodeVarInt(1)...)
+			expected = append(expected, encodeVarInt(6)...)
+			expected = append(expected, []byte("foobar")...)
+			Expect(b.Bytes()).To(Equal(expected))
+		})
+
+		It("writes a sample frame, for IETF QUIC", func() {
+			b := &bytes.Buffer{}
+			frame := FECFrame{
+				PacketNumbers: []protocol.PacketNumber{0x42},
+				Data:          []byte("foobar"),
+			}
+			err := frame.Write(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Bytes()[0]).To(BeEquivalentTo(0xfe))
+		})
+
+		It("errors when writing a frame that doesn't protect any packets", func() {
+			frame := FECFrame{Data: []byte("foobar")}
+			err := frame.Write(&bytes.Buffer{}, versionBigEndian)
+			Expect(err).To(MatchError("FEC frame doesn't protect any packets"))
+		})
+
+		It("has the correct length", func() {
+			frame := FECFrame{
+				PacketNumbers: []protocol.PacketNumber{0x1337, 0x1338, 0x133a},
+				Data:          []byte("foobar"),
+			}
+			Expect(frame.Length(versionBigEndian)).To(Equal(1 + 1 + utils.VarIntLen(0x1337) + 1 + 1 + 1 + 6))
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionBigEndian)).To(Succeed())
+			Expect(frame.Length(versionBigEndian)).To(BeEquivalentTo(b.Len()))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/qerr"
@@ -143,6 +144,24 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame).To(Equal(f))
 		})
 
+		It("unpacks CLOSE_PATH frames", func() {
+			f := &ClosePathFrame{PathID: 1}
+			err := f.Write(buf, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks FEC frames", func() {
+			f := &FECFrame{PacketNumbers: []protocol.PacketNumber{3, 4}, Data: []byte("foobar")}
+			err := f.Write(buf, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks ACK frames", func() {
 			f := &AckFrame{
 				LargestAcked: 0x13,
@@ -172,6 +191,8 @@ var _ = Describe("Frame parsing", func() {
 				0x04: qerr.InvalidWindowUpdateData,
 				0x05: qerr.InvalidBlockedData,
 				0x06: qerr.InvalidStopWaitingData,
+				0x08: qerr.InvalidFrameData,
+				0x09: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), &Header{PacketNumberLen: 2}, versionBigEndian)
 				Expect(err).To(HaveOccurred())
@@ -295,6 +316,30 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*AckFrame).LargestAcked).To(Equal(protocol.PacketNumber(0x13)))
 		})
 
+		It("unpacks FEC frames", func() {
+			f := &FECFrame{PacketNumbers: []protocol.PacketNumber{3, 4}, Data: []byte("foobar")}
+			buf := &bytes.Buffer{}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks ACK_FREQUENCY frames", func() {
+			f := &AckFrequencyFrame{
+				SequenceNumber:    3,
+				PacketTolerance:   20,
+				UpdateMaxAckDelay: 50 * time.Millisecond,
+			}
+			buf := &bytes.Buffer{}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("errors on invalid type", func() {
 			_, err := ParseNextFrame(bytes.NewReader([]byte{0xf}), nil, versionIETFFrames)
 			Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0xf"))
@@ -313,6 +358,8 @@ var _ = Describe("Frame parsing", func() {
 				0x0c: qerr.InvalidFrameData,
 				0x0e: qerr.InvalidAckData,
 				0x10: qerr.InvalidStreamData,
+				0xaf: qerr.InvalidFrameData,
+				0xfe: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), nil, versionIETFFrames)
 				Expect(err).To(HaveOccurred())
@@ -23,6 +23,7 @@ type Header struct {
 	VersionFlag          bool
 	ResetFlag            bool
 	DiversificationNonce []byte
+	PathID               protocol.PathID // only written and parsed for packets sent on an additional path of a multipath session
 
 	// only needed for the IETF Header
 	Type         protocol.PacketType
@@ -29,8 +29,10 @@ var _ = Describe("Header", func() {
 				PacketNumberLen: protocol.PacketNumberLen2,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			b := bytes.NewReader(buf.Bytes())
+			hdr, err := ParseHeaderSentByClient(b)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.ParsePacketNumber(b, buf.Bytes()[0])).To(Succeed())
 			Expect(hdr.KeyPhase).To(BeEquivalentTo(1))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
 			Expect(hdr.isPublicHeader).To(BeFalse())
@@ -45,8 +47,10 @@ var _ = Describe("Header", func() {
 				Version:      0x1234,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			b := bytes.NewReader(buf.Bytes())
+			hdr, err := ParseHeaderSentByClient(b)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.ParsePacketNumber(b, buf.Bytes()[0])).To(Succeed())
 			Expect(hdr.Type).To(Equal(protocol.PacketType0RTT))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
 			Expect(hdr.isPublicHeader).To(BeFalse())
@@ -55,12 +55,6 @@ func parseLongHeader(b *bytes.Reader, sentBy protocol.Perspective, typeByte byte
 		return h, nil
 	}
 	h.IsLongHeader = true
-	pn, err := utils.BigEndian.ReadUint32(b)
-	if err != nil {
-		return nil, err
-	}
-	h.PacketNumber = protocol.PacketNumber(pn)
-	h.PacketNumberLen = protocol.PacketNumberLen4
 	h.Type = protocol.PacketType(typeByte & 0x7f)
 	if sentBy == protocol.PerspectiveClient && (h.Type != protocol.PacketTypeInitial && h.Type != protocol.PacketTypeHandshake && h.Type != protocol.PacketType0RTT) {
 		return nil, qerr.Error(qerr.InvalidPacketHeader, fmt.Sprintf("Received packet with invalid packet type: %d", h.Type))
@@ -85,6 +79,28 @@ func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	if typeByte&0x18 != 0x10 {
 		return nil, errors.New("invalid bit 4 and 5")
 	}
+	// The key phase and the packet number length are protected by header protection.
+	// They are parsed by ParsePacketNumber, after header protection was removed.
+	return &Header{
+		OmitConnectionID: omitConnID,
+		ConnectionID:     protocol.ConnectionID(connID),
+	}, nil
+}
+
+// ParsePacketNumber parses the packet number of an IETF draft header.
+// It must be called after header protection was removed.
+// typeByte is the unprotected first byte of the header.
+func (h *Header) ParsePacketNumber(b *bytes.Reader, typeByte byte) error {
+	if h.IsLongHeader {
+		pn, err := utils.BigEndian.ReadUint32(b)
+		if err != nil {
+			return err
+		}
+		h.PacketNumber = protocol.PacketNumber(pn)
+		h.PacketNumberLen = protocol.PacketNumberLen4
+		return nil
+	}
+
 	var pnLen protocol.PacketNumberLen
 	switch typeByte & 0x7 {
 	case 0x0:
@@ -94,19 +110,16 @@ func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	case 0x2:
 		pnLen = protocol.PacketNumberLen4
 	default:
-		return nil, errors.New("invalid short header type")
+		return errors.New("invalid short header type")
 	}
 	pn, err := utils.BigEndian.ReadUintN(b, uint8(pnLen))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &Header{
-		KeyPhase:         int(typeByte&0x20) >> 5,
-		OmitConnectionID: omitConnID,
-		ConnectionID:     protocol.ConnectionID(connID),
-		PacketNumber:     protocol.PacketNumber(pn),
-		PacketNumberLen:  pnLen,
-	}, nil
+	h.KeyPhase = int(typeByte&0x20) >> 5
+	h.PacketNumber = protocol.PacketNumber(pn)
+	h.PacketNumberLen = pnLen
+	return nil
 }
 
 // writeHeader writes the Header.
@@ -67,10 +67,20 @@ var _ = Describe("IETF draft Header", func() {
 				Expect(h.IsLongHeader).To(BeTrue())
 				Expect(h.OmitConnectionID).To(BeFalse())
 				Expect(h.ConnectionID).To(Equal(protocol.ConnectionID(0xdeadbeefcafe1337)))
-				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
-				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
 				Expect(h.Version).To(Equal(protocol.VersionNumber(0x1020304)))
 				Expect(h.IsVersionNegotiation).To(BeFalse())
+				Expect(b.Len()).To(Equal(4))
+			})
+
+			It("doesn't parse the packet number, before header protection is removed", func() {
+				b := bytes.NewReader(generatePacket(protocol.PacketTypeInitial))
+				h, err := parseHeader(b, protocol.PerspectiveClient)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.PacketNumber).To(BeZero())
+				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLenInvalid))
+				Expect(h.ParsePacketNumber(b, 0x80^uint8(protocol.PacketTypeInitial))).To(Succeed())
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
+				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
 				Expect(b.Len()).To(BeZero())
 			})
 
@@ -105,10 +115,16 @@ var _ = Describe("IETF draft Header", func() {
 
 			It("errors on EOF", func() {
 				data := generatePacket(protocol.PacketTypeInitial)
-				for i := 0; i < len(data); i++ {
+				for i := 0; i < len(data)-4; i++ {
 					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient)
 					Expect(err).To(Equal(io.EOF))
 				}
+				for i := len(data) - 4; i < len(data); i++ {
+					b := bytes.NewReader(data[:i])
+					h, err := parseHeader(b, protocol.PerspectiveClient)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(h.ParsePacketNumber(b, data[0])).To(Equal(io.EOF))
+				}
 			})
 		})
 
@@ -122,6 +138,7 @@ var _ = Describe("IETF draft Header", func() {
 				b := bytes.NewReader(data)
 				h, err := parseHeader(b, protocol.PerspectiveClient)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(Succeed())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(0))
 				Expect(h.OmitConnectionID).To(BeFalse())
@@ -139,6 +156,7 @@ var _ = Describe("IETF draft Header", func() {
 				b := bytes.NewReader(data)
 				h, err := parseHeader(b, protocol.PerspectiveClient)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(Succeed())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(1))
 				Expect(b.Len()).To(BeZero())
@@ -152,6 +170,7 @@ var _ = Describe("IETF draft Header", func() {
 				b := bytes.NewReader(data)
 				h, err := parseHeader(b, protocol.PerspectiveClient)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(Succeed())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.OmitConnectionID).To(BeTrue())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x21)))
@@ -167,6 +186,7 @@ var _ = Describe("IETF draft Header", func() {
 				b := bytes.NewReader(data)
 				h, err := parseHeader(b, protocol.PerspectiveClient)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(Succeed())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
 				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen2))
@@ -181,6 +201,7 @@ var _ = Describe("IETF draft Header", func() {
 				b := bytes.NewReader(data)
 				h, err := parseHeader(b, protocol.PerspectiveClient)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(Succeed())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdeadbeef)))
 				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
@@ -193,10 +214,27 @@ var _ = Describe("IETF draft Header", func() {
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // connection ID
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
-				for i := 0; i < len(data); i++ {
+				for i := 0; i < len(data)-4; i++ {
 					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient)
 					Expect(err).To(Equal(io.EOF))
 				}
+				for i := len(data) - 4; i < len(data); i++ {
+					b := bytes.NewReader(data[:i])
+					h, err := parseHeader(b, protocol.PerspectiveClient)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(h.ParsePacketNumber(b, data[0])).To(Equal(io.EOF))
+				}
+			})
+
+			It("errors on an invalid packet number length", func() {
+				data := []byte{
+					0x10 ^ 0x40 ^ 0x3,
+					0xde, 0xad, 0xbe, 0xef, // packet number
+				}
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, protocol.PerspectiveClient)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.ParsePacketNumber(b, data[0])).To(MatchError("invalid short header type"))
 			})
 		})
 	})
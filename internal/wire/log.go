@@ -22,6 +22,8 @@ func LogFrame(frame Frame, sent bool) {
 		}
 	case *AckFrame:
 		utils.Debugf("\t%s &wire.AckFrame{LargestAcked: 0x%x, LowestAcked: 0x%x, AckRanges: %#v, DelayTime: %s}", dir, f.LargestAcked, f.LowestAcked, f.AckRanges, f.DelayTime.String())
+	case *FECFrame:
+		utils.Debugf("\t%s &wire.FECFrame{PacketNumbers: %#x, Data length: 0x%x}", dir, f.PacketNumbers, len(f.Data))
 	default:
 		utils.Debugf("\t%s %#v", dir, frame)
 	}
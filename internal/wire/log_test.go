@@ -65,6 +65,15 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.Bytes()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x1337, LowestAcked: 0x42, AckRanges: []wire.AckRange(nil), DelayTime: 1ms}\n"))
 	})
 
+	It("logs FEC frames", func() {
+		frame := &FECFrame{
+			PacketNumbers: []protocol.PacketNumber{0x41, 0x42},
+			Data:          bytes.Repeat([]byte{'f'}, 0x100),
+		}
+		LogFrame(frame, true)
+		Expect(buf.Bytes()).To(ContainSubstring("\t-> &wire.FECFrame{PacketNumbers: [0x41 0x42], Data length: 0x100}\n"))
+	})
+
 	It("logs incoming StopWaiting frames", func() {
 		frame := &StopWaitingFrame{
 			LeastUnacked: 0x1337,
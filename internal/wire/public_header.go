@@ -52,6 +52,9 @@ func (h *Header) writePublicHeader(b *bytes.Buffer, pers protocol.Perspective, _
 		case protocol.PacketNumberLen6:
 			publicFlagByte |= 0x30
 		}
+		if h.PathID != protocol.InitialPathID {
+			publicFlagByte |= 0x40
+		}
 	}
 	b.WriteByte(publicFlagByte)
 
@@ -69,6 +72,9 @@ func (h *Header) writePublicHeader(b *bytes.Buffer, pers protocol.Perspective, _
 		return nil
 	}
 
+	if h.PathID != protocol.InitialPathID {
+		b.WriteByte(uint8(h.PathID))
+	}
 	switch h.PacketNumberLen {
 	case protocol.PacketNumberLen1:
 		b.WriteByte(uint8(h.PacketNumber))
@@ -177,6 +183,18 @@ func parsePublicHeader(b *bytes.Reader, packetSentBy protocol.Perspective) (*Hea
 		header.Version = protocol.VersionNumber(versionTag)
 	}
 
+	// Path ID (optional)
+	if publicFlagByte&0x40 > 0 && header.hasPacketNumber(packetSentBy) {
+		pathID, err := b.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if pathID == 0 {
+			return nil, qerr.Error(qerr.BadMultipathFlag, "path ID flag set for the initial path")
+		}
+		header.PathID = protocol.PathID(pathID)
+	}
+
 	// Packet number
 	if header.hasPacketNumber(packetSentBy) {
 		packetNumber, err := utils.BigEndian.ReadUintN(b, uint8(header.PacketNumberLen))
@@ -204,6 +222,9 @@ func (h *Header) getPublicHeaderLength(pers protocol.Perspective) (protocol.Byte
 			return 0, errPacketNumberLenNotSet
 		}
 		length += protocol.ByteCount(h.PacketNumberLen)
+		if h.PathID != protocol.InitialPathID {
+			length++ // 1 byte for the path ID
+		}
 	}
 	if !h.OmitConnectionID {
 		length += 8 // 8 bytes for the connection ID
@@ -237,5 +258,9 @@ func (h *Header) logPublicHeader() {
 	if h.Version != 0 {
 		ver = h.Version.String()
 	}
+	if h.PathID != protocol.InitialPathID {
+		utils.Debugf("   Public Header{ConnectionID: %s, PathID: %d, PacketNumber: %#x, PacketNumberLen: %d, Version: %s, DiversificationNonce: %#v}", connID, h.PathID, h.PacketNumber, h.PacketNumberLen, ver, h.DiversificationNonce)
+		return
+	}
 	utils.Debugf("   Public Header{ConnectionID: %s, PacketNumber: %#x, PacketNumberLen: %d, Version: %s, DiversificationNonce: %#v}", connID, h.PacketNumber, h.PacketNumberLen, ver, h.DiversificationNonce)
 }
@@ -169,6 +169,38 @@ var _ = Describe("Public Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 		})
+
+		Context("path IDs", func() {
+			It("reads the path ID", func() {
+				b := bytes.NewReader([]byte{0x48, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x3, 0xde})
+				hdr, err := parsePublicHeader(b, protocol.PerspectiveClient)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.PathID).To(Equal(protocol.PathID(3)))
+				Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0xde)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("uses the initial path if the path ID flag is not set", func() {
+				b := bytes.NewReader([]byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0xde})
+				hdr, err := parsePublicHeader(b, protocol.PerspectiveClient)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.PathID).To(Equal(protocol.InitialPathID))
+			})
+
+			It("rejects the path ID of the initial path", func() {
+				b := bytes.NewReader([]byte{0x48, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x0, 0xde})
+				_, err := parsePublicHeader(b, protocol.PerspectiveClient)
+				Expect(err).To(MatchError(qerr.Error(qerr.BadMultipathFlag, "path ID flag set for the initial path")))
+			})
+
+			It("errors on EOF", func() {
+				data := []byte{0x48, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x3, 0xde}
+				for i := range data {
+					_, err := parsePublicHeader(bytes.NewReader(data[:i]), protocol.PerspectiveServer)
+					Expect(err).To(HaveOccurred())
+				}
+			})
+		})
 	})
 
 	Context("when writing", func() {
@@ -196,6 +228,19 @@ var _ = Describe("Public Header", func() {
 			Expect(b.Bytes()).To(Equal([]byte{0x38, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x0, 0x0, 0x0, 0x0, 0x13, 0x37}))
 		})
 
+		It("writes the path ID", func() {
+			b := &bytes.Buffer{}
+			hdr := Header{
+				ConnectionID:    0x4cfa9f9b668619f6,
+				PathID:          3,
+				PacketNumber:    0x1337,
+				PacketNumberLen: protocol.PacketNumberLen2,
+			}
+			err := hdr.writePublicHeader(b, protocol.PerspectiveClient, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Bytes()).To(Equal([]byte{0x58, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x3, 0x13, 0x37}))
+		})
+
 		It("refuses to write a Public Header if the PacketNumberLen is not set", func() {
 			hdr := Header{
 				ConnectionID: 1,
@@ -388,6 +433,17 @@ var _ = Describe("Public Header", func() {
 				Expect(length).To(Equal(protocol.ByteCount(1 + 8 + 2))) // 1 byte public flag, 8 byte connectionID, and packet number
 			})
 
+			It("gets the length of a packet with a path ID", func() {
+				hdr := Header{
+					ConnectionID:    0x4cfa9f9b668619f6,
+					PathID:          1,
+					PacketNumberLen: protocol.PacketNumberLen2,
+				}
+				length, err := hdr.getPublicHeaderLength(protocol.PerspectiveServer)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(length).To(Equal(protocol.ByteCount(1 + 8 + 1 + 2))) // 1 byte public flag, 8 byte connectionID, 1 byte path ID, and packet number
+			})
+
 			It("works with diversification nonce", func() {
 				hdr := Header{
 					DiversificationNonce: []byte("foo"),
@@ -498,6 +554,17 @@ var _ = Describe("Public Header", func() {
 			Expect(buf.String()).To(ContainSubstring("Public Header{ConnectionID: 0xdecafbad, PacketNumber: 0x1337, PacketNumberLen: 6, Version: gQUIC 39"))
 		})
 
+		It("logs the path ID", func() {
+			(&Header{
+				ConnectionID:    0xdecafbad,
+				PathID:          2,
+				PacketNumber:    0x1337,
+				PacketNumberLen: 6,
+				Version:         protocol.Version39,
+			}).logPublicHeader()
+			Expect(buf.String()).To(ContainSubstring("Public Header{ConnectionID: 0xdecafbad, PathID: 2, PacketNumber: 0x1337"))
+		})
+
 		It("logs a Public Header with omitted connection ID", func() {
 			(&Header{
 				OmitConnectionID: true,
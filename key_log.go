@@ -0,0 +1,63 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+const (
+	// the client random follows the TLS record header, the handshake message header and the legacy_version
+	clientRandomOffset = 5 + 4 + 2
+	clientRandomLen    = 32
+)
+
+// The clientHelloRecorder records the beginning of the ClientHello sent or received by mint.
+// It is needed for the key log, since mint doesn't export the client random.
+type clientHelloRecorder struct {
+	net.Conn
+
+	perspective protocol.Perspective
+	data        []byte
+}
+
+var _ net.Conn = &clientHelloRecorder{}
+
+func (r *clientHelloRecorder) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+	if r.perspective == protocol.PerspectiveServer {
+		r.record(b[:n])
+	}
+	return n, err
+}
+
+func (r *clientHelloRecorder) Write(b []byte) (int, error) {
+	if r.perspective == protocol.PerspectiveClient {
+		r.record(b)
+	}
+	return r.Conn.Write(b)
+}
+
+func (r *clientHelloRecorder) record(b []byte) {
+	missing := clientRandomOffset + clientRandomLen - len(r.data)
+	if missing <= 0 {
+		return
+	}
+	if len(b) > missing {
+		b = b[:missing]
+	}
+	r.data = append(r.data, b...)
+}
+
+// clientRandom returns the client random of the ClientHello.
+// It returns nil if no ClientHello was recorded.
+func (r *clientHelloRecorder) clientRandom() []byte {
+	if len(r.data) < clientRandomOffset+clientRandomLen {
+		return nil
+	}
+	// check that this is a handshake record, containing a ClientHello
+	if r.data[0] != 22 || r.data[5] != 1 {
+		return nil
+	}
+	return r.data[clientRandomOffset:]
+}
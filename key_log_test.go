@@ -0,0 +1,122 @@
+package quic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key Log", func() {
+	Context("recording the ClientHello", func() {
+		clientHello := append([]byte{22, 3, 1, 0, 100, 1, 0, 0, 96, 3, 3}, bytes.Repeat([]byte{0x42}, 32)...)
+
+		It("records the client random sent by the client", func() {
+			r := &clientHelloRecorder{Conn: handshake.NewCryptoStreamConn(nil), perspective: protocol.PerspectiveClient}
+			// write the ClientHello in two parts
+			_, err := r.Write(clientHello[:20])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.clientRandom()).To(BeNil())
+			_, err = r.Write(append(clientHello[20:], []byte("foobar")...))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.clientRandom()).To(Equal(bytes.Repeat([]byte{0x42}, 32)))
+			// later writes are ignored
+			_, err = r.Write(bytes.Repeat([]byte{0x13}, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.clientRandom()).To(Equal(bytes.Repeat([]byte{0x42}, 32)))
+		})
+
+		It("doesn't return a client random, if the data is not a ClientHello", func() {
+			r := &clientHelloRecorder{Conn: handshake.NewCryptoStreamConn(nil), perspective: protocol.PerspectiveClient}
+			data := make([]byte, len(clientHello))
+			copy(data, clientHello)
+			data[5] = 2 // ServerHello
+			_, err := r.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.clientRandom()).To(BeNil())
+		})
+
+		It("records the client random received by the server", func() {
+			csc := handshake.NewCryptoStreamConn(nil)
+			csc.AddDataForReading(clientHello)
+			r := &clientHelloRecorder{Conn: csc, perspective: protocol.PerspectiveServer}
+			_, err := r.Read(make([]byte, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.clientRandom()).To(Equal(bytes.Repeat([]byte{0x42}, 32)))
+		})
+
+		It("doesn't record data read by the client", func() {
+			csc := handshake.NewCryptoStreamConn(nil)
+			csc.AddDataForReading(clientHello)
+			r := &clientHelloRecorder{Conn: csc, perspective: protocol.PerspectiveClient}
+			_, err := r.Read(make([]byte, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.data).To(BeEmpty())
+		})
+	})
+
+	It("logs the 1-RTT secrets on the client and on the server", func() {
+		clientConf, err := tlsToMintConfig(nil, protocol.PerspectiveClient)
+		Expect(err).ToNot(HaveOccurred())
+		clientConf.ServerName = "quic.clemente.io"
+		clientConf.InsecureSkipVerify = true
+		serverConf, err := tlsToMintConfig(testdata.GetTLSConfig(), protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		clientToServer := &nonBlockingBuffer{}
+		serverToClient := &nonBlockingBuffer{}
+		clientCSC := handshake.NewCryptoStreamConn(nil)
+		clientCSC.SetStream(struct {
+			io.Reader
+			io.Writer
+		}{serverToClient, clientToServer})
+		serverCSC := handshake.NewCryptoStreamConn(nil)
+		serverCSC.SetStream(struct {
+			io.Reader
+			io.Writer
+		}{clientToServer, serverToClient})
+		client := newMintController(clientCSC, clientConf, protocol.PerspectiveClient)
+		server := newMintController(serverCSC, serverConf, protocol.PerspectiveServer)
+		clientKeyLog := &bytes.Buffer{}
+		serverKeyLog := &bytes.Buffer{}
+		client.keyLogWriter = clientKeyLog
+		server.keyLogWriter = serverKeyLog
+
+		for i := 0; i < 10; i++ {
+			alert := client.Handshake()
+			Expect(alert == mint.AlertNoAlert || alert == mint.AlertWouldBlock).To(BeTrue())
+			alert = server.Handshake()
+			Expect(alert == mint.AlertNoAlert || alert == mint.AlertWouldBlock).To(BeTrue())
+			if client.State() == mint.StateClientConnected && server.State() == mint.StateServerConnected {
+				break
+			}
+		}
+		Expect(client.State()).To(Equal(mint.StateClientConnected))
+		Expect(server.State()).To(Equal(mint.StateServerConnected))
+
+		clientRandom := client.clientHelloRecorder.clientRandom()
+		Expect(clientRandom).To(HaveLen(32))
+		// the secrets are logged only once
+		Expect(client.Handshake()).To(Equal(mint.AlertNoAlert))
+		lines := strings.Split(strings.TrimSuffix(clientKeyLog.String(), "\n"), "\n")
+		Expect(lines).To(HaveLen(2))
+		for i, label := range []string{"QUIC_CLIENT_1RTT_SECRET", "QUIC_SERVER_1RTT_SECRET"} {
+			Expect(lines[i]).To(MatchRegexp(fmt.Sprintf("^%s %x [0-9a-f]{64}$", label, clientRandom)))
+		}
+		Expect(serverKeyLog.String()).To(Equal(clientKeyLog.String()))
+	})
+
+	It("doesn't log anything without a key log writer", func() {
+		conf, err := tlsToMintConfig(nil, protocol.PerspectiveClient)
+		Expect(err).ToNot(HaveOccurred())
+		mc := newMintController(handshake.NewCryptoStreamConn(nil), conf, protocol.PerspectiveClient)
+		Expect(mc.logSecrets).ToNot(Panic())
+	})
+})
@@ -19,6 +19,14 @@ import (
 type mintController struct {
 	csc  *handshake.CryptoStreamConn
 	conn *mint.Conn
+
+	// only set for servers that request client certificates
+	clientCertVerifier *clientCertVerifier
+
+	// only set if the tls.Config has a KeyLogWriter
+	keyLogWriter        io.Writer
+	clientHelloRecorder *clientHelloRecorder
+	loggedSecrets       bool
 }
 
 var _ handshake.MintTLS = &mintController{}
@@ -27,17 +35,17 @@ func newMintController(
 	csc *handshake.CryptoStreamConn,
 	mconf *mint.Config,
 	pers protocol.Perspective,
-) handshake.MintTLS {
-	var conn *mint.Conn
+) *mintController {
+	mc := &mintController{
+		csc:                 csc,
+		clientHelloRecorder: &clientHelloRecorder{Conn: csc, perspective: pers},
+	}
 	if pers == protocol.PerspectiveClient {
-		conn = mint.Client(csc, mconf)
+		mc.conn = mint.Client(mc.clientHelloRecorder, mconf)
 	} else {
-		conn = mint.Server(csc, mconf)
-	}
-	return &mintController{
-		csc:  csc,
-		conn: conn,
+		mc.conn = mint.Server(mc.clientHelloRecorder, mconf)
 	}
+	return mc
 }
 
 func (mc *mintController) GetCipherSuite() mint.CipherSuiteParams {
@@ -49,7 +57,33 @@ func (mc *mintController) ComputeExporter(label string, context []byte, keyLengt
 }
 
 func (mc *mintController) Handshake() mint.Alert {
-	return mc.conn.Handshake()
+	alert := mc.conn.Handshake()
+	if alert != mint.AlertNoAlert {
+		return alert
+	}
+	state := mc.conn.ConnectionState()
+	if state.HandshakeState != mint.StateClientConnected && state.HandshakeState != mint.StateServerConnected {
+		return alert
+	}
+	if mc.clientCertVerifier != nil {
+		if err := mc.clientCertVerifier.checkCertificatePresent(state.PeerCertificates); err != nil {
+			utils.Infof("Rejecting client: %s", err.Error())
+			return mint.AlertBadCertificate
+		}
+	}
+	mc.logSecrets()
+	return alert
+}
+
+// logSecrets logs the 1-RTT secrets, once the handshake has completed
+func (mc *mintController) logSecrets() {
+	if mc.keyLogWriter == nil || mc.loggedSecrets {
+		return
+	}
+	mc.loggedSecrets = true
+	if err := crypto.WriteTLSKeyLog(mc.keyLogWriter, mc, mc.clientHelloRecorder.clientRandom()); err != nil {
+		utils.Errorf("Writing the key log failed: %s", err.Error())
+	}
 }
 
 func (mc *mintController) State() mint.State {
@@ -57,7 +91,12 @@ func (mc *mintController) State() mint.State {
 }
 
 func (mc *mintController) ConnectionState() mint.ConnectionState {
-	return mc.conn.ConnectionState()
+	state := mc.conn.ConnectionState()
+	if mc.clientCertVerifier != nil {
+		// mint doesn't verify client certificates, see clientCertVerifier
+		state.VerifiedChains = mc.clientCertVerifier.getVerifiedChains()
+	}
+	return state
 }
 
 func (mc *mintController) SetCryptoStream(stream io.ReadWriter) {
@@ -74,6 +113,7 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 	}
 	if tlsConf != nil {
 		mconf.ServerName = tlsConf.ServerName
+		mconf.NextProtos = tlsConf.NextProtos
 		mconf.InsecureSkipVerify = tlsConf.InsecureSkipVerify
 		mconf.Certificates = make([]*mint.Certificate, len(tlsConf.Certificates))
 		mconf.VerifyPeerCertificate = tlsConf.VerifyPeerCertificate
@@ -90,13 +130,9 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 				mconf.Certificates[i].Chain[j] = c
 			}
 		}
-		switch tlsConf.ClientAuth {
-		case tls.NoClientCert:
-		case tls.RequireAnyClientCert:
-			mconf.RequireClientAuth = true
-		default:
-			return nil, errors.New("mint currently only support ClientAuthType RequireAnyClientCert")
-		}
+		// mint only requests the client certificate.
+		// The ClientAuthType is enforced by the clientCertVerifier.
+		mconf.RequireClientAuth = tlsConf.ClientAuth != tls.NoClientCert
 	}
 	if err := mconf.Init(pers == protocol.PerspectiveClient); err != nil {
 		return nil, err
@@ -106,9 +142,9 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 
 // unpackInitialOrRetryPacket unpacks packets Initial and Retry packets
 // These packets must contain a STREAM_FRAME for the crypto stream, starting at offset 0.
-func unpackInitialPacket(aead crypto.AEAD, hdr *wire.Header, data []byte, version protocol.VersionNumber) (*wire.StreamFrame, error) {
-	unpacker := &packetUnpacker{aead: &nullAEAD{aead}, version: version}
-	packet, err := unpacker.Unpack(hdr.Raw, hdr, data)
+func unpackInitialPacket(aead crypto.AEAD, hp crypto.HeaderProtector, hdr *wire.Header, data []byte, version protocol.VersionNumber) (*wire.StreamFrame, error) {
+	unpacker := &packetUnpacker{aead: &nullAEAD{aead: aead, hp: hp}, version: version}
+	packet, err := unpacker.Unpack(hdr, data)
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +174,7 @@ func unpackInitialPacket(aead crypto.AEAD, hdr *wire.Header, data []byte, versio
 
 // packUnencryptedPacket provides a low-overhead way to pack a packet.
 // It is supposed to be used in the early stages of the handshake, before a session (which owns a packetPacker) is available.
-func packUnencryptedPacket(aead crypto.AEAD, hdr *wire.Header, f wire.Frame, pers protocol.Perspective) ([]byte, error) {
+func packUnencryptedPacket(aead crypto.AEAD, hp crypto.HeaderProtector, hdr *wire.Header, f wire.Frame, pers protocol.Perspective) ([]byte, error) {
 	raw := *getPacketBuffer()
 	buffer := bytes.NewBuffer(raw[:0])
 	if err := hdr.Write(buffer, pers, hdr.Version); err != nil {
@@ -148,9 +184,15 @@ func packUnencryptedPacket(aead crypto.AEAD, hdr *wire.Header, f wire.Frame, per
 	if err := f.Write(buffer, hdr.Version); err != nil {
 		return nil, err
 	}
+	// this is only used for Long Header packets, which always use a 4 byte packet number
+	pnLen := protocol.PacketNumberLen4
+	if paddingLen := headerProtectionPaddingLen(pnLen, buffer.Len()-payloadStartIndex, aead.Overhead()); paddingLen > 0 {
+		buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
+	}
 	raw = raw[0:buffer.Len()]
 	_ = aead.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], hdr.PacketNumber, raw[:payloadStartIndex])
 	raw = raw[0 : buffer.Len()+aead.Overhead()]
+	protectHeader(hp, raw, payloadStartIndex-int(pnLen), pnLen)
 	if utils.Debug() {
 		utils.Debugf("-> Sending packet 0x%x (%d bytes) for connection %x, %s", hdr.PacketNumber, len(raw), hdr.ConnectionID, protocol.EncryptionUnencrypted)
 		hdr.Log()
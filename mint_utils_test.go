@@ -57,6 +57,7 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 			tlsConf := &tls.Config{
 				ServerName:         "www.example.com",
 				InsecureSkipVerify: true,
+				NextProtos:         []string{"h2", "hq"},
 				VerifyPeerCertificate: func(_ [][]byte, _ [][]*x509.Certificate) error {
 					return verifyErr
 				},
@@ -65,40 +66,54 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(mintConf.ServerName).To(Equal("www.example.com"))
 			Expect(mintConf.InsecureSkipVerify).To(BeTrue())
+			Expect(mintConf.NextProtos).To(Equal([]string{"h2", "hq"}))
 			Expect(mintConf.VerifyPeerCertificate(nil, nil)).To(MatchError(verifyErr))
 		})
 
-		It("requires client authentication", func() {
+		It("requests client certificates", func() {
 			mintConf, err := tlsToMintConfig(nil, protocol.PerspectiveClient)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(mintConf.RequireClientAuth).To(BeFalse())
-			conf := &tls.Config{ClientAuth: tls.RequireAnyClientCert}
-			mintConf, err = tlsToMintConfig(conf, protocol.PerspectiveClient)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(mintConf.RequireClientAuth).To(BeTrue())
-		})
-
-		It("rejects unsupported client auth types", func() {
-			conf := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
-			_, err := tlsToMintConfig(conf, protocol.PerspectiveClient)
-			Expect(err).To(MatchError("mint currently only support ClientAuthType RequireAnyClientCert"))
+			for _, clientAuth := range []tls.ClientAuthType{tls.RequestClientCert, tls.RequireAnyClientCert, tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert} {
+				conf := &tls.Config{ClientAuth: clientAuth}
+				mintConf, err = tlsToMintConfig(conf, protocol.PerspectiveServer)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mintConf.RequireClientAuth).To(BeTrue())
+			}
 		})
 	})
 
 	Context("unpacking", func() {
-		packPacket := func(frames []wire.Frame) []byte {
+		var hp crypto.HeaderProtector
+
+		BeforeEach(func() {
+			var err error
+			hp, err = crypto.NewNullHeaderProtector(protocol.PerspectiveServer, connID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		// packPacket packs and seals a packet, applies header protection, and parses the header again
+		packPacket := func(frames []wire.Frame) (*wire.Header, []byte) {
 			buf := &bytes.Buffer{}
 			err := hdr.Write(buf, protocol.PerspectiveClient, ver)
 			Expect(err).ToNot(HaveOccurred())
 			payloadStartIndex := buf.Len()
 			aeadCl, err := crypto.NewNullAEAD(protocol.PerspectiveClient, connID, ver)
 			Expect(err).ToNot(HaveOccurred())
+			hpCl, err := crypto.NewNullHeaderProtector(protocol.PerspectiveClient, connID)
+			Expect(err).ToNot(HaveOccurred())
 			for _, f := range frames {
 				err := f.Write(buf, ver)
 				Expect(err).ToNot(HaveOccurred())
 			}
-			raw := buf.Bytes()
-			return aeadCl.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], hdr.PacketNumber, raw[:payloadStartIndex])
+			raw := aeadCl.Seal(nil, buf.Bytes()[payloadStartIndex:], hdr.PacketNumber, buf.Bytes()[:payloadStartIndex])
+			raw = append(buf.Bytes()[:payloadStartIndex], raw...)
+			protectHeader(hpCl, raw, payloadStartIndex-4, protocol.PacketNumberLen4)
+			r := bytes.NewReader(raw)
+			h, err := wire.ParseHeaderSentByServer(r, ver)
+			Expect(err).ToNot(HaveOccurred())
+			h.Raw = raw[:len(raw)-r.Len()]
+			return h, raw[len(raw)-r.Len():]
 		}
 
 		It("unpacks a packet", func() {
@@ -106,15 +121,16 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 				StreamID: 0,
 				Data:     []byte("foobar"),
 			}
-			p := packPacket([]wire.Frame{f})
-			frame, err := unpackInitialPacket(aead, hdr, p, ver)
+			h, p := packPacket([]wire.Frame{f})
+			frame, err := unpackInitialPacket(aead, hp, h, p, ver)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(frame).To(Equal(f))
+			Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
 		})
 
 		It("rejects a packet that doesn't contain a STREAM_FRAME", func() {
-			p := packPacket([]wire.Frame{&wire.PingFrame{}})
-			_, err := unpackInitialPacket(aead, hdr, p, ver)
+			h, p := packPacket([]wire.Frame{&wire.PingFrame{}})
+			_, err := unpackInitialPacket(aead, hp, h, p, ver)
 			Expect(err).To(MatchError("Packet doesn't contain a STREAM_FRAME"))
 		})
 
@@ -123,8 +139,8 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 				StreamID: 42,
 				Data:     []byte("foobar"),
 			}
-			p := packPacket([]wire.Frame{f})
-			_, err := unpackInitialPacket(aead, hdr, p, ver)
+			h, p := packPacket([]wire.Frame{f})
+			_, err := unpackInitialPacket(aead, hp, h, p, ver)
 			Expect(err).To(MatchError("UnencryptedStreamData: received unencrypted stream data on stream 42"))
 		})
 
@@ -134,19 +150,26 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 				Offset:   10,
 				Data:     []byte("foobar"),
 			}
-			p := packPacket([]wire.Frame{f})
-			_, err := unpackInitialPacket(aead, hdr, p, ver)
+			h, p := packPacket([]wire.Frame{f})
+			_, err := unpackInitialPacket(aead, hp, h, p, ver)
 			Expect(err).To(MatchError("received stream data with non-zero offset"))
 		})
 	})
 
 	Context("packing", func() {
-		var unpacker *packetUnpacker
+		var (
+			unpacker *packetUnpacker
+			hp       crypto.HeaderProtector
+		)
 
 		BeforeEach(func() {
 			aeadCl, err := crypto.NewNullAEAD(protocol.PerspectiveClient, connID, ver)
 			Expect(err).ToNot(HaveOccurred())
-			unpacker = &packetUnpacker{aead: &nullAEAD{aeadCl}, version: ver}
+			hpCl, err := crypto.NewNullHeaderProtector(protocol.PerspectiveClient, connID)
+			Expect(err).ToNot(HaveOccurred())
+			unpacker = &packetUnpacker{aead: &nullAEAD{aead: aeadCl, hp: hpCl}, version: ver}
+			hp, err = crypto.NewNullHeaderProtector(protocol.PerspectiveServer, connID)
+			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("packs a packet", func() {
@@ -154,11 +177,22 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 				Data:   []byte("foobar"),
 				FinBit: true,
 			}
-			data, err := packUnencryptedPacket(aead, hdr, f, protocol.PerspectiveServer)
+			data, err := packUnencryptedPacket(aead, hp, hdr, f, protocol.PerspectiveServer)
 			Expect(err).ToNot(HaveOccurred())
-			packet, err := unpacker.Unpack(hdr.Raw, hdr, data[len(hdr.Raw):])
+			r := bytes.NewReader(data)
+			h, err := wire.ParseHeaderSentByServer(r, ver)
+			Expect(err).ToNot(HaveOccurred())
+			h.Raw = data[:len(data)-r.Len()]
+			packet, err := unpacker.Unpack(h, data[len(h.Raw):])
 			Expect(err).ToNot(HaveOccurred())
 			Expect(packet.frames).To(Equal([]wire.Frame{f}))
+			Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+		})
+
+		It("pads packets, such that header protection can be applied", func() {
+			data, err := packUnencryptedPacket(aead, hp, hdr, &wire.PingFrame{}, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(data)).To(BeNumerically(">=", len(hdr.Raw)-4+crypto.HeaderProtectionSampleOffset+crypto.HeaderProtectionSampleLen))
 		})
 	})
 })
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -44,6 +45,7 @@ type packetPacker struct {
 	perspective  protocol.Perspective
 	version      protocol.VersionNumber
 	cryptoSetup  handshake.CryptoSetup
+	pathID       protocol.PathID
 
 	packetNumberGenerator *packetNumberGenerator
 	getPacketNumberLen    func(protocol.PacketNumber) protocol.PacketNumberLen
@@ -51,6 +53,11 @@ type packetPacker struct {
 
 	controlFrameMutex sync.Mutex
 	controlFrames     []wire.Frame
+	// packers for additional paths share the control frames of the packer for the initial path
+	initialPathPacker *packetPacker
+
+	// only set if FEC is enabled
+	fecEncoder *fecEncoder
 
 	stopWaiting               *wire.StopWaitingFrame
 	ackFrame                  *wire.AckFrame
@@ -94,12 +101,28 @@ func newPacketPacker(connectionID protocol.ConnectionID,
 	}
 }
 
+// newPathPacker creates a packer for an additional path of a multipath session.
+// It uses a separate packet number space, but shares the queue of control frames with p.
+func (p *packetPacker) newPathPacker(
+	pathID protocol.PathID,
+	getPacketNumberLen func(protocol.PacketNumber) protocol.PacketNumberLen,
+	remoteAddr net.Addr,
+) *packetPacker {
+	packer := newPacketPacker(p.connectionID, 1, getPacketNumberLen, remoteAddr, p.cryptoSetup, p.streams, p.perspective, p.version)
+	packer.pathID = pathID
+	packer.initialPathPacker = p
+	packer.omitConnectionID = p.omitConnectionID
+	packer.maxPacketSize = utils.MinByteCount(packer.maxPacketSize, p.maxPacketSize)
+	packer.hasSentPacket = true // additional paths are only used after the handshake completed
+	return packer
+}
+
 // PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame
 func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*packedPacket, error) {
 	frames := []wire.Frame{ccf}
 	encLevel, sealer := p.cryptoSetup.GetSealer()
 	header := p.getHeader(encLevel)
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, sealer, false)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -122,7 +145,8 @@ func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 		p.stopWaiting = nil
 	}
 	p.ackFrame = nil
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	// ACK-only packets are not retransmitted, so it's not worth protecting them with FEC
+	raw, err := p.writeAndSealPacket(header, frames, sealer, false)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -163,6 +187,9 @@ func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedP
 			return nil, err
 		}
 		maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
+		if p.fecEncoder != nil {
+			maxSize -= protocol.FECPacketSizeReduction
+		}
 
 		// for gQUIC: add a STOP_WAITING for *every* retransmission
 		if p.version.UsesStopWaitingFrames() {
@@ -220,7 +247,7 @@ func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedP
 		if sf, ok := frames[len(frames)-1].(*wire.StreamFrame); ok {
 			sf.DataLenPresent = false
 		}
-		raw, err := p.writeAndSealPacket(header, frames, sealer)
+		raw, err := p.writeAndSealPacket(header, frames, sealer, true)
 		if err != nil {
 			return nil, err
 		}
@@ -260,7 +287,7 @@ func (p *packetPacker) packHandshakeRetransmission(packet *ackhandler.Packet) (*
 	} else {
 		frames = packet.Frames
 	}
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, sealer, false)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -269,6 +296,31 @@ func (p *packetPacker) packHandshakeRetransmission(packet *ackhandler.Packet) (*
 	}, err
 }
 
+// PackFECPacket packs a packet that only contains the FEC frame for the last completed FEC group.
+// It returns nil if FEC is not enabled, or if no FEC group was completed.
+func (p *packetPacker) PackFECPacket() (*packedPacket, error) {
+	if p.fecEncoder == nil {
+		return nil, nil
+	}
+	frame := p.fecEncoder.PopFECFrame()
+	if frame == nil {
+		return nil, nil
+	}
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	header := p.getHeader(encLevel)
+	frames := []wire.Frame{frame}
+	raw, err := p.writeAndSealPacket(header, frames, sealer, false)
+	if err != nil {
+		return nil, err
+	}
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, nil
+}
+
 // PackPacket packs a new packet
 // the other controlFrames are sent in the next packet, but might be queued and sent in the next packet if the packet would overflow MaxPacketSize otherwise
 func (p *packetPacker) PackPacket() (*packedPacket, error) {
@@ -294,6 +346,9 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	}
 
 	maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
+	if p.fecEncoder != nil && encLevel == protocol.EncryptionForwardSecure {
+		maxSize -= protocol.FECPacketSizeReduction
+	}
 	payloadFrames, err := p.composeNextPacket(maxSize, p.canSendData(encLevel))
 	if err != nil {
 		return nil, err
@@ -323,7 +378,8 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	p.stopWaiting = nil
 	p.ackFrame = nil
 
-	raw, err := p.writeAndSealPacket(header, payloadFrames, sealer)
+	fecProtected := encLevel == protocol.EncryptionForwardSecure && ackhandler.HasRetransmittableFrames(payloadFrames)
+	raw, err := p.writeAndSealPacket(header, payloadFrames, sealer, fecProtected)
 	if err != nil {
 		return nil, err
 	}
@@ -346,7 +402,7 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 	sf := p.streams.PopCryptoStreamFrame(maxLen)
 	sf.DataLenPresent = false
 	frames := []wire.Frame{sf}
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, sealer, false)
 	if err != nil {
 		return nil, err
 	}
@@ -376,18 +432,10 @@ func (p *packetPacker) composeNextPacket(
 		payloadLength += p.stopWaiting.Length(p.version)
 	}
 
-	p.controlFrameMutex.Lock()
-	for len(p.controlFrames) > 0 {
-		frame := p.controlFrames[len(p.controlFrames)-1]
-		length := frame.Length(p.version)
-		if payloadLength+length > maxFrameSize {
-			break
-		}
-		payloadFrames = append(payloadFrames, frame)
-		payloadLength += length
-		p.controlFrames = p.controlFrames[:len(p.controlFrames)-1]
+	payloadFrames, payloadLength = p.popControlFrames(p, payloadFrames, payloadLength, maxFrameSize)
+	if p.initialPathPacker != nil {
+		payloadFrames, payloadLength = p.popControlFrames(p.initialPathPacker, payloadFrames, payloadLength, maxFrameSize)
 	}
-	p.controlFrameMutex.Unlock()
 
 	if payloadLength > maxFrameSize {
 		return nil, fmt.Errorf("Packet Packer BUG: packet payload (%d) too large (%d)", payloadLength, maxFrameSize)
@@ -419,6 +467,28 @@ func (p *packetPacker) composeNextPacket(
 	return payloadFrames, nil
 }
 
+// popControlFrames adds the control frames queued in q, as long as they fit into the packet
+func (p *packetPacker) popControlFrames(
+	q *packetPacker,
+	payloadFrames []wire.Frame,
+	payloadLength protocol.ByteCount,
+	maxFrameSize protocol.ByteCount,
+) ([]wire.Frame, protocol.ByteCount) {
+	q.controlFrameMutex.Lock()
+	defer q.controlFrameMutex.Unlock()
+	for len(q.controlFrames) > 0 {
+		frame := q.controlFrames[len(q.controlFrames)-1]
+		length := frame.Length(p.version)
+		if payloadLength+length > maxFrameSize {
+			break
+		}
+		payloadFrames = append(payloadFrames, frame)
+		payloadLength += length
+		q.controlFrames = q.controlFrames[:len(q.controlFrames)-1]
+	}
+	return payloadFrames, payloadLength
+}
+
 func (p *packetPacker) QueueControlFrame(frame wire.Frame) {
 	switch f := frame.(type) {
 	case *wire.StopWaitingFrame:
@@ -426,10 +496,27 @@ func (p *packetPacker) QueueControlFrame(frame wire.Frame) {
 	case *wire.AckFrame:
 		p.ackFrame = f
 	default:
-		p.controlFrameMutex.Lock()
-		p.controlFrames = append(p.controlFrames, f)
-		p.controlFrameMutex.Unlock()
+		q := p.controlFrameQueue()
+		q.controlFrameMutex.Lock()
+		q.controlFrames = append(q.controlFrames, f)
+		q.controlFrameMutex.Unlock()
+	}
+}
+
+// QueuePathControlFrame queues a control frame that is sent on the path of this packer.
+// All other control frames can be sent on any path.
+func (p *packetPacker) QueuePathControlFrame(frame wire.Frame) {
+	p.controlFrameMutex.Lock()
+	p.controlFrames = append(p.controlFrames, frame)
+	p.controlFrameMutex.Unlock()
+}
+
+// controlFrameQueue returns the packer that holds the queued control frames
+func (p *packetPacker) controlFrameQueue() *packetPacker {
+	if p.initialPathPacker != nil {
+		return p.initialPathPacker
 	}
+	return p
 }
 
 func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header {
@@ -438,6 +525,7 @@ func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header
 
 	header := &wire.Header{
 		ConnectionID:    p.connectionID,
+		PathID:          p.pathID,
 		PacketNumber:    pnum,
 		PacketNumberLen: packetNumberLen,
 	}
@@ -471,10 +559,13 @@ func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header
 	return header
 }
 
+// writeAndSealPacket writes and seals a packet.
+// If fecProtected is set and FEC is enabled, the packet is added to the current FEC group.
 func (p *packetPacker) writeAndSealPacket(
 	header *wire.Header,
 	payloadFrames []wire.Frame,
 	sealer handshake.Sealer,
+	fecProtected bool,
 ) ([]byte, error) {
 	raw := *getPacketBuffer()
 	buffer := bytes.NewBuffer(raw[:0])
@@ -504,15 +595,40 @@ func (p *packetPacker) writeAndSealPacket(
 			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
 		}
 	}
+	// header protection samples the ciphertext, so the packet might need to be padded
+	if p.version.UsesTLS() {
+		paddingLen := headerProtectionPaddingLen(header.PacketNumberLen, buffer.Len()-payloadStartIndex, sealer.Overhead())
+		if paddingLen > 0 {
+			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
+		}
+	}
 
 	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
 		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
 	}
 
+	// Packets that are too large to be protected by a single FEC frame are sent without FEC protection.
+	if fecProtected && p.fecEncoder != nil && protocol.ByteCount(buffer.Len()+sealer.Overhead())+protocol.FECPacketSizeReduction <= p.maxPacketSize {
+		p.fecEncoder.AddPacket(header.PacketNumber, header.PacketNumberLen, buffer.Bytes()[payloadStartIndex:])
+	}
+
 	raw = raw[0:buffer.Len()]
-	_ = sealer.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], header.PacketNumber, raw[:payloadStartIndex])
+	_ = sealer.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], noncePacketNumber(header.PathID, header.PacketNumber), raw[:payloadStartIndex])
 	raw = raw[0 : buffer.Len()+sealer.Overhead()]
 
+	if p.version.UsesTLS() {
+		// long header packets are protected with the keys derived from the connection ID
+		encLevel := protocol.EncryptionForwardSecure
+		if header.IsLongHeader {
+			encLevel = protocol.EncryptionUnencrypted
+		}
+		hp, err := p.cryptoSetup.GetHeaderProtector(encLevel)
+		if err != nil {
+			return nil, err
+		}
+		protectHeader(hp, raw, payloadStartIndex-int(header.PacketNumberLen), header.PacketNumberLen)
+	}
+
 	num := p.packetNumberGenerator.Pop()
 	if num != header.PacketNumber {
 		return nil, errors.New("packetPacker BUG: Peeked and Popped packet numbers do not match")
@@ -521,6 +637,19 @@ func (p *packetPacker) writeAndSealPacket(
 	return raw, nil
 }
 
+// headerProtectionPaddingLen calculates how many bytes of padding are needed,
+// such that the header protection sample can be taken from the ciphertext.
+func headerProtectionPaddingLen(pnLen protocol.PacketNumberLen, payloadLen int, overhead int) int {
+	return crypto.HeaderProtectionSampleOffset + crypto.HeaderProtectionSampleLen - int(pnLen) - payloadLen - overhead
+}
+
+// protectHeader applies header protection to a sealed packet.
+// pnOffset is the offset of the packet number.
+func protectHeader(hp crypto.HeaderProtector, raw []byte, pnOffset int, pnLen protocol.PacketNumberLen) {
+	sampleOffset := pnOffset + crypto.HeaderProtectionSampleOffset
+	hp.EncryptHeader(raw[sampleOffset:sampleOffset+crypto.HeaderProtectionSampleLen], &raw[0], raw[pnOffset:pnOffset+int(pnLen)])
+}
+
 func (p *packetPacker) canSendData(encLevel protocol.EncryptionLevel) bool {
 	if p.perspective == protocol.PerspectiveClient {
 		return encLevel >= protocol.EncryptionSecure
@@ -528,6 +657,19 @@ func (p *packetPacker) canSendData(encLevel protocol.EncryptionLevel) bool {
 	return encLevel == protocol.EncryptionForwardSecure
 }
 
+// EnableFEC enables FEC for forward-secure packets.
+// After every groupSize packets, an FEC frame is generated, which can be sent using PackFECPacket.
+func (p *packetPacker) EnableFEC(groupSize int) {
+	p.fecEncoder = newFECEncoder(groupSize)
+}
+
+// CloseFECGroup completes the current FEC group, such that the FEC packet can be packed right away.
+func (p *packetPacker) CloseFECGroup() {
+	if p.fecEncoder != nil {
+		p.fecEncoder.CloseGroup()
+	}
+}
+
 func (p *packetPacker) SetOmitConnectionID() {
 	p.omitConnectionID = true
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
@@ -24,11 +25,24 @@ func (s *mockSealer) Overhead() int { return 12 }
 
 var _ handshake.Sealer = &mockSealer{}
 
+type mockHeaderProtector struct{}
+
+func (*mockHeaderProtector) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {}
+func (*mockHeaderProtector) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {}
+
+var _ crypto.HeaderProtector = &mockHeaderProtector{}
+
 type mockCryptoSetup struct {
 	handleErr          error
 	divNonce           []byte
 	encLevelSeal       protocol.EncryptionLevel
 	encLevelSealCrypto protocol.EncryptionLevel
+	encLevelOpen       protocol.EncryptionLevel // if set, Open returns the unencrypted data
+	headerProtector    crypto.HeaderProtector
+	connectionState    ConnectionState
+	// returned by ExportKeyingMaterial
+	exportedKeyingMaterial []byte
+	exportErr              error
 }
 
 var _ handshake.CryptoSetup = &mockCryptoSetup{}
@@ -37,6 +51,9 @@ func (m *mockCryptoSetup) HandleCryptoStream() error {
 	return m.handleErr
 }
 func (m *mockCryptoSetup) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
+	if m.encLevelOpen != protocol.EncryptionUnspecified {
+		return append(dst, src...), m.encLevelOpen, nil
+	}
 	return nil, protocol.EncryptionUnspecified, nil
 }
 func (m *mockCryptoSetup) GetSealer() (protocol.EncryptionLevel, handshake.Sealer) {
@@ -48,9 +65,18 @@ func (m *mockCryptoSetup) GetSealerForCryptoStream() (protocol.EncryptionLevel,
 func (m *mockCryptoSetup) GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (handshake.Sealer, error) {
 	return &mockSealer{}, nil
 }
+func (m *mockCryptoSetup) GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	if m.headerProtector != nil {
+		return m.headerProtector, nil
+	}
+	return &mockHeaderProtector{}, nil
+}
 func (m *mockCryptoSetup) DiversificationNonce() []byte            { return m.divNonce }
 func (m *mockCryptoSetup) SetDiversificationNonce(divNonce []byte) { m.divNonce = divNonce }
-func (m *mockCryptoSetup) ConnectionState() ConnectionState        { panic("not implemented") }
+func (m *mockCryptoSetup) ConnectionState() ConnectionState        { return m.connectionState }
+func (m *mockCryptoSetup) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	return m.exportedKeyingMaterial, m.exportErr
+}
 
 var _ = Describe("Packet packer", func() {
 	const maxPacketSize protocol.ByteCount = 1357
@@ -917,6 +943,77 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("header protection", func() {
+		var peerHP crypto.HeaderProtector
+
+		BeforeEach(func() {
+			keyClient := []byte("0123456789abcdef")
+			keyServer := []byte("fedcba9876543210")
+			hp, err := crypto.NewAESHeaderProtector(keyClient, keyServer)
+			Expect(err).ToNot(HaveOccurred())
+			peerHP, err = crypto.NewAESHeaderProtector(keyServer, keyClient)
+			Expect(err).ToNot(HaveOccurred())
+			packer.cryptoSetup.(*mockCryptoSetup).headerProtector = hp
+			packer.version = protocol.VersionTLS
+		})
+
+		// unprotect removes header protection and parses the header
+		unprotect := func(raw []byte) *wire.Header {
+			r := bytes.NewReader(raw)
+			hdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			pnOffset := len(raw) - r.Len()
+			header := make([]byte, pnOffset+4)
+			copy(header, raw)
+			sampleOffset := pnOffset + crypto.HeaderProtectionSampleOffset
+			peerHP.DecryptHeader(raw[sampleOffset:sampleOffset+crypto.HeaderProtectionSampleLen], &header[0], header[pnOffset:])
+			Expect(hdr.ParsePacketNumber(bytes.NewReader(header[pnOffset:]), header[0])).To(Succeed())
+			return hdr
+		}
+
+		It("protects the header of short header packets", func() {
+			packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 0x1337})
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.IsLongHeader).To(BeFalse())
+			Expect(p.header.PacketNumberLen).To(Equal(protocol.PacketNumberLen2))
+			buf := &bytes.Buffer{}
+			Expect(p.header.Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+			Expect(p.raw[:buf.Len()]).ToNot(Equal(buf.Bytes()))
+			hdr := unprotect(p.raw)
+			Expect(hdr.PacketNumber).To(Equal(p.header.PacketNumber))
+			Expect(hdr.PacketNumberLen).To(Equal(protocol.PacketNumberLen2))
+		})
+
+		It("protects the header of long header packets", func() {
+			f := &wire.StreamFrame{
+				StreamID: packer.version.CryptoStreamID(),
+				Data:     []byte("foobar"),
+			}
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Return(true)
+			mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(f)
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionUnencrypted
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.IsLongHeader).To(BeTrue())
+			hdr := unprotect(p.raw)
+			Expect(hdr.Type).To(Equal(protocol.PacketTypeHandshake))
+			Expect(hdr.PacketNumber).To(Equal(p.header.PacketNumber))
+		})
+
+		It("pads packets that are too small to take the sample", func() {
+			packer.QueueControlFrame(&wire.AckFrame{})
+			p, err := packer.PackAckPacket()
+			Expect(err).ToNot(HaveOccurred())
+			pnOffset := 1 + 8 // type byte and connection ID
+			Expect(p.raw).To(HaveLen(pnOffset + crypto.HeaderProtectionSampleOffset + crypto.HeaderProtectionSampleLen))
+			hdr := unprotect(p.raw)
+			Expect(hdr.PacketNumber).To(Equal(p.header.PacketNumber))
+		})
+	})
+
 	Context("max packet size", func() {
 		It("sets the maximum packet size", func() {
 			for i := 0; i < 10*int(maxPacketSize); i++ {
@@ -950,4 +1047,174 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
 		})
 	})
+
+	Context("FEC", func() {
+		BeforeEach(func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData().AnyTimes()
+		})
+
+		It("doesn't pack FEC packets if FEC is disabled", func() {
+			p, err := packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("packs an FEC packet when an FEC group is complete", func() {
+			packer.EnableFEC(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			packer.QueueControlFrame(&wire.PingFrame{})
+			p1, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			p, err := packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+			packer.QueueControlFrame(&wire.PingFrame{})
+			p2, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			p, err = packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(p.frames).To(HaveLen(1))
+			Expect(p.frames[0]).To(BeAssignableToTypeOf(&wire.FECFrame{}))
+			Expect(p.frames[0].(*wire.FECFrame).PacketNumbers).To(Equal([]protocol.PacketNumber{p1.header.PacketNumber, p2.header.PacketNumber}))
+			Expect(p.header.PacketNumber).To(BeNumerically(">", p2.header.PacketNumber))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+			// FEC packets themselves are not protected
+			p, err = packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("packs an FEC packet for a partial group after closing it", func() {
+			packer.EnableFEC(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			packer.QueueControlFrame(&wire.PingFrame{})
+			p1, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			packer.CloseFECGroup()
+			p, err := packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(p.frames[0].(*wire.FECFrame).PacketNumbers).To(Equal([]protocol.PacketNumber{p1.header.PacketNumber}))
+		})
+
+		It("doesn't protect ACK-only packets", func() {
+			packer.EnableFEC(1)
+			packer.QueueControlFrame(&wire.AckFrame{LargestAcked: 10, LowestAcked: 1})
+			p, err := packer.PackAckPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			packer.CloseFECGroup()
+			p, err = packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("leaves space for the FEC frame in protected packets", func() {
+			packer.EnableFEC(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).DoAndReturn(func(maxSize protocol.ByteCount) []*wire.StreamFrame {
+				Expect(maxSize).To(Equal(maxFrameSize - protocol.FECPacketSizeReduction + 2))
+				return []*wire.StreamFrame{{
+					StreamID: 5,
+					Data:     bytes.Repeat([]byte{'f'}, int(maxSize-(&wire.StreamFrame{StreamID: 5}).Length(packer.version)-2)),
+				}}
+			})
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			_, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			packer.QueueControlFrame(&wire.PingFrame{})
+			_, err = packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			p, err := packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(len(p.raw)).To(BeNumerically("<=", maxPacketSize))
+		})
+
+		It("doesn't protect packets that are not forward-secure", func() {
+			packer.EnableFEC(2)
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			for i := 0; i < 2; i++ {
+				packer.QueueControlFrame(&wire.PingFrame{})
+				_, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+			}
+			p, err := packer.PackFECPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+	})
+
+	Context("packers for additional paths", func() {
+		var pathPacker *packetPacker
+
+		BeforeEach(func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData().AnyTimes()
+			pathPacker = packer.newPathPacker(
+				2,
+				func(protocol.PacketNumber) protocol.PacketNumberLen { return protocol.PacketNumberLen2 },
+				&net.UDPAddr{IP: net.IPv4(11, 12, 13, 14), Port: 1337},
+			)
+		})
+
+		It("sets the path ID", func() {
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			pathPacker.QueueControlFrame(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1})
+			p, err := pathPacker.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.PathID).To(Equal(protocol.PathID(2)))
+			hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(p.raw), versionGQUICFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PathID).To(Equal(protocol.PathID(2)))
+		})
+
+		It("uses a separate packet number space", func() {
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			packer.packetNumberGenerator.next = 100
+			packer.QueueControlFrame(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.PacketNumber).To(Equal(protocol.PacketNumber(100)))
+			pathPacker.QueueControlFrame(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1})
+			p, err = pathPacker.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+		})
+
+		It("keeps ACKs and STOP_WAITINGs separate", func() {
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			ack := &wire.AckFrame{LargestAcked: 1, LowestAcked: 1}
+			pathPacker.QueueControlFrame(ack)
+			Expect(packer.ackFrame).To(BeNil())
+			p, err := pathPacker.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{ack}))
+		})
+
+		It("shares control frames with the packer of the initial path", func() {
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			f := &wire.MaxDataFrame{ByteOffset: 0x1337}
+			packer.QueueControlFrame(f)
+			p, err := pathPacker.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f}))
+			Expect(packer.controlFrames).To(BeEmpty())
+		})
+
+		It("sends path control frames only on its own path", func() {
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			pathPacker.QueuePathControlFrame(&wire.PingFrame{})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+			p, err = pathPacker.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+		})
+
+		It("uses the path ID for the nonce", func() {
+			Expect(noncePacketNumber(protocol.InitialPathID, 0x1337)).To(Equal(protocol.PacketNumber(0x1337)))
+			Expect(noncePacketNumber(3, 0x1337)).To(Equal(protocol.PacketNumber(0x0300000000001337)))
+		})
+	})
 })
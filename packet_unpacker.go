@@ -2,9 +2,12 @@ package quic
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	"github.com/lucas-clemente/quic-go/qerr"
 )
@@ -16,23 +19,67 @@ type unpackedPacket struct {
 
 type quicAEAD interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error)
+	GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error)
 }
 
 type packetUnpacker struct {
 	version protocol.VersionNumber
 	aead    quicAEAD
+	pathID  protocol.PathID
+
+	// only set if FEC is enabled
+	fecDecoder *fecDecoder
+
+	// Used to calculate the next packet number from the truncated wire representation
+	largestRcvdPacketNumber protocol.PacketNumber
 }
 
-func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+	headerBinary := hdr.Raw
+	// For IETF QUIC, the packet number can only be parsed after header protection was removed.
+	if u.version.UsesTLS() {
+		var err error
+		headerBinary, data, err = u.removeHeaderProtection(hdr, data)
+		if err != nil {
+			// Wrap err in quicError so that the packet is handled like an undecryptable packet
+			return nil, qerr.Error(qerr.DecryptionFailure, err.Error())
+		}
+	}
+
+	// Calculate packet number
+	hdr.PacketNumber = protocol.InferPacketNumber(
+		hdr.PacketNumberLen,
+		u.largestRcvdPacketNumber,
+		hdr.PacketNumber,
+	)
+
 	buf := *getPacketBuffer()
 	buf = buf[:0]
 	defer putPacketBuffer(&buf)
-	decrypted, encryptionLevel, err := u.aead.Open(buf, data, hdr.PacketNumber, headerBinary)
+	decrypted, encryptionLevel, err := u.aead.Open(buf, data, noncePacketNumber(u.pathID, hdr.PacketNumber), headerBinary)
 	if err != nil {
 		// Wrap err in quicError so that public reset is sent by session
 		return nil, qerr.Error(qerr.DecryptionFailure, err.Error())
 	}
-	r := bytes.NewReader(decrypted)
+	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
+	u.largestRcvdPacketNumber = utils.MaxPacketNumber(u.largestRcvdPacketNumber, hdr.PacketNumber)
+	fs, err := parseFrames(decrypted, hdr, encryptionLevel, u.version)
+	if err != nil {
+		return nil, err
+	}
+	if u.fecDecoder != nil && encryptionLevel == protocol.EncryptionForwardSecure {
+		u.fecDecoder.ReceivedPacket(hdr.PacketNumber, hdr.PacketNumberLen, decrypted)
+	}
+
+	return &unpackedPacket{
+		encryptionLevel: encryptionLevel,
+		frames:          fs,
+	}, nil
+}
+
+// parseFrames parses all frames in the (unencrypted) payload of a packet
+func parseFrames(data []byte, hdr *wire.Header, encryptionLevel protocol.EncryptionLevel, version protocol.VersionNumber) ([]wire.Frame, error) {
+	r := bytes.NewReader(data)
 
 	if r.Len() == 0 {
 		return nil, qerr.MissingPayload
@@ -42,7 +89,7 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 
 	// Read all frames in the packet
 	for {
-		frame, err := wire.ParseNextFrame(r, hdr, u.version)
+		frame, err := wire.ParseNextFrame(r, hdr, version)
 		if err != nil {
 			return nil, err
 		}
@@ -50,15 +97,43 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 			break
 		}
 		if sf, ok := frame.(*wire.StreamFrame); ok {
-			if sf.StreamID != u.version.CryptoStreamID() && encryptionLevel <= protocol.EncryptionUnencrypted {
+			if sf.StreamID != version.CryptoStreamID() && encryptionLevel <= protocol.EncryptionUnencrypted {
 				return nil, qerr.Error(qerr.UnencryptedStreamData, fmt.Sprintf("received unencrypted stream data on stream %d", sf.StreamID))
 			}
 		}
 		fs = append(fs, frame)
 	}
+	return fs, nil
+}
 
-	return &unpackedPacket{
-		encryptionLevel: encryptionLevel,
-		frames:          fs,
-	}, nil
+// removeHeaderProtection removes header protection and parses the packet number.
+// It returns the unprotected header, which is used as the additional data when opening the packet,
+// and the payload of the packet.
+// The packet itself is not modified, so that undecryptable packets can be unpacked again later.
+func (u *packetUnpacker) removeHeaderProtection(hdr *wire.Header, data []byte) ([]byte, []byte, error) {
+	if len(data) < crypto.HeaderProtectionSampleOffset+crypto.HeaderProtectionSampleLen {
+		return nil, nil, errors.New("packet too small to sample for header protection")
+	}
+	// long header packets are protected with the keys derived from the connection ID
+	encLevel := protocol.EncryptionForwardSecure
+	if hdr.IsLongHeader {
+		encLevel = protocol.EncryptionUnencrypted
+	}
+	hp, err := u.aead.GetHeaderProtector(encLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the length of the packet number is not known before header protection is removed
+	// unprotect the maximum packet number length, and only use as many bytes as needed
+	pnOffset := len(hdr.Raw)
+	header := make([]byte, pnOffset+int(protocol.PacketNumberLen4))
+	copy(header, hdr.Raw)
+	copy(header[pnOffset:], data)
+	sample := data[crypto.HeaderProtectionSampleOffset : crypto.HeaderProtectionSampleOffset+crypto.HeaderProtectionSampleLen]
+	hp.DecryptHeader(sample, &header[0], header[pnOffset:])
+	if err := hdr.ParsePacketNumber(bytes.NewReader(header[pnOffset:]), header[0]); err != nil {
+		return nil, nil, err
+	}
+	pnLen := int(hdr.PacketNumberLen)
+	return header[:pnOffset+pnLen], data[pnLen:], nil
 }
@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"errors"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -28,8 +29,46 @@ func (m *mockAEAD) Seal(dst, src []byte, packetNumber protocol.PacketNumber, ass
 	return nullAEAD.Seal(dst, src, packetNumber, associatedData), protocol.EncryptionUnspecified
 }
 
+func (m *mockAEAD) GetHeaderProtector(protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	return &mockHeaderProtector{}, nil
+}
+
 var _ quicAEAD = &mockAEAD{}
 
+// headerProtectingAEAD is a quicAEAD that opens packets using an AEAD and a HeaderProtector
+type headerProtectingAEAD struct {
+	aead     crypto.AEAD
+	hp       crypto.HeaderProtector
+	encLevel protocol.EncryptionLevel
+}
+
+func (a *headerProtectingAEAD) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
+	data, err := a.aead.Open(dst, src, packetNumber, associatedData)
+	return data, a.encLevel, err
+}
+
+func (a *headerProtectingAEAD) GetHeaderProtector(encLevel protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	if encLevel != a.encLevel {
+		return nil, errors.New("no header protector")
+	}
+	return a.hp, nil
+}
+
+var _ quicAEAD = &headerProtectingAEAD{}
+
+// pnRecordingAEAD is a quicAEAD that records the packet number used to open the last packet
+type pnRecordingAEAD struct {
+	mockAEAD
+	packetNumber protocol.PacketNumber
+}
+
+func (a *pnRecordingAEAD) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
+	a.packetNumber = packetNumber
+	return nil, protocol.EncryptionUnspecified, errors.New("decryption failed")
+}
+
+var _ quicAEAD = &pnRecordingAEAD{}
+
 var _ = Describe("Packet unpacker", func() {
 	var (
 		unpacker *packetUnpacker
@@ -45,6 +84,7 @@ var _ = Describe("Packet unpacker", func() {
 			PacketNumberLen: 1,
 		}
 		hdrBin = []byte{0x04, 0x4c, 0x01}
+		hdr.Raw = hdrBin
 		unpacker = &packetUnpacker{aead: &mockAEAD{}}
 		data = nil
 		buf = &bytes.Buffer{}
@@ -56,7 +96,7 @@ var _ = Describe("Packet unpacker", func() {
 
 	It("errors if the packet doesn't contain any payload", func() {
 		setData(nil)
-		_, err := unpacker.Unpack(hdrBin, hdr, data)
+		_, err := unpacker.Unpack(hdr, data)
 		Expect(err).To(MatchError(qerr.MissingPayload))
 	})
 
@@ -67,11 +107,44 @@ var _ = Describe("Packet unpacker", func() {
 		Expect(err).ToNot(HaveOccurred())
 		setData(buf.Bytes())
 		unpacker.aead.(*mockAEAD).encLevelOpen = protocol.EncryptionSecure
-		packet, err := unpacker.Unpack(hdrBin, hdr, data)
+		packet, err := unpacker.Unpack(hdr, data)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 	})
 
+	Context("FEC", func() {
+		BeforeEach(func() {
+			unpacker.version = versionGQUICFrames
+			unpacker.fecDecoder = newFECDecoder()
+			err := (&wire.PingFrame{}).Write(buf, versionGQUICFrames)
+			Expect(err).ToNot(HaveOccurred())
+			setData(buf.Bytes())
+		})
+
+		It("saves forward-secure packets in the FEC decoder", func() {
+			unpacker.aead.(*mockAEAD).encLevelOpen = protocol.EncryptionForwardSecure
+			_, err := unpacker.Unpack(hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(unpacker.fecDecoder.symbols).To(HaveKey(protocol.PacketNumber(10)))
+		})
+
+		It("doesn't save packets with lower encryption levels", func() {
+			unpacker.aead.(*mockAEAD).encLevelOpen = protocol.EncryptionSecure
+			_, err := unpacker.Unpack(hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(unpacker.fecDecoder.symbols).To(BeEmpty())
+		})
+	})
+
+	It("uses the path ID to calculate the nonce", func() {
+		aead := &pnRecordingAEAD{}
+		unpacker.aead = aead
+		unpacker.pathID = 2
+		_, err := unpacker.Unpack(hdr, []byte("foobar"))
+		Expect(err).To(HaveOccurred())
+		Expect(aead.packetNumber).To(Equal(noncePacketNumber(2, 10)))
+	})
+
 	Context("unpacking STREAM frames", func() {
 		BeforeEach(func() {
 			unpacker.version = versionGQUICFrames
@@ -86,7 +159,7 @@ var _ = Describe("Packet unpacker", func() {
 			err := f.Write(buf, versionGQUICFrames)
 			Expect(err).ToNot(HaveOccurred())
 			setData(buf.Bytes())
-			packet, err := unpacker.Unpack(hdrBin, hdr, data)
+			packet, err := unpacker.Unpack(hdr, data)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(packet.frames).To(Equal([]wire.Frame{f}))
 		})
@@ -100,7 +173,7 @@ var _ = Describe("Packet unpacker", func() {
 			err := f.Write(buf, versionGQUICFrames)
 			Expect(err).ToNot(HaveOccurred())
 			setData(buf.Bytes())
-			packet, err := unpacker.Unpack(hdrBin, hdr, data)
+			packet, err := unpacker.Unpack(hdr, data)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(packet.frames).To(Equal([]wire.Frame{f}))
 		})
@@ -114,8 +187,150 @@ var _ = Describe("Packet unpacker", func() {
 			err := f.Write(buf, versionGQUICFrames)
 			Expect(err).ToNot(HaveOccurred())
 			setData(buf.Bytes())
-			_, err = unpacker.Unpack(hdrBin, hdr, data)
+			_, err = unpacker.Unpack(hdr, data)
 			Expect(err).To(MatchError(qerr.Error(qerr.UnencryptedStreamData, "received unencrypted stream data on stream 3")))
 		})
 	})
+
+	Context("calculating the packet number", func() {
+		BeforeEach(func() {
+			unpacker.version = versionGQUICFrames
+			f := &wire.PingFrame{}
+			err := f.Write(buf, versionGQUICFrames)
+			Expect(err).ToNot(HaveOccurred())
+			setData(buf.Bytes())
+		})
+
+		It("infers the packet number", func() {
+			unpacker.largestRcvdPacketNumber = 0x1337
+			hdr.PacketNumber = 0x38
+			_, err := unpacker.Unpack(hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x1338)))
+			Expect(unpacker.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(0x1338)))
+		})
+
+		It("doesn't decrease the largest received packet number, for an out-of-order packet", func() {
+			unpacker.largestRcvdPacketNumber = 0x1337
+			hdr.PacketNumber = 0x30
+			_, err := unpacker.Unpack(hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x1330)))
+			Expect(unpacker.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
+		})
+
+		It("doesn't update the largest received packet number, if decryption fails", func() {
+			hdr.PacketNumber = 0x42
+			data[len(data)-1]++
+			_, err := unpacker.Unpack(hdr, data)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.DecryptionFailure))
+			Expect(unpacker.largestRcvdPacketNumber).To(BeZero())
+		})
+	})
+
+	Context("removing header protection", func() {
+		const connID = protocol.ConnectionID(0xdeadbeef)
+		var (
+			sealer    crypto.AEAD
+			protector crypto.HeaderProtector
+		)
+
+		BeforeEach(func() {
+			var err error
+			sealer, err = crypto.NewNullAEAD(protocol.PerspectiveClient, connID, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			protector, err = crypto.NewNullHeaderProtector(protocol.PerspectiveClient, connID)
+			Expect(err).ToNot(HaveOccurred())
+			aead, err := crypto.NewNullAEAD(protocol.PerspectiveServer, connID, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			hp, err := crypto.NewNullHeaderProtector(protocol.PerspectiveServer, connID)
+			Expect(err).ToNot(HaveOccurred())
+			unpacker = &packetUnpacker{
+				aead:    &headerProtectingAEAD{aead: aead, hp: hp, encLevel: protocol.EncryptionForwardSecure},
+				version: protocol.VersionTLS,
+			}
+		})
+
+		// packPacket packs a packet with a Short Header, and applies header protection
+		packPacket := func(h *wire.Header, frames ...wire.Frame) []byte {
+			b := &bytes.Buffer{}
+			Expect(h.Write(b, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
+			payloadStartIndex := b.Len()
+			for _, f := range frames {
+				Expect(f.Write(b, protocol.VersionTLS)).To(Succeed())
+			}
+			raw := b.Bytes()
+			raw = append(raw[:payloadStartIndex], sealer.Seal(nil, raw[payloadStartIndex:], h.PacketNumber, raw[:payloadStartIndex])...)
+			protectHeader(protector, raw, payloadStartIndex-int(h.PacketNumberLen), h.PacketNumberLen)
+			return raw
+		}
+
+		parseHeader := func(raw []byte) (*wire.Header, []byte) {
+			r := bytes.NewReader(raw)
+			h, err := wire.ParseHeaderSentByClient(r)
+			Expect(err).ToNot(HaveOccurred())
+			h.Raw = raw[:len(raw)-r.Len()]
+			return h, raw[len(raw)-r.Len():]
+		}
+
+		It("unpacks a packet with a protected header", func() {
+			f := &wire.MaxDataFrame{ByteOffset: 0x1234}
+			raw := packPacket(&wire.Header{
+				ConnectionID:    connID,
+				PacketNumber:    0x1337,
+				PacketNumberLen: protocol.PacketNumberLen2,
+				KeyPhase:        1,
+			}, f)
+			rawCopy := make([]byte, len(raw))
+			copy(rawCopy, raw)
+			h, data := parseHeader(raw)
+			packet, err := unpacker.Unpack(h, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packet.frames).To(Equal([]wire.Frame{f}))
+			Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
+			Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen2))
+			Expect(h.KeyPhase).To(Equal(1))
+			// make sure that the packet can be unpacked again
+			Expect(raw).To(Equal(rawCopy))
+		})
+
+		It("errors if the packet is too small to take the sample", func() {
+			raw := packPacket(&wire.Header{
+				ConnectionID:    connID,
+				PacketNumber:    0x1337,
+				PacketNumberLen: protocol.PacketNumberLen2,
+			}, &wire.PingFrame{})
+			h, data := parseHeader(raw)
+			_, err := unpacker.Unpack(h, data[:3])
+			Expect(err).To(MatchError(qerr.Error(qerr.DecryptionFailure, "packet too small to sample for header protection")))
+		})
+
+		It("errors if the header protection keys are not available yet", func() {
+			unpacker.aead.(*headerProtectingAEAD).encLevel = protocol.EncryptionUnencrypted
+			raw := packPacket(&wire.Header{
+				ConnectionID:    connID,
+				PacketNumber:    0x1337,
+				PacketNumberLen: protocol.PacketNumberLen2,
+			}, &wire.MaxDataFrame{ByteOffset: 0x1234})
+			h, data := parseHeader(raw)
+			_, err := unpacker.Unpack(h, data)
+			Expect(err).To(MatchError(qerr.Error(qerr.DecryptionFailure, "no header protector")))
+		})
+
+		It("fails to open the packet if the header was protected with the wrong keys", func() {
+			var err error
+			protector, err = crypto.NewNullHeaderProtector(protocol.PerspectiveClient, connID+1)
+			Expect(err).ToNot(HaveOccurred())
+			raw := packPacket(&wire.Header{
+				ConnectionID:    connID,
+				PacketNumber:    0x1337,
+				PacketNumberLen: protocol.PacketNumberLen4,
+			}, &wire.PingFrame{})
+			h, data := parseHeader(raw)
+			_, err = unpacker.Unpack(h, data)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.DecryptionFailure))
+		})
+	})
 })
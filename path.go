@@ -0,0 +1,374 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// errPathClosed is returned when sending on an additional path failed, and the path was closed
+var errPathClosed = errors.New("path closed")
+
+// A path is a network path used by a session.
+// Every path has its own congestion controller, RTT estimate and packet number space.
+// The initial path uses the connection, the ackhandlers and the packer of the session,
+// additional paths (only available in gQUIC multipath sessions) are stored in session.paths.
+type path struct {
+	pathID protocol.PathID
+	conn   connection
+
+	rttStats              *congestion.RTTStats
+	sentPacketHandler     ackhandler.SentPacketHandler
+	receivedPacketHandler ackhandler.ReceivedPacketHandler
+
+	packer   *packetPacker
+	unpacker unpacker
+
+	// only used for additional paths
+	lastRcvdPacketNumber protocol.PacketNumber
+}
+
+func (p *path) isInitialPath() bool {
+	return p.pathID == protocol.InitialPathID
+}
+
+// A pathRequest is used to add or remove a path of a client session.
+type pathRequest struct {
+	localAddr net.Addr
+	conn      connection // only set when adding a path
+	errChan   chan error
+}
+
+// A pathConn sends packets of an additional path of a server session.
+// It uses the same packet conn as the initial path, but sends to a different remote address.
+type pathConn struct {
+	connection
+	remoteAddr net.Addr
+}
+
+var _ connection = &pathConn{}
+
+func (c *pathConn) Write(p []byte) error {
+	return c.connection.WriteTo(p, c.remoteAddr)
+}
+
+func (c *pathConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *pathConn) SetCurrentRemoteAddr(addr net.Addr) {
+	c.remoteAddr = addr
+}
+
+// Close doesn't close the underlying connection, since it is still used by the initial path.
+func (c *pathConn) Close() error {
+	return nil
+}
+
+// noncePacketNumber returns the packet number used to calculate the AEAD nonce.
+// The gQUIC AEADs use all 64 bits of the packet number for the nonce.
+// Since every path has its own packet number space, the path ID is used as the most significant byte.
+func noncePacketNumber(pathID protocol.PathID, pn protocol.PacketNumber) protocol.PacketNumber {
+	return protocol.PacketNumber(uint64(pathID)<<56 | uint64(pn))
+}
+
+func (s *session) newPath(pathID protocol.PathID, conn connection) *path {
+	rttStats := &congestion.RTTStats{}
+	sentPacketHandler := ackhandler.NewSentPacketHandler(rttStats, s.version)
+	sentPacketHandler.SetHandshakeComplete()
+	return &path{
+		pathID:            pathID,
+		conn:              conn,
+		rttStats:          rttStats,
+		sentPacketHandler: sentPacketHandler,
+		receivedPacketHandler: ackhandler.NewReceivedPacketHandler(
+			rttStats,
+			s.config.AckSendDelay,
+			s.config.RetransmittablePacketsBeforeAck,
+			!s.config.DisableAckDecimation,
+			s.version,
+		),
+		packer:   s.packer.newPathPacker(pathID, sentPacketHandler.GetPacketNumberLen, conn.RemoteAddr()),
+		unpacker: &packetUnpacker{aead: s.cryptoSetup, version: s.version, pathID: pathID},
+	}
+}
+
+// initialPath returns the path that the session was established on.
+func (s *session) initialPath() *path {
+	return &path{
+		pathID:                protocol.InitialPathID,
+		conn:                  s.conn,
+		rttStats:              s.rttStats,
+		sentPacketHandler:     s.sentPacketHandler,
+		receivedPacketHandler: s.receivedPacketHandler,
+		packer:                s.packer,
+		unpacker:              s.unpacker,
+	}
+}
+
+// getPaths returns all paths, ordered by their smoothed RTT.
+// Paths that don't have an RTT estimate yet are used last.
+func (s *session) getPaths() []*path {
+	paths := []*path{s.initialPath()}
+	for _, pth := range s.paths {
+		i := len(paths)
+		for i > 0 && pathIsFaster(pth, paths[i-1]) {
+			i--
+		}
+		paths = append(paths, nil)
+		copy(paths[i+1:], paths[i:])
+		paths[i] = pth
+	}
+	return paths
+}
+
+func pathIsFaster(a, b *path) bool {
+	rttA := a.rttStats.SmoothedRTT()
+	rttB := b.rttStats.SmoothedRTT()
+	if rttA == 0 {
+		return false
+	}
+	return rttB == 0 || rttA < rttB
+}
+
+func (s *session) multipathEnabled() bool {
+	return !s.version.UsesTLS() && s.config.EnableMultipath && s.peerParams != nil && s.peerParams.EnableMultipath
+}
+
+// handlePathPacket handles a packet received on an additional path
+func (s *session) handlePathPacket(p *receivedPacket) error {
+	hdr := p.header
+	pth, ok := s.paths[hdr.PathID]
+	if !ok {
+		// Only the client opens new paths.
+		if s.perspective == protocol.PerspectiveClient || !s.handshakeComplete || !s.multipathEnabled() {
+			utils.Debugf("Ignoring packet for unknown path %d", hdr.PathID)
+			return nil
+		}
+		if _, closed := s.closedPaths[hdr.PathID]; closed || len(s.paths)+1 >= protocol.MaxPaths {
+			utils.Debugf("Ignoring packet for path %d", hdr.PathID)
+			return nil
+		}
+		pth = s.newPath(hdr.PathID, &pathConn{connection: s.conn, remoteAddr: p.remoteAddr})
+	}
+
+	packet, err := pth.unpacker.Unpack(hdr, p.data)
+	if utils.Debug() {
+		if err != nil {
+			utils.Debugf("<- Reading packet 0x%x (%d bytes) for connection %x on path %d", hdr.PacketNumber, len(p.data)+len(hdr.Raw), hdr.ConnectionID, hdr.PathID)
+		} else {
+			utils.Debugf("<- Reading packet 0x%x (%d bytes) for connection %x on path %d, %s", hdr.PacketNumber, len(p.data)+len(hdr.Raw), hdr.ConnectionID, hdr.PathID, packet.encryptionLevel)
+		}
+		hdr.Log()
+	}
+	if err != nil {
+		if !ok {
+			// don't open a new path for packets that can't be decrypted
+			return nil
+		}
+		return err
+	}
+	// Additional paths are only used after the handshake completed.
+	if packet.encryptionLevel != protocol.EncryptionForwardSecure {
+		utils.Debugf("Ignoring packet on path %d sent with encryption level %s", hdr.PathID, packet.encryptionLevel)
+		return nil
+	}
+	if !ok {
+		utils.Infof("Opening path %d for connection %x to %s", hdr.PathID, s.connectionID, p.remoteAddr)
+		s.paths[hdr.PathID] = pth
+	}
+
+	pth.lastRcvdPacketNumber = hdr.PacketNumber
+	isRetransmittable := ackhandler.HasRetransmittableFrames(packet.frames)
+	if err := pth.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.rcvTime, isRetransmittable); err != nil {
+		return err
+	}
+
+	// ACKs acknowledge packets sent on the same path
+	frames := make([]wire.Frame, 0, len(packet.frames))
+	for _, f := range packet.frames {
+		if _, isFEC := f.(*wire.FECFrame); isFEC {
+			// FEC only protects packets sent on the initial path
+			return qerr.Error(qerr.InvalidFrameData, "received FEC frame on an additional path")
+		}
+		ack, isAck := f.(*wire.AckFrame)
+		if !isAck {
+			frames = append(frames, f)
+			continue
+		}
+		wire.LogFrame(ack, false)
+		if err := pth.sentPacketHandler.ReceivedAck(ack, pth.lastRcvdPacketNumber, packet.encryptionLevel, p.rcvTime); err != nil {
+			return err
+		}
+		pth.receivedPacketHandler.IgnoreBelow(pth.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
+	}
+	return s.handleFrames(frames, packet.encryptionLevel)
+}
+
+func (s *session) handleClosePathFrame(frame *wire.ClosePathFrame) error {
+	if frame.PathID == protocol.InitialPathID {
+		return qerr.Error(qerr.InvalidFrameData, "cannot close the initial path")
+	}
+	if pth, ok := s.paths[frame.PathID]; ok {
+		return s.closePath(pth, false)
+	}
+	return nil
+}
+
+// closePath closes an additional path.
+// All packets that are still outstanding on this path are retransmitted on the remaining paths.
+func (s *session) closePath(pth *path, sendClosePath bool) error {
+	utils.Infof("Closing path %d for connection %x", pth.pathID, s.connectionID)
+	delete(s.paths, pth.pathID)
+	s.closedPaths[pth.pathID] = struct{}{}
+	if err := pth.sentPacketHandler.QueueAllForRetransmission(); err != nil {
+		return err
+	}
+	for p := pth.sentPacketHandler.DequeuePacketForRetransmission(); p != nil; p = pth.sentPacketHandler.DequeuePacketForRetransmission() {
+		s.closedPathRetransmissions = append(s.closedPathRetransmissions, p)
+	}
+	if sendClosePath {
+		s.packer.QueueControlFrame(&wire.ClosePathFrame{PathID: pth.pathID})
+	}
+	s.scheduleSending()
+	return pth.conn.Close()
+}
+
+func (s *session) handlePathRequest(req *pathRequest) {
+	if req.conn != nil {
+		req.errChan <- s.addPath(req.conn)
+		return
+	}
+	req.errChan <- s.removePath(req.localAddr)
+}
+
+func (s *session) addPath(conn connection) error {
+	if !s.handshakeComplete {
+		conn.Close()
+		return errors.New("cannot add a path before the handshake completed")
+	}
+	if !s.multipathEnabled() {
+		conn.Close()
+		return errors.New("multipath is not enabled")
+	}
+	if len(s.paths)+1 >= protocol.MaxPaths {
+		conn.Close()
+		return errors.New("too many paths")
+	}
+	if s.nextPathID == 0 {
+		conn.Close()
+		return errors.New("no path IDs left")
+	}
+	pth := s.newPath(s.nextPathID, conn)
+	s.nextPathID++
+	s.paths[pth.pathID] = pth
+	utils.Infof("Opening path %d for connection %x from %s", pth.pathID, s.connectionID, conn.LocalAddr())
+	go s.listenOnPath(pth)
+	// Make sure the server learns about the new path.
+	pth.packer.QueuePathControlFrame(&wire.PingFrame{})
+	s.scheduleSending()
+	return nil
+}
+
+func (s *session) removePath(localAddr net.Addr) error {
+	if localAddr.String() == s.conn.LocalAddr().String() {
+		return errors.New("cannot remove the initial path")
+	}
+	for _, pth := range s.paths {
+		if pth.conn.LocalAddr().String() == localAddr.String() {
+			return s.closePath(pth, true)
+		}
+	}
+	return fmt.Errorf("no path for local address %s", localAddr)
+}
+
+// listenOnPath reads packets sent by the server on an additional path of a client session
+func (s *session) listenOnPath(pth *path) {
+	for {
+		data := *getPacketBuffer()
+		data = data[:protocol.MaxReceivePacketSize]
+		n, remoteAddr, err := pth.conn.Read(data)
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
+				utils.Errorf("error reading from path %d: %s", pth.pathID, err.Error())
+			}
+			return
+		}
+		rcvTime := time.Now()
+		data = data[:n]
+		r := bytes.NewReader(data)
+		hdr, err := wire.ParseHeaderSentByServer(r, s.version)
+		if err != nil {
+			utils.Errorf("error parsing packet from %s: %s", remoteAddr.String(), err.Error())
+			continue
+		}
+		if hdr.PathID != pth.pathID || hdr.ResetFlag || hdr.VersionFlag || (!hdr.OmitConnectionID && hdr.ConnectionID != s.connectionID) {
+			continue
+		}
+		hdr.Raw = data[:len(data)-r.Len()]
+		s.handlePacket(&receivedPacket{
+			remoteAddr: remoteAddr,
+			header:     hdr,
+			data:       data[len(data)-r.Len():],
+			rcvTime:    rcvTime,
+		})
+	}
+}
+
+// AddLocalAddress opens a new path from the given local address to the remote address of the session.
+// It can only be used by the client, after the handshake completed, and if both peers enabled multipath.
+func (s *session) AddLocalAddress(addr net.Addr) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return errors.New("only the client can add paths")
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("invalid local address: %s", addr)
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	return s.sendPathRequest(&pathRequest{
+		localAddr: udpConn.LocalAddr(),
+		conn:      &conn{pconn: udpConn, currentAddr: s.conn.RemoteAddr()},
+	})
+}
+
+// RemoveLocalAddress closes the path that uses the given local address.
+// Packets that are outstanding on this path are retransmitted on the remaining paths.
+// The initial path can't be removed.
+func (s *session) RemoveLocalAddress(addr net.Addr) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return errors.New("only the client can remove paths")
+	}
+	return s.sendPathRequest(&pathRequest{localAddr: addr})
+}
+
+func (s *session) sendPathRequest(req *pathRequest) error {
+	req.errChan = make(chan error, 1)
+	select {
+	case s.pathRequests <- req:
+	case <-s.ctx.Done():
+		if req.conn != nil {
+			req.conn.Close()
+		}
+		return errors.New("session closed")
+	}
+	select {
+	case err := <-req.errChan:
+		return err
+	case <-s.ctx.Done():
+		return errors.New("session closed")
+	}
+}
@@ -42,6 +42,16 @@ func (e *QuicError) Timeout() bool {
 	return false
 }
 
+// A CertificateVerificationError is returned when the certificate chain presented by the server could not be verified.
+// This includes errors returned by the tls.Config.VerifyPeerCertificate callback.
+type CertificateVerificationError struct {
+	Err error
+}
+
+func (e *CertificateVerificationError) Error() string {
+	return fmt.Sprintf("certificate verification failed: %s", e.Err.Error())
+}
+
 // ToQuicError converts an arbitrary error to a QuicError. It leaves QuicErrors
 // unchanged, and properly handles `ErrorCode`s.
 func ToQuicError(err error) *QuicError {
@@ -50,6 +60,8 @@ func ToQuicError(err error) *QuicError {
 		return e
 	case ErrorCode:
 		return Error(e, "")
+	case *CertificateVerificationError:
+		return Error(ProofInvalid, e.Error())
 	}
 	utils.Errorf("Internal error: %v", err)
 	return Error(InternalError, err.Error())
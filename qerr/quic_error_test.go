@@ -40,6 +40,12 @@ var _ = Describe("Quic error", func() {
 			Expect(ToQuicError(err)).To(Equal(Error(DecryptionFailure, "")))
 		})
 
+		It("converts CertificateVerificationErrors to ProofInvalid", func() {
+			err := &CertificateVerificationError{Err: io.EOF}
+			Expect(err).To(MatchError("certificate verification failed: EOF"))
+			Expect(ToQuicError(err)).To(Equal(Error(ProofInvalid, "certificate verification failed: EOF")))
+		})
+
 		It("changes default errors to InternalError", func() {
 			Expect(ToQuicError(io.EOF)).To(Equal(Error(InternalError, "EOF")))
 		})
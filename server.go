@@ -2,6 +2,8 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -39,7 +41,7 @@ type server struct {
 	serverTLS   *serverTLS
 
 	certChain crypto.CertChain
-	scfg      *handshake.ServerConfig
+	scfg      *handshake.ServerConfigManager
 
 	sessionsMutex sync.RWMutex
 	sessions      map[protocol.ConnectionID]packetHandler
@@ -50,7 +52,7 @@ type server struct {
 	errorChan    chan struct{}
 
 	// set as members, so they can be set in the tests
-	newSession                func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config) (packetHandler, error)
+	newSession                func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfigManager, tlsConf *tls.Config, config *Config) (packetHandler, error)
 	deleteClosedSessionsAfter time.Duration
 }
 
@@ -71,20 +73,31 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 	return Listen(conn, tlsConf, config)
 }
 
+// GenerateServerConfigKey generates a random ServerConfigKey.
+// The server config is valid from notBefore on, and expires at expiry.
+func GenerateServerConfigKey(notBefore, expiry time.Time) (ServerConfigKey, error) {
+	key := ServerConfigKey{
+		NotBefore: notBefore,
+		Expiry:    expiry,
+	}
+	for _, b := range [][]byte{key.ID[:], key.Orbit[:], key.PrivateKey[:], key.P256PrivateKey[:]} {
+		if _, err := rand.Read(b); err != nil {
+			return ServerConfigKey{}, err
+		}
+	}
+	return key, nil
+}
+
 // Listen listens for QUIC connections on a given net.PacketConn.
 // The listener is not active until Serve() is called.
 // The tls.Config must not be nil, the quic.Config may be nil.
-func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
+func Listen(conn net.PacketConn, tlsConf *tls.Config, quicConfig *Config) (Listener, error) {
+	config := populateServerConfig(quicConfig)
 	certChain := crypto.NewCertChain(tlsConf)
-	kex, err := crypto.NewCurve25519KEX()
+	scfg, err := handshake.NewServerConfigManager(config.ServerConfigKeys, config.CookieKeys, certChain, tlsConf)
 	if err != nil {
 		return nil, err
 	}
-	scfg, err := handshake.NewServerConfig(kex, certChain)
-	if err != nil {
-		return nil, err
-	}
-	config = populateServerConfig(config)
 
 	var supportsTLS bool
 	for _, v := range config.Versions {
@@ -97,6 +110,27 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 			break
 		}
 	}
+	// gQUIC has no way to authenticate the client, so only versions that use TLS can be used
+	if tlsConf != nil && requiresClientCert(tlsConf.ClientAuth) {
+		versions := make([]protocol.VersionNumber, 0, len(config.Versions))
+		for _, v := range config.Versions {
+			if v.UsesTLS() {
+				versions = append(versions, v)
+			}
+		}
+		restricted := len(versions) < len(config.Versions)
+		if len(versions) == 0 {
+			if quicConfig != nil && len(quicConfig.Versions) > 0 {
+				return nil, errors.New("client certificates are required, but none of the versions supports them")
+			}
+			versions = []protocol.VersionNumber{protocol.VersionTLS}
+			supportsTLS = true
+		}
+		if restricted {
+			utils.Infof("Client certificates are required. Only using the versions that support them: %s", versions)
+		}
+		config.Versions = versions
+	}
 
 	s := &server{
 		conn:                      conn,
@@ -122,7 +156,7 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 }
 
 func (s *server) setupTLS() error {
-	cookieHandler, err := handshake.NewCookieHandler(s.config.AcceptCookie)
+	cookieHandler, err := handshake.NewCookieHandler(s.config.AcceptCookie, s.config.CookieKeys)
 	if err != nil {
 		return err
 	}
@@ -215,6 +249,15 @@ func populateServerConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	ackSendDelay := protocol.DefaultMaxAckDelay
+	if config.AckSendDelay != 0 {
+		ackSendDelay = config.AckSendDelay
+	}
+	retransmittablePacketsBeforeAck := protocol.DefaultRetransmittablePacketsBeforeAck
+	if config.RetransmittablePacketsBeforeAck > 0 {
+		retransmittablePacketsBeforeAck = config.RetransmittablePacketsBeforeAck
+	}
+	fecGroupSize := utils.Max(0, utils.Min(config.FECGroupSize, protocol.MaxFECGroupSize))
 
 	return &Config{
 		Versions:                              versions,
@@ -226,6 +269,15 @@ func populateServerConfig(config *Config) *Config {
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		AckSendDelay:                          ackSendDelay,
+		RetransmittablePacketsBeforeAck:       retransmittablePacketsBeforeAck,
+		DisableAckDecimation:                  config.DisableAckDecimation,
+		PeerAckSendDelay:                      config.PeerAckSendDelay,
+		PeerRetransmittablePacketsBeforeAck:   config.PeerRetransmittablePacketsBeforeAck,
+		EnableMultipath:                       config.EnableMultipath,
+		FECGroupSize:                          fecGroupSize,
+		ServerConfigKeys:                      config.ServerConfigKeys,
+		CookieKeys:                            config.CookieKeys,
 	}
 }
 
@@ -252,12 +304,19 @@ func (s *server) serve() {
 
 // Accept returns newly openend sessions
 func (s *server) Accept() (Session, error) {
+	return s.AcceptContext(context.Background())
+}
+
+// AcceptContext returns newly openend sessions, or the context's error if the context is done
+func (s *server) AcceptContext(ctx context.Context) (Session, error) {
 	var sess Session
 	select {
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
 		return nil, s.serverError
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
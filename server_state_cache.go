@@ -0,0 +1,157 @@
+package quic
+
+import (
+	"container/list"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const defaultServerStateCacheCapacity = 64
+
+type lruServerStateCacheEntry struct {
+	hostname string
+	state    *CachedServerState
+}
+
+type lruServerStateCache struct {
+	mutex sync.Mutex
+
+	capacity int
+	entries  map[string]*list.Element
+	queue    *list.List // the front is the most recently used entry
+}
+
+var _ ServerStateCache = &lruServerStateCache{}
+
+// NewLRUServerStateCache returns a ServerStateCache that keeps the state of up to capacity servers in memory.
+// If the cache is full, the least recently used entry is evicted.
+// If capacity is smaller than 1, a default capacity is used.
+func NewLRUServerStateCache(capacity int) ServerStateCache {
+	if capacity < 1 {
+		capacity = defaultServerStateCacheCapacity
+	}
+	return &lruServerStateCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		queue:    list.New(),
+	}
+}
+
+func (c *lruServerStateCache) Get(hostname string) (*CachedServerState, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, ok := c.entries[hostname]
+	if !ok {
+		return nil, false
+	}
+	c.queue.MoveToFront(el)
+	return el.Value.(*lruServerStateCacheEntry).state, true
+}
+
+func (c *lruServerStateCache) Put(hostname string, state *CachedServerState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[hostname]; ok {
+		if state == nil {
+			c.queue.Remove(el)
+			delete(c.entries, hostname)
+			return
+		}
+		el.Value.(*lruServerStateCacheEntry).state = state
+		c.queue.MoveToFront(el)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if c.queue.Len() >= c.capacity {
+		oldest := c.queue.Back()
+		c.queue.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruServerStateCacheEntry).hostname)
+	}
+	c.entries[hostname] = c.queue.PushFront(&lruServerStateCacheEntry{hostname: hostname, state: state})
+}
+
+type fileServerStateCache struct {
+	mutex sync.Mutex
+
+	dir string
+}
+
+var _ ServerStateCache = &fileServerStateCache{}
+
+// NewFileServerStateCache returns a ServerStateCache that saves the state of every server in a file in dir.
+// This allows reusing the state across processes.
+// The directory is created if it doesn't exist yet.
+func NewFileServerStateCache(dir string) (ServerStateCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileServerStateCache{dir: dir}, nil
+}
+
+func (c *fileServerStateCache) filename(hostname string) string {
+	return filepath.Join(c.dir, hex.EncodeToString([]byte(hostname)))
+}
+
+func (c *fileServerStateCache) Get(hostname string) (*CachedServerState, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := ioutil.ReadFile(c.filename(hostname))
+	if err != nil {
+		return nil, false
+	}
+	state := &CachedServerState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		utils.Infof("Failed to parse the cached server state for %s: %s", hostname, err.Error())
+		return nil, false
+	}
+	return state, true
+}
+
+func (c *fileServerStateCache) Put(hostname string, state *CachedServerState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.put(hostname, state); err != nil {
+		utils.Infof("Failed to cache the server state for %s: %s", hostname, err.Error())
+	}
+}
+
+func (c *fileServerStateCache) put(hostname string, state *CachedServerState) error {
+	filename := c.filename(hostname)
+	if state == nil {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so that a concurrent process never reads a partially written file
+	f, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
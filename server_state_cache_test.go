@@ -0,0 +1,133 @@
+package quic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server State Cache", func() {
+	getState := func(stk string) *CachedServerState {
+		return &CachedServerState{
+			ServerConfig:       []byte("scfg"),
+			SourceAddressToken: []byte(stk),
+			CertificateChain:   []byte("cert"),
+		}
+	}
+
+	Context("LRU", func() {
+		var cache ServerStateCache
+
+		BeforeEach(func() {
+			cache = NewLRUServerStateCache(2)
+		})
+
+		It("returns false for unknown hostnames", func() {
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("saves and returns a state", func() {
+			state := getState("foo")
+			cache.Put("quic.clemente.io", state)
+			s, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(state))
+		})
+
+		It("replaces a state", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			cache.Put("quic.clemente.io", getState("bar"))
+			s, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(getState("bar")))
+		})
+
+		It("deletes a state", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			cache.Put("quic.clemente.io", nil)
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("evicts the least recently used state", func() {
+			cache.Put("a", getState("a"))
+			cache.Put("b", getState("b"))
+			_, ok := cache.Get("a")
+			Expect(ok).To(BeTrue())
+			cache.Put("c", getState("c"))
+			_, ok = cache.Get("b")
+			Expect(ok).To(BeFalse())
+			_, ok = cache.Get("a")
+			Expect(ok).To(BeTrue())
+			_, ok = cache.Get("c")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("uses a default capacity", func() {
+			cache = NewLRUServerStateCache(0)
+			Expect(cache.(*lruServerStateCache).capacity).To(Equal(defaultServerStateCacheCapacity))
+		})
+	})
+
+	Context("file-backed", func() {
+		var (
+			dir   string
+			cache ServerStateCache
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "quic-go")
+			Expect(err).ToNot(HaveOccurred())
+			cache, err = NewFileServerStateCache(filepath.Join(dir, "cache"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("returns false for unknown hostnames", func() {
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("saves and returns a state", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			s, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(getState("foo")))
+		})
+
+		It("reuses the state in a new cache", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			cache2, err := NewFileServerStateCache(filepath.Join(dir, "cache"))
+			Expect(err).ToNot(HaveOccurred())
+			s, ok := cache2.Get("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(getState("foo")))
+		})
+
+		It("deletes a state", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			cache.Put("quic.clemente.io", nil)
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+			files, err := ioutil.ReadDir(filepath.Join(dir, "cache"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		It("ignores corrupted files", func() {
+			cache.Put("quic.clemente.io", getState("foo"))
+			filename := cache.(*fileServerStateCache).filename("quic.clemente.io")
+			Expect(ioutil.WriteFile(filename, []byte("foobar"), 0600)).To(Succeed())
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
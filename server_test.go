@@ -62,13 +62,30 @@ func (s *mockSession) AcceptUniStream() (ReceiveStream, error) { panic("not impl
 func (s *mockSession) OpenStreamSync() (Stream, error)         { panic("not implemented") }
 func (s *mockSession) OpenUniStream() (SendStream, error)      { panic("not implemented") }
 func (s *mockSession) OpenUniStreamSync() (SendStream, error)  { panic("not implemented") }
-func (s *mockSession) LocalAddr() net.Addr                     { panic("not implemented") }
-func (s *mockSession) RemoteAddr() net.Addr                    { panic("not implemented") }
-func (*mockSession) Context() context.Context                  { panic("not implemented") }
-func (*mockSession) ConnectionState() ConnectionState          { panic("not implemented") }
-func (*mockSession) GetVersion() protocol.VersionNumber        { return protocol.VersionWhatever }
-func (s *mockSession) handshakeStatus() <-chan error           { return s.handshakeChan }
-func (*mockSession) getCryptoStream() cryptoStreamI            { panic("not implemented") }
+func (s *mockSession) AcceptStreamContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) AcceptUniStreamContext(context.Context) (ReceiveStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenStreamSyncContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenUniStreamSyncContext(context.Context) (SendStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) LocalAddr() net.Addr            { panic("not implemented") }
+func (s *mockSession) RemoteAddr() net.Addr           { panic("not implemented") }
+func (*mockSession) Context() context.Context         { panic("not implemented") }
+func (*mockSession) ConnectionState() ConnectionState { panic("not implemented") }
+func (*mockSession) ExportKeyingMaterial(string, []byte, int) ([]byte, error) {
+	panic("not implemented")
+}
+func (*mockSession) AddLocalAddress(net.Addr) error     { panic("not implemented") }
+func (*mockSession) RemoveLocalAddress(net.Addr) error  { panic("not implemented") }
+func (*mockSession) GetVersion() protocol.VersionNumber { return protocol.VersionWhatever }
+func (s *mockSession) handshakeStatus() <-chan error    { return s.handshakeChan }
+func (*mockSession) getCryptoStream() cryptoStreamI     { panic("not implemented") }
 
 var _ Session = &mockSession{}
 
@@ -76,7 +93,7 @@ func newMockSession(
 	_ connection,
 	_ protocol.VersionNumber,
 	connectionID protocol.ConnectionID,
-	_ *handshake.ServerConfig,
+	_ *handshake.ServerConfigManager,
 	_ *tls.Config,
 	_ *Config,
 ) (packetHandler, error) {
@@ -126,11 +143,20 @@ var _ = Describe("Server", func() {
 
 		It("setups with the right values", func() {
 			config := &Config{
-				HandshakeTimeout:            1337 * time.Minute,
-				IdleTimeout:                 42 * time.Hour,
-				RequestConnectionIDOmission: true,
-				MaxIncomingStreams:          1234,
-				MaxIncomingUniStreams:       4321,
+				HandshakeTimeout:                    1337 * time.Minute,
+				IdleTimeout:                         42 * time.Hour,
+				RequestConnectionIDOmission:         true,
+				MaxIncomingStreams:                  1234,
+				MaxIncomingUniStreams:               4321,
+				AckSendDelay:                        42 * time.Millisecond,
+				RetransmittablePacketsBeforeAck:     5,
+				DisableAckDecimation:                true,
+				PeerAckSendDelay:                    100 * time.Millisecond,
+				PeerRetransmittablePacketsBeforeAck: 20,
+				EnableMultipath:                     true,
+				FECGroupSize:                        10,
+				ServerConfigKeys:                    []ServerConfigKey{{NotBefore: time.Unix(1337, 0)}},
+				CookieKeys:                          [][32]byte{{0x42}},
 			}
 			c := populateServerConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -138,6 +164,22 @@ var _ = Describe("Server", func() {
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
 			Expect(c.MaxIncomingStreams).To(Equal(1234))
 			Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+			Expect(c.AckSendDelay).To(Equal(42 * time.Millisecond))
+			Expect(c.RetransmittablePacketsBeforeAck).To(Equal(5))
+			Expect(c.DisableAckDecimation).To(BeTrue())
+			Expect(c.PeerAckSendDelay).To(Equal(100 * time.Millisecond))
+			Expect(c.PeerRetransmittablePacketsBeforeAck).To(Equal(20))
+			Expect(c.EnableMultipath).To(BeTrue())
+			Expect(c.FECGroupSize).To(Equal(10))
+			Expect(c.ServerConfigKeys).To(Equal(config.ServerConfigKeys))
+			Expect(c.CookieKeys).To(Equal(config.CookieKeys))
+		})
+
+		It("limits the FEC group size", func() {
+			c := populateServerConfig(&Config{FECGroupSize: 1000})
+			Expect(c.FECGroupSize).To(Equal(protocol.MaxFECGroupSize))
+			c = populateServerConfig(&Config{FECGroupSize: -1})
+			Expect(c.FECGroupSize).To(BeZero())
 		})
 
 		It("disables bidirectional streams", func() {
@@ -340,6 +382,24 @@ var _ = Describe("Server", func() {
 			Eventually(func() bool { return returned }).Should(BeTrue())
 		})
 
+		It("returns from AcceptContext when the context is canceled", func() {
+			ln, err := ListenAddr("127.0.0.1:0", testdata.GetTLSConfig(), config)
+			Expect(err).ToNot(HaveOccurred())
+			defer ln.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := ln.AcceptContext(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("errors when encountering a connection error", func(done Done) {
 			testErr := errors.New("connection error")
 			conn.readErr = testErr
@@ -467,12 +527,67 @@ var _ = Describe("Server", func() {
 		Expect(server.config.KeepAlive).To(BeTrue())
 	})
 
+	It("uses the server config keys", func() {
+		key, err := GenerateServerConfigKey(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		ln, err := Listen(conn, &tls.Config{}, &Config{ServerConfigKeys: []ServerConfigKey{key}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.(*server).scfg.Current().ID).To(Equal(key.ID[:]))
+	})
+
+	It("errors if all server configs have expired", func() {
+		key, err := GenerateServerConfigKey(time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = Listen(conn, &tls.Config{}, &Config{ServerConfigKeys: []ServerConfigKey{key}})
+		Expect(err).To(MatchError("no valid server config"))
+	})
+
+	It("generates random server config keys", func() {
+		notBefore := time.Now()
+		expiry := notBefore.Add(time.Hour)
+		key1, err := GenerateServerConfigKey(notBefore, expiry)
+		Expect(err).ToNot(HaveOccurred())
+		key2, err := GenerateServerConfigKey(notBefore, expiry)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key1.NotBefore).To(Equal(notBefore))
+		Expect(key1.Expiry).To(Equal(expiry))
+		Expect(key1.ID).ToNot(Equal(key2.ID))
+		Expect(key1.Orbit).ToNot(Equal(key2.Orbit))
+		Expect(key1.PrivateKey).ToNot(Equal(key2.PrivateKey))
+		Expect(key1.P256PrivateKey).ToNot(Equal(key2.P256PrivateKey))
+		Expect(key1.P256PrivateKey).ToNot(Equal([32]byte{}))
+	})
+
 	It("errors when the Config contains an invalid version", func() {
 		version := protocol.VersionNumber(0x1234)
 		_, err := Listen(conn, &tls.Config{}, &Config{Versions: []protocol.VersionNumber{version}})
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("only uses versions that use TLS when client certificates are required", func() {
+		tlsConf := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+		versions := []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}
+		ln, err := Listen(conn, tlsConf, &Config{Versions: versions})
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Expect(ln.(*server).config.Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS}))
+		// the versions of the Config are not modified
+		Expect(versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+	})
+
+	It("uses IETF QUIC when client certificates are required, if no versions are set", func() {
+		ln, err := Listen(conn, &tls.Config{ClientAuth: tls.RequireAnyClientCert}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Expect(ln.(*server).config.Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS}))
+	})
+
+	It("errors when client certificates are required, but only gQUIC versions are used", func() {
+		tlsConf := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+		_, err := Listen(conn, tlsConf, &Config{Versions: []protocol.VersionNumber{protocol.Version39}})
+		Expect(err).To(MatchError("client certificates are required, but none of the versions supports them"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, &tls.Config{}, &Config{})
 		Expect(err).ToNot(HaveOccurred())
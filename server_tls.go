@@ -17,6 +17,7 @@ import (
 
 type nullAEAD struct {
 	aead crypto.AEAD
+	hp   crypto.HeaderProtector
 }
 
 var _ quicAEAD = &nullAEAD{}
@@ -26,6 +27,13 @@ func (n *nullAEAD) Open(dst, src []byte, packetNumber protocol.PacketNumber, ass
 	return data, protocol.EncryptionUnencrypted, err
 }
 
+func (n *nullAEAD) GetHeaderProtector(encLevel protocol.EncryptionLevel) (crypto.HeaderProtector, error) {
+	if encLevel != protocol.EncryptionUnencrypted {
+		return nil, fmt.Errorf("no header protector for encryption level %s", encLevel)
+	}
+	return n.hp, nil
+}
+
 type tlsSession struct {
 	connID protocol.ConnectionID
 	sess   packetHandler
@@ -36,6 +44,7 @@ type serverTLS struct {
 	config            *Config
 	supportedVersions []protocol.VersionNumber
 	mintConf          *mint.Config
+	tlsConf           *tls.Config
 	params            *handshake.TransportParameters
 	newMintConn       func(*handshake.CryptoStreamConn, protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
 
@@ -53,7 +62,7 @@ func newServerTLS(
 		return nil, nil, err
 	}
 	mconf.RequireCookie = true
-	cs, err := mint.NewDefaultCookieProtector()
+	cs, err := handshake.NewCookieProtector(config.CookieKeys)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -66,6 +75,7 @@ func newServerTLS(
 		config:            config,
 		supportedVersions: config.Versions,
 		mintConf:          mconf,
+		tlsConf:           tlsConf,
 		sessionChan:       sessionChan,
 		params: &handshake.TransportParameters{
 			StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
@@ -73,6 +83,9 @@ func newServerTLS(
 			IdleTimeout:                 config.IdleTimeout,
 			MaxBidiStreams:              uint16(config.MaxIncomingStreams),
 			MaxUniStreams:               uint16(config.MaxIncomingUniStreams),
+			MaxAckDelay:                 config.AckSendDelay,
+			MinAckDelay:                 protocol.MinAckDelay,
+			EnableFEC:                   config.FECGroupSize > 0,
 		},
 	}
 	s.newMintConn = s.newMintConnImpl
@@ -100,10 +113,19 @@ func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.V
 	extHandler := handshake.NewExtensionHandlerServer(s.params, s.config.Versions, v)
 	conf := s.mintConf.Clone()
 	conf.ExtensionHandler = extHandler
-	return newMintController(bc, conf, protocol.PerspectiveServer), extHandler.GetPeerParams(), nil
+	verifier := newClientCertVerifier(s.tlsConf)
+	if verifier != nil {
+		conf.VerifyPeerCertificate = verifier.VerifyPeerCertificate
+	}
+	mc := newMintController(bc, conf, protocol.PerspectiveServer)
+	mc.clientCertVerifier = verifier
+	if s.tlsConf != nil {
+		mc.keyLogWriter = s.tlsConf.KeyLogWriter
+	}
+	return mc, extHandler.GetPeerParams(), nil
 }
 
-func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
+func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, hp crypto.HeaderProtector, closeErr error) error {
 	ccf := &wire.ConnectionCloseFrame{
 		ErrorCode:    qerr.HandshakeFailed,
 		ReasonPhrase: closeErr.Error(),
@@ -115,7 +137,7 @@ func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Hea
 		PacketNumber: 1,                      // random packet number
 		Version:      clientHdr.Version,
 	}
-	data, err := packUnencryptedPacket(aead, replyHdr, ccf, protocol.PerspectiveServer)
+	data, err := packUnencryptedPacket(aead, hp, replyHdr, ccf, protocol.PerspectiveServer)
 	if err != nil {
 		return err
 	}
@@ -139,14 +161,18 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 	if err != nil {
 		return nil, err
 	}
-	frame, err := unpackInitialPacket(aead, hdr, data, hdr.Version)
+	hp, err := crypto.NewNullHeaderProtector(protocol.PerspectiveServer, hdr.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := unpackInitialPacket(aead, hp, hdr, data, hdr.Version)
 	if err != nil {
 		utils.Debugf("Error unpacking initial packet: %s", err)
 		return nil, nil
 	}
-	sess, err := s.handleUnpackedInitial(remoteAddr, hdr, frame, aead)
+	sess, err := s.handleUnpackedInitial(remoteAddr, hdr, frame, aead, hp)
 	if err != nil {
-		if ccerr := s.sendConnectionClose(remoteAddr, hdr, aead, err); ccerr != nil {
+		if ccerr := s.sendConnectionClose(remoteAddr, hdr, aead, hp, err); ccerr != nil {
 			utils.Debugf("Error sending CONNECTION_CLOSE: %s", ccerr)
 		}
 		return nil, err
@@ -154,7 +180,7 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 	return sess, nil
 }
 
-func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD) (packetHandler, error) {
+func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD, hp crypto.HeaderProtector) (packetHandler, error) {
 	version := hdr.Version
 	bc := handshake.NewCryptoStreamConn(remoteAddr)
 	bc.AddDataForReading(frame.Data)
@@ -177,7 +203,7 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 			StreamID: version.CryptoStreamID(),
 			Data:     bc.GetDataForWriting(),
 		}
-		data, err := packUnencryptedPacket(aead, replyHdr, f, protocol.PerspectiveServer)
+		data, err := packUnencryptedPacket(aead, hp, replyHdr, f, protocol.PerspectiveServer)
 		if err != nil {
 			return nil, err
 		}
@@ -205,6 +231,7 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 		tls,
 		bc,
 		aead,
+		hp,
 		&params,
 		version,
 	)
@@ -48,34 +48,45 @@ var _ = Describe("Stateless TLS handling", func() {
 		hdrBuf := &bytes.Buffer{}
 		hdr := &wire.Header{
 			IsLongHeader: true,
+			Type:         protocol.PacketTypeInitial,
 			PacketNumber: 1,
 			Version:      protocol.VersionTLS,
 		}
 		err := hdr.Write(hdrBuf, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		hdr.Raw = hdrBuf.Bytes()
+		hdrLen := hdrBuf.Len()
 		aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, 0, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
+		hp, err := crypto.NewNullHeaderProtector(protocol.PerspectiveClient, 0)
+		Expect(err).ToNot(HaveOccurred())
 		buf := &bytes.Buffer{}
 		err = f.Write(buf, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 		// pad the packet such that is has exactly the required minimum size
-		buf.Write(bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize-len(hdr.Raw)-aead.Overhead()-buf.Len()))
-		data := aead.Seal(nil, buf.Bytes(), 1, hdr.Raw)
-		Expect(len(hdr.Raw) + len(data)).To(Equal(protocol.MinInitialPacketSize))
-		return hdr, data
+		buf.Write(bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize-hdrLen-aead.Overhead()-buf.Len()))
+		raw := append(hdrBuf.Bytes(), aead.Seal(nil, buf.Bytes(), 1, hdrBuf.Bytes())...)
+		Expect(raw).To(HaveLen(protocol.MinInitialPacketSize))
+		protectHeader(hp, raw, hdrLen-4, protocol.PacketNumberLen4)
+		r := bytes.NewReader(raw)
+		hdr, err = wire.ParseHeaderSentByClient(r)
+		Expect(err).ToNot(HaveOccurred())
+		hdr.Raw = raw[:len(raw)-r.Len()]
+		return hdr, raw[len(raw)-r.Len():]
 	}
 
-	unpackPacket := func(data []byte) (*wire.Header, []byte) {
+	unpackPacket := func(data []byte) (*wire.Header, []wire.Frame) {
 		r := bytes.NewReader(conn.dataWritten.Bytes())
 		hdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 		hdr.Raw = data[:len(data)-r.Len()]
 		aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, hdr.ConnectionID, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		payload, err := aead.Open(nil, data[len(data)-r.Len():], hdr.PacketNumber, hdr.Raw)
+		hp, err := crypto.NewNullHeaderProtector(protocol.PerspectiveClient, hdr.ConnectionID)
 		Expect(err).ToNot(HaveOccurred())
-		return hdr, payload
+		unpacker := &packetUnpacker{aead: &nullAEAD{aead: aead, hp: hp}, version: protocol.VersionTLS}
+		packet, err := unpacker.Unpack(hdr, data[len(data)-r.Len():])
+		Expect(err).ToNot(HaveOccurred())
+		return hdr, packet.frames
 	}
 
 	It("sends a version negotiation packet if it doesn't support the version", func() {
@@ -112,6 +123,9 @@ var _ = Describe("Stateless TLS handling", func() {
 		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.Type).To(Equal(protocol.PacketTypeRetry))
+		// the Retry packet echoes the client's packet number
+		_, frames := unpackPacket(conn.dataWritten.Bytes())
+		Expect(frames).To(HaveLen(1))
 		Expect(sessionChan).ToNot(Receive())
 	})
 
@@ -146,12 +160,11 @@ var _ = Describe("Stateless TLS handling", func() {
 		// the Handshake packet is written by the session
 		Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 		// unpack the packet to check that it actually contains a CONNECTION_CLOSE
-		hdr, data = unpackPacket(conn.dataWritten.Bytes())
+		hdr, frames := unpackPacket(conn.dataWritten.Bytes())
 		Expect(hdr.Type).To(Equal(protocol.PacketTypeHandshake))
-		frame, err := wire.ParseNextFrame(bytes.NewReader(data), nil, protocol.VersionTLS)
-		Expect(err).ToNot(HaveOccurred())
-		Expect(frame).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
-		ccf := frame.(*wire.ConnectionCloseFrame)
+		Expect(frames).To(HaveLen(1))
+		Expect(frames[0]).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+		ccf := frames[0].(*wire.ConnectionCloseFrame)
 		Expect(ccf.ErrorCode).To(Equal(qerr.HandshakeFailed))
 		Expect(ccf.ReasonPhrase).To(Equal(mint.AlertAccessDenied.String()))
 	})
@@ -21,7 +21,7 @@ import (
 )
 
 type unpacker interface {
-	Unpack(headerBinary []byte, hdr *wire.Header, data []byte) (*unpackedPacket, error)
+	Unpack(hdr *wire.Header, data []byte) (*unpackedPacket, error)
 }
 
 type streamGetter interface {
@@ -34,10 +34,10 @@ type streamManager interface {
 	GetOrOpenReceiveStream(protocol.StreamID) (receiveStreamI, error)
 	OpenStream() (Stream, error)
 	OpenUniStream() (SendStream, error)
-	OpenStreamSync() (Stream, error)
-	OpenUniStreamSync() (SendStream, error)
-	AcceptStream() (Stream, error)
-	AcceptUniStream() (ReceiveStream, error)
+	OpenStreamSync(context.Context) (Stream, error)
+	OpenUniStreamSync(context.Context) (SendStream, error)
+	AcceptStream(context.Context) (Stream, error)
+	AcceptUniStream(context.Context) (ReceiveStream, error)
 	DeleteStream(protocol.StreamID) error
 	UpdateLimits(*handshake.TransportParameters)
 	HandleMaxStreamIDFrame(*wire.MaxStreamIDFrame) error
@@ -111,24 +111,36 @@ type session struct {
 	handshakeChan     chan error
 	handshakeComplete bool
 
-	receivedFirstPacket              bool // since packet numbers start at 0, we can't use largestRcvdPacketNumber != 0 for this
+	receivedFirstPacket              bool // since packet numbers start at 0, we can't use lastRcvdPacketNumber != 0 for this
 	receivedFirstForwardSecurePacket bool
-	lastRcvdPacketNumber             protocol.PacketNumber
-	// Used to calculate the next packet number from the truncated wire
-	// representation, and sent back in public reset packets
-	largestRcvdPacketNumber protocol.PacketNumber
+	// sent back in public reset packets
+	lastRcvdPacketNumber protocol.PacketNumber
 
 	sessionCreationTime     time.Time
 	lastNetworkActivityTime time.Time
 	// pacingDeadline is the time when the next packet should be sent
 	pacingDeadline time.Time
 
-	peerParams *handshake.TransportParameters
+	peerParams      *handshake.TransportParameters
+	peerParamsMutex sync.Mutex // needed since the peerParams are read by ConnectionState
 
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
+	// ackFrequencyFrameQueued stores whether an ACK_FREQUENCY frame was queued
+	ackFrequencyFrameQueued bool
+
+	// additional paths, only used for gQUIC multipath sessions
+	paths        map[protocol.PathID]*path
+	closedPaths  map[protocol.PathID]struct{}
+	nextPathID   protocol.PathID
+	pathRequests chan *pathRequest
+	// packets that were outstanding on a path when it was closed
+	closedPathRetransmissions []*ackhandler.Packet
+
+	// only set if FEC is enabled
+	fecDecoder *fecDecoder
 }
 
 var _ Session = &session{}
@@ -139,7 +151,7 @@ func newSession(
 	conn connection,
 	v protocol.VersionNumber,
 	connectionID protocol.ConnectionID,
-	scfg *handshake.ServerConfig,
+	scfg *handshake.ServerConfigManager,
 	tlsConf *tls.Config,
 	config *Config,
 ) (packetHandler, error) {
@@ -160,6 +172,8 @@ func newSession(
 		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
+		EnableMultipath:             s.config.EnableMultipath,
+		EnableFEC:                   s.config.FECGroupSize > 0,
 	}
 	cs, err := newCryptoSetup(
 		s.cryptoStream,
@@ -168,6 +182,7 @@ func newSession(
 		s.version,
 		scfg,
 		transportParams,
+		tlsConf,
 		s.config.Versions,
 		s.config.AcceptCookie,
 		paramsChan,
@@ -209,6 +224,8 @@ var newClientSession = func(
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
 		OmitConnectionID:            s.config.RequestConnectionIDOmission,
+		EnableMultipath:             s.config.EnableMultipath,
+		EnableFEC:                   s.config.FECGroupSize > 0,
 	}
 	cs, err := newCryptoSetupClient(
 		s.cryptoStream,
@@ -216,6 +233,7 @@ var newClientSession = func(
 		s.connectionID,
 		s.version,
 		tlsConf,
+		config.ServerStateCache,
 		transportParams,
 		paramsChan,
 		handshakeEvent,
@@ -237,6 +255,7 @@ func newTLSServerSession(
 	tls handshake.MintTLS,
 	cryptoStreamConn *handshake.CryptoStreamConn,
 	nullAEAD crypto.AEAD,
+	nullHeaderProtector crypto.HeaderProtector,
 	peerParams *handshake.TransportParameters,
 	v protocol.VersionNumber,
 ) (packetHandler, error) {
@@ -254,6 +273,7 @@ func newTLSServerSession(
 		tls,
 		cryptoStreamConn,
 		nullAEAD,
+		nullHeaderProtector,
 		handshakeEvent,
 		v,
 	)
@@ -262,7 +282,7 @@ func newTLSServerSession(
 	}
 	s.peerParams = peerParams
 	s.processTransportParameters(peerParams)
-	s.unpacker = &packetUnpacker{aead: s.cryptoSetup, version: s.version}
+	s.unpacker = &packetUnpacker{aead: s.cryptoSetup, version: s.version, fecDecoder: s.fecDecoder}
 	return s, nil
 }
 
@@ -320,6 +340,10 @@ func (s *session) postSetup(initialPacketNumber protocol.PacketNumber) error {
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
+	s.paths = make(map[protocol.PathID]*path)
+	s.closedPaths = make(map[protocol.PathID]struct{})
+	s.nextPathID = protocol.InitialPathID + 1
+	s.pathRequests = make(chan *pathRequest)
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
@@ -327,8 +351,14 @@ func (s *session) postSetup(initialPacketNumber protocol.PacketNumber) error {
 	s.lastNetworkActivityTime = now
 	s.sessionCreationTime = now
 
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats)
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.version)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.version)
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(
+		s.rttStats,
+		s.config.AckSendDelay,
+		s.config.RetransmittablePacketsBeforeAck,
+		!s.config.DisableAckDecimation,
+		s.version,
+	)
 
 	if s.version.UsesTLS() {
 		s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
@@ -346,7 +376,10 @@ func (s *session) postSetup(initialPacketNumber protocol.PacketNumber) error {
 		s.version,
 	)
 	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.cryptoStream, s.packer.QueueControlFrame)
-	s.unpacker = &packetUnpacker{aead: s.cryptoSetup, version: s.version}
+	if s.config.FECGroupSize > 0 {
+		s.fecDecoder = newFECDecoder()
+	}
+	s.unpacker = &packetUnpacker{aead: s.cryptoSetup, version: s.version, fecDecoder: s.fecDecoder}
 	return nil
 }
 
@@ -398,8 +431,11 @@ runLoop:
 			// This is a bit unclean, but works properly, since the packet always
 			// begins with the public header and we never copy it.
 			putPacketBuffer(&p.header.Raw)
+		case req := <-s.pathRequests:
+			s.handlePathRequest(req)
 		case p := <-s.paramsChan:
 			s.processTransportParameters(&p)
+			s.maybeQueueAckFrequencyFrame()
 		case _, ok := <-handshakeEvent:
 			if !ok { // the aeadChanged chan was closed. This means that the handshake is completed.
 				s.handshakeComplete = true
@@ -410,6 +446,7 @@ runLoop:
 					// We need to make sure that the client actually sends such a packet.
 					s.packer.QueueControlFrame(&wire.PingFrame{})
 				}
+				s.maybeQueueAckFrequencyFrame()
 				close(s.handshakeChan)
 			} else {
 				s.tryDecryptingQueuedPackets()
@@ -424,10 +461,17 @@ runLoop:
 				s.closeLocal(err)
 			}
 		}
+		for _, pth := range s.paths {
+			if timeout := pth.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
+				if err := pth.sentPacketHandler.OnAlarm(); err != nil {
+					s.closeLocal(err)
+				}
+			}
+		}
 
 		var pacingDeadline time.Time
 		if s.pacingDeadline.IsZero() { // the timer didn't have a pacing deadline set
-			pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+			pacingDeadline = s.timeUntilSend()
 		}
 		if s.config.KeepAlive && !s.keepAlivePingSent && s.handshakeComplete && time.Since(s.lastNetworkActivityTime) >= s.peerParams.IdleTimeout/2 {
 			// send the PING frame since there is no activity in the session
@@ -462,6 +506,9 @@ runLoop:
 		s.handshakeChan <- closeErr.err
 	}
 	s.handleCloseError(closeErr)
+	for _, pth := range s.paths {
+		pth.conn.Close()
+	}
 	return closeErr.err
 }
 
@@ -470,7 +517,21 @@ func (s *session) Context() context.Context {
 }
 
 func (s *session) ConnectionState() ConnectionState {
-	return s.cryptoSetup.ConnectionState()
+	state := s.cryptoSetup.ConnectionState()
+	state.Version = s.version
+	s.peerParamsMutex.Lock()
+	if s.peerParams != nil {
+		state.PeerIdleTimeout = s.peerParams.IdleTimeout
+		state.PeerStreamFlowControlWindow = uint64(s.peerParams.StreamFlowControlWindow)
+		state.PeerConnectionFlowControlWindow = uint64(s.peerParams.ConnectionFlowControlWindow)
+		state.PeerMaxPacketSize = uint64(s.peerParams.MaxPacketSize)
+	}
+	s.peerParamsMutex.Unlock()
+	return state
+}
+
+func (s *session) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	return s.cryptoSetup.ExportKeyingMaterial(label, context, length)
 }
 
 func (s *session) maybeResetTimer() {
@@ -487,6 +548,14 @@ func (s *session) maybeResetTimer() {
 	if lossTime := s.sentPacketHandler.GetAlarmTimeout(); !lossTime.IsZero() {
 		deadline = utils.MinTime(deadline, lossTime)
 	}
+	for _, pth := range s.paths {
+		if ackAlarm := pth.receivedPacketHandler.GetAlarmTimeout(); !ackAlarm.IsZero() {
+			deadline = utils.MinTime(deadline, ackAlarm)
+		}
+		if lossTime := pth.sentPacketHandler.GetAlarmTimeout(); !lossTime.IsZero() {
+			deadline = utils.MinTime(deadline, lossTime)
+		}
+	}
 	if !s.handshakeComplete {
 		handshakeDeadline := s.sessionCreationTime.Add(s.config.HandshakeTimeout)
 		deadline = utils.MinTime(deadline, handshakeDeadline)
@@ -520,14 +589,11 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	hdr := p.header
 	data := p.data
 
-	// Calculate packet number
-	hdr.PacketNumber = protocol.InferPacketNumber(
-		hdr.PacketNumberLen,
-		s.largestRcvdPacketNumber,
-		hdr.PacketNumber,
-	)
+	if hdr.PathID != protocol.InitialPathID {
+		return s.handlePathPacket(p)
+	}
 
-	packet, err := s.unpacker.Unpack(hdr.Raw, hdr, data)
+	packet, err := s.unpacker.Unpack(hdr, data)
 	if utils.Debug() {
 		if err != nil {
 			utils.Debugf("<- Reading packet 0x%x (%d bytes) for connection %x", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.ConnectionID)
@@ -551,8 +617,6 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	s.lastRcvdPacketNumber = hdr.PacketNumber
-	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
-	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
 
 	// If this is a Retry packet, there's no need to send an ACK.
 	// The session will be closed and recreated as soon as the crypto setup processed the HRR.
@@ -594,6 +658,12 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.StopSendingFrame:
 			err = s.handleStopSendingFrame(frame)
 		case *wire.PingFrame:
+		case *wire.AckFrequencyFrame:
+			err = s.receivedPacketHandler.ReceivedAckFrequencyFrame(frame)
+		case *wire.ClosePathFrame:
+			err = s.handleClosePathFrame(frame)
+		case *wire.FECFrame:
+			err = s.handleFECFrame(frame)
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -698,6 +768,31 @@ func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.Encrypt
 	return nil
 }
 
+func (s *session) handleFECFrame(frame *wire.FECFrame) error {
+	if s.fecDecoder == nil {
+		return qerr.Error(qerr.InvalidFrameData, "received FEC frame, but FEC is not enabled")
+	}
+	packet, err := s.fecDecoder.ReceivedFECFrame(frame)
+	if err != nil || packet == nil {
+		return err
+	}
+	hdr := &wire.Header{PacketNumber: packet.packetNumber, PacketNumberLen: packet.packetNumberLen}
+	frames, err := parseFrames(packet.data, hdr, protocol.EncryptionForwardSecure, s.version)
+	if err != nil {
+		return err
+	}
+	utils.Debugf("Recovered packet 0x%x using FEC", packet.packetNumber)
+	// The recovered packet is acknowledged, so that the peer doesn't declare it lost.
+	if err := s.receivedPacketHandler.ReceivedPacket(packet.packetNumber, time.Now(), ackhandler.HasRetransmittableFrames(frames)); err != nil {
+		return err
+	}
+	// ACK frames in the recovered packet are handled as if the packet had been received
+	lastRcvdPacketNumber := s.lastRcvdPacketNumber
+	s.lastRcvdPacketNumber = packet.packetNumber
+	defer func() { s.lastRcvdPacketNumber = lastRcvdPacketNumber }()
+	return s.handleFrames(frames, protocol.EncryptionForwardSecure)
+}
+
 func (s *session) closeLocal(e error) {
 	s.closeOnce.Do(func() {
 		s.closeChan <- closeError{err: e, remote: false}
@@ -756,7 +851,9 @@ func (s *session) handleCloseError(closeErr closeError) error {
 }
 
 func (s *session) processTransportParameters(params *handshake.TransportParameters) {
+	s.peerParamsMutex.Lock()
 	s.peerParams = params
+	s.peerParamsMutex.Unlock()
 	s.streamsMap.UpdateLimits(params)
 	if params.OmitConnectionID {
 		s.packer.SetOmitConnectionID()
@@ -764,20 +861,82 @@ func (s *session) processTransportParameters(params *handshake.TransportParamete
 	if params.MaxPacketSize != 0 {
 		s.packer.SetMaxPacketSize(params.MaxPacketSize)
 	}
+	if params.MaxAckDelay != 0 {
+		s.rttStats.SetMaxAckDelay(params.MaxAckDelay)
+	}
+	if s.config.FECGroupSize > 0 && params.EnableFEC {
+		s.packer.EnableFEC(s.config.FECGroupSize)
+	}
 	s.connFlowController.UpdateSendWindow(params.ConnectionFlowControlWindow)
 	// the crypto stream is the only open stream at this moment
 	// so we don't need to update stream flow control windows
 }
 
+// maybeQueueAckFrequencyFrame asks the peer to change the rate at which it sends ACKs, if configured to do so.
+// This is only possible after the handshake completed, and if the peer supports the ACK frequency extension.
+func (s *session) maybeQueueAckFrequencyFrame() {
+	if s.ackFrequencyFrameQueued || !s.handshakeComplete || s.peerParams == nil || s.peerParams.MinAckDelay == 0 {
+		return
+	}
+	if s.config.PeerAckSendDelay == 0 && s.config.PeerRetransmittablePacketsBeforeAck <= 0 {
+		return
+	}
+	ackDelay := protocol.DefaultMaxAckDelay
+	if s.config.PeerAckSendDelay != 0 {
+		ackDelay = utils.MaxDuration(s.config.PeerAckSendDelay, s.peerParams.MinAckDelay)
+	}
+	packetTolerance := protocol.DefaultRetransmittablePacketsBeforeAck
+	if s.config.PeerRetransmittablePacketsBeforeAck > 0 {
+		packetTolerance = s.config.PeerRetransmittablePacketsBeforeAck
+	}
+	s.ackFrequencyFrameQueued = true
+	// The peer might already use the new max ack delay before the ACK_FREQUENCY frame is acknowledged.
+	s.rttStats.SetMaxAckDelay(utils.MaxDuration(s.rttStats.MaxAckDelay(), ackDelay))
+	s.queueControlFrame(&wire.AckFrequencyFrame{
+		PacketTolerance:   uint64(packetTolerance),
+		UpdateMaxAckDelay: ackDelay,
+	})
+}
+
+// sendPackets sends packets on all paths.
+// Paths with a lower RTT are used first.
 func (s *session) sendPackets() error {
 	s.pacingDeadline = time.Time{}
+	for _, pth := range s.getPaths() {
+		pacingDeadline, err := s.sendPacketsOnPath(pth)
+		if err != nil {
+			if err == errPathClosed {
+				continue
+			}
+			return err
+		}
+		if !pacingDeadline.IsZero() && (s.pacingDeadline.IsZero() || pacingDeadline.Before(s.pacingDeadline)) {
+			s.pacingDeadline = pacingDeadline
+		}
+	}
+	return nil
+}
+
+// timeUntilSend returns the earliest time when a packet can be sent on any of the paths
+func (s *session) timeUntilSend() time.Time {
+	t := s.sentPacketHandler.TimeUntilSend()
+	for _, pth := range s.paths {
+		if t2 := pth.sentPacketHandler.TimeUntilSend(); t2.Before(t) {
+			t = t2
+		}
+	}
+	return t
+}
 
-	sendMode := s.sentPacketHandler.SendMode()
+// sendPacketsOnPath sends packets on a single path.
+// It returns the pacing deadline for this path, if any.
+func (s *session) sendPacketsOnPath(pth *path) (time.Time, error) {
+	sendMode := pth.sentPacketHandler.SendMode()
 	if sendMode == ackhandler.SendNone { // shortcut: return immediately if there's nothing to send
-		return nil
+		return time.Time{}, nil
 	}
 
-	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
+	numPackets := pth.sentPacketHandler.ShouldSendNumPackets()
 	var numPacketsSent int
 sendLoop:
 	for {
@@ -788,11 +947,11 @@ sendLoop:
 			// We can at most send a single ACK only packet.
 			// There will only be a new ACK after receiving new packets.
 			// SendAck is only returned when we're congestion limited, so we don't need to set the pacingt timer.
-			return s.maybeSendAckOnlyPacket()
+			return time.Time{}, s.maybeSendAckOnlyPacket(pth)
 		case ackhandler.SendRetransmission:
-			sentPacket, err := s.maybeSendRetransmission()
+			sentPacket, err := s.maybeSendRetransmission(pth)
 			if err != nil {
-				return err
+				return time.Time{}, err
 			}
 			if sentPacket {
 				numPacketsSent++
@@ -800,56 +959,67 @@ sendLoop:
 				// e.g. when an Initial is queued, but we already received a packet from the server.
 			}
 		case ackhandler.SendAny:
-			sentPacket, err := s.sendPacket()
+			var sentPacket bool
+			var err error
+			if len(s.closedPathRetransmissions) > 0 {
+				sentPacket, err = s.sendClosedPathRetransmission(pth)
+			} else {
+				sentPacket, err = s.sendPacket(pth)
+			}
 			if err != nil {
-				return err
+				return time.Time{}, err
 			}
 			if !sentPacket {
+				// There's no more data to send, so the partial FEC group is sent right away.
+				pth.packer.CloseFECGroup()
+				if err := s.maybeSendFECPacket(pth); err != nil {
+					return time.Time{}, err
+				}
 				break sendLoop
 			}
 			numPacketsSent++
 		default:
-			return fmt.Errorf("BUG: invalid send mode %d", sendMode)
+			return time.Time{}, fmt.Errorf("BUG: invalid send mode %d", sendMode)
 		}
 		if numPacketsSent >= numPackets {
 			break
 		}
-		sendMode = s.sentPacketHandler.SendMode()
+		sendMode = pth.sentPacketHandler.SendMode()
 	}
 	// Only start the pacing timer if we sent as many packets as we were allowed.
 	// There will probably be more to send when calling sendPacket again.
 	if numPacketsSent == numPackets {
-		s.pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+		return pth.sentPacketHandler.TimeUntilSend(), nil
 	}
-	return nil
+	return time.Time{}, nil
 }
 
-func (s *session) maybeSendAckOnlyPacket() error {
-	ack := s.receivedPacketHandler.GetAckFrame()
+func (s *session) maybeSendAckOnlyPacket(pth *path) error {
+	ack := pth.receivedPacketHandler.GetAckFrame()
 	if ack == nil {
 		return nil
 	}
-	s.packer.QueueControlFrame(ack)
+	pth.packer.QueueControlFrame(ack)
 
 	if s.version.UsesStopWaitingFrames() { // for gQUIC, maybe add a STOP_WAITING
-		if swf := s.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
-			s.packer.QueueControlFrame(swf)
+		if swf := pth.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
+			pth.packer.QueueControlFrame(swf)
 		}
 	}
-	packet, err := s.packer.PackAckPacket()
+	packet, err := pth.packer.PackAckPacket()
 	if err != nil {
 		return err
 	}
-	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
-	return s.sendPackedPacket(packet)
+	pth.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	return s.sendPackedPacket(pth, packet)
 }
 
 // maybeSendRetransmission sends retransmissions for at most one packet.
 // It takes care that Initials aren't retransmitted, if a packet from the server was already received.
-func (s *session) maybeSendRetransmission() (bool, error) {
+func (s *session) maybeSendRetransmission(pth *path) (bool, error) {
 	var retransmitPacket *ackhandler.Packet
 	for {
-		retransmitPacket = s.sentPacketHandler.DequeuePacketForRetransmission()
+		retransmitPacket = pth.sentPacketHandler.DequeuePacketForRetransmission()
 		if retransmitPacket == nil {
 			return false, nil
 		}
@@ -871,9 +1041,9 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 	}
 
 	if s.version.UsesStopWaitingFrames() {
-		s.packer.QueueControlFrame(s.sentPacketHandler.GetStopWaitingFrame(true))
+		pth.packer.QueueControlFrame(pth.sentPacketHandler.GetStopWaitingFrame(true))
 	}
-	packets, err := s.packer.PackRetransmission(retransmitPacket)
+	packets, err := pth.packer.PackRetransmission(retransmitPacket)
 	if err != nil {
 		return false, err
 	}
@@ -881,16 +1051,41 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 	for i, packet := range packets {
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
 	}
-	s.sentPacketHandler.SentPacketsAsRetransmission(ackhandlerPackets, retransmitPacket.PacketNumber)
+	pth.sentPacketHandler.SentPacketsAsRetransmission(ackhandlerPackets, retransmitPacket.PacketNumber)
 	for _, packet := range packets {
-		if err := s.sendPackedPacket(packet); err != nil {
+		if err := s.sendPackedPacket(pth, packet); err != nil {
 			return false, err
 		}
 	}
 	return true, nil
 }
 
-func (s *session) sendPacket() (bool, error) {
+// sendClosedPathRetransmission retransmits a packet that was outstanding on a closed path.
+// Since the packet was sent in a different packet number space, the retransmission is registered as a new packet.
+func (s *session) sendClosedPathRetransmission(pth *path) (bool, error) {
+	retransmitPacket := s.closedPathRetransmissions[0]
+	s.closedPathRetransmissions = s.closedPathRetransmissions[1:]
+	utils.Debugf("\tDequeueing retransmission for packet 0x%x sent on a closed path", retransmitPacket.PacketNumber)
+
+	swf := pth.sentPacketHandler.GetStopWaitingFrame(true)
+	if swf == nil { // no packet was acknowledged on this path yet
+		swf = &wire.StopWaitingFrame{LeastUnacked: 1}
+	}
+	pth.packer.QueueControlFrame(swf)
+	packets, err := pth.packer.PackRetransmission(retransmitPacket)
+	if err != nil {
+		return false, err
+	}
+	for _, packet := range packets {
+		pth.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+		if err := s.sendPackedPacket(pth, packet); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *session) sendPacket(pth *path) (bool, error) {
 	if offset := s.connFlowController.GetWindowUpdate(); offset != 0 {
 		s.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: offset})
 	}
@@ -899,30 +1094,52 @@ func (s *session) sendPacket() (bool, error) {
 	}
 	s.windowUpdateQueue.QueueAll()
 
-	if ack := s.receivedPacketHandler.GetAckFrame(); ack != nil {
-		s.packer.QueueControlFrame(ack)
+	if ack := pth.receivedPacketHandler.GetAckFrame(); ack != nil {
+		pth.packer.QueueControlFrame(ack)
 		if s.version.UsesStopWaitingFrames() {
-			if swf := s.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
-				s.packer.QueueControlFrame(swf)
+			if swf := pth.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
+				pth.packer.QueueControlFrame(swf)
 			}
 		}
 	}
 
-	packet, err := s.packer.PackPacket()
+	packet, err := pth.packer.PackPacket()
 	if err != nil || packet == nil {
 		return false, err
 	}
-	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
-	if err := s.sendPackedPacket(packet); err != nil {
+	pth.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	if err := s.sendPackedPacket(pth, packet); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (s *session) sendPackedPacket(packet *packedPacket) error {
+func (s *session) sendPackedPacket(pth *path, packet *packedPacket) error {
 	defer putPacketBuffer(&packet.raw)
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	err := pth.conn.Write(packet.raw)
+	if err != nil && !pth.isInitialPath() {
+		// If sending fails on an additional path, only this path is closed.
+		utils.Infof("Error sending packet on path %d: %s", pth.pathID, err)
+		if err := s.closePath(pth, true); err != nil {
+			return err
+		}
+		return errPathClosed
+	}
+	if err != nil {
+		return err
+	}
+	return s.maybeSendFECPacket(pth)
+}
+
+// maybeSendFECPacket sends an FEC packet, if an FEC group was completed
+func (s *session) maybeSendFECPacket(pth *path) error {
+	packet, err := pth.packer.PackFECPacket()
+	if err != nil || packet == nil {
+		return err
+	}
+	pth.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	return s.sendPackedPacket(pth, packet)
 }
 
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
@@ -966,11 +1183,19 @@ func (s *session) GetOrOpenStream(id protocol.StreamID) (Stream, error) {
 
 // AcceptStream returns the next stream openend by the peer
 func (s *session) AcceptStream() (Stream, error) {
-	return s.streamsMap.AcceptStream()
+	return s.AcceptStreamContext(context.Background())
+}
+
+func (s *session) AcceptStreamContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.AcceptStream(ctx)
 }
 
 func (s *session) AcceptUniStream() (ReceiveStream, error) {
-	return s.streamsMap.AcceptUniStream()
+	return s.AcceptUniStreamContext(context.Background())
+}
+
+func (s *session) AcceptUniStreamContext(ctx context.Context) (ReceiveStream, error) {
+	return s.streamsMap.AcceptUniStream(ctx)
 }
 
 // OpenStream opens a stream
@@ -979,7 +1204,11 @@ func (s *session) OpenStream() (Stream, error) {
 }
 
 func (s *session) OpenStreamSync() (Stream, error) {
-	return s.streamsMap.OpenStreamSync()
+	return s.OpenStreamSyncContext(context.Background())
+}
+
+func (s *session) OpenStreamSyncContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.OpenStreamSync(ctx)
 }
 
 func (s *session) OpenUniStream() (SendStream, error) {
@@ -987,7 +1216,11 @@ func (s *session) OpenUniStream() (SendStream, error) {
 }
 
 func (s *session) OpenUniStreamSync() (SendStream, error) {
-	return s.streamsMap.OpenUniStreamSync()
+	return s.OpenUniStreamSyncContext(context.Background())
+}
+
+func (s *session) OpenUniStreamSyncContext(ctx context.Context) (SendStream, error) {
+	return s.streamsMap.OpenUniStreamSync(ctx)
 }
 
 func (s *session) newStream(id protocol.StreamID) streamI {
@@ -49,6 +49,7 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
+func (m *mockConnection) WriteTo(p []byte, _ net.Addr) error { return m.Write(p) }
 func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
@@ -62,7 +63,7 @@ type mockUnpacker struct {
 	unpackErr error
 }
 
-func (m *mockUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+func (m *mockUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
 	if m.unpackErr != nil {
 		return nil, m.unpackErr
 	}
@@ -80,7 +81,7 @@ func areSessionsRunning() bool {
 var _ = Describe("Session", func() {
 	var (
 		sess          *session
-		scfg          *handshake.ServerConfig
+		scfg          *handshake.ServerConfigManager
 		mconn         *mockConnection
 		cryptoSetup   *mockCryptoSetup
 		streamManager *MockStreamManager
@@ -96,8 +97,9 @@ var _ = Describe("Session", func() {
 			_ protocol.ConnectionID,
 			_ net.Addr,
 			_ protocol.VersionNumber,
-			_ *handshake.ServerConfig,
+			_ *handshake.ServerConfigManager,
 			_ *handshake.TransportParameters,
+			_ *tls.Config,
 			_ []protocol.VersionNumber,
 			_ func(net.Addr, *Cookie) bool,
 			_ chan<- handshake.TransportParameters,
@@ -109,9 +111,8 @@ var _ = Describe("Session", func() {
 
 		mconn = newMockConnection()
 		certChain := crypto.NewCertChain(testdata.GetTLSConfig())
-		kex, err := crypto.NewCurve25519KEX()
-		Expect(err).NotTo(HaveOccurred())
-		scfg, err = handshake.NewServerConfig(kex, certChain)
+		var err error
+		scfg, err = handshake.NewServerConfigManager(nil, nil, certChain, nil)
 		Expect(err).NotTo(HaveOccurred())
 		var pSess Session
 		pSess, err = newSession(
@@ -147,8 +148,9 @@ var _ = Describe("Session", func() {
 				_ protocol.ConnectionID,
 				_ net.Addr,
 				_ protocol.VersionNumber,
-				_ *handshake.ServerConfig,
+				_ *handshake.ServerConfigManager,
 				_ *handshake.TransportParameters,
+				_ *tls.Config,
 				_ []protocol.VersionNumber,
 				cookieFunc func(net.Addr, *Cookie) bool,
 				_ chan<- handshake.TransportParameters,
@@ -410,6 +412,15 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("passes ACK_FREQUENCY frames to the ReceivedPacketHandler", func() {
+			f := &wire.AckFrequencyFrame{PacketTolerance: 5, UpdateMaxAckDelay: 50 * time.Millisecond}
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedAckFrequencyFrame(f)
+			sess.receivedPacketHandler = rph
+			err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It("handles BLOCKED frames", func() {
 			err := sess.handleFrames([]wire.Frame{&wire.BlockedFrame{}}, protocol.EncryptionUnspecified)
 			Expect(err).NotTo(HaveOccurred())
@@ -459,7 +470,7 @@ var _ = Describe("Session", func() {
 
 	It("accepts new streams", func() {
 		mstr := NewMockStreamI(mockCtrl)
-		streamManager.EXPECT().AcceptStream().Return(mstr, nil)
+		streamManager.EXPECT().AcceptStream(context.Background()).Return(mstr, nil)
 		str, err := sess.AcceptStream()
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str).To(Equal(mstr))
@@ -551,12 +562,11 @@ var _ = Describe("Session", func() {
 			hdr = &wire.Header{PacketNumberLen: protocol.PacketNumberLen6}
 		})
 
-		It("sets the {last,largest}RcvdPacketNumber", func() {
+		It("sets the lastRcvdPacketNumber", func() {
 			hdr.PacketNumber = 5
 			err := sess.handlePacketImpl(&receivedPacket{header: hdr})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.lastRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
-			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 		})
 
 		It("informs the ReceivedPacketHandler", func() {
@@ -596,17 +606,15 @@ var _ = Describe("Session", func() {
 			close(done)
 		})
 
-		It("sets the {last,largest}RcvdPacketNumber, for an out-of-order packet", func() {
+		It("sets the lastRcvdPacketNumber, for an out-of-order packet", func() {
 			hdr.PacketNumber = 5
 			err := sess.handlePacketImpl(&receivedPacket{header: hdr})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.lastRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
-			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 			hdr.PacketNumber = 3
 			err = sess.handlePacketImpl(&receivedPacket{header: hdr})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.lastRcvdPacketNumber).To(Equal(protocol.PacketNumber(3)))
-			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 		})
 
 		It("handles duplicate packets", func() {
@@ -659,7 +667,7 @@ var _ = Describe("Session", func() {
 			packetNumber := protocol.PacketNumber(0x035e)
 			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
-			sent, err := sess.sendPacket()
+			sent, err := sess.sendPacket(sess.initialPath())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeTrue())
 			Expect(mconn.written).To(HaveLen(1))
@@ -679,7 +687,7 @@ var _ = Describe("Session", func() {
 				Expect(p.SendTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
 			})
 			sess.sentPacketHandler = sph
-			sent, err := sess.sendPacket()
+			sent, err := sess.sendPacket(sess.initialPath())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeTrue())
 		})
@@ -694,7 +702,7 @@ var _ = Describe("Session", func() {
 				Expect(p.Frames).To(ContainElement(&wire.MaxStreamDataFrame{StreamID: 2, ByteOffset: 20}))
 			})
 			sess.sentPacketHandler = sph
-			sent, err := sess.sendPacket()
+			sent, err := sess.sendPacket(sess.initialPath())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeTrue())
 		})
@@ -711,7 +719,7 @@ var _ = Describe("Session", func() {
 				}))
 			})
 			sess.sentPacketHandler = sph
-			sent, err := sess.sendPacket()
+			sent, err := sess.sendPacket(sess.initialPath())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeTrue())
 		})
@@ -742,7 +750,7 @@ var _ = Describe("Session", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.receivedFirstPacket).To(BeTrue())
-			sent, err := sess.maybeSendRetransmission()
+			sent, err := sess.maybeSendRetransmission(sess.initialPath())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeFalse())
 		})
@@ -920,7 +928,7 @@ var _ = Describe("Session", func() {
 		It("doesn't do anything if there's no ACK to be sent", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sess.sentPacketHandler = sph
-			err := sess.maybeSendAckOnlyPacket()
+			err := sess.maybeSendAckOnlyPacket(sess.initialPath())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(mconn.written).To(BeEmpty())
 		})
@@ -1017,7 +1025,7 @@ var _ = Describe("Session", func() {
 					Expect(p.Frames).To(Equal([]wire.Frame{swf, sf}))
 					Expect(p.SendTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
 				})
-				sent, err := sess.maybeSendRetransmission()
+				sent, err := sess.maybeSendRetransmission(sess.initialPath())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(1))
@@ -1039,7 +1047,7 @@ var _ = Describe("Session", func() {
 					Expect(p.Frames).To(Equal([]wire.Frame{sf}))
 					Expect(p.SendTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
 				})
-				sent, err := sess.maybeSendRetransmission()
+				sent, err := sess.maybeSendRetransmission(sess.initialPath())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(1))
@@ -1067,7 +1075,7 @@ var _ = Describe("Session", func() {
 					Expect(p.Frames[1]).To(Equal(f))
 					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
 				})
-				sent, err := sess.maybeSendRetransmission()
+				sent, err := sess.maybeSendRetransmission(sess.initialPath())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(1))
@@ -1091,7 +1099,7 @@ var _ = Describe("Session", func() {
 					Expect(p.Frames).To(Equal([]wire.Frame{f}))
 					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
 				})
-				sent, err := sess.maybeSendRetransmission()
+				sent, err := sess.maybeSendRetransmission(sess.initialPath())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(1))
@@ -1117,7 +1125,7 @@ var _ = Describe("Session", func() {
 						Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
 					}
 				})
-				sent, err := sess.maybeSendRetransmission()
+				sent, err := sess.maybeSendRetransmission(sess.initialPath())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(2))
@@ -1407,18 +1415,260 @@ var _ = Describe("Session", func() {
 			ConnectionFlowControlWindow: 0x5000,
 			OmitConnectionID:            true,
 			MaxPacketSize:               0x42,
+			MaxAckDelay:                 42 * time.Millisecond,
 		}
 		streamManager.EXPECT().UpdateLimits(&params)
 		paramsChan <- params
 		Eventually(func() *handshake.TransportParameters { return sess.peerParams }).Should(Equal(&params))
 		Eventually(func() bool { return sess.packer.omitConnectionID }).Should(BeTrue())
 		Eventually(func() protocol.ByteCount { return sess.packer.maxPacketSize }).Should(Equal(protocol.ByteCount(0x42)))
+		Eventually(func() time.Duration { return sess.rttStats.MaxAckDelay() }).Should(Equal(42 * time.Millisecond))
 		// make the go routine return
 		streamManager.EXPECT().CloseWithError(gomock.Any())
 		Expect(sess.Close(nil)).To(Succeed())
 		Eventually(done).Should(BeClosed())
 	})
 
+	Context("ACK frequency", func() {
+		BeforeEach(func() {
+			sess.handshakeComplete = true
+			sess.peerParams = &handshake.TransportParameters{MinAckDelay: 5 * time.Millisecond}
+			sess.config.PeerAckSendDelay = 100 * time.Millisecond
+			sess.config.PeerRetransmittablePacketsBeforeAck = 20
+		})
+
+		It("asks the peer to change its ack frequency", func() {
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.AckFrequencyFrame{
+				PacketTolerance:   20,
+				UpdateMaxAckDelay: 100 * time.Millisecond,
+			}}))
+			Expect(sess.rttStats.MaxAckDelay()).To(Equal(100 * time.Millisecond))
+			// only send a single ACK_FREQUENCY frame
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("uses default values for values that are not set", func() {
+			sess.config.PeerAckSendDelay = 0
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.AckFrequencyFrame{
+				PacketTolerance:   20,
+				UpdateMaxAckDelay: protocol.DefaultMaxAckDelay,
+			}}))
+		})
+
+		It("doesn't request a max ack delay smaller than the peer's min_ack_delay", func() {
+			sess.config.PeerAckSendDelay = time.Millisecond
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			Expect(sess.packer.controlFrames[0].(*wire.AckFrequencyFrame).UpdateMaxAckDelay).To(Equal(5 * time.Millisecond))
+		})
+
+		It("doesn't send an ACK_FREQUENCY frame if not configured to do so", func() {
+			sess.config.PeerAckSendDelay = 0
+			sess.config.PeerRetransmittablePacketsBeforeAck = 0
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+
+		It("doesn't send an ACK_FREQUENCY frame before the handshake completes", func() {
+			sess.handshakeComplete = false
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+			sess.handshakeComplete = true
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("doesn't send an ACK_FREQUENCY frame if the peer doesn't support the extension", func() {
+			sess.peerParams = &handshake.TransportParameters{}
+			sess.maybeQueueAckFrequencyFrame()
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+	})
+
+	Context("FEC", func() {
+		It("errors when receiving an FEC frame if FEC is not enabled", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.FECFrame{PacketNumbers: []protocol.PacketNumber{1}}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received FEC frame, but FEC is not enabled")))
+		})
+
+		It("recovers a lost packet and handles its frames", func() {
+			sess.fecDecoder = newFECDecoder()
+			sess.lastRcvdPacketNumber = 42
+			encoder := newFECEncoder(2)
+			buf := &bytes.Buffer{}
+			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
+			encoder.AddPacket(10, protocol.PacketNumberLen2, []byte{0}) // a PADDING frame
+			encoder.AddPacket(11, protocol.PacketNumberLen2, buf.Bytes())
+			sess.fecDecoder.ReceivedPacket(10, protocol.PacketNumberLen2, []byte{0})
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(11), gomock.Any(), true)
+			sess.receivedPacketHandler = rph
+			err := sess.handleFrames([]wire.Frame{encoder.PopFECFrame()}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.lastRcvdPacketNumber).To(Equal(protocol.PacketNumber(42)))
+		})
+
+		It("sends an FEC packet when an FEC group is complete", func() {
+			sess.packer.hasSentPacket = true
+			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			sess.packer.EnableFEC(1)
+			sess.packer.QueueControlFrame(&wire.PingFrame{})
+			sent, err := sess.sendPacket(sess.initialPath())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Expect(mconn.written).To(HaveLen(2))
+		})
+
+		It("sends an FEC packet for a partial group when there's no more data to send", func() {
+			sess.packer.hasSentPacket = true
+			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			sess.packer.EnableFEC(10)
+			sess.packer.QueueControlFrame(&wire.PingFrame{})
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(HaveLen(1))
+			// the run loop calls sendPackets again when the pacing deadline is reached
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(HaveLen(2))
+		})
+	})
+
+	Context("multipath", func() {
+		var remoteAddr *net.UDPAddr
+
+		BeforeEach(func() {
+			remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1234}
+			sess.handshakeComplete = true
+			sess.config.EnableMultipath = true
+			sess.peerParams = &handshake.TransportParameters{EnableMultipath: true}
+			cryptoSetup.encLevelOpen = protocol.EncryptionForwardSecure
+		})
+
+		getPathPacket := func(pathID protocol.PathID, pn protocol.PacketNumber, frames ...wire.Frame) *receivedPacket {
+			buf := &bytes.Buffer{}
+			for _, f := range frames {
+				Expect(f.Write(buf, sess.version)).To(Succeed())
+			}
+			return &receivedPacket{
+				remoteAddr: remoteAddr,
+				header: &wire.Header{
+					PathID:          pathID,
+					PacketNumber:    pn,
+					PacketNumberLen: protocol.PacketNumberLen2,
+				},
+				data:    buf.Bytes(),
+				rcvTime: time.Now(),
+			}
+		}
+
+		It("opens a new path when receiving a packet for an unknown path", func() {
+			Expect(sess.handlePacketImpl(getPathPacket(1, 1, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(HaveKey(protocol.PathID(1)))
+			Expect(sess.paths[1].conn.RemoteAddr()).To(Equal(remoteAddr))
+			Expect(sess.conn.RemoteAddr()).ToNot(Equal(remoteAddr))
+		})
+
+		It("doesn't open a path if the peer didn't enable multipath", func() {
+			sess.peerParams = &handshake.TransportParameters{}
+			Expect(sess.handlePacketImpl(getPathPacket(1, 1, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+		})
+
+		It("doesn't open a path before the handshake completed", func() {
+			sess.handshakeComplete = false
+			Expect(sess.handlePacketImpl(getPathPacket(1, 1, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+		})
+
+		It("doesn't open a path for packets that are not forward-secure", func() {
+			cryptoSetup.encLevelOpen = protocol.EncryptionSecure
+			Expect(sess.handlePacketImpl(getPathPacket(1, 1, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+		})
+
+		It("limits the number of paths", func() {
+			for i := 1; i < 2*protocol.MaxPaths; i++ {
+				Expect(sess.handlePacketImpl(getPathPacket(protocol.PathID(i), 1, &wire.PingFrame{}))).To(Succeed())
+			}
+			Expect(sess.paths).To(HaveLen(protocol.MaxPaths - 1))
+		})
+
+		It("doesn't reopen closed paths", func() {
+			Expect(sess.handlePacketImpl(getPathPacket(1, 1, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(HaveKey(protocol.PathID(1)))
+			Expect(sess.handleFrames([]wire.Frame{&wire.ClosePathFrame{PathID: 1}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+			Expect(sess.handlePacketImpl(getPathPacket(1, 2, &wire.PingFrame{}))).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+		})
+
+		It("passes ACKs to the sent packet handler of the path", func() {
+			pth := sess.newPath(1, &pathConn{connection: mconn, remoteAddr: remoteAddr})
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			pth.sentPacketHandler = sph
+			sess.paths[1] = pth
+			ack := &wire.AckFrame{LargestAcked: 3, LowestAcked: 2}
+			sph.EXPECT().ReceivedAck(gomock.Any(), protocol.PacketNumber(7), protocol.EncryptionForwardSecure, gomock.Any()).Do(func(f *wire.AckFrame, _ protocol.PacketNumber, _ protocol.EncryptionLevel, _ time.Time) {
+				Expect(f.LargestAcked).To(Equal(ack.LargestAcked))
+				Expect(f.LowestAcked).To(Equal(ack.LowestAcked))
+			})
+			sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+			// the sent packet handler of the initial path is a real sent packet handler, it would reject this ACK
+			Expect(sess.handlePacketImpl(getPathPacket(1, 7, ack))).To(Succeed())
+		})
+
+		It("sends packets on additional paths", func() {
+			sess.packer.hasSentPacket = true
+			sess.packer.connectionID = 0x1337
+			cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+			pth := sess.newPath(1, &pathConn{connection: mconn, remoteAddr: remoteAddr})
+			sess.paths[1] = pth
+			pth.packer.QueuePathControlFrame(&wire.PingFrame{})
+			Expect(sess.sendPackets()).To(Succeed())
+			var data []byte
+			Expect(mconn.written).To(Receive(&data))
+			hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(data), sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PathID).To(Equal(protocol.PathID(1)))
+		})
+
+		It("retransmits outstanding packets on the remaining paths when a path is closed", func() {
+			sess.packer.hasSentPacket = true
+			cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+			pth := sess.newPath(1, &pathConn{connection: mconn, remoteAddr: remoteAddr})
+			sess.paths[1] = pth
+			pth.packer.QueuePathControlFrame(&wire.PingFrame{})
+			sent, err := sess.sendPacket(pth)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Expect(mconn.written).To(Receive())
+			Expect(sess.handleFrames([]wire.Frame{&wire.ClosePathFrame{PathID: 1}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.paths).To(BeEmpty())
+			Expect(sess.closedPathRetransmissions).To(HaveLen(1))
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(Receive())
+			Expect(sess.closedPathRetransmissions).To(BeEmpty())
+		})
+
+		It("rejects FEC frames on additional paths", func() {
+			sess.fecDecoder = newFECDecoder()
+			err := sess.handlePacketImpl(getPathPacket(1, 1, &wire.FECFrame{PacketNumbers: []protocol.PacketNumber{1}, Data: []byte("foobar")}))
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received FEC frame on an additional path")))
+		})
+
+		It("errors when receiving a CLOSE_PATH frame for the initial path", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.ClosePathFrame{PathID: 0}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "cannot close the initial path")))
+		})
+
+		It("doesn't allow the server to add or remove paths", func() {
+			Expect(sess.AddLocalAddress(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})).To(MatchError("only the client can add paths"))
+			Expect(sess.RemoveLocalAddress(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})).To(MatchError("only the client can remove paths"))
+		})
+	})
+
 	Context("keep-alives", func() {
 		// should be shorter than the local timeout for these tests
 		// otherwise we'd send a CONNECTION_CLOSE in the tests where we're testing that no PING is sent
@@ -1582,7 +1832,7 @@ var _ = Describe("Session", func() {
 
 		It("opens streams synchronously", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().OpenStreamSync().Return(mstr, nil)
+			streamManager.EXPECT().OpenStreamSync(context.Background()).Return(mstr, nil)
 			str, err := sess.OpenStreamSync()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1598,7 +1848,7 @@ var _ = Describe("Session", func() {
 
 		It("opens unidirectional streams synchronously", func() {
 			mstr := NewMockSendStreamI(mockCtrl)
-			streamManager.EXPECT().OpenUniStreamSync().Return(mstr, nil)
+			streamManager.EXPECT().OpenUniStreamSync(context.Background()).Return(mstr, nil)
 			str, err := sess.OpenUniStreamSync()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1606,7 +1856,7 @@ var _ = Describe("Session", func() {
 
 		It("accepts streams", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptStream().Return(mstr, nil)
+			streamManager.EXPECT().AcceptStream(context.Background()).Return(mstr, nil)
 			str, err := sess.AcceptStream()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1614,11 +1864,28 @@ var _ = Describe("Session", func() {
 
 		It("accepts unidirectional streams", func() {
 			mstr := NewMockReceiveStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptUniStream().Return(mstr, nil)
+			streamManager.EXPECT().AcceptUniStream(context.Background()).Return(mstr, nil)
 			str, err := sess.AcceptUniStream()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
+
+		It("passes the context to the streams map", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			streamManager.EXPECT().OpenStreamSync(ctx).Return(nil, context.Canceled)
+			streamManager.EXPECT().OpenUniStreamSync(ctx).Return(nil, context.Canceled)
+			streamManager.EXPECT().AcceptStream(ctx).Return(nil, context.Canceled)
+			streamManager.EXPECT().AcceptUniStream(ctx).Return(nil, context.Canceled)
+			_, err := sess.OpenStreamSyncContext(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			_, err = sess.OpenUniStreamSyncContext(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			_, err = sess.AcceptStreamContext(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			_, err = sess.AcceptUniStreamContext(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+		})
 	})
 
 	Context("ignoring errors", func() {
@@ -1649,6 +1916,34 @@ var _ = Describe("Session", func() {
 		mconn.remoteAddr = addr
 		Expect(sess.RemoteAddr()).To(Equal(addr))
 	})
+
+	It("exports keying material", func() {
+		cryptoSetup.exportedKeyingMaterial = []byte("foobar")
+		Expect(sess.ExportKeyingMaterial("label", nil, 6)).To(Equal([]byte("foobar")))
+		testErr := errors.New("test error")
+		cryptoSetup.exportErr = testErr
+		_, err := sess.ExportKeyingMaterial("label", nil, 6)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("reports the connection state", func() {
+		cryptoSetup.connectionState = ConnectionState{NegotiatedProtocol: "hq"}
+		state := sess.ConnectionState()
+		Expect(state.NegotiatedProtocol).To(Equal("hq"))
+		Expect(state.Version).To(Equal(sess.version))
+		Expect(state.PeerIdleTimeout).To(BeZero())
+		sess.peerParams = &handshake.TransportParameters{
+			IdleTimeout:                 42 * time.Second,
+			StreamFlowControlWindow:     0x1000,
+			ConnectionFlowControlWindow: 0x2000,
+			MaxPacketSize:               1337,
+		}
+		state = sess.ConnectionState()
+		Expect(state.PeerIdleTimeout).To(Equal(42 * time.Second))
+		Expect(state.PeerStreamFlowControlWindow).To(Equal(uint64(0x1000)))
+		Expect(state.PeerConnectionFlowControlWindow).To(Equal(uint64(0x2000)))
+		Expect(state.PeerMaxPacketSize).To(Equal(uint64(1337)))
+	})
 })
 
 var _ = Describe("Client Session", func() {
@@ -1670,6 +1965,7 @@ var _ = Describe("Client Session", func() {
 			_ protocol.ConnectionID,
 			_ protocol.VersionNumber,
 			_ *tls.Config,
+			_ handshake.ServerStateCache,
 			_ *handshake.TransportParameters,
 			_ chan<- handshake.TransportParameters,
 			handshakeChanP chan<- struct{},
@@ -1740,4 +2036,93 @@ var _ = Describe("Client Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 	})
+
+	Context("multipath", func() {
+		var (
+			remoteConn *net.UDPConn
+			localAddr  = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+		)
+
+		BeforeEach(func() {
+			var err error
+			remoteConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			mconn.remoteAddr = remoteConn.LocalAddr()
+			mconn.localAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4321}
+			sess.handshakeComplete = true
+			sess.config.EnableMultipath = true
+			sess.peerParams = &handshake.TransportParameters{EnableMultipath: true}
+			cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+		})
+
+		AfterEach(func() {
+			Expect(remoteConn.Close()).To(Succeed())
+		})
+
+		runSession := func() chan struct{} {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			return done
+		}
+
+		It("ignores packets for unknown paths", func() {
+			cryptoSetup.encLevelOpen = protocol.EncryptionForwardSecure
+			err := sess.handlePacketImpl(&receivedPacket{
+				header: &wire.Header{PathID: 1, PacketNumber: 1, PacketNumberLen: protocol.PacketNumberLen2},
+				data:   []byte{0x7}, // PING frame
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.paths).To(BeEmpty())
+		})
+
+		It("adds and removes a path", func() {
+			sess.packer.connectionID = 0x1337
+			done := runSession()
+			Expect(sess.AddLocalAddress(localAddr)).To(Succeed())
+			// the client sends a PING on the new path
+			b := make([]byte, protocol.MaxReceivePacketSize)
+			n, addr, err := remoteConn.ReadFromUDP(b)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(b[:n]))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PathID).To(Equal(protocol.PathID(1)))
+			Expect(sess.RemoveLocalAddress(addr)).To(Succeed())
+			// the CLOSE_PATH frame is sent on the initial path
+			Eventually(mconn.written).Should(Receive())
+			Expect(sess.RemoveLocalAddress(addr)).To(MatchError("no path for local address " + addr.String()))
+			// make the go routine return
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't remove the initial path", func() {
+			done := runSession()
+			Expect(sess.RemoveLocalAddress(mconn.localAddr)).To(MatchError("cannot remove the initial path"))
+			// make the go routine return
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't add a path if the server didn't enable multipath", func() {
+			sess.peerParams = &handshake.TransportParameters{}
+			done := runSession()
+			Expect(sess.AddLocalAddress(localAddr)).To(MatchError("multipath is not enabled"))
+			// make the go routine return
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't add a path before the handshake completed", func() {
+			sess.handshakeComplete = false
+			done := runSession()
+			Expect(sess.AddLocalAddress(localAddr)).To(MatchError("cannot add a path before the handshake completed"))
+			// make the go routine return
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+	})
 })
@@ -1,7 +1,9 @@
 package quic
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
@@ -11,6 +13,25 @@ import (
 
 type streamType int
 
+// broadcastOnDone wakes up all goroutines waiting on cond when the context is done.
+// It returns a function that must be called to stop watching the context.
+func broadcastOnDone(ctx context.Context, cond *sync.Cond) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cond.L.Lock()
+			cond.Broadcast()
+			cond.L.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 const (
 	streamTypeOutgoingBidi streamType = iota
 	streamTypeIncomingBidi
@@ -124,24 +145,24 @@ func (m *streamsMap) OpenStream() (Stream, error) {
 	return m.outgoingBidiStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenStreamSync() (Stream, error) {
-	return m.outgoingBidiStreams.OpenStreamSync()
+func (m *streamsMap) OpenStreamSync(ctx context.Context) (Stream, error) {
+	return m.outgoingBidiStreams.OpenStreamSync(ctx)
 }
 
 func (m *streamsMap) OpenUniStream() (SendStream, error) {
 	return m.outgoingUniStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenUniStreamSync() (SendStream, error) {
-	return m.outgoingUniStreams.OpenStreamSync()
+func (m *streamsMap) OpenUniStreamSync(ctx context.Context) (SendStream, error) {
+	return m.outgoingUniStreams.OpenStreamSync(ctx)
 }
 
-func (m *streamsMap) AcceptStream() (Stream, error) {
-	return m.incomingBidiStreams.AcceptStream()
+func (m *streamsMap) AcceptStream(ctx context.Context) (Stream, error) {
+	return m.incomingBidiStreams.AcceptStream(ctx)
 }
 
-func (m *streamsMap) AcceptUniStream() (ReceiveStream, error) {
-	return m.incomingUniStreams.AcceptStream()
+func (m *streamsMap) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	return m.incomingUniStreams.AcceptStream(ctx)
 }
 
 func (m *streamsMap) DeleteStream(id protocol.StreamID) error {
@@ -5,6 +5,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -48,9 +49,10 @@ func newIncomingBidiStreamsMap(
 	return m
 }
 
-func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
+func (m *incomingBidiStreamsMap) AcceptStream(ctx context.Context) (streamI, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.cond)()
 
 	var str streamI
 	for {
@@ -58,6 +60,9 @@ func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStream]
 		if ok {
 			break
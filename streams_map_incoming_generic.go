@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -46,9 +47,10 @@ func newIncomingItemsMap(
 	return m
 }
 
-func (m *incomingItemsMap) AcceptStream() (item, error) {
+func (m *incomingItemsMap) AcceptStream(ctx context.Context) (item, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.cond)()
 
 	var str item
 	for {
@@ -56,6 +58,9 @@ func (m *incomingItemsMap) AcceptStream() (item, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStream]
 		if ok {
 			break
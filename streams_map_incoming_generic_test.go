@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -55,10 +56,10 @@ var _ = Describe("Streams Map (outgoing)", func() {
 	It("accepts streams in the right order", func() {
 		_, err := m.GetOrOpenStream(firstNewStream + 4) // open stream 20 and 24
 		Expect(err).ToNot(HaveOccurred())
-		str, err := m.AcceptStream()
+		str, err := m.AcceptStream(context.Background())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str).To(Equal(firstNewStream))
-		str, err = m.AcceptStream()
+		str, err = m.AcceptStream(context.Background())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str).To(Equal(firstNewStream + 4))
 	})
@@ -78,7 +79,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 		strChan := make(chan item)
 		go func() {
 			defer GinkgoRecover()
-			str, err := m.AcceptStream()
+			str, err := m.AcceptStream(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			strChan <- str
 		}()
@@ -94,7 +95,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
-			_, err := m.AcceptStream()
+			_, err := m.AcceptStream(context.Background())
 			Expect(err).To(MatchError(testErr))
 			close(done)
 		}()
@@ -103,10 +104,31 @@ var _ = Describe("Streams Map (outgoing)", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("unblocks AcceptStream when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := m.AcceptStream(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			close(done)
+		}()
+		Consistently(done).ShouldNot(BeClosed())
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("errors AcceptStream immediately if the context is already done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := m.AcceptStream(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
 	It("errors AcceptStream immediately if it is closed", func() {
 		testErr := errors.New("test error")
 		m.CloseWithError(testErr)
-		_, err := m.AcceptStream()
+		_, err := m.AcceptStream(context.Background())
 		Expect(err).To(MatchError(testErr))
 	})
 
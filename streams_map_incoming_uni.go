@@ -5,6 +5,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -48,9 +49,10 @@ func newIncomingUniStreamsMap(
 	return m
 }
 
-func (m *incomingUniStreamsMap) AcceptStream() (receiveStreamI, error) {
+func (m *incomingUniStreamsMap) AcceptStream(ctx context.Context) (receiveStreamI, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.cond)()
 
 	var str receiveStreamI
 	for {
@@ -58,6 +60,9 @@ func (m *incomingUniStreamsMap) AcceptStream() (receiveStreamI, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStream]
 		if ok {
 			break
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -168,14 +169,18 @@ func (m *streamsMapLegacy) OpenStream() (Stream, error) {
 	return m.openStreamImpl()
 }
 
-func (m *streamsMapLegacy) OpenStreamSync() (Stream, error) {
+func (m *streamsMapLegacy) OpenStreamSync(ctx context.Context) (Stream, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.openStreamOrErrCond)()
 
 	for {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, err := m.openStreamImpl()
 		if err == nil {
 			return str, err
@@ -191,32 +196,41 @@ func (m *streamsMapLegacy) OpenUniStream() (SendStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
-func (m *streamsMapLegacy) OpenUniStreamSync() (SendStream, error) {
+func (m *streamsMapLegacy) OpenUniStreamSync(context.Context) (SendStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
 // AcceptStream returns the next stream opened by the peer
 // it blocks until a new stream is opened
-func (m *streamsMapLegacy) AcceptStream() (Stream, error) {
+// Streams that were already closed before they were accepted are skipped.
+func (m *streamsMapLegacy) AcceptStream(ctx context.Context) (Stream, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.nextStreamOrErrCond)()
 	var str streamI
 	for {
 		var ok bool
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStreamToAccept]
 		if ok {
 			break
 		}
+		if m.nextStreamToAccept <= m.highestStreamOpenedByPeer {
+			m.nextStreamToAccept += 2
+			continue
+		}
 		m.nextStreamOrErrCond.Wait()
 	}
 	m.nextStreamToAccept += 2
 	return str, nil
 }
 
-func (m *streamsMapLegacy) AcceptUniStream() (ReceiveStream, error) {
+func (m *streamsMapLegacy) AcceptUniStream(context.Context) (ReceiveStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
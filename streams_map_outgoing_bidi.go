@@ -5,6 +5,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -51,11 +52,15 @@ func (m *outgoingBidiStreamsMap) OpenStream() (streamI, error) {
 	return m.openStreamImpl()
 }
 
-func (m *outgoingBidiStreamsMap) OpenStreamSync() (streamI, error) {
+func (m *outgoingBidiStreamsMap) OpenStreamSync(ctx context.Context) (streamI, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	defer broadcastOnDone(ctx, &m.cond)()
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, err := m.openStreamImpl()
 		if err == nil {
 			return str, err